@@ -0,0 +1,236 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	FormatName    = "kpo-finance-backup"
+	FormatVersion = 3 // 2: пользователи, владельцы и доступы к счетам; 3: пакеты импорта, внешние ID операций, IBAN счетов
+
+	manifestFile = "manifest.json"
+)
+
+var (
+	ErrNotBackup          = errors.New("not a backup archive")
+	ErrUnsupportedVersion = errors.New("unsupported backup version")
+	ErrChecksumMismatch   = errors.New("backup checksum mismatch")
+)
+
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Entries   []Entry   `json:"entries"`
+}
+
+type Entry struct {
+	Name   string `json:"name"`   // файл внутри архива, напр. accounts.json
+	Table  string `json:"table"`  // таблица БД
+	Rows   int    `json:"rows"`   // число записей
+	SHA256 string `json:"sha256"` // hex от содержимого файла
+}
+
+type userRec struct {
+	ID              string    `json:"id"`
+	Login           string    `json:"login"`
+	PasswordHash    string    `json:"password_hash,omitempty"` // только в архивах до ограничения одним пользователем
+	ActiveAccountID *string   `json:"active_account_id"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type shareRec struct {
+	AccountID string `json:"account_id"`
+	UserID    string `json:"user_id"`
+}
+
+type accountRec struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Balance string  `json:"balance"`
+	OwnerID *string `json:"owner_id"`
+	IBAN    *string `json:"iban,omitempty"`
+}
+
+type categoryRec struct {
+	ID      string  `json:"id"`
+	Type    int     `json:"type"`
+	Name    string  `json:"name"`
+	OwnerID *string `json:"owner_id"`
+}
+
+type importBatchRec struct {
+	ID        string    `json:"id"`
+	AccountID string    `json:"account_id"`
+	UserID    *string   `json:"user_id"`
+	Source    string    `json:"source"`
+	Imported  int       `json:"imported"`
+	Skipped   int       `json:"skipped"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type operationRec struct {
+	ID            string  `json:"id"`
+	Type          int     `json:"type"`
+	AccountID     string  `json:"bank_account_id"`
+	Amount        string  `json:"amount"`
+	Date          string  `json:"date"`
+	Description   *string `json:"description"`
+	CategoryID    string  `json:"category_id"`
+	ImportBatchID *string `json:"import_batch_id,omitempty"`
+	ExternalID    *string `json:"external_id,omitempty"`
+}
+
+type dataset struct {
+	Users      []userRec
+	Accounts   []accountRec
+	Shares     []shareRec
+	Categories []categoryRec
+	Batches    []importBatchRec
+	Operations []operationRec
+}
+
+func (d dataset) tables() []tableData {
+	return []tableData{
+		{Table: "users", Rows: len(d.Users), V: d.Users},
+		{Table: "accounts", Rows: len(d.Accounts), V: d.Accounts},
+		{Table: "account_shares", Rows: len(d.Shares), V: d.Shares},
+		{Table: "categories", Rows: len(d.Categories), V: d.Categories},
+		{Table: "import_batches", Rows: len(d.Batches), V: d.Batches},
+		{Table: "operations", Rows: len(d.Operations), V: d.Operations},
+	}
+}
+
+func (d *dataset) targets() map[string]any {
+	return map[string]any{
+		"users":          &d.Users,
+		"account_shares": &d.Shares,
+		"accounts":       &d.Accounts,
+		"categories":     &d.Categories,
+		"import_batches": &d.Batches,
+		"operations":     &d.Operations,
+	}
+}
+
+type tableData struct {
+	Table string
+	Rows  int
+	V     any
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeArchive(w io.Writer, d dataset, now time.Time) (Manifest, error) {
+	zw := zip.NewWriter(w)
+	m := Manifest{Format: FormatName, Version: FormatVersion, CreatedAt: now.UTC()}
+
+	for _, t := range d.tables() {
+		b, err := json.MarshalIndent(t.V, "", "  ")
+		if err != nil {
+			return Manifest{}, err
+		}
+		name := t.Table + ".json"
+		f, err := zw.Create(name)
+		if err != nil {
+			return Manifest{}, err
+		}
+		if _, err := f.Write(b); err != nil {
+			return Manifest{}, err
+		}
+		m.Entries = append(m.Entries, Entry{Name: name, Table: t.Table, Rows: t.Rows, SHA256: checksum(b)})
+	}
+
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	f, err := zw.Create(manifestFile)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if _, err := f.Write(mb); err != nil {
+		return Manifest{}, err
+	}
+	return m, zw.Close()
+}
+
+func readArchive(data []byte) (Manifest, dataset, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Manifest{}, dataset{}, fmt.Errorf("%w: %v", ErrNotBackup, err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	mf, ok := files[manifestFile]
+	if !ok {
+		return Manifest{}, dataset{}, fmt.Errorf("%w: no %s", ErrNotBackup, manifestFile)
+	}
+	mb, err := readZipFile(mf)
+	if err != nil {
+		return Manifest{}, dataset{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(mb, &m); err != nil {
+		return Manifest{}, dataset{}, fmt.Errorf("%w: %v", ErrNotBackup, err)
+	}
+	if m.Format != FormatName {
+		return Manifest{}, dataset{}, ErrNotBackup
+	}
+	if m.Version < 1 || m.Version > FormatVersion {
+		return Manifest{}, dataset{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, m.Version)
+	}
+
+	var d dataset
+	targets := d.targets()
+	for _, e := range m.Entries {
+		f, ok := files[e.Name]
+		if !ok {
+			return Manifest{}, dataset{}, fmt.Errorf("%w: missing %s", ErrNotBackup, e.Name)
+		}
+		b, err := readZipFile(f)
+		if err != nil {
+			return Manifest{}, dataset{}, err
+		}
+		if checksum(b) != e.SHA256 {
+			return Manifest{}, dataset{}, fmt.Errorf("%w: %s", ErrChecksumMismatch, e.Name)
+		}
+		dst, ok := targets[e.Table]
+		if !ok {
+			return Manifest{}, dataset{}, fmt.Errorf("%w: unknown table %s", ErrNotBackup, e.Table)
+		}
+		if err := json.Unmarshal(b, dst); err != nil {
+			return Manifest{}, dataset{}, fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	for _, t := range d.tables() {
+		for _, e := range m.Entries {
+			if e.Table == t.Table && e.Rows != t.Rows {
+				return Manifest{}, dataset{}, fmt.Errorf("%w: %s rows %d != %d", ErrChecksumMismatch, e.Name, t.Rows, e.Rows)
+			}
+		}
+	}
+	return m, d, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
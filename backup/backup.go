@@ -0,0 +1,168 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"main/repo"
+)
+
+type Service struct {
+	db *pgxpool.Pool
+}
+
+func NewService(db *pgxpool.Pool) *Service { return &Service{db: db} }
+
+// Create пишет данные вошедшего пользователя в один zip-архив: его запись
+// (без хэша пароля), его счета с доступами, пакетами импорта и операциями,
+// его категории и чужие категории, которые встречаются в операциях его счетов. Данные читаются
+// в одном снимке (REPEATABLE READ), так что архив согласован.
+func (s *Service) Create(ctx context.Context, path string) (Manifest, error) {
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	d, err := dump(ctx, tx, string(uid))
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	buf := &bytes.Buffer{}
+	m, err := writeArchive(buf, d, time.Now())
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+func dump(ctx context.Context, tx pgx.Tx, uid string) (dataset, error) {
+	var d dataset
+
+	rows, err := tx.Query(ctx,
+		`SELECT id, login, active_account_id::text, created_at FROM users WHERE id = $1`, uid)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var u userRec
+		if err := rows.Scan(&u.ID, &u.Login, &u.ActiveAccountID, &u.CreatedAt); err != nil {
+			rows.Close()
+			return d, err
+		}
+		d.Users = append(d.Users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	rows, err = tx.Query(ctx, `SELECT id, name, balance, owner_id::text, iban FROM accounts WHERE owner_id = $1 ORDER BY id`, uid)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var a accountRec
+		if err := rows.Scan(&a.ID, &a.Name, &a.Balance, &a.OwnerID, &a.IBAN); err != nil {
+			rows.Close()
+			return d, err
+		}
+		d.Accounts = append(d.Accounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	rows, err = tx.Query(ctx, `SELECT s.account_id, s.user_id FROM account_shares s JOIN accounts a ON a.id = s.account_id
+		  WHERE a.owner_id = $1 ORDER BY s.account_id, s.user_id`, uid)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var sh shareRec
+		if err := rows.Scan(&sh.AccountID, &sh.UserID); err != nil {
+			rows.Close()
+			return d, err
+		}
+		d.Shares = append(d.Shares, sh)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	rows, err = tx.Query(ctx, `SELECT c.id, c.type, c.name, c.owner_id::text FROM categories c
+		  WHERE c.owner_id = $1 OR EXISTS (
+		        SELECT 1 FROM operations o JOIN accounts a ON a.id = o.bank_account_id
+		         WHERE o.category_id = c.id AND a.owner_id = $1)
+		  ORDER BY c.id`, uid)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var c categoryRec
+		if err := rows.Scan(&c.ID, &c.Type, &c.Name, &c.OwnerID); err != nil {
+			rows.Close()
+			return d, err
+		}
+		d.Categories = append(d.Categories, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	rows, err = tx.Query(ctx,
+		`SELECT b.id, b.account_id, b.user_id::text, b.source, b.imported, b.skipped, b.created_at
+		   FROM import_batches b JOIN accounts a ON a.id = b.account_id
+		  WHERE a.owner_id = $1 ORDER BY b.created_at, b.id`, uid)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var b importBatchRec
+		if err := rows.Scan(&b.ID, &b.AccountID, &b.UserID, &b.Source, &b.Imported, &b.Skipped, &b.CreatedAt); err != nil {
+			rows.Close()
+			return d, err
+		}
+		d.Batches = append(d.Batches, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+
+	rows, err = tx.Query(ctx,
+		`SELECT o.id, o.type, o.bank_account_id, o.amount, o."date", o.description, o.category_id, o.import_batch_id::text, o.external_id
+		   FROM operations o JOIN accounts a ON a.id = o.bank_account_id
+		  WHERE a.owner_id = $1 ORDER BY o."date", o.id`, uid)
+	if err != nil {
+		return d, err
+	}
+	for rows.Next() {
+		var o operationRec
+		var dt time.Time
+		if err := rows.Scan(&o.ID, &o.Type, &o.AccountID, &o.Amount, &dt, &o.Description, &o.CategoryID, &o.ImportBatchID, &o.ExternalID); err != nil {
+			rows.Close()
+			return d, err
+		}
+		o.Date = dt.Format("2006-01-02")
+		d.Operations = append(d.Operations, o)
+	}
+	rows.Close()
+	return d, rows.Err()
+}
@@ -0,0 +1,465 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+
+	"main/domain"
+	"main/repo"
+)
+
+type Mode int
+
+const (
+	// ModeReplace удаляет счета, операции и категории вошедшего пользователя и
+	// воссоздаёт их ровно как в архиве.
+	ModeReplace Mode = iota + 1
+	// ModeMerge добавляет недостающие записи, существующие не трогает.
+	ModeMerge
+)
+
+var ErrForeignArchive = errors.New("backup contains other users' data")
+
+type Conflict struct {
+	Table  string
+	ID     string
+	Reason string
+}
+
+type Report struct {
+	Manifest  Manifest
+	Mode      Mode
+	Inserted  map[string]int
+	Skipped   map[string]int
+	Conflicts []Conflict
+}
+
+func (r *Report) conflict(table, id, format string, args ...any) {
+	r.Conflicts = append(r.Conflicts, Conflict{Table: table, ID: id, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Restore проверяет манифест и контрольные суммы архива и загружает его
+// в БД одной транзакцией: при любой ошибке БД остаётся как была. Архив
+// восстанавливается в данные вошедшего пользователя; архив с несколькими
+// пользователями отклоняется.
+func (s *Service) Restore(ctx context.Context, path string, mode Mode) (Report, error) {
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+	m, d, err := readArchive(data)
+	if err != nil {
+		return Report{}, err
+	}
+	if d, err = ownedBy(d, string(uid)); err != nil {
+		return Report{}, err
+	}
+
+	rep := Report{
+		Manifest: m,
+		Mode:     mode,
+		Inserted: map[string]int{},
+		Skipped:  map[string]int{},
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	switch mode {
+	case ModeReplace:
+		if err = clearOwned(ctx, tx, string(uid)); err == nil {
+			err = merge(ctx, tx, string(uid), d, &rep)
+		}
+		if err == nil {
+			err = setActiveAccount(ctx, tx, string(uid), d.Users)
+		}
+	case ModeMerge:
+		err = merge(ctx, tx, string(uid), d, &rep)
+	default:
+		err = fmt.Errorf("unknown restore mode %d", mode)
+	}
+	if err != nil {
+		return Report{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Report{}, err
+	}
+	return rep, nil
+}
+
+// ownedBy переписывает архив на пользователя uid. В архиве может быть только
+// один пользователь (архивы версии 1 — без пользователей); его счета и
+// категории становятся счетами и категориями uid. Счёт другого владельца —
+// архив не этого пользователя. Чужие категории (из операций его счетов)
+// остаются чужими: они используются, только если уже есть в БД.
+func ownedBy(d dataset, uid string) (dataset, error) {
+	if len(d.Users) > 1 {
+		return d, fmt.Errorf("%w: %d users", ErrForeignArchive, len(d.Users))
+	}
+	src := uid
+	if len(d.Users) == 1 {
+		src = d.Users[0].ID
+		d.Users[0].ID = uid
+	}
+	own := func(p *string) bool { return p == nil || *p == src || *p == uid }
+	for i, a := range d.Accounts {
+		if !own(a.OwnerID) {
+			return d, fmt.Errorf("%w: account %s", ErrForeignArchive, a.ID)
+		}
+		d.Accounts[i].OwnerID = &uid
+	}
+	for i, c := range d.Categories {
+		if own(c.OwnerID) {
+			d.Categories[i].OwnerID = &uid
+		}
+	}
+	for i, b := range d.Batches {
+		if b.UserID != nil && *b.UserID == src {
+			d.Batches[i].UserID = &uid
+		}
+	}
+	shares := d.Shares[:0]
+	for _, sh := range d.Shares {
+		if sh.UserID != src && sh.UserID != uid {
+			shares = append(shares, sh)
+		}
+	}
+	d.Shares = shares
+	return d, nil
+}
+
+// clearOwned удаляет счета пользователя (с операциями и доступами) и его категории.
+// Категории, которые остались в операциях чужих счетов, не удаляются — при
+// восстановлении одноимённые категории архива сливаются с ними.
+func clearOwned(ctx context.Context, tx pgx.Tx, uid string) error {
+	for _, q := range []string{
+		`DELETE FROM account_shares s USING accounts a WHERE a.id = s.account_id AND a.owner_id = $1`,
+		`DELETE FROM operations o USING accounts a WHERE a.id = o.bank_account_id AND a.owner_id = $1`,
+		`DELETE FROM accounts WHERE owner_id = $1`,
+		`DELETE FROM categories c WHERE c.owner_id = $1
+		    AND NOT EXISTS (SELECT 1 FROM operations o WHERE o.category_id = c.id)`,
+	} {
+		if _, err := tx.Exec(ctx, q, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge добавляет записи архива к данным пользователя uid. Записи ищутся
+// только среди его счетов и видимых ему категорий: ID, занятый чужой
+// записью, даёт ошибку вставки и откат всего восстановления.
+func merge(ctx context.Context, tx pgx.Tx, uid string, d dataset, rep *Report) error {
+	rep.Skipped["users"] = len(d.Users)
+
+	// счета
+	localAcc := map[string]accountRec{}
+	rows, err := tx.Query(ctx, `SELECT id, name, balance, owner_id::text, iban FROM accounts WHERE owner_id = $1 FOR UPDATE`, uid)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var a accountRec
+		if err := rows.Scan(&a.ID, &a.Name, &a.Balance, &a.OwnerID, &a.IBAN); err != nil {
+			rows.Close()
+			return err
+		}
+		localAcc[a.ID] = a
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, a := range d.Accounts {
+		if l, ok := localAcc[a.ID]; ok {
+			if l.Name != a.Name || !decEqual(l.Balance, a.Balance) {
+				rep.conflict("accounts", a.ID, "счёт уже есть с другими данными (%s / %s), оставлен локальный", l.Name, l.Balance)
+			}
+			rep.Skipped["accounts"]++
+			continue
+		}
+		iban, err := insertAccount(ctx, tx, a)
+		if err != nil {
+			return fmt.Errorf("account %s: %w", a.ID, err)
+		}
+		if a.IBAN != nil && iban == nil {
+			rep.conflict("accounts", a.ID, "IBAN %s уже привязан к другому счёту, счёт добавлен без него", *a.IBAN)
+		}
+		rep.Inserted["accounts"]++
+	}
+
+	for _, sh := range d.Shares {
+		ok, err := insertShare(ctx, tx, uid, sh)
+		if err != nil {
+			return fmt.Errorf("share %s/%s: %w", sh.AccountID, sh.UserID, err)
+		}
+		if ok {
+			rep.Inserted["account_shares"]++
+		} else {
+			rep.Skipped["account_shares"]++
+		}
+	}
+
+	// категории: совпадение по id (свои и чужие из операций доступных счетов)
+	// или по (type, имя без учёта регистра) среди своих
+	localCat := map[string]categoryRec{}
+	byName := map[string]string{}
+	rows, err = tx.Query(ctx,
+		`SELECT c.id, c.type, c.name, c.owner_id::text FROM categories c
+		  WHERE c.owner_id = $1 OR EXISTS (
+		        SELECT 1 FROM operations o JOIN accounts a ON a.id = o.bank_account_id
+		         WHERE o.category_id = c.id AND `+repo.AccountAccess("a", 1)+`)`, uid)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var c categoryRec
+		if err := rows.Scan(&c.ID, &c.Type, &c.Name, &c.OwnerID); err != nil {
+			rows.Close()
+			return err
+		}
+		localCat[c.ID] = c
+		if c.OwnerID != nil && *c.OwnerID == uid {
+			byName[categoryKey(c)] = c.ID
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	catMap := map[string]string{}
+	for _, c := range d.Categories {
+		if l, ok := localCat[c.ID]; ok {
+			if l.Type != c.Type || l.Name != c.Name {
+				rep.conflict("categories", c.ID, "категория уже есть как %q (тип %d), оставлена локальная", l.Name, l.Type)
+			}
+			catMap[c.ID] = c.ID
+			rep.Skipped["categories"]++
+			continue
+		}
+		if c.OwnerID == nil || *c.OwnerID != uid {
+			// чужой категории больше нет — она становится своей
+			c.OwnerID = &uid
+		}
+		if id, ok := byName[categoryKey(c)]; ok {
+			rep.conflict("categories", c.ID, "слита с существующей категорией %q (%s)", c.Name, id)
+			catMap[c.ID] = id
+			rep.Skipped["categories"]++
+			continue
+		}
+		if err := insertCategory(ctx, tx, c); err != nil {
+			return fmt.Errorf("category %s: %w", c.ID, err)
+		}
+		catMap[c.ID] = c.ID
+		byName[categoryKey(c)] = c.ID
+		rep.Inserted["categories"]++
+	}
+
+	// пакеты импорта — только в счета пользователя; существующие по id пропускаются
+	for _, b := range d.Batches {
+		ok, err := insertBatch(ctx, tx, uid, b)
+		if err != nil {
+			return fmt.Errorf("import batch %s: %w", b.ID, err)
+		}
+		if ok {
+			rep.Inserted["import_batches"]++
+		} else {
+			rep.Skipped["import_batches"]++
+		}
+	}
+
+	// операции
+	ids := make([]string, 0, len(d.Operations))
+	for _, o := range d.Operations {
+		ids = append(ids, o.ID)
+	}
+	localOps := map[string]operationRec{}
+	if len(ids) > 0 {
+		rows, err = tx.Query(ctx,
+			`SELECT o.id, o.type, o.bank_account_id, o.amount, o."date"::text, o.description, o.category_id
+			   FROM operations o JOIN accounts a ON a.id = o.bank_account_id
+			  WHERE o.id = ANY($1::uuid[]) AND a.owner_id = $2`, ids, uid)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var o operationRec
+			if err := rows.Scan(&o.ID, &o.Type, &o.AccountID, &o.Amount, &o.Date, &o.Description, &o.CategoryID); err != nil {
+				rows.Close()
+				return err
+			}
+			localOps[o.ID] = o
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	// баланс существующих счетов корректируется на вставленные операции
+	delta := map[string]decimal.Decimal{}
+	for _, o := range d.Operations {
+		if l, ok := localOps[o.ID]; ok {
+			if !sameOperation(l, o) {
+				rep.conflict("operations", o.ID, "операция уже есть с другими данными, оставлена локальная")
+			}
+			rep.Skipped["operations"]++
+			continue
+		}
+		o.CategoryID = catMap[o.CategoryID]
+		extID, err := insertOperation(ctx, tx, o)
+		if err != nil {
+			return fmt.Errorf("operation %s: %w", o.ID, err)
+		}
+		if o.ExternalID != nil && extID == nil {
+			rep.conflict("operations", o.ID, "внешний ID %q уже занят другой операцией счёта, операция добавлена без него", *o.ExternalID)
+		}
+		rep.Inserted["operations"]++
+
+		if _, existed := localAcc[o.AccountID]; existed {
+			amt, err := decimal.NewFromString(o.Amount)
+			if err != nil {
+				return err
+			}
+			if domain.OperationType(o.Type) == domain.OpExpense {
+				amt = amt.Neg()
+			}
+			delta[o.AccountID] = delta[o.AccountID].Add(amt)
+		}
+	}
+
+	for id, dlt := range delta {
+		cur, err := decimal.NewFromString(localAcc[id].Balance)
+		if err != nil {
+			return err
+		}
+		acc := domain.BankAccount{ID: domain.AccountID(id), Balance: cur}
+		if dlt.IsPositive() {
+			err = acc.Credit(dlt)
+		} else if dlt.IsNegative() {
+			err = acc.Debit(dlt.Abs())
+		}
+		if err != nil {
+			return fmt.Errorf("account %s: %w", id, err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE accounts SET balance=$2 WHERE id=$1 AND owner_id=$3`, id, acc.Balance.StringFixed(2), uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setActiveAccount возвращает пользователю активный счёт из архива, если он ему доступен.
+func setActiveAccount(ctx context.Context, tx pgx.Tx, uid string, users []userRec) error {
+	if len(users) == 0 || users[0].ActiveAccountID == nil {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`UPDATE users SET active_account_id=$2
+		  WHERE id=$1 AND EXISTS (SELECT 1 FROM accounts a WHERE a.id=$2 AND `+repo.AccountAccess("a", 1)+`)`,
+		uid, *users[0].ActiveAccountID)
+	return err
+}
+
+// insertShare открывает счёт пользователя uid другому пользователю, если тот есть в БД.
+func insertShare(ctx context.Context, tx pgx.Tx, uid string, sh shareRec) (bool, error) {
+	ct, err := tx.Exec(ctx,
+		`INSERT INTO account_shares(account_id, user_id)
+		 SELECT $1, $2 WHERE EXISTS (SELECT 1 FROM users WHERE id = $2)
+		                 AND EXISTS (SELECT 1 FROM accounts WHERE id = $1 AND owner_id = $3)
+		 ON CONFLICT DO NOTHING`,
+		sh.AccountID, sh.UserID, uid)
+	return ct.RowsAffected() > 0, err
+}
+
+// insertBatch добавляет пакет импорта в счёт пользователя uid. Импортировавший
+// пользователь сохраняется, только если он есть в БД.
+func insertBatch(ctx context.Context, tx pgx.Tx, uid string, b importBatchRec) (bool, error) {
+	ct, err := tx.Exec(ctx,
+		`INSERT INTO import_batches(id, account_id, user_id, source, imported, skipped, created_at)
+		 SELECT $1, $2, (SELECT id FROM users WHERE id = $3), $4, $5, $6, $7
+		  WHERE EXISTS (SELECT 1 FROM accounts WHERE id = $2 AND owner_id = $8)
+		 ON CONFLICT (id) DO NOTHING`,
+		b.ID, b.AccountID, b.UserID, b.Source, b.Imported, b.Skipped, b.CreatedAt, uid)
+	return ct.RowsAffected() > 0, err
+}
+
+// insertAccount возвращает сохранённый IBAN: если он уже привязан к другому
+// счёту владельца, счёт вставляется без него.
+func insertAccount(ctx context.Context, tx pgx.Tx, a accountRec) (*string, error) {
+	var iban *string
+	err := tx.QueryRow(ctx,
+		`INSERT INTO accounts(id,name,balance,owner_id,iban)
+		 VALUES($1,$2,$3,$4,
+		        CASE WHEN EXISTS (SELECT 1 FROM accounts WHERE owner_id = $4 AND iban = $5::text)
+		             THEN NULL ELSE $5::text END)
+		 RETURNING iban`,
+		a.ID, a.Name, a.Balance, a.OwnerID, a.IBAN).Scan(&iban)
+	return iban, err
+}
+
+func insertCategory(ctx context.Context, tx pgx.Tx, c categoryRec) error {
+	_, err := tx.Exec(ctx, `INSERT INTO categories(id,type,name,owner_id) VALUES($1,$2,$3,$4)`,
+		c.ID, c.Type, c.Name, c.OwnerID)
+	return err
+}
+
+// insertOperation возвращает сохранённый внешний ID: если он уже занят другой
+// операцией того же счёта, операция вставляется без него.
+func insertOperation(ctx context.Context, tx pgx.Tx, o operationRec) (*string, error) {
+	var extID *string
+	err := tx.QueryRow(ctx,
+		`INSERT INTO operations(id,type,bank_account_id,amount,"date",description,category_id,import_batch_id,external_id)
+		 VALUES($1,$2,$3,$4,$5::date,$6,$7,
+		        (SELECT id FROM import_batches WHERE id = $8::uuid AND account_id = $3),
+		        CASE WHEN EXISTS (SELECT 1 FROM operations WHERE bank_account_id = $3 AND external_id = $9::text)
+		             THEN NULL ELSE $9::text END)
+		 RETURNING external_id`,
+		o.ID, o.Type, o.AccountID, o.Amount, o.Date, o.Description, o.CategoryID, o.ImportBatchID, o.ExternalID,
+	).Scan(&extID)
+	return extID, err
+}
+
+func categoryKey(c categoryRec) string {
+	owner := ""
+	if c.OwnerID != nil {
+		owner = *c.OwnerID
+	}
+	return fmt.Sprintf("%s|%d|%s", owner, c.Type, strings.ToLower(strings.TrimSpace(c.Name)))
+}
+
+func decEqual(a, b string) bool {
+	x, err1 := decimal.NewFromString(a)
+	y, err2 := decimal.NewFromString(b)
+	if err1 != nil || err2 != nil {
+		return a == b
+	}
+	return x.Equal(y)
+}
+
+func sameOperation(a, b operationRec) bool {
+	da, db := "", ""
+	if a.Description != nil {
+		da = *a.Description
+	}
+	if b.Description != nil {
+		db = *b.Description
+	}
+	return a.Type == b.Type && a.AccountID == b.AccountID && decEqual(a.Amount, b.Amount) &&
+		a.Date == b.Date && da == db && a.CategoryID == b.CategoryID
+}
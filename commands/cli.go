@@ -0,0 +1,336 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"main/backup"
+	"main/files"
+	"main/menu"
+	"main/service"
+)
+
+// Run выполняет одну команду без интерактивного меню, например:
+//
+//	go run . backup backup.zip
+//	go run . restore -mode=merge backup.zip
+//	go run . doctor -fix -dry-run
+//	go run . reencrypt -dry-run
+//	go run . rotate-key -retire
+//	go run . export -period=last-month -accounts=all -type=expense ops.csv
+//	go run . export -from=2024-01-01 -to=2024-03-31 -category=Еда,Кафе -columns=date,amount,account ops.json
+//	go run . export -period=ytd -accounts=all -currency=RUB finance.beancount
+//	go run . dataset-export all.json
+//	go run . dataset-import -dry-run all.json
+//	go run . dataset-schema dataset.schema.json
+//	go run . inbox
+//	go run . inbox -watch -interval=30s
+func Run(ctx context.Context, deps *menu.Deps, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("команда не указана")
+	}
+	cmd, err := parse(args[0], args[1:])
+	if err != nil {
+		return err
+	}
+	return NewTimed(cmd).Execute(ctx, deps)
+}
+
+func parse(name string, args []string) (Command, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	switch name {
+	case "backup":
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		path := fs.Arg(0)
+		if path == "" {
+			path = "backup-" + time.Now().Format("20060102-150405") + ".zip"
+		}
+		return NewFuncCommand(name, func(ctx context.Context, d *menu.Deps) error {
+			m, err := d.Backup.Create(ctx, path)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Резервная копия создана:", path)
+			for _, e := range m.Entries {
+				fmt.Printf("- %-12s %6d записей\n", e.Table, e.Rows)
+			}
+			return nil
+		}), nil
+
+	case "restore":
+		modeName := fs.String("mode", "replace", "replace | merge")
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		path := fs.Arg(0)
+		if path == "" {
+			return nil, fmt.Errorf("restore: укажите путь к архиву")
+		}
+		var mode backup.Mode
+		switch *modeName {
+		case "replace":
+			mode = backup.ModeReplace
+		case "merge":
+			mode = backup.ModeMerge
+		default:
+			return nil, fmt.Errorf("restore: неизвестный режим %q", *modeName)
+		}
+		return NewFuncCommand(name, func(ctx context.Context, d *menu.Deps) error {
+			rep, err := d.Backup.Restore(ctx, path, mode)
+			if err != nil {
+				return err
+			}
+			menu.PrintRestoreReport(rep)
+			return nil
+		}), nil
+
+	case "doctor":
+		fix := fs.Bool("fix", false, "исправить найденные проблемы")
+		dryRun := fs.Bool("dry-run", false, "с -fix: показать исправления, не сохраняя их")
+		dropOrphans := fs.Bool("drop-unused", false, "с -fix: удалить категории без операций")
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		return NewFuncCommand(name, func(ctx context.Context, d *menu.Deps) error {
+			if !*fix {
+				rep, err := d.Doctor.Check(ctx)
+				if err != nil {
+					return err
+				}
+				menu.PrintDoctorReport(rep)
+				if rep.Problems() > 0 {
+					return fmt.Errorf("найдено проблем: %d", rep.Problems())
+				}
+				return nil
+			}
+			rep, res, err := d.Doctor.Repair(ctx, service.RepairOptions{DryRun: *dryRun, DropOrphans: *dropOrphans})
+			if err != nil {
+				return err
+			}
+			menu.PrintDoctorReport(rep)
+			menu.PrintRepairResult(res)
+			return nil
+		}), nil
+
+	case "reencrypt":
+		dryRun := fs.Bool("dry-run", false, "показать, что изменится, не сохраняя")
+		decrypt := fs.Bool("decrypt", false, "снять шифрование (записать открытый текст)")
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		return NewFuncCommand(name, func(ctx context.Context, d *menu.Deps) error {
+			res, err := d.Crypt.Reencrypt(ctx, service.ReencryptOptions{DryRun: *dryRun, Decrypt: *decrypt})
+			if err != nil {
+				return err
+			}
+			menu.PrintReencryptResult(res)
+			return nil
+		}), nil
+
+	case "rotate-key":
+		retire := fs.Bool("retire", false, "после перешифровки удалить старые ключи из файла")
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		return NewFuncCommand(name, func(ctx context.Context, d *menu.Deps) error {
+			res, err := d.Crypt.Rotate(ctx, *retire)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Создан новый ключ:", res.KeyID)
+			menu.PrintReencryptResult(res)
+			return nil
+		}), nil
+
+	case "export":
+		format := fs.String("format", "", "имя формата: csv, json, yaml, qif, xlsx, ledger, beancount… (пусто = по расширению файла)")
+		period := fs.String("period", "30d", "month | last-month | 30d | 3m | ytd | last-year")
+		fromStr := fs.String("from", "", "начало периода YYYY-MM-DD (вместо -period)")
+		toStr := fs.String("to", "", "конец периода YYYY-MM-DD (пусто = сегодня)")
+		accounts := fs.String("accounts", "", "all или имена счетов через запятую (пусто = активный)")
+		category := fs.String("category", "", "только эти категории, через запятую")
+		opType := fs.String("type", "all", "all | income | expense")
+		colsStr := fs.String("columns", "", "колонки через запятую: "+strings.Join(files.AllColumns, ","))
+		dateOrder := fs.String("date-order", files.QIFMonthFirst, "QIF: порядок дня и месяца (mdy | dmy)")
+		transfers := fs.Bool("transfers", false, "ledger: категории переводов как счета Assets")
+		currency := fs.String("currency", "", "Beancount: валюта (пусто = RUB)")
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		path := fs.Arg(0)
+		if path == "" {
+			return nil, fmt.Errorf("export: укажите путь к файлу")
+		}
+		f, err := files.ExportFormat(path)
+		if *format != "" {
+			var ok bool
+			if f, ok = files.FormatByName(*format); !ok || !f.CanExport() {
+				return nil, fmt.Errorf("export: неизвестный формат выгрузки %q", *format)
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("export: %w", err)
+		}
+		cols, err := files.ParseColumns(*colsStr)
+		if err != nil {
+			return nil, fmt.Errorf("export: %w", err)
+		}
+		var q files.ExportQuery
+		for _, c := range strings.Split(*category, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				q.Categories = append(q.Categories, c)
+			}
+		}
+		switch *opType {
+		case "all":
+		case "income":
+			q.Type = 1
+		case "expense":
+			q.Type = -1
+		default:
+			return nil, fmt.Errorf("export: неизвестный тип %q", *opType)
+		}
+		if *fromStr == "" && *toStr != "" {
+			return nil, fmt.Errorf("export: -to без -from")
+		}
+		if *fromStr != "" {
+			if q.From, err = time.ParseInLocation("2006-01-02", *fromStr, time.Local); err != nil {
+				return nil, fmt.Errorf("export: -from: %w", err)
+			}
+			q.To = time.Now()
+			if *toStr != "" {
+				if q.To, err = time.ParseInLocation("2006-01-02", *toStr, time.Local); err != nil {
+					return nil, fmt.Errorf("export: -to: %w", err)
+				}
+			}
+			if q.To.Before(q.From) {
+				return nil, fmt.Errorf("export: конец периода раньше начала")
+			}
+		} else if q.From, q.To, err = menu.PeriodPreset(*period, time.Now()); err != nil {
+			return nil, fmt.Errorf("export: %w", err)
+		}
+		return NewFuncCommand(name, func(ctx context.Context, d *menu.Deps) error {
+			ids, err := menu.ResolveAccounts(ctx, d, *accounts)
+			if err != nil {
+				return err
+			}
+			q.Accounts = ids
+			opts := files.ExportOptions{
+				Columns:   cols,
+				DateOrder: *dateOrder,
+				Transfers: *transfers,
+				Currency:  strings.ToUpper(*currency),
+				Names:     d.BeancountNames,
+			}
+			if *colsStr == "" && len(ids) != 1 {
+				opts.Columns = append(slices.Clip(cols), files.ColAccount)
+			}
+			if opts.Categories, err = menu.ExportCategories(ctx, d, f, q); err != nil {
+				return err
+			}
+			if err := files.Export(ctx, d.AccRepo, d.OpsRepo, d.CatRepo, f, q, opts, path); err != nil {
+				return err
+			}
+			fmt.Println("Экспортировано в", path)
+			return nil
+		}), nil
+
+	case "dataset-export":
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		path := fs.Arg(0)
+		if path == "" {
+			path = "dataset-" + time.Now().Format("20060102") + ".json"
+		}
+		return NewFuncCommand(name, func(ctx context.Context, d *menu.Deps) error {
+			if err := files.ExportDataset(ctx, d.AccRepo, d.OpsRepo, d.CatRepo, path); err != nil {
+				return err
+			}
+			fmt.Println("Данные выгружены в", path)
+			return nil
+		}), nil
+
+	case "dataset-import":
+		dryRun := fs.Bool("dry-run", false, "показать, что изменится, не сохраняя")
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		path := fs.Arg(0)
+		if path == "" {
+			return nil, fmt.Errorf("dataset-import: укажите путь к файлу")
+		}
+		return NewFuncCommand(name, func(ctx context.Context, d *menu.Deps) error {
+			ds, err := files.ReadDataset(path)
+			if err != nil {
+				return err
+			}
+			apply := d.Dataset.Import
+			if *dryRun {
+				apply = d.Dataset.Preview
+			}
+			rep, err := apply(ctx, ds)
+			if err != nil {
+				return err
+			}
+			menu.PrintDatasetReport(rep)
+			return nil
+		}), nil
+
+	case "dataset-schema":
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		path := fs.Arg(0)
+		return NewFuncCommand(name, func(context.Context, *menu.Deps) error {
+			if path == "" {
+				_, err := os.Stdout.Write(files.DatasetSchema)
+				return err
+			}
+			return os.WriteFile(path, files.DatasetSchema, 0o644)
+		}), nil
+
+	case "inbox":
+		watch := fs.Bool("watch", false, "следить за папкой, пока процесс не остановят")
+		interval := fs.Duration("interval", 0, "с -watch: период опроса (0 = из настроек)")
+		dir := fs.String("dir", "", "папка входящих (пусто = из настроек)")
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		return NewFuncCommand(name, func(ctx context.Context, d *menu.Deps) error {
+			in := d.Inbox
+			if *dir != "" {
+				in.Config.Dir = *dir
+			}
+			if *interval > 0 {
+				in.Config.Interval = *interval
+			}
+			if *watch {
+				ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				return in.Watch(ctx)
+			}
+			res, err := in.Process(ctx)
+			if err != nil {
+				return err
+			}
+			menu.PrintInboxSummary(res)
+			for _, r := range res {
+				if !r.OK() {
+					return fmt.Errorf("не все файлы импортированы")
+				}
+			}
+			return nil
+		}), nil
+	}
+	return nil, fmt.Errorf("неизвестная команда: %s", name)
+}
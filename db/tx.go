@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier — общее между *pgxpool.Pool и pgx.Tx, чтобы репозитории
+// одинаково работали и вне транзакции, и внутри единицы работы.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type txKey struct{}
+
+type txState struct {
+	tx       pgx.Tx
+	onCommit []func()
+}
+
+func WithTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, &txState{tx: tx})
+}
+
+func TxFrom(ctx context.Context) (pgx.Tx, bool) {
+	st, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return nil, false
+	}
+	return st.tx, true
+}
+
+// Conn возвращает транзакцию из контекста, если она есть, иначе pool.
+func Conn(ctx context.Context, pool Querier) Querier {
+	if tx, ok := TxFrom(ctx); ok {
+		return tx
+	}
+	return pool
+}
+
+// OnCommit откладывает fn до успешного коммита транзакции из контекста;
+// вне транзакции fn выполняется сразу.
+func OnCommit(ctx context.Context, fn func()) {
+	st, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		fn()
+		return
+	}
+	st.onCommit = append(st.onCommit, fn)
+}
+
+func RunCommitHooks(ctx context.Context) {
+	st, ok := ctx.Value(txKey{}).(*txState)
+	if !ok {
+		return
+	}
+	for _, fn := range st.onCommit {
+		fn()
+	}
+	st.onCommit = nil
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/dig"
 
+	"main/backup"
 	"main/db"
 	"main/domain"
 	"main/facade"
+	"main/files"
+	"main/inbox"
 	"main/menu"
 	"main/repo"
+	"main/secret"
 	"main/service"
 )
 
@@ -35,6 +41,13 @@ func Build(ctx context.Context) (*App, error) {
 		return nil, err
 	}
 
+	if err := c.Provide(secret.Load); err != nil {
+		return nil, err
+	}
+
+	if err := c.Provide(repo.NewPgUserRepo); err != nil {
+		return nil, err
+	}
 	if err := c.Provide(repo.NewPgAccountRepo); err != nil {
 		return nil, err
 	}
@@ -44,13 +57,36 @@ func Build(ctx context.Context) (*App, error) {
 	if err := c.Provide(repo.NewPgOperationRepo); err != nil {
 		return nil, err
 	}
+	if err := c.Provide(repo.NewPgImportRepo); err != nil {
+		return nil, err
+	}
+	if err := c.Provide(func(cats *repo.PgCategoryRepo) *repo.CachedCategoryRepo {
+		return repo.NewCachedCategoryRepo(cats, categoryCacheTTL())
+	}); err != nil {
+		return nil, err
+	}
 
 	if err := c.Provide(service.NewOperationService); err != nil {
 		return nil, err
 	}
+	if err := c.Provide(service.NewUnitOfWork); err != nil {
+		return nil, err
+	}
 	if err := c.Provide(service.NewAnalyticsService); err != nil {
 		return nil, err
 	}
+	if err := c.Provide(service.NewDoctorService); err != nil {
+		return nil, err
+	}
+	if err := c.Provide(admins); err != nil {
+		return nil, err
+	}
+	if err := c.Provide(service.NewEncryptionService); err != nil {
+		return nil, err
+	}
+	if err := c.Provide(backup.NewService); err != nil {
+		return nil, err
+	}
 
 	if err := c.Provide(func() string {
 		if p := os.Getenv("MENU_PATH"); p != "" {
@@ -64,6 +100,26 @@ func Build(ctx context.Context) (*App, error) {
 	if err := c.Provide(menu.Load); err != nil {
 		return nil, err
 	}
+	if err := c.Provide(func() (files.CSVProfiles, error) {
+		return files.LoadCSVProfiles(csvProfilesPath())
+	}); err != nil {
+		return nil, err
+	}
+	if err := c.Provide(func() (files.BeancountNames, error) {
+		return files.LoadBeancountNames(beancountNamesPath())
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := c.Provide(func() (inbox.Config, error) {
+		cfg, err := inbox.LoadConfig(inboxConfigPath())
+		if d := os.Getenv("INBOX_DIR"); d != "" {
+			cfg.Dir = d
+		}
+		return cfg, err
+	}); err != nil {
+		return nil, err
+	}
 
 	var app *App
 	err := c.Invoke(func(
@@ -71,24 +127,46 @@ func Build(ctx context.Context) (*App, error) {
 		pool *pgxpool.Pool,
 		f domain.Factory,
 		m menu.Menu,
+		users *repo.PgUserRepo,
 		accounts *repo.PgAccountRepo,
-		cats *repo.PgCategoryRepo,
+		catsCached *repo.CachedCategoryRepo,
 		ops *repo.PgOperationRepo,
+		imports *repo.PgImportRepo,
 		opSvc *service.OperationService,
 		anaSvc *service.AnalyticsService,
+		uow *service.UnitOfWork,
+		bak *backup.Service,
+		doctor *service.DoctorService,
+		crypt *service.EncryptionService,
+		profiles files.CSVProfiles,
+		beanNames files.BeancountNames,
+		inboxCfg inbox.Config,
 	) error {
-		id, name, err := ensureActiveAccount(ctx, accounts, f)
+		auth := facade.AuthFacade{
+			F:     f,
+			Users: users,
+			UoW:   uow,
+		}
+		user, err := login(ctx, auth)
+		if err != nil {
+			return err
+		}
+		ctx = repo.WithUser(ctx, user.ID)
+
+		id, name, err := ensureActiveAccount(ctx, accounts, auth, user, f)
 		if err != nil {
 			return err
 		}
 		fmt.Printf("Активный счёт: %s (%s)\n\n", name, id)
 
-		catsCached := repo.NewCachedCategoryRepo(cats)
+		go catsCached.Listen(ctx, pool)
 
 		accFacade := facade.AccountFacade{
 			F:          f,
 			Accounts:   accounts,
 			Operations: ops,
+			Users:      users,
+			UoW:        uow,
 		}
 		catFacade := facade.CategoryFacade{
 			F:          f,
@@ -100,6 +178,29 @@ func Build(ctx context.Context) (*App, error) {
 			Categories: catsCached,
 			Operations: ops,
 			OpSvc:      opSvc,
+			UoW:        uow,
+		}
+		importFacade := facade.ImportFacade{
+			F:          f,
+			Accounts:   accounts,
+			Categories: catsCached,
+			Operations: ops,
+			Imports:    imports,
+			Op:         opFacade,
+			UoW:        uow,
+		}
+		datasetFacade := facade.DatasetFacade{
+			Accounts:   accounts,
+			Categories: catsCached,
+			Operations: ops,
+			UoW:        uow,
+		}
+		in := inbox.Inbox{
+			Config:   inboxCfg,
+			Import:   importFacade,
+			Acc:      accFacade,
+			Accounts: accounts,
+			Profiles: profiles,
 		}
 		analytics := facade.AnalyticsFacade{
 			Svc: anaSvc,
@@ -109,14 +210,26 @@ func Build(ctx context.Context) (*App, error) {
 			Pool:      pool,
 			Factory:   f,
 			AccRepo:   accounts,
-			CatRepo:   cats,
+			CatRepo:   catsCached,
 			OpsRepo:   ops,
 			AccountID: id,
+			User:      user,
+
+			Auth:    auth,
+			Acc:     accFacade,
+			Cat:     catFacade,
+			Op:      opFacade,
+			Ana:     analytics,
+			Import:  importFacade,
+			Dataset: datasetFacade,
+			Inbox:   in,
 
-			Acc: accFacade,
-			Cat: catFacade,
-			Op:  opFacade,
-			Ana: analytics,
+			CSVProfiles:    profiles,
+			BeancountNames: beanNames,
+
+			Backup: bak,
+			Doctor: doctor,
+			Crypt:  crypt,
 		}
 		app = &App{Menu: m, Deps: deps, Pool: pool}
 		return nil
@@ -127,3 +240,45 @@ func Build(ctx context.Context) (*App, error) {
 	}
 	return app, nil
 }
+
+// categoryCacheTTL — страховка на случай, если LISTEN недоступен.
+func categoryCacheTTL() time.Duration {
+	if v := os.Getenv("CATEGORY_CACHE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return 5 * time.Minute
+}
+
+// admins — логины из FINANCE_ADMINS через запятую.
+func admins() service.Admins {
+	var out service.Admins
+	for _, l := range strings.Split(os.Getenv("FINANCE_ADMINS"), ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func csvProfilesPath() string {
+	if p := os.Getenv("CSV_PROFILES_PATH"); p != "" {
+		return p
+	}
+	return "files/csv_profiles.yaml"
+}
+
+func beancountNamesPath() string {
+	if p := os.Getenv("BEANCOUNT_NAMES_PATH"); p != "" {
+		return p
+	}
+	return "files/beancount_names.yaml"
+}
+
+func inboxConfigPath() string {
+	if p := os.Getenv("INBOX_CONFIG_PATH"); p != "" {
+		return p
+	}
+	return "inbox/inbox.yaml"
+}
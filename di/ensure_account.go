@@ -9,11 +9,11 @@ import (
 	"strings"
 
 	"main/domain"
+	"main/facade"
 	"main/repo"
-	"main/state"
 )
 
-func ensureActiveAccount(ctx context.Context, accRepo *repo.PgAccountRepo, f domain.Factory) (domain.AccountID, string, error) {
+func ensureActiveAccount(ctx context.Context, accRepo *repo.PgAccountRepo, auth facade.AuthFacade, u domain.User, f domain.Factory) (domain.AccountID, string, error) {
 	accs, err := accRepo.List(ctx)
 	if err != nil {
 		return "", "", err
@@ -27,13 +27,13 @@ func ensureActiveAccount(ctx context.Context, accRepo *repo.PgAccountRepo, f dom
 		if err := accRepo.Create(ctx, acc); err != nil {
 			return "", "", err
 		}
-		_ = state.SaveAccountID(string(acc.ID))
+		_ = auth.SetActiveAccount(ctx, u.ID, acc.ID)
 		return acc.ID, acc.Name, nil
 	}
 
-	if saved, err := state.LoadAccountID(); err == nil && saved != "" {
+	if saved, err := auth.ActiveAccount(ctx, u.ID); err == nil && saved != "" {
 		for _, a := range accs {
-			if string(a.ID) == saved {
+			if a.ID == saved {
 				return a.ID, a.Name, nil
 			}
 		}
@@ -57,22 +57,23 @@ func ensureActiveAccount(ctx context.Context, accRepo *repo.PgAccountRepo, f dom
 		if err := accRepo.Create(ctx, acc); err != nil {
 			return "", "", err
 		}
-		_ = state.SaveAccountID(string(acc.ID))
+		_ = auth.SetActiveAccount(ctx, u.ID, acc.ID)
 		return acc.ID, acc.Name, nil
 	}
 
 	if n >= 1 && n <= len(accs) {
-		_ = state.SaveAccountID(string(accs[n-1].ID))
+		_ = auth.SetActiveAccount(ctx, u.ID, accs[n-1].ID)
 		return accs[n-1].ID, accs[n-1].Name, nil
 	}
 
-	_ = state.SaveAccountID(string(accs[0].ID))
+	_ = auth.SetActiveAccount(ctx, u.ID, accs[0].ID)
 	return accs[0].ID, accs[0].Name, nil
 }
 
+var stdin = bufio.NewReader(os.Stdin)
+
 func readLineSimple(prompt string) string {
 	fmt.Print(prompt)
-	in := bufio.NewReader(os.Stdin)
-	s, _ := in.ReadString('\n')
+	s, _ := stdin.ReadString('\n')
 	return strings.TrimSpace(s)
 }
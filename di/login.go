@@ -0,0 +1,86 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"main/domain"
+	"main/facade"
+)
+
+// login спрашивает логин и пароль при старте. FINANCE_LOGIN/FINANCE_PASSWORD
+// позволяют войти без вопросов (для неинтерактивных команд).
+func login(ctx context.Context, auth facade.AuthFacade) (domain.User, error) {
+	if l, p := os.Getenv("FINANCE_LOGIN"), os.Getenv("FINANCE_PASSWORD"); l != "" && p != "" {
+		return auth.Login(ctx, l, p)
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		fmt.Println("=== Вход ===")
+		fmt.Println("1) Войти")
+		fmt.Println("2) Зарегистрироваться")
+		choice := readLineSimple("Ваш выбор: ")
+
+		name := readLineSimple("Логин: ")
+		pass, err := readPassword("Пароль: ")
+		if err != nil {
+			return domain.User{}, err
+		}
+
+		var u domain.User
+		switch choice {
+		case "2":
+			again, err := readPassword("Повторите пароль: ")
+			if err != nil {
+				return domain.User{}, err
+			}
+			if again != pass {
+				fmt.Println("Пароли не совпадают")
+				continue
+			}
+			u, err = auth.Register(ctx, name, pass)
+			if errors.Is(err, facade.ErrPasswordTooShort) {
+				fmt.Printf("Пароль должен быть не короче %d символов\n", facade.MinPasswordLen)
+				continue
+			}
+			if errors.Is(err, facade.ErrLoginTaken) {
+				fmt.Println("Такой логин уже занят")
+				continue
+			}
+			if err != nil {
+				return domain.User{}, err
+			}
+		default:
+			u, err = auth.Login(ctx, name, pass)
+			if errors.Is(err, facade.ErrInvalidCredentials) {
+				fmt.Println("Неверный логин или пароль")
+				continue
+			}
+			if err != nil {
+				return domain.User{}, err
+			}
+		}
+		fmt.Printf("Вы вошли как %s\n\n", u.Login)
+		return u, nil
+	}
+	return domain.User{}, facade.ErrInvalidCredentials
+}
+
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return readLineSimple(prompt), nil
+	}
+	fmt.Print(prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
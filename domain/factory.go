@@ -10,6 +10,14 @@ import (
 
 type Factory struct{}
 
+func (_ Factory) NewUser(login string) (User, error) {
+	u := User{
+		ID:    UserID(uuid.NewString()),
+		Login: strings.ToLower(strings.TrimSpace(login)),
+	}
+	return u, u.Validate()
+}
+
 func (_ Factory) NewBankAccount(name string) (BankAccount, error) {
 	a := BankAccount{
 		ID:      AccountID(uuid.NewString()),
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// NormalizeDescription приводит описание к виду для сравнения: нижний регистр,
+// только буквы и цифры, пробелы схлопнуты ("  Кофе, Starbucks!" → "кофе starbucks").
+func NormalizeDescription(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// Fingerprint — отпечаток операции для поиска дублей при импорте. Считается в памяти
+// по расшифрованным операциям и в БД не хранится: по несекретному хэшу описание
+// подбиралось бы словарём.
+func Fingerprint(acc AccountID, date time.Time, t OperationType, amount decimal.Decimal, desc string) string {
+	h := sha256.New()
+	h.Write([]byte(string(acc) + "|" + date.Format("2006-01-02") + "|" + strconv.Itoa(int(t)) + "|" +
+		amount.StringFixed(2) + "|" + NormalizeDescription(desc)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (o Operation) Fingerprint() string {
+	return Fingerprint(o.BankAccount, o.Date, o.Type, o.Amount, o.Description)
+}
+
+// ImportBatch — один импорт файла в счёт.
+type ImportBatch struct {
+	ID        ImportBatchID
+	AccountID AccountID
+	Source    string // имя файла
+	Imported  int
+	Skipped   int
+	CreatedAt time.Time
+}
+
+func (_ Factory) NewImportBatch(acc AccountID, source string) ImportBatch {
+	return ImportBatch{
+		ID:        ImportBatchID(uuid.NewString()),
+		AccountID: acc,
+		Source:    source,
+		CreatedAt: time.Now(),
+	}
+}
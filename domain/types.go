@@ -1,8 +1,10 @@
 package domain
 
+type UserID string
 type AccountID string
 type CategoryID string
 type OperationID string
+type ImportBatchID string
 
 type CategoryType int
 
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrEmptyUserID = errors.New("user id is empty")
+	ErrEmptyLogin  = errors.New("login is empty")
+)
+
+type User struct {
+	ID    UserID `json:"id"    yaml:"id"`
+	Login string `json:"login" yaml:"login"`
+}
+
+func (u User) Validate() error {
+	if strings.TrimSpace(string(u.ID)) == "" {
+		return ErrEmptyUserID
+	}
+	if strings.TrimSpace(u.Login) == "" {
+		return ErrEmptyLogin
+	}
+	return nil
+}
@@ -2,12 +2,14 @@ package facade
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"time"
 
 	"main/domain"
 	"main/repo"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/shopspring/decimal"
 )
 
@@ -15,10 +17,12 @@ type AccountFacade struct {
 	F          domain.Factory
 	Accounts   *repo.PgAccountRepo
 	Operations *repo.PgOperationRepo
+	Users      *repo.PgUserRepo
+	UoW        UnitOfWork
 }
 
 func (f AccountFacade) Create(ctx context.Context, name string) (domain.BankAccount, error) {
-	acc, err := f.F.NewBankAccount(strings.TrimSpace(name))
+	acc, err := f.New(name)
 	if err != nil {
 		return domain.BankAccount{}, err
 	}
@@ -28,6 +32,12 @@ func (f AccountFacade) Create(ctx context.Context, name string) (domain.BankAcco
 	return acc, nil
 }
 
+// New — счёт без сохранения в БД: его создаёт импорт (ImportTarget.Create)
+// только после подтверждения, в своей транзакции.
+func (f AccountFacade) New(name string) (domain.BankAccount, error) {
+	return f.F.NewBankAccount(strings.TrimSpace(name))
+}
+
 func (f AccountFacade) Rename(ctx context.Context, id domain.AccountID, newName string) error {
 	newName = strings.TrimSpace(newName)
 	if newName == "" {
@@ -36,44 +46,79 @@ func (f AccountFacade) Rename(ctx context.Context, id domain.AccountID, newName
 	return f.Accounts.UpdateName(ctx, id, newName)
 }
 
-func (f AccountFacade) RecalculateBalance(ctx context.Context, id domain.AccountID) (decimal.Decimal, decimal.Decimal, error) {
-	acc, err := f.Accounts.Get(ctx, id)
+// Share открывает счёт пользователю с логином login (только для владельца).
+func (f AccountFacade) Share(ctx context.Context, id domain.AccountID, login string) error {
+	u, err := f.userByLogin(ctx, login)
 	if err != nil {
-		return decimal.Zero, decimal.Zero, err
+		return err
 	}
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	if u.ID == uid {
+		return errors.New("cannot share account with yourself")
+	}
+	return f.Accounts.Share(ctx, id, u.ID)
+}
 
-	from := time.Unix(0, 0)
-	to := time.Now().AddDate(100, 0, 0)
-
-	ops, err := f.Operations.ListByAccount(ctx, id, from, to)
+func (f AccountFacade) Unshare(ctx context.Context, id domain.AccountID, login string) error {
+	u, err := f.userByLogin(ctx, login)
 	if err != nil {
-		return decimal.Zero, decimal.Zero, err
+		return err
 	}
+	return f.Accounts.Unshare(ctx, id, u.ID)
+}
 
-	computed := decimal.Zero
-	for _, op := range ops {
-		if op.IsIncome() {
-			computed = computed.Add(op.Amount)
-		} else if op.IsExpense() {
-			computed = computed.Sub(op.Amount)
-		}
+func (f AccountFacade) userByLogin(ctx context.Context, login string) (domain.User, error) {
+	u, _, err := f.Users.GetByLogin(ctx, strings.ToLower(strings.TrimSpace(login)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.User{}, ErrUserNotFound
 	}
+	return u, err
+}
 
-	oldBal := acc.Balance
-	delta := computed.Sub(acc.Balance)
+func (f AccountFacade) SharedWith(ctx context.Context, id domain.AccountID) ([]domain.User, error) {
+	return f.Accounts.SharedWith(ctx, id)
+}
 
-	if delta.GreaterThan(decimal.Zero) {
-		if err := acc.Credit(delta); err != nil {
-			return oldBal, acc.Balance, err
+func (f AccountFacade) RecalculateBalance(ctx context.Context, id domain.AccountID) (oldBal, newBal decimal.Decimal, err error) {
+	err = f.UoW.Do(ctx, func(ctx context.Context) error {
+		acc, err := f.Accounts.GetForUpdate(ctx, id)
+		if err != nil {
+			return err
 		}
-	} else if delta.LessThan(decimal.Zero) {
-		if err := acc.Debit(delta.Abs()); err != nil {
-			return oldBal, acc.Balance, err
+		oldBal, newBal = acc.Balance, acc.Balance
+
+		from := time.Unix(0, 0)
+		to := time.Now().AddDate(100, 0, 0)
+
+		ops, err := f.Operations.ListByAccount(ctx, id, from, to)
+		if err != nil {
+			return err
 		}
-	}
 
-	if err := f.Accounts.Update(ctx, acc); err != nil {
-		return oldBal, acc.Balance, err
-	}
-	return oldBal, acc.Balance, nil
+		computed := decimal.Zero
+		for _, op := range ops {
+			if op.IsIncome() {
+				computed = computed.Add(op.Amount)
+			} else if op.IsExpense() {
+				computed = computed.Sub(op.Amount)
+			}
+		}
+
+		delta := computed.Sub(acc.Balance)
+		if delta.GreaterThan(decimal.Zero) {
+			if err := acc.Credit(delta); err != nil {
+				return err
+			}
+		} else if delta.LessThan(decimal.Zero) {
+			if err := acc.Debit(delta.Abs()); err != nil {
+				return err
+			}
+		}
+		newBal = acc.Balance
+		return f.Accounts.Update(ctx, acc)
+	})
+	return oldBal, newBal, err
 }
@@ -0,0 +1,94 @@
+package facade
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"main/domain"
+	"main/repo"
+)
+
+const MinPasswordLen = 8
+
+var (
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	ErrPasswordTooShort   = errors.New("password is too short")
+	ErrLoginTaken         = errors.New("login is already taken")
+	ErrUserNotFound       = errors.New("user not found")
+)
+
+type AuthFacade struct {
+	F     domain.Factory
+	Users *repo.PgUserRepo
+	UoW   UnitOfWork
+}
+
+// Register создаёт пользователя. Первый зарегистрированный пользователь
+// получает счета и категории, созданные до появления пользователей;
+// одновременные регистрации выполняются по очереди, так что первым
+// оказывается ровно один.
+func (f AuthFacade) Register(ctx context.Context, login, password string) (domain.User, error) {
+	u, err := f.F.NewUser(login)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if len(password) < MinPasswordLen {
+		return domain.User{}, ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	err = f.UoW.Do(ctx, func(ctx context.Context) error {
+		if err := f.Users.LockRegistration(ctx); err != nil {
+			return err
+		}
+		if _, _, err := f.Users.GetByLogin(ctx, u.Login); err == nil {
+			return ErrLoginTaken
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		n, err := f.Users.Count(ctx)
+		if err != nil {
+			return err
+		}
+		if err := f.Users.Create(ctx, u, string(hash)); err != nil {
+			return err
+		}
+		if n == 0 {
+			_, err = f.Users.ClaimUnowned(ctx, u.ID)
+		}
+		return err
+	})
+	if err != nil {
+		return domain.User{}, err
+	}
+	return u, nil
+}
+
+func (f AuthFacade) Login(ctx context.Context, login, password string) (domain.User, error) {
+	u, hash, err := f.Users.GetByLogin(ctx, strings.ToLower(strings.TrimSpace(login)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return domain.User{}, ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+func (f AuthFacade) ActiveAccount(ctx context.Context, u domain.UserID) (domain.AccountID, error) {
+	return f.Users.ActiveAccount(ctx, u)
+}
+
+func (f AuthFacade) SetActiveAccount(ctx context.Context, u domain.UserID, acc domain.AccountID) error {
+	return f.Users.SetActiveAccount(ctx, u, acc)
+}
@@ -0,0 +1,292 @@
+package facade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"main/domain"
+	"main/files"
+	"main/repo"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// DatasetCounts — сколько записей одного вида импорт создал, изменил и оставил как есть.
+type DatasetCounts struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+// DatasetBalance — счёт, баланс которого после импорта разошёлся с балансом в файле:
+// в БД есть операции, которых нет в файле (или наоборот).
+type DatasetBalance struct {
+	Account domain.AccountID
+	Name    string
+	File    decimal.Decimal
+	Result  decimal.Decimal
+}
+
+type DatasetReport struct {
+	Accounts   DatasetCounts
+	Categories DatasetCounts
+	Operations DatasetCounts
+	// Merged — категории файла, слитые с уже существующими категориями
+	// того же типа и имени (у них другой ID).
+	Merged     int
+	Mismatched []DatasetBalance
+	// NotRenamed — расшаренные счета, имя которых в файле другое, но менять
+	// его может только владелец.
+	NotRenamed []string
+}
+
+// DatasetFacade загружает полную выгрузку (files.Dataset) по ID записей:
+// существующие записи обновляются, отсутствующие — создаются, так что
+// повторный импорт того же файла ничего не меняет.
+type DatasetFacade struct {
+	Accounts   *repo.PgAccountRepo
+	Categories CategoryRepo
+	Operations *repo.PgOperationRepo
+	UoW        UnitOfWork
+}
+
+var errDatasetDryRun = errors.New("dataset: dry run")
+
+// Preview считает, что изменит Import, и откатывает транзакцию.
+func (f DatasetFacade) Preview(ctx context.Context, d files.Dataset) (DatasetReport, error) {
+	var rep DatasetReport
+	err := f.UoW.Do(ctx, func(ctx context.Context) error {
+		var err error
+		if rep, err = f.upsert(ctx, d); err != nil {
+			return err
+		}
+		return errDatasetDryRun
+	})
+	if errors.Is(err, errDatasetDryRun) {
+		err = nil
+	}
+	return rep, err
+}
+
+// Import применяет выгрузку в одной транзакции: ошибка в любой записи откатывает всё.
+func (f DatasetFacade) Import(ctx context.Context, d files.Dataset) (DatasetReport, error) {
+	var rep DatasetReport
+	err := f.UoW.Do(ctx, func(ctx context.Context) error {
+		var err error
+		rep, err = f.upsert(ctx, d)
+		return err
+	})
+	return rep, err
+}
+
+func (f DatasetFacade) upsert(ctx context.Context, d files.Dataset) (DatasetReport, error) {
+	var rep DatasetReport
+	if err := d.Validate(); err != nil {
+		return rep, err
+	}
+
+	for _, a := range d.Accounts {
+		cur, err := f.Accounts.Get(ctx, a.ID)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			acc := domain.BankAccount{ID: a.ID, Name: strings.TrimSpace(a.Name), Balance: decimal.Zero}
+			if err := acc.Validate(); err != nil {
+				return rep, fmt.Errorf("dataset: account %s: %w", a.ID, err)
+			}
+			if err := f.Accounts.Create(ctx, acc); err != nil {
+				return rep, fmt.Errorf("dataset: account %s: %w", a.ID, err)
+			}
+			rep.Accounts.Created++
+		case err != nil:
+			return rep, err
+		case cur.Name == a.Name:
+			rep.Accounts.Unchanged++
+		default:
+			err := f.Accounts.UpdateName(ctx, a.ID, a.Name)
+			if errors.Is(err, repo.ErrAccountNotFound) {
+				// чужой расшаренный счёт
+				rep.NotRenamed = append(rep.NotRenamed, cur.Name)
+				rep.Accounts.Unchanged++
+				continue
+			}
+			if err != nil {
+				return rep, fmt.Errorf("dataset: account %s: %w", a.ID, err)
+			}
+			rep.Accounts.Updated++
+		}
+	}
+
+	catID, err := f.upsertCategories(ctx, d.Categories, &rep)
+	if err != nil {
+		return rep, err
+	}
+
+	delta := map[domain.AccountID]decimal.Decimal{}
+	move := func(o domain.Operation, sign int64) {
+		delta[o.BankAccount] = delta[o.BankAccount].Add(o.Amount.Mul(decimal.NewFromInt(sign * int64(o.Sign()))))
+	}
+	for _, do := range d.Operations {
+		o := do.Operation()
+		o.Category = catID[o.Category]
+		if err := o.Validate(); err != nil {
+			return rep, fmt.Errorf("dataset: operation %s: %w", o.ID, err)
+		}
+		cur, err := f.Operations.Get(ctx, o.ID)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			if err := f.Operations.Create(ctx, o); err != nil {
+				return rep, fmt.Errorf("dataset: operation %s: %w", o.ID, err)
+			}
+			move(o, 1)
+			rep.Operations.Created++
+		case err != nil:
+			return rep, err
+		case sameOperation(cur, o):
+			rep.Operations.Unchanged++
+		default:
+			if err := f.Operations.Update(ctx, o); err != nil {
+				return rep, fmt.Errorf("dataset: operation %s: %w", o.ID, err)
+			}
+			move(cur, -1)
+			move(o, 1)
+			rep.Operations.Updated++
+		}
+	}
+
+	file := map[domain.AccountID]decimal.Decimal{}
+	for _, a := range d.Accounts {
+		file[a.ID] = a.Balance
+	}
+	for _, a := range d.Accounts {
+		acc, err := f.Accounts.GetForUpdate(ctx, a.ID)
+		if err != nil {
+			return rep, err
+		}
+		if dl := delta[a.ID]; !dl.IsZero() {
+			acc.Balance = acc.Balance.Add(dl)
+			if acc.Balance.IsNegative() {
+				return rep, fmt.Errorf("dataset: account %s: %w", acc.Name, domain.ErrInsufficientFunds)
+			}
+			if err := f.Accounts.Update(ctx, acc); err != nil {
+				return rep, err
+			}
+		}
+		if !acc.Balance.Equal(file[a.ID]) {
+			rep.Mismatched = append(rep.Mismatched, DatasetBalance{
+				Account: acc.ID, Name: acc.Name, File: file[a.ID], Result: acc.Balance,
+			})
+		}
+	}
+	// операции в других счетах, которые переехали в счета файла
+	for id, dl := range delta {
+		if _, ok := file[id]; ok || dl.IsZero() {
+			continue
+		}
+		acc, err := f.Accounts.GetForUpdate(ctx, id)
+		if err != nil {
+			return rep, err
+		}
+		acc.Balance = acc.Balance.Add(dl)
+		if acc.Balance.IsNegative() {
+			return rep, fmt.Errorf("dataset: account %s: %w", acc.Name, domain.ErrInsufficientFunds)
+		}
+		if err := f.Accounts.Update(ctx, acc); err != nil {
+			return rep, err
+		}
+	}
+	return rep, nil
+}
+
+// upsertCategories возвращает, под каким ID каждая категория файла оказалась в БД.
+// Категория без совпадения по ID, но с тем же типом и именем, что у существующей,
+// сливается с ней: имена уникальны в пределах пользователя.
+func (f DatasetFacade) upsertCategories(ctx context.Context, list []files.DatasetCategory, rep *DatasetReport) (map[domain.CategoryID]domain.CategoryID, error) {
+	existing, err := f.Categories.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := func(t domain.CategoryType, name string) (domain.CategoryID, bool) {
+		for _, c := range existing {
+			if c.Type == t && strings.EqualFold(c.Name, name) {
+				return c.ID, true
+			}
+		}
+		return "", false
+	}
+
+	out := make(map[domain.CategoryID]domain.CategoryID, len(list))
+	for _, dc := range list {
+		c := domain.Category{ID: dc.ID, Type: dc.Type, Name: strings.TrimSpace(dc.Name)}
+		cur, err := f.Categories.Get(ctx, c.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			if id, ok := byName(c.Type, c.Name); ok {
+				out[c.ID] = id
+				rep.Merged++
+				continue
+			}
+			if err := c.Validate(); err != nil {
+				return nil, fmt.Errorf("dataset: category %s: %w", c.ID, err)
+			}
+			if err := f.Categories.Create(ctx, c); err != nil {
+				return nil, fmt.Errorf("dataset: category %s: %w", c.ID, err)
+			}
+			existing = append(existing, c)
+			out[c.ID] = c.ID
+			rep.Categories.Created++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[c.ID] = c.ID
+
+		changed := false
+		if cur.Type != c.Type {
+			used, err := f.Categories.HasOperations(ctx, c.ID)
+			if err != nil {
+				return nil, err
+			}
+			if used {
+				return nil, fmt.Errorf("dataset: category %q is %s in the database and %s in the file, and already has operations",
+					cur.Name, typeName(cur.Type), typeName(c.Type))
+			}
+			if err := f.Categories.UpdateType(ctx, c.ID, c.Type); err != nil {
+				return nil, fmt.Errorf("dataset: category %s: %w", c.ID, err)
+			}
+			changed = true
+		}
+		if cur.Name != c.Name {
+			err := f.Categories.UpdateName(ctx, c.ID, c.Name)
+			// категория из чужого расшаренного счёта — имя оставляем
+			if err != nil && !errors.Is(err, repo.ErrCategoryNotFound) {
+				return nil, fmt.Errorf("dataset: category %s: %w", c.ID, err)
+			}
+			changed = changed || err == nil
+		}
+		if changed {
+			rep.Categories.Updated++
+		} else {
+			rep.Categories.Unchanged++
+		}
+	}
+	return out, nil
+}
+
+func sameOperation(a, b domain.Operation) bool {
+	return a.Type == b.Type &&
+		a.BankAccount == b.BankAccount &&
+		a.Category == b.Category &&
+		a.Amount.Equal(b.Amount) &&
+		a.Date.Format("2006-01-02") == b.Date.Format("2006-01-02") &&
+		a.Description == b.Description
+}
+
+func typeName(t domain.CategoryType) string {
+	if t == domain.CatIncome {
+		return "income"
+	}
+	return "expense"
+}
@@ -0,0 +1,467 @@
+package facade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"main/domain"
+	"main/files"
+	"main/repo"
+
+	"github.com/shopspring/decimal"
+)
+
+type NewCategory struct {
+	Name string
+	Type domain.CategoryType
+}
+
+// Duplicate — строка файла, совпавшая с уже существующей операцией счёта.
+type Duplicate struct {
+	Row   files.Row
+	Match domain.Operation
+	Fuzzy bool // совпало всё, кроме даты (±1 день)
+}
+
+type ImportOptions struct {
+	Source    string // имя файла — сохраняется в пакете импорта
+	KeepFuzzy bool   // импортировать строки, похожие на существующие с разницей в день
+}
+
+type ImportPreview struct {
+	Rows          int // будет добавлено
+	Incomes       int
+	Expenses      int
+	IncomeTotal   decimal.Decimal
+	ExpenseTotal  decimal.Decimal
+	NewCategories []NewCategory
+	BalanceBefore decimal.Decimal
+	BalanceAfter  decimal.Decimal
+	// FirstShortfall — строка файла, на которой баланс ушёл бы в минус; 0 — таких нет.
+	FirstShortfall int
+
+	Skipped []Duplicate // точные дубли — не импортируются
+	Flagged []Duplicate // похожие (±1 день) — импортируются только с KeepFuzzy
+}
+
+func (p ImportPreview) Net() decimal.Decimal { return p.IncomeTotal.Sub(p.ExpenseTotal) }
+
+type ImportResult struct {
+	BatchID  domain.ImportBatchID
+	Imported int
+	Skipped  []Duplicate
+	Flagged  []Duplicate
+}
+
+// ImportFacade загружает строки из файла в счёт целиком: либо все, либо ни одной.
+// Строки, которые уже есть в счёте, пропускаются.
+type ImportFacade struct {
+	F          domain.Factory
+	Accounts   *repo.PgAccountRepo
+	Categories CategoryRepo
+	Operations *repo.PgOperationRepo
+	Imports    *repo.PgImportRepo
+	Op         OperationFacade
+	UoW        UnitOfWork
+}
+
+// Preview ничего не пишет: считает, что изменит импорт.
+// rows проходятся несколько раз — поток должен позволять повторный проход.
+func (f ImportFacade) Preview(ctx context.Context, accID domain.AccountID, rows files.RowSeq, opts ImportOptions) (ImportPreview, error) {
+	p, _, err := f.plan(ctx, accID, rows, opts)
+	return p, err
+}
+
+// PreviewNew — предпросмотр импорта в счёт, который ещё не сохранён
+// (ImportTarget.Create): дублей нет, баланс — начальный баланс счёта.
+func (f ImportFacade) PreviewNew(ctx context.Context, acc domain.BankAccount, rows files.RowSeq, opts ImportOptions) (ImportPreview, error) {
+	p, _, err := f.planAccount(ctx, acc, false, rows, opts)
+	return p, err
+}
+
+// Apply добавляет строки в одной транзакции; ошибка в любой строке откатывает весь импорт.
+// Дубли ищутся заново внутри транзакции — между предпросмотром и импортом счёт мог измениться.
+func (f ImportFacade) Apply(ctx context.Context, accID domain.AccountID, rows files.RowSeq, opts ImportOptions) (ImportResult, error) {
+	if f.UoW == nil {
+		return ImportResult{}, errors.New("unit of work not wired: cannot import")
+	}
+	var res ImportResult
+	err := f.UoW.Do(ctx, func(ctx context.Context) error {
+		p, skip, err := f.plan(ctx, accID, rows, opts)
+		if err != nil {
+			return err
+		}
+		batch := f.F.NewImportBatch(accID, opts.Source)
+		if err := f.Imports.CreateBatch(ctx, batch); err != nil {
+			return err
+		}
+		n, imported := 0, 0
+		for r, err := range rows {
+			if err != nil {
+				return err
+			}
+			n++
+			if skip[n-1] {
+				continue
+			}
+			t := rowType(r)
+			in := AddOpInput{
+				AccountID:    accID,
+				Amount:       r.Amount,
+				When:         r.Date,
+				CategoryName: r.Category,
+				Description:  r.Description,
+			}
+			op, err := f.Op.add(ctx, t, in)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", r.Line, err)
+			}
+			if err := f.Imports.MarkImported(ctx, op.ID, batch.ID, r.ExternalID); err != nil {
+				return err
+			}
+			imported++
+		}
+		if imported != p.Rows {
+			return fmt.Errorf("import source changed while importing: planned %d rows, got %d", p.Rows, imported)
+		}
+		if err := f.Imports.FinishBatch(ctx, batch.ID, imported, n-imported); err != nil {
+			return err
+		}
+		res = ImportResult{BatchID: batch.ID, Imported: imported, Skipped: p.Skipped, Flagged: p.Flagged}
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	return res, nil
+}
+
+// ImportTarget — строки одной выписки и счёт, в который они идут.
+type ImportTarget struct {
+	Account domain.AccountID
+	Rows    files.RowSeq
+	Options ImportOptions
+	// Create — счёт ещё не сохранён (AccountFacade.New): ApplyAll создаёт его
+	// в транзакции импорта. Несколько выписок могут указывать один такой счёт.
+	Create *domain.BankAccount
+	IBAN   string // номер выписки, привязывается к созданному счёту
+}
+
+// ApplyAll импортирует выписки одного файла в одной транзакции: ошибка в любой
+// откатывает все, так что перевод между счетами файла не останется наполовину.
+// Новые счета выписок создаются в той же транзакции.
+func (f ImportFacade) ApplyAll(ctx context.Context, targets []ImportTarget) ([]ImportResult, error) {
+	if f.UoW == nil {
+		return nil, errors.New("unit of work not wired: cannot import")
+	}
+	var out []ImportResult
+	err := f.UoW.Do(ctx, func(ctx context.Context) error {
+		out = out[:0]
+		created := map[domain.AccountID]bool{}
+		for _, t := range targets {
+			if t.Create != nil && !created[t.Create.ID] {
+				if t.Create.ID != t.Account {
+					return fmt.Errorf("import target: account %s does not match created account %s", t.Account, t.Create.ID)
+				}
+				if err := f.Accounts.Create(ctx, *t.Create); err != nil {
+					return err
+				}
+				if t.IBAN != "" {
+					if err := f.Accounts.SetIBAN(ctx, t.Create.ID, t.IBAN); err != nil {
+						return err
+					}
+				}
+				created[t.Create.ID] = true
+			}
+			res, err := f.Apply(ctx, t.Account, t.Rows, t.Options)
+			if err != nil {
+				return err
+			}
+			out = append(out, res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// plan делит строки на дубли и те, что будут добавлены, и считает эффект на баланс.
+// skip — порядковые номера (с 0) строк, которые не импортируются. В памяти
+// держатся только дубли и операции счёта за период файла, не сами строки.
+func (f ImportFacade) plan(ctx context.Context, accID domain.AccountID, rows files.RowSeq, opts ImportOptions) (ImportPreview, map[int]bool, error) {
+	acc, err := f.Accounts.Get(ctx, accID)
+	if err != nil {
+		return ImportPreview{}, nil, err
+	}
+	return f.planAccount(ctx, acc, true, rows, opts)
+}
+
+// planAccount — plan для счёта acc; stored=false — счёта ещё нет в БД, сверять не с чем.
+func (f ImportFacade) planAccount(ctx context.Context, acc domain.BankAccount, stored bool, rows files.RowSeq, opts ImportOptions) (ImportPreview, map[int]bool, error) {
+	accID := acc.ID
+	cats, err := f.Categories.List(ctx)
+	if err != nil {
+		return ImportPreview{}, nil, err
+	}
+	known := map[string]bool{}
+	for _, c := range cats {
+		known[categoryKey(c.Name, c.Type)] = true
+	}
+	m, err := f.matcher(ctx, accID, rows, stored)
+	if err != nil {
+		return ImportPreview{}, nil, err
+	}
+
+	dups, err := m.classify(accID, rows)
+	if err != nil {
+		return ImportPreview{}, nil, err
+	}
+
+	p := ImportPreview{BalanceBefore: acc.Balance}
+	bal := acc.Balance
+	skip := map[int]bool{}
+	n := -1
+	for r, err := range rows {
+		if err != nil {
+			return ImportPreview{}, nil, err
+		}
+		n++
+		t := rowType(r)
+		if d := dups[n]; d != nil {
+			if !d.Fuzzy {
+				p.Skipped = append(p.Skipped, *d)
+				skip[n] = true
+				continue
+			}
+			p.Flagged = append(p.Flagged, *d)
+			if !opts.KeepFuzzy {
+				skip[n] = true
+				continue
+			}
+		}
+		p.Rows++
+
+		if t == domain.OpIncome {
+			p.Incomes++
+			p.IncomeTotal = p.IncomeTotal.Add(r.Amount)
+			bal = bal.Add(r.Amount)
+		} else {
+			p.Expenses++
+			p.ExpenseTotal = p.ExpenseTotal.Add(r.Amount)
+			bal = bal.Sub(r.Amount)
+			if bal.IsNegative() && p.FirstShortfall == 0 {
+				p.FirstShortfall = r.Line
+			}
+		}
+		name := strings.TrimSpace(r.Category)
+		if k := categoryKey(name, t); !known[k] {
+			known[k] = true
+			p.NewCategories = append(p.NewCategories, NewCategory{Name: name, Type: t})
+		}
+	}
+	p.BalanceAfter = bal
+	return p, skip, nil
+}
+
+// matcher сопоставляет строки файла с операциями счёта. Каждая существующая
+// операция закрывает не больше одной строки: две одинаковые покупки в файле
+// при одной в БД дадут один дубль и одну новую операцию.
+//
+// Строки с внешним id (FITID) сверяются прежде всего по нему; по отпечатку они
+// совпадают только с операциями без внешнего id (внесёнными вручную или из CSV).
+type matcher struct {
+	ops   []domain.Operation
+	exact map[string][]int // отпечаток → индексы ops
+	loose map[string][]int // тип|сумма|описание → индексы ops
+	used  map[int]bool
+
+	byExt  map[string]domain.Operation // внешний id → операция счёта
+	hasExt map[domain.OperationID]bool // у операции есть внешний id
+}
+
+// matcher проверяет строки и загружает операции счёта за период файла (±1 день);
+// у несохранённого счёта (stored=false) операций нет.
+func (f ImportFacade) matcher(ctx context.Context, accID domain.AccountID, rows files.RowSeq, stored bool) (*matcher, error) {
+	m := &matcher{exact: map[string][]int{}, loose: map[string][]int{}, used: map[int]bool{}}
+	var from, to time.Time
+	var ids []string
+	for r, err := range rows {
+		if err != nil {
+			return nil, err
+		}
+		if err := validateRow(r); err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.Line, err)
+		}
+		if from.IsZero() || r.Date.Before(from) {
+			from = r.Date
+		}
+		if r.Date.After(to) {
+			to = r.Date
+		}
+		if r.ExternalID != "" {
+			ids = append(ids, r.ExternalID)
+		}
+	}
+	if from.IsZero() || !stored {
+		return m, nil
+	}
+	from, to = from.AddDate(0, 0, -1), to.AddDate(0, 0, 1)
+	ops, err := f.Operations.ListByAccount(ctx, accID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	m.ops = ops
+
+	if m.byExt, err = f.Operations.ListByExternalIDs(ctx, accID, ids); err != nil {
+		return nil, err
+	}
+	ext, err := f.Imports.ExternalIDs(ctx, accID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	m.hasExt = map[domain.OperationID]bool{}
+	for id := range ext {
+		m.hasExt[id] = true
+	}
+	for i, o := range ops {
+		m.exact[o.Fingerprint()] = append(m.exact[o.Fingerprint()], i)
+		k := looseKey(o.Type, o.Amount, o.Description)
+		m.loose[k] = append(m.loose[k], i)
+	}
+	return m, nil
+}
+
+// classify сначала ищет точные совпадения по всем строкам, потом похожие:
+// иначе строка со сдвигом в день могла бы занять операцию, точно совпадающую с другой строкой.
+// Результат — дубли по порядковому номеру строки.
+func (m *matcher) classify(accID domain.AccountID, rows files.RowSeq) (map[int]*Duplicate, error) {
+	out := map[int]*Duplicate{}
+	index := map[domain.OperationID]int{}
+	for i, o := range m.ops {
+		index[o.ID] = i
+	}
+	seen := map[string]files.Row{}
+	n := -1
+	for r, err := range rows {
+		if err != nil {
+			return nil, err
+		}
+		n++
+		if r.ExternalID == "" {
+			continue
+		}
+		if o, ok := m.byExt[r.ExternalID]; ok {
+			if i, ok := index[o.ID]; ok {
+				m.used[i] = true
+			}
+			out[n] = &Duplicate{Row: r, Match: o}
+			continue
+		}
+		// тот же FITID дважды в одном файле — вторая строка считается дублем первой
+		if first, ok := seen[r.ExternalID]; ok {
+			out[n] = &Duplicate{Row: r, Match: domain.Operation{
+				BankAccount: accID, Type: rowType(first), Amount: first.Amount, Date: first.Date, Description: first.Description,
+			}}
+			continue
+		}
+		seen[r.ExternalID] = r
+	}
+	if len(m.ops) == 0 {
+		return out, nil // сопоставлять не с чем
+	}
+	usable := func(r files.Row, i int) bool {
+		return !m.used[i] && (r.ExternalID == "" || !m.hasExt[m.ops[i].ID])
+	}
+
+	n = -1
+	for r, err := range rows {
+		if err != nil {
+			return nil, err
+		}
+		n++
+		if out[n] != nil {
+			continue
+		}
+		for _, i := range m.exact[domain.Fingerprint(accID, r.Date, rowType(r), r.Amount, r.Description)] {
+			if usable(r, i) {
+				m.used[i] = true
+				out[n] = &Duplicate{Row: r, Match: m.ops[i]}
+				break
+			}
+		}
+	}
+	n = -1
+	for r, err := range rows {
+		if err != nil {
+			return nil, err
+		}
+		n++
+		if out[n] != nil {
+			continue
+		}
+		day := r.Date.Format("2006-01-02")
+		for _, i := range m.loose[looseKey(rowType(r), r.Amount, r.Description)] {
+			o := m.ops[i]
+			if !usable(r, i) {
+				continue
+			}
+			if o.Date.AddDate(0, 0, 1).Format("2006-01-02") == day || o.Date.AddDate(0, 0, -1).Format("2006-01-02") == day {
+				m.used[i] = true
+				out[n] = &Duplicate{Row: r, Match: o, Fuzzy: true}
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// Reconciliation — сверка баланса счёта с конечным остатком выписки.
+type Reconciliation struct {
+	Statement files.Balance
+	Account   decimal.Decimal
+}
+
+func (r Reconciliation) Diff() decimal.Decimal { return r.Account.Sub(r.Statement.Amount) }
+func (r Reconciliation) OK() bool              { return r.Diff().IsZero() }
+
+// Reconcile сравнивает текущий баланс счёта с остатком выписки; ok=false — в выписке остатка нет.
+func (f ImportFacade) Reconcile(ctx context.Context, accID domain.AccountID, st files.Statement) (Reconciliation, bool, error) {
+	if st.Closing == nil {
+		return Reconciliation{}, false, nil
+	}
+	acc, err := f.Accounts.Get(ctx, accID)
+	if err != nil {
+		return Reconciliation{}, false, err
+	}
+	return Reconciliation{Statement: *st.Closing, Account: acc.Balance}, true, nil
+}
+
+func looseKey(t domain.OperationType, amount decimal.Decimal, desc string) string {
+	return fmt.Sprintf("%d|%s|%s", t, amount.StringFixed(2), domain.NormalizeDescription(desc))
+}
+
+func rowType(r files.Row) domain.OperationType {
+	if r.Type >= 0 {
+		return domain.OpIncome
+	}
+	return domain.OpExpense
+}
+
+func validateRow(r files.Row) error {
+	if strings.TrimSpace(r.Category) == "" {
+		return errors.New("category is required")
+	}
+	if !r.Amount.IsPositive() {
+		return domain.ErrNonPositiveAmt
+	}
+	return nil
+}
+
+func categoryKey(name string, t domain.CategoryType) string {
+	return fmt.Sprintf("%d|%s", t, strings.ToLower(strings.TrimSpace(name)))
+}
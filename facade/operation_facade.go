@@ -29,6 +29,10 @@ type EditOpInput struct {
 	ForcedType  *domain.CategoryType
 }
 
+// ErrTypeChangeNeedsCategory — тип операции меняется, а категория остаётся
+// старой: её тип уже не совпадёт с типом операции.
+var ErrTypeChangeNeedsCategory = errors.New("changing the operation type requires a category of the new type")
+
 type OperationFacade struct {
 	F          domain.Factory
 	Accounts   *repo.PgAccountRepo
@@ -36,6 +40,7 @@ type OperationFacade struct {
 	Operations *repo.PgOperationRepo
 
 	OpSvc *service.OperationService
+	UoW   UnitOfWork
 }
 
 func (f OperationFacade) AddIncome(ctx context.Context, in AddOpInput) (domain.Operation, error) {
@@ -49,147 +54,97 @@ func (f OperationFacade) add(ctx context.Context, t domain.OperationType, in Add
 	if strings.TrimSpace(in.CategoryName) == "" {
 		return domain.Operation{}, errors.New("category is required")
 	}
-	cats, err := f.Categories.List(ctx)
-	if err != nil {
-		return domain.Operation{}, err
+	if t != domain.OpIncome && t != domain.OpExpense {
+		return domain.Operation{}, errors.New("unknown operation type")
 	}
-	var catID domain.CategoryID
-	for _, c := range cats {
-		if strings.EqualFold(c.Name, in.CategoryName) {
-			catID = c.ID
-			break
-		}
+	if f.OpSvc == nil || f.UoW == nil {
+		return domain.Operation{}, errors.New("operation service not wired: cannot add")
 	}
-	if catID == "" {
-		var ct domain.CategoryType
-		if t == domain.OpIncome {
-			ct = domain.CatIncome
-		} else {
-			ct = domain.CatExpense
-		}
-		cat, err := f.F.NewCategory(in.CategoryName, ct)
+
+	var op domain.Operation
+	err := f.UoW.Do(ctx, func(ctx context.Context) error {
+		catID, err := f.categoryByName(ctx, in.CategoryName, t)
 		if err != nil {
-			return domain.Operation{}, err
+			return err
 		}
-		if err := f.Categories.Create(ctx, cat); err != nil {
-			return domain.Operation{}, err
-		}
-		catID = cat.ID
-	}
-
-	op, err := f.F.NewOperation(t, in.AccountID, in.Amount, in.When, catID, in.Description)
+		op, err = f.OpSvc.ApplyOperation(ctx, t, in.AccountID, in.Amount, in.When, catID, in.Description)
+		return err
+	})
 	if err != nil {
 		return domain.Operation{}, err
 	}
+	return op, nil
+}
 
-	acc, err := f.Accounts.Get(ctx, in.AccountID)
+// categoryByName ищет категорию типа t по имени без учёта регистра,
+// а если такой нет — создаёт её.
+func (f OperationFacade) categoryByName(ctx context.Context, name string, t domain.CategoryType) (domain.CategoryID, error) {
+	cats, err := f.Categories.List(ctx)
 	if err != nil {
-		return domain.Operation{}, err
+		return "", err
 	}
-	switch t {
-	case domain.OpIncome:
-		if err := acc.Credit(in.Amount); err != nil {
-			return domain.Operation{}, err
-		}
-	case domain.OpExpense:
-		if err := acc.Debit(in.Amount); err != nil {
-			return domain.Operation{}, err
+	for _, c := range cats {
+		if c.Type == t && strings.EqualFold(c.Name, name) {
+			return c.ID, nil
 		}
-	default:
-		return domain.Operation{}, errors.New("unknown operation type")
 	}
-	if err := f.Operations.Create(ctx, op); err != nil {
-		return domain.Operation{}, err
+	cat, err := f.F.NewCategory(name, t)
+	if err != nil {
+		return "", err
 	}
-	if err := f.Accounts.Update(ctx, acc); err != nil {
-		return domain.Operation{}, err
+	if err := f.Categories.Create(ctx, cat); err != nil {
+		return "", err
 	}
-	return op, nil
+	return cat.ID, nil
 }
 
 func (f OperationFacade) Edit(ctx context.Context, in EditOpInput) (domain.Operation, error) {
-	old, err := f.Operations.Get(ctx, in.OperationID)
-	if err != nil {
-		return domain.Operation{}, err
+	if f.OpSvc == nil || f.UoW == nil {
+		return domain.Operation{}, errors.New("operation service not wired: cannot edit")
 	}
-
-	newOp := old
-
-	if in.NewAmount != nil {
-		newOp.Amount = *in.NewAmount
-	}
-	if in.NewWhen != nil {
-		newOp.Date = *in.NewWhen
-	}
-	if in.NewCategory != nil && strings.TrimSpace(*in.NewCategory) != "" {
-		cats, err := f.Categories.List(ctx)
+	if in.ForcedType != nil && (in.NewCategory == nil || strings.TrimSpace(*in.NewCategory) == "") {
+		old, err := f.Operations.Get(ctx, in.OperationID)
 		if err != nil {
 			return domain.Operation{}, err
 		}
-		var foundID domain.CategoryID
-		for _, c := range cats {
-			if strings.EqualFold(c.Name, *in.NewCategory) {
-				if in.ForcedType == nil || c.Type == *in.ForcedType {
-					foundID = c.ID
-					break
-				}
-			}
-		}
-		if foundID == "" {
-			ct := domain.CatExpense
-			if old.IsIncome() {
-				ct = domain.CatIncome
-			}
-			if in.ForcedType != nil {
-				ct = *in.ForcedType
-			}
-			cat, err := f.F.NewCategory(*in.NewCategory, ct)
-			if err != nil {
-				return domain.Operation{}, err
-			}
-			if err := f.Categories.Create(ctx, cat); err != nil {
-				return domain.Operation{}, err
-			}
-			foundID = cat.ID
+		if old.Type != *in.ForcedType {
+			return domain.Operation{}, ErrTypeChangeNeedsCategory
 		}
-		newOp.Category = foundID
-	}
-	if in.NewDesc != nil {
-		newOp.Description = *in.NewDesc
 	}
 
-	if !newOp.Amount.Equal(old.Amount) {
-		acc, err := f.Accounts.Get(ctx, old.BankAccount)
+	var newOp domain.Operation
+	err := f.UoW.Do(ctx, func(ctx context.Context) error {
+		old, err := f.Operations.Get(ctx, in.OperationID)
 		if err != nil {
-			return domain.Operation{}, err
+			return err
 		}
-		diff := newOp.Amount.Sub(old.Amount)
-		if old.IsIncome() {
-			if diff.GreaterThan(decimal.Zero) {
-				if err := acc.Credit(diff); err != nil {
-					return domain.Operation{}, err
-				}
-			} else if diff.LessThan(decimal.Zero) {
-				if err := acc.Debit(diff.Abs()); err != nil {
-					return domain.Operation{}, err
-				}
-			}
-		} else { // расход
-			if diff.GreaterThan(decimal.Zero) {
-				if err := acc.Debit(diff); err != nil {
-					return domain.Operation{}, err
-				}
-			} else if diff.LessThan(decimal.Zero) {
-				if err := acc.Credit(diff.Abs()); err != nil {
-					return domain.Operation{}, err
-				}
+
+		newOp = old
+		if in.ForcedType != nil {
+			newOp.Type = *in.ForcedType
+		}
+		if in.NewAmount != nil {
+			newOp.Amount = *in.NewAmount
+		}
+		if in.NewWhen != nil {
+			newOp.Date = *in.NewWhen
+		}
+		if in.NewCategory != nil && strings.TrimSpace(*in.NewCategory) != "" {
+			newOp.Category, err = f.categoryByName(ctx, *in.NewCategory, newOp.Type)
+			if err != nil {
+				return err
 			}
 		}
-		if err := f.Accounts.Update(ctx, acc); err != nil {
-			return domain.Operation{}, err
+		if in.NewDesc != nil {
+			newOp.Description = *in.NewDesc
 		}
-	}
+		newOp.Amount = newOp.Amount.Round(2)
 
+		return f.OpSvc.UpdateOperation(ctx, newOp.ID, newOp.Type, newOp.Amount, newOp.Date, newOp.Category, newOp.Description)
+	})
+	if err != nil {
+		return domain.Operation{}, err
+	}
 	return newOp, nil
 }
 
@@ -16,3 +16,9 @@ type CategoryRepo interface {
 	Delete(ctx context.Context, id domain.CategoryID) error
 	HasOperations(ctx context.Context, id domain.CategoryID) (bool, error)
 }
+
+// UnitOfWork выполняет fn атомарно: всё, что сделано через ctx, коммитится
+// вместе или откатывается целиком.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
@@ -0,0 +1,275 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
+)
+
+// BeancountNames — имена счетов Beancount для счетов и категорий приложения:
+// "Еда вне дома" → "Food:Restaurants". Чего нет в словаре, транслитерируется.
+type BeancountNames map[string]string
+
+// LoadBeancountNames читает словарь из YAML ("names: {Еда: Food}"); отсутствующий файл — не ошибка.
+func LoadBeancountNames(path string) (BeancountNames, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return BeancountNames{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Names BeancountNames `yaml:"names"`
+	}
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for from, to := range cfg.Names {
+		if !beancountAccountRe.MatchString(to) {
+			return nil, fmt.Errorf("%s: %q: %q is not a valid beancount account name (A-Z, a-z, 0-9, '-', levels split by ':')", path, from, to)
+		}
+	}
+	if cfg.Names == nil {
+		cfg.Names = BeancountNames{}
+	}
+	return cfg.Names, nil
+}
+
+var (
+	beancountAccountRe  = regexp.MustCompile(`^[A-Z0-9][A-Za-z0-9-]*(:[A-Z0-9][A-Za-z0-9-]*)*$`)
+	beancountCurrencyRe = regexp.MustCompile(`^[A-Z][A-Z0-9'._-]{0,22}[A-Z0-9]$`)
+)
+
+// BeancountAccount — счёт приложения за период: остаток на начало и строки.
+type BeancountAccount struct {
+	Name    string
+	Opening decimal.Decimal
+	Rows    RowSeq
+}
+
+// BeancountEncoder пишет файл, который проходит bean-check: open для каждого счёта
+// (Assets:) и категории (Expenses:/Income:), входящий остаток проводкой с
+// Equity:Opening-Balances, транзакции и balance на день после конца периода.
+// Исходные имена сохраняются метаданными "name" у open.
+type BeancountEncoder struct {
+	Account  string // для Encode с одним счётом
+	Opening  decimal.Decimal
+	Currency string // RUB по умолчанию
+	Names    BeancountNames
+	From, To time.Time
+}
+
+const beancountEquity = "Equity:Opening-Balances"
+
+func (e BeancountEncoder) Encode(w io.Writer, rows RowSeq) error {
+	return e.EncodeAccounts(w, []BeancountAccount{{Name: e.Account, Opening: e.Opening, Rows: rows}})
+}
+
+// EncodeAccounts проходит строки дважды: open должны идти до транзакций,
+// а список категорий известен только после всех строк.
+func (e BeancountEncoder) EncodeAccounts(w io.Writer, accs []BeancountAccount) error {
+	cur := e.Currency
+	if cur == "" {
+		cur = "RUB"
+	}
+	if !beancountCurrencyRe.MatchString(cur) {
+		return fmt.Errorf("beancount: bad currency %q", cur)
+	}
+
+	n := beancountNamer{names: e.Names, used: map[string]string{}}
+	type opened struct{ account, name string }
+	var opens []opened
+	seen := map[string]bool{}
+	open := func(account, name string) {
+		if !seen[account] {
+			seen[account] = true
+			opens = append(opens, opened{account, name})
+		}
+	}
+	category := func(r Row) (string, decimal.Decimal) {
+		amt := r.Amount
+		root := LedgerIncome
+		if r.Type < 0 {
+			amt, root = amt.Neg(), LedgerExpenses
+		}
+		cat := strings.TrimSpace(r.Category)
+		if cat == "" {
+			cat = NoCategory
+		}
+		other := n.account(root, cat)
+		open(other, cat)
+		return other, amt
+	}
+
+	// первый проход: счета, категории и границы периода
+	var first, last time.Time
+	assets := make([]string, len(accs))
+	for i, a := range accs {
+		assets[i] = n.account(LedgerAssets, a.Name)
+		open(assets[i], a.Name)
+		if !a.Opening.IsZero() {
+			open(beancountEquity, "")
+		}
+		for r, err := range a.Rows {
+			if err != nil {
+				return err
+			}
+			category(r)
+			if first.IsZero() || r.Date.Before(first) {
+				first = r.Date
+			}
+			if r.Date.After(last) {
+				last = r.Date
+			}
+		}
+	}
+	from, to := day(e.From), day(e.To)
+	if from.IsZero() || to.IsZero() {
+		from, to = day(first), day(last)
+		if from.IsZero() {
+			from = day(time.Now())
+			to = from
+		}
+	}
+
+	out := &errWriter{w: w}
+	fmt.Fprintf(out, "option \"title\" %s\n", beancountString("Финансы: "+from.Format("2006-01-02")+" — "+to.Format("2006-01-02")))
+	fmt.Fprintf(out, "option \"operating_currency\" \"%s\"\n\n", cur)
+	sort.Slice(opens, func(i, j int) bool { return opens[i].account < opens[j].account })
+	for _, o := range opens {
+		fmt.Fprintf(out, "%s open %s %s\n", from.Format("2006-01-02"), o.account, cur)
+		if o.name != "" {
+			fmt.Fprintf(out, "  name: %s\n", beancountString(o.name))
+		}
+	}
+
+	// второй проход: транзакции
+	var balances []string
+	for i, a := range accs {
+		asset := assets[i]
+		if !a.Opening.IsZero() {
+			fmt.Fprintf(out, "\n%s * %s\n", from.Format("2006-01-02"), beancountString("Входящий остаток"))
+			beancountPosting(out, asset, a.Opening, cur)
+			beancountPosting(out, beancountEquity, a.Opening.Neg(), cur)
+		}
+		bal := a.Opening
+		for r, err := range a.Rows {
+			if err != nil {
+				return err
+			}
+			other, amt := category(r)
+			fmt.Fprintf(out, "\n%s * %s\n", r.Date.Format("2006-01-02"), beancountString(r.Description))
+			beancountPosting(out, asset, amt, cur)
+			beancountPosting(out, other, amt.Neg(), cur)
+			bal = bal.Add(amt)
+		}
+		balances = append(balances, fmt.Sprintf("%s balance %-40s %12s %s\n",
+			to.AddDate(0, 0, 1).Format("2006-01-02"), asset, bal.StringFixed(2), cur))
+	}
+	io.WriteString(out, "\n")
+	for _, b := range balances {
+		io.WriteString(out, b)
+	}
+	return out.err
+}
+
+func beancountPosting(w io.Writer, account string, amt decimal.Decimal, cur string) {
+	fmt.Fprintf(w, "  %-40s %12s %s\n", account, amt.StringFixed(2), cur)
+}
+
+// beancountString — строка в кавычках: \ и " экранируются, переводы строк схлопываются.
+func beancountString(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+	return `"` + s + `"`
+}
+
+func day(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// beancountNamer даёт счетам и категориям корректные и уникальные имена счетов Beancount.
+type beancountNamer struct {
+	names BeancountNames
+	used  map[string]string // имя счёта Beancount → исходное имя
+}
+
+func (n beancountNamer) account(root, name string) string {
+	path := n.names[name]
+	if path == "" {
+		var parts []string
+		for _, p := range strings.Split(name, ":") {
+			if c := beancountComponent(p); c != "" {
+				parts = append(parts, c)
+			}
+		}
+		if len(parts) == 0 {
+			parts = []string{"Other"}
+		}
+		path = strings.Join(parts, ":")
+	}
+	acc := root + ":" + path
+	// "Еда" и "Eda" дают одно имя — второму достаётся суффикс
+	for i := 2; ; i++ {
+		prev, ok := n.used[acc]
+		if !ok {
+			n.used[acc] = name
+			return acc
+		}
+		if prev == name {
+			return acc
+		}
+		acc = fmt.Sprintf("%s:%s-%d", root, path, i)
+	}
+}
+
+// beancountComponent: "еда вне дома" → "Eda-Vne-Doma". Слова транслитерируются,
+// пишутся с заглавной и склеиваются дефисом; всё, кроме латиницы и цифр, выбрасывается.
+func beancountComponent(s string) string {
+	var words []string
+	for _, w := range strings.FieldsFunc(translit(s), func(r rune) bool {
+		return !(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)))
+	}) {
+		words = append(words, strings.ToUpper(w[:1])+w[1:])
+	}
+	return strings.Join(words, "-")
+}
+
+var translitTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
+
+// translit — кириллица латиницей (упрощённая ГОСТ 7.79, вариант Б); регистр первой буквы сохраняется.
+func translit(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		lr := unicode.ToLower(r)
+		t, ok := translitTable[lr]
+		switch {
+		case !ok:
+			b.WriteRune(r)
+		case lr != r && t != "":
+			b.WriteString(strings.ToUpper(t[:1]) + t[1:])
+		default:
+			b.WriteString(t)
+		}
+	}
+	return b.String()
+}
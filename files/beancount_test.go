@@ -0,0 +1,245 @@
+package files
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const beancountGolden = `option "title" "Финансы: 2024-01-01 — 2024-01-31"
+option "operating_currency" "RUB"
+
+2024-01-01 open Assets:Main RUB
+  name: "Основной счёт"
+2024-01-01 open Equity:Opening-Balances RUB
+2024-01-01 open Expenses:Eda RUB
+  name: "Еда"
+2024-01-01 open Expenses:Eda-2 RUB
+  name: "Eda"
+2024-01-01 open Expenses:Food:Restaurants RUB
+  name: "Еда вне дома"
+2024-01-01 open Income:Zarplata RUB
+  name: "Зарплата"
+
+2024-01-01 * "Входящий остаток"
+  Assets:Main                                    100.00 RUB
+  Equity:Opening-Balances                       -100.00 RUB
+
+2024-01-05 * "Кафе \"Ромашка\" и т.д."
+  Assets:Main                                    -30.00 RUB
+  Expenses:Food:Restaurants                       30.00 RUB
+
+2024-01-10 * ""
+  Assets:Main                                   1000.00 RUB
+  Income:Zarplata                              -1000.00 RUB
+
+2024-01-11 * "a\\b"
+  Assets:Main                                     -5.00 RUB
+  Expenses:Eda                                     5.00 RUB
+
+2024-01-12 * ""
+  Assets:Main                                     -7.00 RUB
+  Expenses:Eda-2                                   7.00 RUB
+
+2024-02-01 balance Assets:Main                                   1058.00 RUB
+`
+
+func TestBeancountEncoder(t *testing.T) {
+	e := BeancountEncoder{
+		Account: "Основной счёт",
+		Opening: decimal.NewFromInt(100),
+		Names:   BeancountNames{"Основной счёт": "Main", "Еда вне дома": "Food:Restaurants"},
+		From:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:      time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+	}
+	out, err := EncodeRows(e, []Row{
+		testRow(-1, "30", "2024-01-05", "Еда вне дома", "Кафе \"Ромашка\"\nи т.д."),
+		testRow(1, "1000", "2024-01-10", "Зарплата", ""),
+		testRow(-1, "5", "2024-01-11", "Еда", `a\b`),
+		testRow(-1, "7", "2024-01-12", "Eda", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != beancountGolden {
+		t.Errorf("got:\n%s\nwant:\n%s", out, beancountGolden)
+	}
+	checkBeancount(t, string(out))
+}
+
+func TestBeancountEncodeAccounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		enc      BeancountEncoder
+		accs     []BeancountAccount
+		balances []string
+	}{
+		{
+			name: "период по строкам",
+			enc:  BeancountEncoder{Currency: "EUR"},
+			accs: []BeancountAccount{
+				{Name: "Карта", Rows: SliceRows([]Row{
+					testRow(-1, "10", "2024-03-05", "Еда", ""),
+					testRow(-1, "1", "2024-03-01", TransferPrefix+"Сбережения", ""),
+				})},
+				{Name: "Сбережения", Opening: decimal.RequireFromString("50.5"), Rows: SliceRows([]Row{
+					testRow(1, "1", "2024-03-01", TransferPrefix+"Карта", ""),
+				})},
+			},
+			balances: []string{"2024-03-06 Assets:Karta -11.00 EUR", "2024-03-06 Assets:Sberezheniya 51.50 EUR"},
+		},
+		{
+			name: "период задан, строк нет",
+			enc: BeancountEncoder{
+				From: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC),
+			},
+			accs:     []BeancountAccount{{Name: "Карта", Opening: decimal.NewFromInt(-3), Rows: SliceRows(nil)}},
+			balances: []string{"2024-06-01 Assets:Karta -3.00 RUB"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := tt.enc.EncodeAccounts(&b, tt.accs); err != nil {
+				t.Fatal(err)
+			}
+			got := checkBeancount(t, b.String())
+			if !reflect.DeepEqual(got, tt.balances) {
+				t.Errorf("balances:\n got %q\nwant %q\nfile:\n%s", got, tt.balances, b.String())
+			}
+		})
+	}
+}
+
+func TestBeancountBadCurrency(t *testing.T) {
+	_, err := EncodeRows(BeancountEncoder{Currency: "руб"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "bad currency") {
+		t.Fatalf("err = %v, want bad currency", err)
+	}
+}
+
+// checkBeancount — упрощённый bean-check: счёт открыт до первой проводки,
+// проводки транзакции дают ноль, balance совпадает с суммой проводок по счёту.
+// Возвращает директивы balance в виде "дата счёт сумма валюта".
+func checkBeancount(t *testing.T, src string) []string {
+	t.Helper()
+	opened := map[string]bool{}
+	sums := map[string]decimal.Decimal{}
+	var balances []string
+	txn, txnLine := decimal.Zero, 0
+	closeTxn := func() {
+		if txnLine > 0 && !txn.IsZero() {
+			t.Errorf("строка %d: транзакция не сбалансирована: %s", txnLine, txn)
+		}
+		txn, txnLine = decimal.Zero, 0
+	}
+	sc := bufio.NewScanner(strings.NewReader(src))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		f := strings.Fields(line)
+		switch {
+		case len(f) == 0:
+			closeTxn()
+		case len(f) >= 3 && f[1] == "open":
+			opened[f[2]] = true
+		case len(f) >= 2 && f[1] == "*":
+			closeTxn()
+			txnLine = n
+		case len(f) == 5 && f[1] == "balance":
+			if want := sums[f[2]]; !want.Equal(decimal.RequireFromString(f[3])) {
+				t.Errorf("строка %d: balance %s %s, а по проводкам %s", n, f[2], f[3], want)
+			}
+			balances = append(balances, strings.Join([]string{f[0], f[2], f[3], f[4]}, " "))
+		case txnLine > 0 && strings.HasPrefix(line, "  ") && len(f) == 3:
+			if !opened[f[0]] {
+				t.Errorf("строка %d: счёт %s не открыт", n, f[0])
+			}
+			amt := decimal.RequireFromString(f[1])
+			txn = txn.Add(amt)
+			sums[f[0]] = sums[f[0]].Add(amt)
+		}
+	}
+	closeTxn()
+	return balances
+}
+
+func TestBeancountComponent(t *testing.T) {
+	for in, want := range map[string]string{
+		"еда вне дома":  "Eda-Vne-Doma",
+		"Щи и борщ":     "Shchi-I-Borshch",
+		"Ёлка 2024":     "Yolka-2024",
+		"  Такси/метро": "Taksi-Metro",
+		"Café":          "Caf",
+		"!!!":           "",
+	} {
+		if got := beancountComponent(in); got != want {
+			t.Errorf("beancountComponent(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBeancountNamer(t *testing.T) {
+	n := beancountNamer{names: BeancountNames{"Продукты": "Food:Groceries"}, used: map[string]string{}}
+	tests := []struct {
+		root, name, want string
+	}{
+		{LedgerExpenses, "Продукты", "Expenses:Food:Groceries"},
+		{LedgerExpenses, "Авто:Бензин", "Expenses:Avto:Benzin"},
+		{LedgerExpenses, "Авто:Бензин", "Expenses:Avto:Benzin"},
+		{LedgerExpenses, "Avto: Benzin", "Expenses:Avto:Benzin-2"},
+		{LedgerIncome, "Авто:Бензин", "Income:Avto:Benzin"},
+		{LedgerExpenses, "???", "Expenses:Other"},
+	}
+	for _, tt := range tests {
+		if got := n.account(tt.root, tt.name); got != tt.want {
+			t.Errorf("account(%q, %q) = %q, want %q", tt.root, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadBeancountNames(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	tests := []struct {
+		name, path string
+		want       BeancountNames
+		err        string
+	}{
+		{name: "нет файла", path: filepath.Join(dir, "missing.yaml"), want: BeancountNames{}},
+		{name: "пустой", path: write("empty.yaml", "# ничего\n"), want: BeancountNames{}},
+		{name: "словарь", path: write("ok.yaml", "names:\n  Еда: Food\n  Такси: Transport:Taxi\n"),
+			want: BeancountNames{"Еда": "Food", "Такси": "Transport:Taxi"}},
+		{name: "плохое имя", path: write("bad.yaml", "names:\n  Еда: food\n"), err: "not a valid beancount account name"},
+		{name: "не YAML", path: write("broken.yaml", "names: [\n"), err: "broken.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadBeancountNames(tt.path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package files
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CAMTImporter читает выписки ISO 20022 camt.053 (BkToCstmrStmt, версии 001.02–001.08).
+// Каждая проведённая запись (Ntry) — строка: CdtDbtInd задаёт тип, BookgDt — дату,
+// RmtInf и имя контрагента — описание. Запись с несколькими TxDtls (пакетный платёж)
+// делится на строки по суммам транзакций. OPBD/CLBD становятся остатками выписки,
+// IBAN счёта — номером, по которому меню находит счёт.
+type CAMTImporter struct {
+	DefaultCategory string
+}
+
+// sniffCAMT: пространство имён camt.053 или корневой элемент выписки.
+func sniffCAMT(head []byte) bool {
+	return bytes.Contains(head, []byte("camt.053")) || bytes.Contains(head, []byte("<BkToCstmrStmt"))
+}
+
+var camtFormat = fieldFormat{dateLayout: "2006-01-02", dateHint: "ГГГГ-ММ-ДД", signed: 1}
+
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	ID       string        `xml:"Id"`
+	IBAN     string        `xml:"Acct>Id>IBAN"`
+	Other    string        `xml:"Acct>Id>Othr>Id"`
+	Currency string        `xml:"Acct>Ccy"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// day — дата без времени: "2025-01-15T10:00:00+03:00" → "2025-01-15".
+func (d camtDate) day() string {
+	s := strings.TrimSpace(d.Date)
+	if s == "" {
+		s = strings.TrimSpace(d.DateTime)
+	}
+	if len(s) > 10 {
+		s = s[:10]
+	}
+	return s
+}
+
+type camtBalance struct {
+	Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    camtAmount `xml:"Amt"`
+	Indicator string     `xml:"CdtDbtInd"`
+	Date      camtDate   `xml:"Dt"`
+}
+
+type camtParty struct {
+	Name    string `xml:"Nm"`
+	PtyName string `xml:"Pty>Nm"` // camt.053.001.08
+}
+
+func (p camtParty) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.PtyName
+}
+
+type camtTx struct {
+	Amount       *camtAmount `xml:"Amt"`
+	TxAmount     *camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	Indicator    string      `xml:"CdtDbtInd"`
+	Ref          string      `xml:"Refs>AcctSvcrRef"`
+	Debtor       camtParty   `xml:"RltdPties>Dbtr"`
+	Creditor     camtParty   `xml:"RltdPties>Cdtr"`
+	Unstructured []string    `xml:"RmtInf>Ustrd"`
+	CreditorRef  []string    `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Additional   string      `xml:"AddtlTxInf"`
+}
+
+func (t camtTx) amount() *camtAmount {
+	if t.Amount != nil {
+		return t.Amount
+	}
+	return t.TxAmount
+}
+
+type camtEntry struct {
+	Ref        string     `xml:"NtryRef"`
+	Amount     camtAmount `xml:"Amt"`
+	Indicator  string     `xml:"CdtDbtInd"`
+	Reversal   bool       `xml:"RvslInd"`
+	Status     camtStatus `xml:"Sts"`
+	Booking    camtDate   `xml:"BookgDt"`
+	Value      camtDate   `xml:"ValDt"`
+	ServicerRf string     `xml:"AcctSvcrRef"`
+	Txs        []camtTx   `xml:"NtryDtls>TxDtls"`
+	Additional string     `xml:"AddtlNtryInf"`
+}
+
+// camtStatus: "<Sts>BOOK</Sts>" до 001.08 и "<Sts><Cd>BOOK</Cd></Sts>" начиная с неё.
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+func (e camtEntry) status() string {
+	s := strings.TrimSpace(e.Status.Code)
+	if s == "" {
+		s = strings.TrimSpace(e.Status.Text)
+	}
+	return strings.ToUpper(s)
+}
+
+// camtSpan — где в файле лежит элемент: строка начала и смещения для исходного текста.
+type camtSpan struct {
+	line       int
+	start, end int64
+}
+
+// decode читает файл целиком: XML выписки разбирается в структуры за один вызов.
+func (im CAMTImporter) decode(r io.Reader, res *Parsed) error {
+	data, err := readAll(r, "camt.053")
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	var doc camtDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("camt.053: %w", err)
+	}
+	if len(doc.Statements) == 0 {
+		return errors.New("camt.053: в файле нет выписок (BkToCstmrStmt/Stmt)")
+	}
+	spans, err := camtEntrySpans(data)
+	if err != nil {
+		return err
+	}
+	category := im.DefaultCategory
+	if strings.TrimSpace(category) == "" {
+		category = NoCategory
+	}
+
+	record := 0
+	for si, stmt := range doc.Statements {
+		st := Statement{Account: strings.ReplaceAll(stmt.IBAN, " ", ""), Currency: stmt.Currency}
+		if st.Account == "" {
+			st.Account = strings.TrimSpace(stmt.Other)
+		}
+		for _, b := range stmt.Balances {
+			bal, err := camtBalanceOf(b)
+			if err != nil {
+				return fmt.Errorf("camt.053: выписка %s: остаток %s: %w", stmt.ID, b.Code, err)
+			}
+			switch strings.ToUpper(b.Code) {
+			case "OPBD":
+				st.Opening = &bal
+			case "PRCD": // остаток прошлой выписки — если OPBD нет
+				if st.Opening == nil {
+					st.Opening = &bal
+				}
+			case "CLBD":
+				st.Closing = &bal
+			}
+		}
+		res.Statements = append(res.Statements, st)
+
+		for _, e := range stmt.Entries {
+			record++
+			var sp camtSpan
+			if record <= len(spans) {
+				sp = spans[record-1]
+			}
+			source := strings.TrimSpace(string(data[sp.start:sp.end]))
+			if s := e.status(); s != "" && s != "BOOK" {
+				res.Records++
+				res.reject(sp.line, record, "status", s, "запись не проведена банком", source)
+				continue
+			}
+			if c := e.Amount.Currency; c != "" && st.Currency != "" && !strings.EqualFold(c, st.Currency) {
+				res.Records++
+				res.reject(sp.line, record, "currency", c, "валюта записи не совпадает с валютой счёта "+st.Currency, source)
+				continue
+			}
+			for _, r := range im.rows(e, category) {
+				r.Statement = si
+				res.addWith(camtFormat, sp.line, record, r, source)
+			}
+		}
+	}
+	return nil
+}
+
+// rows — строки записи: одна или, для пакета с суммами у каждой транзакции, по одной на транзакцию.
+func (im CAMTImporter) rows(e camtEntry, category string) []rawRow {
+	date := e.Booking.day()
+	if date == "" {
+		date = e.Value.day()
+	}
+	ref := strings.TrimSpace(e.ServicerRf)
+	if ref == "" {
+		ref = strings.TrimSpace(e.Ref)
+	}
+
+	split := len(e.Txs) > 1
+	for _, t := range e.Txs {
+		if a := t.amount(); a == nil || !strings.EqualFold(a.Currency, e.Amount.Currency) {
+			split = false
+		}
+	}
+	if !split {
+		var tx camtTx
+		if len(e.Txs) == 1 {
+			tx = e.Txs[0]
+		}
+		desc := camtDescription(e.Indicator, tx)
+		if desc == "" {
+			desc = strings.TrimSpace(e.Additional)
+		}
+		return []rawRow{{
+			Amount:      camtSigned(e.Amount, e.Indicator, e.Reversal),
+			Date:        date,
+			Category:    category,
+			Description: desc,
+			ExternalID:  ref,
+		}}
+	}
+
+	out := make([]rawRow, 0, len(e.Txs))
+	for n, t := range e.Txs {
+		ind := t.Indicator
+		if ind == "" {
+			ind = e.Indicator
+		}
+		id := strings.TrimSpace(t.Ref)
+		if id == "" && ref != "" {
+			id = ref + "/" + strconv.Itoa(n+1)
+		}
+		out = append(out, rawRow{
+			Amount:      camtSigned(*t.amount(), ind, e.Reversal),
+			Date:        date,
+			Category:    category,
+			Description: camtDescription(ind, t),
+			ExternalID:  id,
+		})
+	}
+	return out
+}
+
+// camtSigned даёт сумму со знаком: DBIT — минус; RvslInd (сторно) меняет знак.
+func camtSigned(a camtAmount, ind string, reversal bool) string {
+	v := strings.TrimSpace(a.Value)
+	debit := strings.EqualFold(strings.TrimSpace(ind), "DBIT")
+	if reversal {
+		debit = !debit
+	}
+	if debit {
+		return "-" + v
+	}
+	return v
+}
+
+// camtDescription: контрагент (плательщик для прихода, получатель для расхода) и назначение платежа.
+func camtDescription(ind string, t camtTx) string {
+	party := t.Creditor.name()
+	if strings.EqualFold(strings.TrimSpace(ind), "CRDT") {
+		party = t.Debtor.name()
+	}
+	info := strings.TrimSpace(strings.Join(t.Unstructured, " "))
+	if info == "" {
+		info = strings.TrimSpace(strings.Join(t.CreditorRef, " "))
+	}
+	if info == "" {
+		info = strings.TrimSpace(t.Additional)
+	}
+	return joinDescription(party, info)
+}
+
+func camtBalanceOf(b camtBalance) (Balance, error) {
+	amt, err := decimal.NewFromString(strings.TrimSpace(b.Amount.Value))
+	if err != nil {
+		return Balance{}, fmt.Errorf("сумма %q: не число", b.Amount.Value)
+	}
+	if strings.EqualFold(strings.TrimSpace(b.Indicator), "DBIT") {
+		amt = amt.Neg()
+	}
+	var dt time.Time
+	if s := b.Date.day(); s != "" {
+		if dt, err = time.Parse("2006-01-02", s); err != nil {
+			return Balance{}, fmt.Errorf("дата %q: %w", s, err)
+		}
+	}
+	return Balance{Amount: amt, Date: dt}, nil
+}
+
+// camtEntrySpans находит все Ntry в порядке следования: xml.Unmarshal позиций не сохраняет.
+func camtEntrySpans(data []byte) ([]camtSpan, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var out []camtSpan
+	var open []int // индексы незакрытых Ntry
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("camt.053: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "Ntry" {
+				line := bytes.Count(data[:start], []byte("\n")) + 1
+				out = append(out, camtSpan{line: line, start: start})
+				open = append(open, len(out)-1)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "Ntry" && len(open) > 0 {
+				out[open[len(open)-1]].end = dec.InputOffset()
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,187 @@
+package files
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// camtDoc оборачивает выписки в документ camt.053.
+func camtDoc(stmts ...string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt>
+` + strings.Join(stmts, "\n") + `
+</BkToCstmrStmt>
+</Document>
+`
+}
+
+const camtBatch = `<Stmt><Id>S1</Id>
+<Acct><Id><IBAN>DE89 3704 0044 0532 0130 00</IBAN></Id><Ccy>EUR</Ccy></Acct>
+<Ntry>
+  <Amt Ccy="EUR">300.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts>
+  <BookgDt><Dt>2024-04-02</Dt></BookgDt><AcctSvcrRef>B1</AcctSvcrRef>
+  <NtryDtls>
+    <TxDtls><AmtDtls><TxAmt><Amt Ccy="EUR">100.00</Amt></TxAmt></AmtDtls>
+      <RltdPties><Cdtr><Nm>Иванов</Nm></Cdtr></RltdPties><RmtInf><Ustrd>Аренда</Ustrd></RmtInf></TxDtls>
+    <TxDtls><Amt Ccy="EUR">150.00</Amt><Refs><AcctSvcrRef>B1-X</AcctSvcrRef></Refs>
+      <RltdPties><Cdtr><Nm>Петров</Nm></Cdtr></RltdPties></TxDtls>
+    <TxDtls><Amt Ccy="EUR">50.00</Amt><CdtDbtInd>CRDT</CdtDbtInd>
+      <RltdPties><Dbtr><Nm>Сидоров</Nm></Dbtr></RltdPties></TxDtls>
+  </NtryDtls>
+</Ntry>
+</Stmt>`
+
+func TestCAMTImporter(t *testing.T) {
+	tests := []struct {
+		name       string
+		im         CAMTImporter
+		src        string
+		rows       []string
+		statements []string
+		stmtIndex  []int
+		issues     []string
+	}{
+		{
+			name: "остатки, приход и расход, 001.08",
+			im:   CAMTImporter{DefaultCategory: "Банк"},
+			src: camtDoc(`<Stmt><Id>S1</Id>
+<Acct><Id><Othr><Id>40817810</Id></Othr></Id><Ccy>RUB</Ccy></Acct>
+<Bal><Tp><CdOrPrtry><Cd>PRCD</Cd></CdOrPrtry></Tp><Amt Ccy="RUB">1.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2024-03-31</Dt></Dt></Bal>
+<Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="RUB">100.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Dt><Dt>2024-04-01</Dt></Dt></Bal>
+<Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="RUB">900.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><DtTm>2024-04-30T23:59:59+03:00</DtTm></Dt></Bal>
+<Ntry><NtryRef>N1</NtryRef><Amt Ccy="RUB">1000.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts><Cd>BOOK</Cd></Sts>
+  <BookgDt><DtTm>2024-04-05T10:00:00+03:00</DtTm></BookgDt>
+  <NtryDtls><TxDtls><RltdPties><Dbtr><Pty><Nm>ООО Ромашка</Nm></Pty></Dbtr></RltdPties>
+    <RmtInf><Strd><CdtrRefInf><Ref>INV-7</Ref></CdtrRefInf></Strd></RmtInf></TxDtls></NtryDtls>
+</Ntry>
+<Ntry><Amt Ccy="RUB">0.50</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts>
+  <ValDt><Dt>2024-04-06</Dt></ValDt><AddtlNtryInf>Комиссия</AddtlNtryInf>
+</Ntry>
+</Stmt>`),
+			rows: []string{
+				"1 1000.00 2024-04-05 Банк | ООО Ромашка — INV-7 | N1",
+				"-1 0.50 2024-04-06 Банк | Комиссия",
+			},
+			statements: []string{"40817810 RUB -100@2024-04-01→900@2024-04-30"},
+		},
+		{
+			name: "пакет делится по транзакциям",
+			src:  camtDoc(camtBatch),
+			rows: []string{
+				"-1 100.00 2024-04-02 Без категории | Иванов — Аренда | B1/1",
+				"-1 150.00 2024-04-02 Без категории | Петров | B1-X",
+				"1 50.00 2024-04-02 Без категории | Сидоров | B1/3",
+			},
+			statements: []string{"DE89370400440532013000 EUR -→-"},
+		},
+		{
+			name: "пакет без сумм транзакций — одной строкой",
+			src: camtDoc(`<Stmt><Acct><Ccy>EUR</Ccy></Acct>
+<Ntry><Amt Ccy="EUR">30</Amt><CdtDbtInd>DBIT</CdtDbtInd><BookgDt><Dt>2024-04-03</Dt></BookgDt><AddtlNtryInf>Пакет</AddtlNtryInf>
+  <NtryDtls><TxDtls><Amt Ccy="EUR">10</Amt></TxDtls><TxDtls></TxDtls></NtryDtls>
+</Ntry></Stmt>`),
+			rows:       []string{"-1 30.00 2024-04-03 Без категории | Пакет"},
+			statements: []string{" EUR -→-"},
+		},
+		{
+			name: "сторно меняет знак, в том числе в пакете",
+			src: camtDoc(`<Stmt><Acct><Ccy>EUR</Ccy></Acct>
+<Ntry><Amt Ccy="EUR">25.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><RvslInd>true</RvslInd><BookgDt><Dt>2024-04-07</Dt></BookgDt>
+  <AcctSvcrRef>R1</AcctSvcrRef><AddtlNtryInf>Сторно зачисления</AddtlNtryInf></Ntry>
+<Ntry><Amt Ccy="EUR">25.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><RvslInd>true</RvslInd><BookgDt><Dt>2024-04-08</Dt></BookgDt>
+  <AcctSvcrRef>R2</AcctSvcrRef>
+  <NtryDtls><TxDtls><Amt Ccy="EUR">20</Amt></TxDtls><TxDtls><Amt Ccy="EUR">5</Amt><CdtDbtInd>CRDT</CdtDbtInd></TxDtls></NtryDtls>
+</Ntry></Stmt>`),
+			rows: []string{
+				"-1 25.00 2024-04-07 Без категории | Сторно зачисления | R1",
+				"1 20.00 2024-04-08 Без категории |  | R2/1",
+				"-1 5.00 2024-04-08 Без категории |  | R2/2",
+			},
+			statements: []string{" EUR -→-"},
+		},
+		{
+			name: "непроведённые и в чужой валюте отклоняются",
+			src: camtDoc(`<Stmt><Acct><Ccy>EUR</Ccy></Acct>
+<Ntry><Amt Ccy="EUR">1</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>PDNG</Sts><BookgDt><Dt>2024-04-09</Dt></BookgDt></Ntry>
+<Ntry><Amt Ccy="USD">2</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-04-09</Dt></BookgDt></Ntry>
+<Ntry><Amt Ccy="EUR">3</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2024-04-09</Dt></BookgDt></Ntry>
+</Stmt>`),
+			rows:       []string{"-1 3.00 2024-04-09 Без категории | "},
+			statements: []string{" EUR -→-"},
+			issues: []string{
+				"1 status: запись не проведена банком",
+				"2 currency: валюта записи не совпадает с валютой счёта EUR",
+			},
+		},
+		{
+			name: "несколько выписок",
+			src: camtDoc(camtBatch, `<Stmt><Acct><Id><IBAN>GB00</IBAN></Id><Ccy>GBP</Ccy></Acct>
+<Ntry><Amt Ccy="GBP">7</Amt><CdtDbtInd>CRDT</CdtDbtInd><BookgDt><Dt>2024-04-10</Dt></BookgDt></Ntry></Stmt>`),
+			rows: []string{
+				"-1 100.00 2024-04-02 Без категории | Иванов — Аренда | B1/1",
+				"-1 150.00 2024-04-02 Без категории | Петров | B1-X",
+				"1 50.00 2024-04-02 Без категории | Сидоров | B1/3",
+				"1 7.00 2024-04-10 Без категории | ",
+			},
+			statements: []string{"DE89370400440532013000 EUR -→-", "GB00 GBP -→-"},
+			stmtIndex:  []int{0, 0, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := decodeString(t, tt.im, tt.src)
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n got %q\nwant %q", got, tt.rows)
+			}
+			if got := statementsText(res.Statements); !reflect.DeepEqual(got, tt.statements) {
+				t.Errorf("statements:\n got %q\nwant %q", got, tt.statements)
+			}
+			if got := issuesText(res.Issues); !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("issues:\n got %q\nwant %q", got, tt.issues)
+			}
+			if tt.stmtIndex != nil {
+				var got []int
+				for _, r := range res.Rows {
+					got = append(got, r.Statement)
+				}
+				if !reflect.DeepEqual(got, tt.stmtIndex) {
+					t.Errorf("statement index: got %v, want %v", got, tt.stmtIndex)
+				}
+			}
+		})
+	}
+}
+
+func TestCAMTEntryLines(t *testing.T) {
+	res := decodeString(t, CAMTImporter{}, camtDoc(`<Stmt><Acct><Ccy>EUR</Ccy></Acct>
+<Ntry><Amt Ccy="EUR">1</Amt><CdtDbtInd>DBIT</CdtDbtInd><BookgDt><Dt>2024-04-09</Dt></BookgDt></Ntry>
+<Ntry><Amt Ccy="EUR">x</Amt><CdtDbtInd>DBIT</CdtDbtInd><BookgDt><Dt>2024-04-09</Dt></BookgDt></Ntry>
+</Stmt>`))
+	if len(res.Rows) != 1 || res.Rows[0].Line != 5 {
+		t.Fatalf("rows = %+v, want one row on line 5", res.Rows)
+	}
+	if len(res.Issues) != 1 || res.Issues[0].Line != 6 || !strings.HasPrefix(res.Issues[0].Source, "<Ntry>") {
+		t.Fatalf("issues = %+v, want amount issue on line 6 with entry source", res.Issues)
+	}
+}
+
+func TestCAMTImporterErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"не XML", "<Document><BkToCstmrStmt>", "camt.053"},
+		{"нет выписок", camtDoc(), "нет выписок"},
+		{"плохой остаток", camtDoc(`<Stmt><Id>S9</Id><Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt>abc</Amt></Bal></Stmt>`), "выписка S9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res Parsed
+			err := CAMTImporter{}.decode(strings.NewReader(tt.src), &res)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package files
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// CoinKeeperImporter читает CSV-выгрузку CoinKeeper (английский или русский
+// заголовок). Тип записи задаёт, что в колонках «Из» и «В»: доход — из
+// источника (он и есть категория) в счёт, расход — из счёта в категорию,
+// перевод — из счёта в счёт. Сумма «Из» — в валюте «Из»; сумма в валюте
+// конвертации, если есть, — это сумма стороны «В». Метки и примечание идут
+// в описание. Таблицы итогов после списка операций не читаются.
+type CoinKeeperImporter struct {
+	DefaultCategory string // для записей без категории; "" — NoCategory
+}
+
+var coinKeeperColumns = map[string][]string{
+	"date":         {"date", "data", "данные", "дата"},
+	"type":         {"type", "тип"},
+	"from":         {"from", "из"},
+	"to":           {"to", "в"},
+	"tags":         {"tags", "метки"},
+	"amount":       {"amount", "сумма"},
+	"currency":     {"currency", "валюта"},
+	"converted":    {"amount converted", "сумма в валюте конвертации", "сумма в валюте"},
+	"convCurrency": {"currency of conversion", "валюта конвертации"},
+	"note":         {"note", "примечание", "комментарий"},
+}
+
+// coinKeeperTypes — значения колонки «Тип».
+var coinKeeperTypes = map[string]string{
+	"income": "income", "доход": "income",
+	"expense": "expense", "расход": "expense",
+	"transfer": "transfer", "перевод": "transfer",
+}
+
+func sniffCoinKeeper(head []byte) bool {
+	cells := headerCells(head)
+	return (slices.Contains(cells, "from") && slices.Contains(cells, "tags")) ||
+		(slices.Contains(cells, "из") && slices.Contains(cells, "метки"))
+}
+
+// decode читает файл целиком: записи сортируются по дате.
+func (im CoinKeeperImporter) decode(in io.Reader, res *Parsed) error {
+	cols, recs, err := readAppCSV(in, "coinkeeper", coinKeeperColumns,
+		[]string{"date", "type", "from", "to", "amount"}, true)
+	if err != nil {
+		return err
+	}
+	book := newAppBook(res)
+	for _, rec := range recs {
+		if err := res.stopped(); err != nil {
+			return err
+		}
+		f := func(field string) string { return appField(rec.fields, cols, field) }
+		source := strings.Join(rec.fields, ",")
+
+		typ, ok := coinKeeperTypes[strings.ToLower(f("type"))]
+		if !ok {
+			res.Records++
+			res.reject(rec.line, rec.record, "type", f("type"), "ожидается доход, расход или перевод", source)
+			continue
+		}
+		amount, err := appAmount(f("amount"))
+		if err != nil || !amount.IsPositive() {
+			res.Records++
+			res.reject(rec.line, rec.record, "amount", f("amount"), "сумма должна быть > 0", source)
+			continue
+		}
+		toAmount, toCurrency := amount, f("currency")
+		if conv, err := appAmount(f("converted")); err == nil && conv.IsPositive() {
+			toAmount = conv
+			if c := f("convCurrency"); c != "" {
+				toCurrency = c
+			}
+		}
+
+		var tags string
+		if t := splitList(f("tags")); len(t) > 0 {
+			tags = "метки: " + strings.Join(t, ", ")
+		}
+		desc := joinNonEmpty("; ", f("note"), tags)
+		date := appDate(f("date"))
+		from := appEntry{account: f("from"), currency: f("currency"), amount: amount}
+		to := appEntry{account: f("to"), currency: toCurrency, amount: toAmount}
+
+		switch typ {
+		case "income":
+			to.typ, to.category = 1, defaultCategory(firstNonEmpty(from.account, im.DefaultCategory))
+			book.add(rec, source, date, desc, to)
+		case "expense":
+			from.typ, from.category = -1, defaultCategory(firstNonEmpty(to.account, im.DefaultCategory))
+			book.add(rec, source, date, desc, from)
+		case "transfer":
+			book.transfer(rec, source, from, to, date, desc)
+		}
+	}
+	if len(recs) == 0 {
+		return fmt.Errorf("coinkeeper: в файле нет операций")
+	}
+	return nil
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// splitList — непустые элементы списка через запятую.
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package files
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const coinKeeperHeader = "Date,Type,From,To,Tags,Amount,Currency,Amount converted,Currency of conversion,Note\n"
+
+func TestCoinKeeperImporter(t *testing.T) {
+	tests := []struct {
+		name       string
+		im         CoinKeeperImporter
+		src        string
+		rows       []string
+		statements []string
+		stmtIndex  []int
+		issues     []string
+	}{
+		{
+			name: "доход, расход, переводы; таблица итогов отрезается",
+			src: coinKeeperHeader +
+				"03/05/2024,Transfer,Card,Savings,,100,USD,,,\n" +
+				`03/01/2024,Expense,Card,Food,"lunch, work",12.50,USD,,,cafe` + "\n" +
+				"03/02/2024,Income,Salary,Card,,1000,USD,,,\n" +
+				"03/04/2024,Transfer,Card,Euro,,110,USD,100,EUR,exchange\n" +
+				"\n" +
+				"Account,Balance\n" +
+				"Card,777\n" +
+				"03/06/2024,Expense,Card,Food,,1,USD,,,\n",
+			rows: []string{
+				"-1 12.50 2024-03-01 Food | cafe; метки: lunch, work",
+				"1 1000.00 2024-03-02 Salary | ",
+				"-1 110.00 2024-03-04 Перевод: Euro | exchange",
+				"1 100.00 2024-03-04 Перевод: Card | exchange",
+				"-1 100.00 2024-03-05 Перевод: Savings | ",
+				"1 100.00 2024-03-05 Перевод: Card | ",
+			},
+			statements: []string{"Card USD -→-", "Euro EUR -→-", "Savings USD -→-"},
+			stmtIndex:  []int{0, 0, 0, 1, 0, 2},
+		},
+		{
+			name: "русский заголовок, ошибки записей",
+			src: "Дата;Тип;Из;В;Метки;Сумма;Валюта;Сумма в валюте конвертации;Валюта конвертации;Примечание\n" +
+				"01.02.2024;Расход;Карта;;;100;RUB;;;\n" +
+				"02.02.2024;Покупка;Карта;Еда;;100;RUB;;;\n" +
+				"03.02.2024;Расход;Карта;Еда;;-5;RUB;;;\n" +
+				"04.02.2024;Доход;;Карта;;50;RUB;;;премия\n" +
+				"05.02.2024;Расход;Карта;Еда;;12,50;RUB;;;\n" +
+				"Итого;;\n",
+			rows: []string{
+				"-1 100.00 2024-02-01 Без категории | ",
+				"1 50.00 2024-02-04 Без категории | премия",
+				"-1 12.50 2024-02-05 Еда | ",
+			},
+			statements: []string{"Карта RUB -→-"},
+			issues: []string{
+				"2 type: ожидается доход, расход или перевод",
+				"3 amount: сумма должна быть > 0",
+			},
+		},
+		{
+			name: "чужая валюта счёта отклоняет перевод целиком",
+			im:   CoinKeeperImporter{DefaultCategory: "Разное"},
+			src: coinKeeperHeader +
+				"2024-01-01,Expense,Card,,,5,USD,,,\n" +
+				"2024-01-02,Transfer,Cash,Card,,5,USD,4,EUR,\n" +
+				"2024-01-03,Income,,card,,7,usd,,,\n",
+			rows: []string{
+				"-1 5.00 2024-01-01 Разное | ",
+				"1 7.00 2024-01-03 Разное | ",
+			},
+			statements: []string{"Card USD -→-", "Cash USD -→-"},
+			stmtIndex:  []int{0, 0},
+			issues:     []string{"2 currency: валюта EUR, а счёт «Card» в файле в USD"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := decodeString(t, tt.im, tt.src)
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n got %q\nwant %q", got, tt.rows)
+			}
+			if got := statementsText(res.Statements); !reflect.DeepEqual(got, tt.statements) {
+				t.Errorf("statements:\n got %q\nwant %q", got, tt.statements)
+			}
+			if got := issuesText(res.Issues); !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("issues:\n got %q\nwant %q", got, tt.issues)
+			}
+			if tt.stmtIndex != nil {
+				var got []int
+				for _, r := range res.Rows {
+					got = append(got, r.Statement)
+				}
+				if !reflect.DeepEqual(got, tt.stmtIndex) {
+					t.Errorf("statement index: got %v, want %v", got, tt.stmtIndex)
+				}
+			}
+		})
+	}
+}
+
+func TestCoinKeeperImporterErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"нет операций", coinKeeperHeader + "\nAccount,Balance\n", "coinkeeper: в файле нет операций"},
+		{"нет колонки", "Date,Type,From,To\n", `в заголовке нет колонки "amount"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res Parsed
+			err := CoinKeeperImporter{}.decode(strings.NewReader(tt.src), &res)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffCoinKeeper(t *testing.T) {
+	for src, want := range map[string]bool{
+		coinKeeperHeader: true,
+		"Дата;Тип;Из;В;Метки;Сумма\n": true,
+		zenmoneyHeader:          false,
+		"date,from,to,amount\n": false,
+	} {
+		if got := sniffCoinKeeper([]byte(src)); got != want {
+			t.Errorf("sniffCoinKeeper(%q) = %v, want %v", src, got, want)
+		}
+	}
+}
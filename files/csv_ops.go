@@ -2,100 +2,190 @@ package files
 
 import (
 	"bytes"
-	"context"
 	"encoding/csv"
+	"fmt"
+	"io"
 	"strconv"
-	"time"
-
-	"main/domain"
-	"main/repo"
-
-	"github.com/shopspring/decimal"
+	"strings"
 )
 
-type CSVEncoder struct{}
+// CSVEncoder пишет выбранные колонки; nil — DefaultColumns.
+type CSVEncoder struct {
+	Columns []string
+}
 
-func (CSVEncoder) EncodeRows(rows []Row) ([]byte, error) {
-	buf := &bytes.Buffer{}
-	w := csv.NewWriter(buf)
+func (e CSVEncoder) Encode(out io.Writer, rows RowSeq) error {
+	w := csv.NewWriter(out)
+	cols := columns(e.Columns)
 
-	if err := w.Write([]string{"type", "amount", "date", "category", "description"}); err != nil {
-		return nil, err
+	if err := w.Write(cols); err != nil {
+		return err
 	}
 
-	for _, r := range rows {
-		rec := []string{
-			strconv.Itoa(r.Type),
-			r.Amount.StringFixed(2),
-			r.Date.Format("2006-01-02"),
-			r.Category,
-			r.Description,
+	rec := make([]string, len(cols))
+	for r, err := range rows {
+		if err != nil {
+			return err
+		}
+		for i, c := range cols {
+			rec[i] = fmt.Sprint(rowValue(r, c))
 		}
 		if err := w.Write(rec); err != nil {
-			return nil, err
+			return err
 		}
 	}
 	w.Flush()
-	if err := w.Error(); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+	return w.Error()
 }
 
-func ExportOperationsCSV(
-	ctx context.Context,
-	ops *repo.PgOperationRepo,
-	cats *repo.PgCategoryRepo,
-	accID domain.AccountID,
-	from, to time.Time,
-	path string,
-) error {
-	return ExportOperations(ctx, ops, cats, accID, from, to, path, CSVEncoder{})
+// CSVImporter читает CSV по профилю; нулевое значение — DefaultCSVProfile.
+type CSVImporter struct {
+	Profile *CSVProfile
 }
 
-type CSVImporter struct{}
+// sniffCSV: в первой строке есть разделитель. Проверяется последним — под это
+// правило подходит почти любой текст.
+func sniffCSV(head []byte) bool {
+	first, _, _ := bytes.Cut(head, []byte("\n"))
+	return bytes.ContainsAny(first, ",;\t") && !bytes.ContainsAny(first[:min(1, len(first))], "[{<-!:#")
+}
 
-func (CSVImporter) parse(data []byte) ([]Row, error) {
-	r := csv.NewReader(bytes.NewReader(data))
-	rows, err := r.ReadAll()
-	if err != nil {
-		return nil, err
+func (im CSVImporter) decode(in io.Reader, res *Parsed) error {
+	p := DefaultCSVProfile
+	if im.Profile != nil {
+		p = *im.Profile
 	}
-	if len(rows) <= 1 {
-		return nil, nil
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("csv: профиль %q: %w", p.Name, err)
 	}
+	decode, _ := decoderFor(p.Encoding)
+	comma, _ := p.delimiter()
+	ff := p.format()
 
-	out := make([]Row, 0, len(rows)-1)
-	for i := 1; i < len(rows); i++ {
-		rec := rows[i]
-		if len(rec) < 5 {
+	r := csv.NewReader(decode(in))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	var cols map[string]int // поле → индекс колонки
+	var err error
+	if p.HeaderRow == 0 {
+		if cols, err = p.resolve(nil); err != nil {
+			return err
+		}
+	}
+	for n, record := 0, 0; ; {
+		if err := res.stopped(); err != nil {
+			return err
+		}
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		n++
+		if perr, ok := err.(*csv.ParseError); ok && perr.Err != csv.ErrFieldCount {
+			if n <= p.HeaderRow {
+				return fmt.Errorf("csv: заголовок: %w", err)
+			}
+			record++
+			res.Records++
+			res.reject(perr.Line, record, "", "", perr.Err.Error(), "")
 			continue
 		}
-
-		t, err := strconv.Atoi(rec[0])
 		if err != nil {
+			return fmt.Errorf("csv: %s: %w", p.Encoding, err)
+		}
+		line, _ := r.FieldPos(0)
+		if n < p.HeaderRow {
 			continue
 		}
-		amt, err := decimal.NewFromString(rec[1])
-		if err != nil {
+		if n == p.HeaderRow {
+			if cols, err = p.resolve(rec); err != nil {
+				return err
+			}
 			continue
 		}
-		dt, err := time.Parse("2006-01-02", rec[2])
-		if err != nil {
+		record++
+		source := strings.Join(rec, string(comma))
+		raw, missing := p.extract(rec, cols)
+		if missing != "" {
+			res.Records++
+			res.reject(line, record, missing, "", fmt.Sprintf("нет колонки (в строке %d колонок)", len(rec)), source)
 			continue
 		}
-		out = append(out, Row{
-			Type:        t,
-			Amount:      amt.Round(2),
-			Date:        dt,
-			Category:    rec[3],
-			Description: rec[4],
-		})
+		res.addWith(ff, line, record, raw, source)
 	}
-	return out, nil
+	return nil
 }
 
-func ImportOperationsCSV(path string) ([]Row, error) {
-	base := BaseImporter{parser: CSVImporter{}}
-	return base.Import(path)
+// resolve сопоставляет поля профиля с индексами колонок по заголовку или номерам.
+func (p CSVProfile) resolve(header []string) (map[string]int, error) {
+	names := map[string]int{}
+	for i, h := range header {
+		names[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	c := p.Columns
+	cols := map[string]int{}
+	for field, col := range map[string]string{
+		"type": c.Type, "amount": c.Amount, "debit": c.Debit, "credit": c.Credit,
+		"date": c.Date, "category": c.Category, "description": c.Description,
+	} {
+		if col == "" {
+			continue
+		}
+		if isIndex(col) {
+			cols[field], _ = strconv.Atoi(col)
+			cols[field]--
+			continue
+		}
+		i, ok := names[strings.ToLower(strings.TrimSpace(col))]
+		if !ok {
+			return nil, fmt.Errorf("csv: профиль %q: колонка %q (%s) не найдена в заголовке", p.Name, col, field)
+		}
+		cols[field] = i
+	}
+	return cols, nil
+}
+
+// extract достаёт поля записи; missing — первое обязательное поле, которого нет в строке.
+func (p CSVProfile) extract(rec []string, cols map[string]int) (raw rawRow, missing string) {
+	get := func(field string) (string, bool) {
+		i, ok := cols[field]
+		if !ok {
+			return "", true
+		}
+		if i >= len(rec) {
+			return "", false
+		}
+		return strings.TrimSpace(rec[i]), true
+	}
+	var ok bool
+	for _, f := range []struct {
+		name string
+		dst  *string
+	}{
+		{"type", &raw.Type}, {"amount", &raw.Amount}, {"date", &raw.Date},
+		{"category", &raw.Category}, {"description", &raw.Description},
+	} {
+		if *f.dst, ok = get(f.name); !ok && f.name != "description" && f.name != "category" {
+			return raw, f.name
+		}
+	}
+
+	if p.sign() == SignDebitCredit {
+		debit, ok1 := get("debit")
+		credit, ok2 := get("credit")
+		if !ok1 && !ok2 {
+			return raw, "debit"
+		}
+		if amt, err := parseAmount(debit, p.DecimalComma); debit != "" && (err != nil || !amt.IsZero()) {
+			raw.Type, raw.Amount = "-1", strings.TrimPrefix(debit, "-")
+		} else {
+			raw.Type, raw.Amount = "1", credit
+		}
+	}
+	if raw.Category == "" {
+		raw.Category = p.DefaultCategory
+	}
+	return raw, ""
 }
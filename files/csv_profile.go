@@ -0,0 +1,269 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+	"gopkg.in/yaml.v3"
+)
+
+// Способ определить тип операции.
+const (
+	SignTypeColumn  = "type"         // отдельная колонка типа (значения — IncomeValues/ExpenseValues)
+	SignSigned      = "signed"       // сумма со знаком: минус — расход
+	SignInverted    = "inverted"     // сумма со знаком: минус — доход
+	SignDebitCredit = "debit_credit" // две колонки: списание и зачисление
+)
+
+// CSVColumns — колонка задаётся именем из заголовка или номером с 1 ("3").
+type CSVColumns struct {
+	Type        string `yaml:"type"`
+	Amount      string `yaml:"amount"`
+	Debit       string `yaml:"debit"`  // для debit_credit: расход
+	Credit      string `yaml:"credit"` // для debit_credit: доход
+	Date        string `yaml:"date"`
+	Category    string `yaml:"category"`
+	Description string `yaml:"description"`
+}
+
+// CSVProfile описывает выгрузку конкретного банка.
+type CSVProfile struct {
+	Name            string     `yaml:"name"`
+	Delimiter       string     `yaml:"delimiter"`  // "," по умолчанию; "\t" — табуляция
+	Encoding        string     `yaml:"encoding"`   // utf-8 (по умолчанию), windows-1251, koi8-r
+	HeaderRow       int        `yaml:"header_row"` // строка заголовка (с 1), строки до неё пропускаются; 0 — без заголовка
+	Columns         CSVColumns `yaml:"columns"`
+	DateFormat      string     `yaml:"date_format"`   // dd.MM.yyyy, d.M.yyyy, yyyy-MM-dd HH:mm:ss или Go-раскладка
+	DecimalComma    bool       `yaml:"decimal_comma"` // "1 234,56"
+	Sign            string     `yaml:"sign"`
+	IncomeValues    []string   `yaml:"income_values"`  // для sign: type
+	ExpenseValues   []string   `yaml:"expense_values"` // для sign: type
+	DefaultCategory string     `yaml:"default_category"`
+}
+
+// DefaultCSVProfile — собственный формат экспорта: type,amount,date,category,description.
+var DefaultCSVProfile = CSVProfile{
+	Name:      "default",
+	Delimiter: ",",
+	Encoding:  "utf-8",
+	HeaderRow: 1,
+	Columns: CSVColumns{
+		Type: "1", Amount: "2", Date: "3", Category: "4", Description: "5",
+	},
+	DateFormat: "yyyy-MM-dd",
+	Sign:       SignTypeColumn,
+}
+
+type CSVProfiles []CSVProfile
+
+func (ps CSVProfiles) Get(name string) (CSVProfile, bool) {
+	for _, p := range ps {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return CSVProfile{}, false
+}
+
+// LoadCSVProfiles читает профили из YAML-файла; встроенный "default" всегда первый.
+// Отсутствующий файл — не ошибка.
+func LoadCSVProfiles(path string) (CSVProfiles, error) {
+	out := CSVProfiles{DefaultCSVProfile}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Profiles []CSVProfile `yaml:"profiles"`
+	}
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, p := range cfg.Profiles {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: профиль %q: %w", path, p.Name, err)
+		}
+		if _, dup := out.Get(p.Name); dup {
+			return nil, fmt.Errorf("%s: профиль %q объявлен дважды", path, p.Name)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (p CSVProfile) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("не задано имя профиля (name)")
+	}
+	if _, err := p.delimiter(); err != nil {
+		return err
+	}
+	if _, err := decoderFor(p.Encoding); err != nil {
+		return err
+	}
+	if _, err := p.dateLayout(); err != nil {
+		return err
+	}
+	if p.HeaderRow < 0 {
+		return errors.New("header_row должен быть >= 0")
+	}
+	c := p.Columns
+	if c.Date == "" {
+		return errors.New("не задана колонка даты (columns.date)")
+	}
+	switch p.sign() {
+	case SignTypeColumn:
+		if c.Type == "" || c.Amount == "" {
+			return errors.New("для sign: type нужны columns.type и columns.amount")
+		}
+	case SignSigned, SignInverted:
+		if c.Amount == "" {
+			return fmt.Errorf("для sign: %s нужна columns.amount", p.Sign)
+		}
+	case SignDebitCredit:
+		if c.Debit == "" || c.Credit == "" {
+			return errors.New("для sign: debit_credit нужны columns.debit и columns.credit")
+		}
+	default:
+		return fmt.Errorf("неизвестный sign %q: ожидается type, signed, inverted или debit_credit", p.Sign)
+	}
+	if c.Category == "" && strings.TrimSpace(p.DefaultCategory) == "" {
+		return errors.New("нужна колонка категории (columns.category) или default_category")
+	}
+	for _, col := range []string{c.Type, c.Amount, c.Debit, c.Credit, c.Date, c.Category, c.Description} {
+		if p.HeaderRow == 0 && col != "" && !isIndex(col) {
+			return fmt.Errorf("колонка %q: без header_row колонки задаются номерами с 1", col)
+		}
+	}
+	return nil
+}
+
+func (p CSVProfile) sign() string {
+	if p.Sign == "" {
+		return SignTypeColumn
+	}
+	return p.Sign
+}
+
+func (p CSVProfile) delimiter() (rune, error) {
+	switch p.Delimiter {
+	case "", ",":
+		return ',', nil
+	case `\t`, "\t", "tab":
+		return '\t', nil
+	}
+	r := []rune(p.Delimiter)
+	if len(r) != 1 || r[0] == '"' || r[0] == '\n' || r[0] == '\r' {
+		return 0, fmt.Errorf("разделитель %q: нужен один символ, кроме кавычки и перевода строки", p.Delimiter)
+	}
+	return r[0], nil
+}
+
+// layout — раскладка time.Parse для DateFormat; профиль уже проверен Validate.
+func (p CSVProfile) layout() string {
+	l, _ := p.dateLayout()
+	return l
+}
+
+// dateTokens — буквы шаблона dd.MM.yyyy по длине серии: "d" — день без
+// ведущего нуля, "dd" — с нулём и т.д.
+var dateTokens = map[string]string{
+	"yyyy": "2006", "yy": "06",
+	"MM": "01", "M": "1",
+	"dd": "02", "d": "2",
+	"HH": "15", "H": "15",
+	"mm": "04", "m": "4",
+	"ss": "05", "s": "5",
+}
+
+// dateLayout переводит dd.MM.yyyy, d.M.yyyy H:mm и подобные шаблоны в раскладку
+// time.Parse; строка с "2006" считается уже готовой раскладкой.
+func (p CSVProfile) dateLayout() (string, error) {
+	f := p.DateFormat
+	if f == "" {
+		return "2006-01-02", nil
+	}
+	if strings.Contains(f, "2006") {
+		return f, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(f); {
+		c := f[i]
+		if !strings.ContainsRune("yMdHms", rune(c)) {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		j := i
+		for j < len(f) && f[j] == c {
+			j++
+		}
+		l, ok := dateTokens[f[i:j]]
+		if !ok {
+			return "", fmt.Errorf("date_format %q: непонятный шаблон %q", f, f[i:j])
+		}
+		b.WriteString(l)
+		i = j
+	}
+	return b.String(), nil
+}
+
+func (p CSVProfile) format() fieldFormat {
+	ff := fieldFormat{dateLayout: p.layout(), dateHint: p.DateFormat, decimalComma: p.DecimalComma}
+	if ff.dateHint == "" {
+		ff.dateHint = canonicalFormat.dateHint
+	}
+	switch p.sign() {
+	case SignSigned:
+		ff.signed = 1
+	case SignInverted:
+		ff.signed = -1
+	case SignTypeColumn:
+		if len(p.IncomeValues) > 0 || len(p.ExpenseValues) > 0 {
+			ff.types = map[string]int{}
+			for _, v := range p.IncomeValues {
+				ff.types[strings.ToLower(strings.TrimSpace(v))] = 1
+			}
+			for _, v := range p.ExpenseValues {
+				ff.types[strings.ToLower(strings.TrimSpace(v))] = -1
+			}
+		}
+	}
+	return ff
+}
+
+// decoderFor — поток в UTF-8 из кодировки профиля; BOM в начале UTF-8 отбрасывается.
+func decoderFor(enc string) (func(io.Reader) io.Reader, error) {
+	switch strings.ToLower(strings.ReplaceAll(enc, "_", "-")) {
+	case "", "utf-8", "utf8":
+		return skipBOM, nil
+	case "windows-1251", "cp1251":
+		return charmap.Windows1251.NewDecoder().Reader, nil
+	case "koi8-r", "koi8r":
+		return charmap.KOI8R.NewDecoder().Reader, nil
+	}
+	return nil, fmt.Errorf("кодировка %q не поддерживается: utf-8, windows-1251 или koi8-r", enc)
+}
+
+func skipBOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(3); bytes.Equal(b, []byte("\xef\xbb\xbf")) {
+		br.Discard(3)
+	}
+	return br
+}
+
+func isIndex(col string) bool {
+	n, err := strconv.Atoi(col)
+	return err == nil && n > 0
+}
@@ -0,0 +1,258 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadCSVProfiles(t *testing.T) {
+	ps, err := LoadCSVProfiles("csv_profiles.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range ps {
+		names = append(names, p.Name)
+	}
+	want := []string{"default", "bank-signed", "bank-debit-credit", "bank-direction"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("profiles = %q, want %q", names, want)
+	}
+	if p, ok := ps.Get("BANK-SIGNED"); !ok || p.Encoding != "windows-1251" || !p.DecimalComma {
+		t.Errorf("Get(BANK-SIGNED) = %+v, %v", p, ok)
+	}
+
+	dir := t.TempDir()
+	ps, err = LoadCSVProfiles(filepath.Join(dir, "missing.yaml"))
+	if err != nil || len(ps) != 1 || ps[0].Name != "default" {
+		t.Errorf("missing file: %v, %v", ps, err)
+	}
+
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"плохой YAML", "profiles: [", "bad.yaml"},
+		{"неверный профиль", "profiles:\n  - name: x\n    columns: {amount: Сумма}\n", `профиль "x": не задана колонка даты`},
+		{"повтор встроенного", "profiles:\n  - name: Default\n    sign: signed\n    default_category: X\n    columns: {date: 1, amount: 2}\n", `профиль "Default" объявлен дважды`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "bad.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadCSVProfiles(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVProfileValidate(t *testing.T) {
+	valid := CSVProfile{
+		Name: "p", HeaderRow: 1, Sign: SignSigned, DefaultCategory: "Прочее",
+		Columns: CSVColumns{Date: "Дата", Amount: "Сумма"},
+	}
+	tests := []struct {
+		name string
+		edit func(p *CSVProfile)
+		want string // "" — профиль верный
+	}{
+		{"верный", func(p *CSVProfile) {}, ""},
+		{"табуляция", func(p *CSVProfile) { p.Delimiter = "tab" }, ""},
+		{"cp1251", func(p *CSVProfile) { p.Encoding = "CP1251" }, ""},
+		{"без имени", func(p *CSVProfile) { p.Name = " " }, "не задано имя профиля"},
+		{"длинный разделитель", func(p *CSVProfile) { p.Delimiter = ";;" }, `разделитель ";;": нужен один символ`},
+		{"кавычка-разделитель", func(p *CSVProfile) { p.Delimiter = `"` }, "нужен один символ, кроме кавычки"},
+		{"кодировка", func(p *CSVProfile) { p.Encoding = "latin1" }, `кодировка "latin1" не поддерживается`},
+		{"шаблон даты", func(p *CSVProfile) { p.DateFormat = "dd MMM yyyy" }, `непонятный шаблон "MMM"`},
+		{"header_row", func(p *CSVProfile) { p.HeaderRow = -1 }, "header_row должен быть >= 0"},
+		{"без даты", func(p *CSVProfile) { p.Columns.Date = "" }, "не задана колонка даты"},
+		{"type без колонки", func(p *CSVProfile) { p.Sign = "" }, "для sign: type нужны columns.type и columns.amount"},
+		{"inverted без суммы", func(p *CSVProfile) { p.Sign, p.Columns.Amount = SignInverted, "" }, "для sign: inverted нужна columns.amount"},
+		{"debit_credit", func(p *CSVProfile) { p.Sign, p.Columns.Debit = SignDebitCredit, "Списание" }, "нужны columns.debit и columns.credit"},
+		{"неизвестный sign", func(p *CSVProfile) { p.Sign = "plus" }, `неизвестный sign "plus"`},
+		{"без категории", func(p *CSVProfile) { p.DefaultCategory = "" }, "нужна колонка категории"},
+		{"имена без заголовка", func(p *CSVProfile) { p.HeaderRow = 0 }, `колонка "Сумма": без header_row колонки задаются номерами`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.edit(&p)
+			err := p.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVProfileLayout(t *testing.T) {
+	tests := []struct {
+		format, layout, value string
+		want                  time.Time
+	}{
+		{"", "2006-01-02", "2024-03-05", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"dd.MM.yyyy", "02.01.2006", "05.03.2024", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"d.M.yyyy", "2.1.2006", "5.3.2024", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"d.M.yyyy", "2.1.2006", "15.12.2024", time.Date(2024, 12, 15, 0, 0, 0, 0, time.UTC)},
+		{"dd/MM/yy H:m", "02/01/06 15:4", "05/03/24 9:7", time.Date(2024, 3, 5, 9, 7, 0, 0, time.UTC)},
+		{"yyyy-MM-dd HH:mm:ss", "2006-01-02 15:04:05", "2024-03-05 10:15:30", time.Date(2024, 3, 5, 10, 15, 30, 0, time.UTC)},
+		{"dd.MM.yyyy г.", "02.01.2006 г.", "05.03.2024 г.", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"02 Jan 2006", "02 Jan 2006", "05 Mar 2024", time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		p := CSVProfile{DateFormat: tt.format}
+		if got := p.layout(); got != tt.layout {
+			t.Errorf("layout(%q) = %q, want %q", tt.format, got, tt.layout)
+			continue
+		}
+		if got, err := time.Parse(p.layout(), tt.value); err != nil || !got.Equal(tt.want) {
+			t.Errorf("%q по %q = %v, %v; want %v", tt.value, tt.format, got, err, tt.want)
+		}
+	}
+}
+
+func TestCSVImporter(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *CSVProfile
+		src     string
+		rows    []string
+		issues  []string
+	}{
+		{
+			name: "профиль по умолчанию",
+			src: "type,amount,date,category,description\n" +
+				"1,100,2024-01-05,Зарплата,аванс\n" +
+				"-1,25.50,2024-01-06,Еда,\n" +
+				"2,1,2024-01-07,Прочее,\n",
+			rows: []string{
+				"1 100.00 2024-01-05 Зарплата | аванс",
+				"-1 25.50 2024-01-06 Еда | ",
+			},
+			issues: []string{"3 type: ожидается 1 (доход) или -1 (расход)"},
+		},
+		{
+			name: "sign: type со своими значениями",
+			profile: &CSVProfile{
+				Name: "direction", HeaderRow: 1, Sign: SignTypeColumn,
+				IncomeValues: []string{"Зачисление"}, ExpenseValues: []string{"Покупка"},
+				Columns: CSVColumns{Type: "Направление", Amount: "Сумма", Date: "Дата", Category: "Категория"},
+			},
+			src: "Направление,Сумма,Дата,Категория\n" +
+				"зачисление,10,2024-02-01,Подарки\n" +
+				"Покупка,5,2024-02-02,\n" +
+				"Перевод,1,2024-02-03,Прочее\n",
+			rows:   []string{"1 10.00 2024-02-01 Подарки | "},
+			issues: []string{"2 category: категория обязательна", "3 type: неизвестное значение типа операции"},
+		},
+		{
+			name: "signed: минус — расход, d.M.yyyy, десятичная запятая",
+			profile: &CSVProfile{
+				Name: "signed", Delimiter: ";", HeaderRow: 1, DateFormat: "d.M.yyyy", DecimalComma: true,
+				Sign: SignSigned, DefaultCategory: "Прочее",
+				Columns: CSVColumns{Date: "Дата", Amount: "Сумма", Description: "Описание"},
+			},
+			src: "Дата;Сумма;Описание\n" +
+				"5.3.2024;-1 234,50;Магазин\n" +
+				"15.12.2024;100;Кэшбэк\n" +
+				"6.3.2024;0;Ноль\n",
+			rows: []string{
+				"-1 1234.50 2024-03-05 Прочее | Магазин",
+				"1 100.00 2024-12-15 Прочее | Кэшбэк",
+			},
+			issues: []string{"3 amount: нулевая сумма"},
+		},
+		{
+			name: "inverted: минус — доход, без заголовка",
+			profile: &CSVProfile{
+				Name: "inverted", Sign: SignInverted,
+				Columns: CSVColumns{Date: "1", Amount: "2", Category: "3"},
+			},
+			src: "2024-01-01,-50,Возврат\n" +
+				"2024-01-02,20,Кафе\n" +
+				"2024-01-03\n",
+			rows: []string{
+				"1 50.00 2024-01-01 Возврат | ",
+				"-1 20.00 2024-01-02 Кафе | ",
+			},
+			issues: []string{"3 amount: нет колонки (в строке 1 колонок)"},
+		},
+		{
+			name: "debit_credit, шапка над заголовком, windows-1251",
+			profile: &CSVProfile{
+				Name: "debit-credit", Delimiter: ";", Encoding: "windows-1251", HeaderRow: 3,
+				DateFormat: "dd.MM.yyyy HH:mm", DecimalComma: true, Sign: SignDebitCredit, DefaultCategory: "Импорт",
+				Columns: CSVColumns{Date: "Дата", Debit: "Списание", Credit: "Зачисление", Description: "Назначение"},
+			},
+			src: mustEncode1251(t, "Выписка по счёту\nза март\n"+
+				"Дата;Списание;Зачисление;Назначение\n"+
+				"05.03.2024 10:15;500,00;;Аренда\n"+
+				"06.03.2024 09:00;;1 000,00;Зарплата\n"+
+				"07.03.2024 09:00;0,00;20,00;Возврат\n"+
+				"08.03.2024;1,00;;Комиссия\n"),
+			rows: []string{
+				"-1 500.00 2024-03-05 Импорт | Аренда",
+				"1 1000.00 2024-03-06 Импорт | Зарплата",
+				"1 20.00 2024-03-07 Импорт | Возврат",
+			},
+			issues: []string{"4 date: ожидается дата в формате dd.MM.yyyy HH:mm"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := decodeString(t, CSVImporter{Profile: tt.profile}, tt.src)
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n got %q\nwant %q", got, tt.rows)
+			}
+			if got := issuesText(res.Issues); !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("issues:\n got %q\nwant %q", got, tt.issues)
+			}
+		})
+	}
+}
+
+func TestCSVImporterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile CSVProfile
+		src     string
+		want    string
+	}{
+		{
+			name:    "неверный профиль",
+			profile: CSVProfile{Name: "bad", Columns: CSVColumns{Date: "1"}, Sign: "plus"},
+			src:     "2024-01-01,1\n",
+			want:    `csv: профиль "bad": неизвестный sign "plus"`,
+		},
+		{
+			name: "колонки нет в заголовке",
+			profile: CSVProfile{
+				Name: "p", HeaderRow: 1, Sign: SignSigned, DefaultCategory: "X",
+				Columns: CSVColumns{Date: "Дата", Amount: "Сумма"},
+			},
+			src:  "Дата,Amount\n2024-01-01,1\n",
+			want: `колонка "Сумма" (amount) не найдена в заголовке`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res Parsed
+			err := CSVImporter{Profile: &tt.profile}.decode(strings.NewReader(tt.src), &res)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"time"
+
+	"main/domain"
+	"main/repo"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Полная выгрузка данных пользователя: счета, категории с типом и операции с
+// их ID. В отличие от форматов операций, повторный импорт такого файла
+// обновляет те же записи, а не создаёт новые.
+const (
+	DatasetFormat  = "kpo-finance-dataset"
+	DatasetVersion = 1
+)
+
+// DatasetSchema — JSON Schema документа текущей версии.
+//
+//go:embed dataset.schema.json
+var DatasetSchema []byte
+
+type Dataset struct {
+	Format     string             `json:"format"`
+	Version    int                `json:"version"`
+	ExportedAt time.Time          `json:"exported_at"`
+	Accounts   []DatasetAccount   `json:"accounts"`
+	Categories []DatasetCategory  `json:"categories"`
+	Operations []DatasetOperation `json:"operations"`
+}
+
+type DatasetAccount struct {
+	ID      domain.AccountID `json:"id"`
+	Name    string           `json:"name"`
+	Balance decimal.Decimal  `json:"balance"` // справочно: при импорте баланс считается по операциям
+}
+
+type DatasetCategory struct {
+	ID   domain.CategoryID   `json:"id"`
+	Type domain.CategoryType `json:"type"` // 1 — доход, -1 — расход
+	Name string              `json:"name"`
+}
+
+type DatasetOperation struct {
+	ID          domain.OperationID   `json:"id"`
+	Type        domain.OperationType `json:"type"`
+	AccountID   domain.AccountID     `json:"account_id"`
+	CategoryID  domain.CategoryID    `json:"category_id"`
+	Amount      decimal.Decimal      `json:"amount"`
+	Date        string               `json:"date"` // YYYY-MM-DD
+	Description string               `json:"description"`
+}
+
+// Operation — операция домена; дата уже проверена Validate.
+func (o DatasetOperation) Operation() domain.Operation {
+	d, _ := time.Parse(time.DateOnly, o.Date)
+	return domain.Operation{
+		ID:          o.ID,
+		Type:        o.Type,
+		BankAccount: o.AccountID,
+		Amount:      o.Amount,
+		Date:        d,
+		Description: o.Description,
+		Category:    o.CategoryID,
+	}
+}
+
+// ExportDataset выгружает все доступные пользователю счета с операциями и
+// категории: свои и те, на которые ссылаются операции расшаренных счетов.
+// Операции читаются из БД потоком, дважды: сначала — чтобы собрать категории.
+func ExportDataset(
+	ctx context.Context,
+	accs *repo.PgAccountRepo,
+	ops *repo.PgOperationRepo,
+	cats *repo.CachedCategoryRepo,
+	path string,
+) error {
+	list, err := accs.List(ctx)
+	if err != nil {
+		return err
+	}
+	ids := make([]domain.AccountID, len(list))
+	for i, a := range list {
+		ids[i] = a.ID
+	}
+	all := func() iter.Seq2[domain.Operation, error] {
+		return ops.StreamByAccounts(ctx, ids, time.Time{}, time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+	}
+
+	own, err := cats.List(ctx)
+	if err != nil {
+		return err
+	}
+	seen := map[domain.CategoryID]bool{}
+	var categories []domain.Category
+	for _, c := range own {
+		seen[c.ID] = true
+		categories = append(categories, c)
+	}
+	for o, err := range all() {
+		if err != nil {
+			return err
+		}
+		if seen[o.Category] {
+			continue
+		}
+		c, err := cats.Get(ctx, o.Category)
+		if err != nil {
+			return fmt.Errorf("export: category %s: %w", o.Category, err)
+		}
+		seen[c.ID] = true
+		categories = append(categories, c)
+	}
+
+	return writeFile(path, func(out io.Writer) error {
+		w := &errWriter{w: out}
+		fmt.Fprintf(w, "{\n  \"format\": %q,\n  \"version\": %d,\n  \"exported_at\": %q,\n",
+			DatasetFormat, DatasetVersion, time.Now().UTC().Format(time.RFC3339))
+
+		io.WriteString(w, "  \"accounts\": ")
+		if err := writeItems(w, list, func(a domain.BankAccount) any {
+			return DatasetAccount{ID: a.ID, Name: a.Name, Balance: a.Balance}
+		}); err != nil {
+			return err
+		}
+		io.WriteString(w, ",\n  \"categories\": ")
+		if err := writeItems(w, categories, func(c domain.Category) any {
+			return DatasetCategory{ID: c.ID, Type: c.Type, Name: c.Name}
+		}); err != nil {
+			return err
+		}
+		io.WriteString(w, ",\n  \"operations\": ")
+		if err := writeSeq(w, all(), func(o domain.Operation) any {
+			return DatasetOperation{
+				ID:          o.ID,
+				Type:        o.Type,
+				AccountID:   o.BankAccount,
+				CategoryID:  o.Category,
+				Amount:      o.Amount,
+				Date:        o.Date.Format(time.DateOnly),
+				Description: o.Description,
+			}
+		}); err != nil {
+			return err
+		}
+		io.WriteString(w, "\n}\n")
+		return w.err
+	})
+}
+
+func writeItems[T any](w io.Writer, items []T, conv func(T) any) error {
+	return writeSeq(w, func(yield func(T, error) bool) {
+		for _, it := range items {
+			if !yield(it, nil) {
+				return
+			}
+		}
+	}, conv)
+}
+
+// writeSeq пишет массив во вложенном отступе документа, по элементу за раз.
+func writeSeq[T any](w io.Writer, items iter.Seq2[T, error], conv func(T) any) error {
+	n := 0
+	for it, err := range items {
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(conv(it), "    ", "  ")
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			io.WriteString(w, "[\n    ")
+		} else {
+			io.WriteString(w, ",\n    ")
+		}
+		w.Write(b)
+		n++
+	}
+	if n == 0 {
+		io.WriteString(w, "[]")
+	} else {
+		io.WriteString(w, "\n  ]")
+	}
+	return nil
+}
+
+// ReadDataset читает и проверяет документ. Файлы более новой версии не
+// читаются: в них могут быть данные, которые эта версия потеряет.
+func ReadDataset(path string) (Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer f.Close()
+	return DecodeDataset(f)
+}
+
+func DecodeDataset(r io.Reader) (Dataset, error) {
+	var head struct {
+		Format  string `json:"format"`
+		Version int    `json:"version"`
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return Dataset{}, err
+	}
+	raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return Dataset{}, fmt.Errorf("файл не JSON: %w", err)
+	}
+	if head.Format != DatasetFormat {
+		return Dataset{}, fmt.Errorf("это не выгрузка данных: format = %q, ожидается %q", head.Format, DatasetFormat)
+	}
+	if head.Version < 1 || head.Version > DatasetVersion {
+		return Dataset{}, fmt.Errorf("версия выгрузки %d не поддерживается (поддерживается до %d)", head.Version, DatasetVersion)
+	}
+
+	var d Dataset
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&d); err != nil {
+		return Dataset{}, fmt.Errorf("ошибка в выгрузке: %w", err)
+	}
+	if err := d.Validate(); err != nil {
+		return Dataset{}, err
+	}
+	return d, nil
+}
+
+// Validate проверяет то, что описывает схема, и ссылки между разделами.
+func (d Dataset) Validate() error {
+	accounts := map[domain.AccountID]bool{}
+	for i, a := range d.Accounts {
+		if err := checkID(string(a.ID)); err != nil {
+			return fmt.Errorf("accounts[%d]: %w", i, err)
+		}
+		if accounts[a.ID] {
+			return fmt.Errorf("accounts[%d]: счёт %s повторяется", i, a.ID)
+		}
+		if a.Name == "" {
+			return fmt.Errorf("accounts[%d]: пустое имя", i)
+		}
+		accounts[a.ID] = true
+	}
+	categories := map[domain.CategoryID]domain.CategoryType{}
+	for i, c := range d.Categories {
+		if err := checkID(string(c.ID)); err != nil {
+			return fmt.Errorf("categories[%d]: %w", i, err)
+		}
+		if _, ok := categories[c.ID]; ok {
+			return fmt.Errorf("categories[%d]: категория %s повторяется", i, c.ID)
+		}
+		if c.Type != domain.CatIncome && c.Type != domain.CatExpense {
+			return fmt.Errorf("categories[%d]: тип %d, ожидается 1 или -1", i, c.Type)
+		}
+		if c.Name == "" {
+			return fmt.Errorf("categories[%d]: пустое имя", i)
+		}
+		categories[c.ID] = c.Type
+	}
+	seen := map[domain.OperationID]bool{}
+	for i, o := range d.Operations {
+		if err := checkID(string(o.ID)); err != nil {
+			return fmt.Errorf("operations[%d]: %w", i, err)
+		}
+		if seen[o.ID] {
+			return fmt.Errorf("operations[%d]: операция %s повторяется", i, o.ID)
+		}
+		seen[o.ID] = true
+		if !accounts[o.AccountID] {
+			return fmt.Errorf("operations[%d]: счёт %s не описан в accounts", i, o.AccountID)
+		}
+		ct, ok := categories[o.CategoryID]
+		if !ok {
+			return fmt.Errorf("operations[%d]: категория %s не описана в categories", i, o.CategoryID)
+		}
+		if o.Type != ct {
+			return fmt.Errorf("operations[%d]: тип операции %d не совпадает с типом категории %d", i, o.Type, ct)
+		}
+		if !o.Amount.GreaterThan(decimal.Zero) || !o.Amount.Equal(o.Amount.Round(2)) {
+			return fmt.Errorf("operations[%d]: сумма %s, ожидается > 0 и не больше 2 знаков после запятой", i, o.Amount)
+		}
+		if _, err := time.Parse(time.DateOnly, o.Date); err != nil {
+			return fmt.Errorf("operations[%d]: дата %q, ожидается ГГГГ-ММ-ДД", i, o.Date)
+		}
+	}
+	return nil
+}
+
+func checkID(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("id %q — не UUID", id)
+	}
+	return nil
+}
+
+// IsDataset — похож ли файл на полную выгрузку (по началу файла).
+func IsDataset(path string) bool {
+	head, err := readHead(path)
+	if err != nil {
+		return false
+	}
+	return bytes.HasPrefix(head, []byte("{")) && bytes.Contains(head, []byte(`"`+DatasetFormat+`"`))
+}
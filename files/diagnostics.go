@@ -0,0 +1,270 @@
+package files
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Issue — отклонённая строка файла: где, какое поле, что в нём было и почему не подошло.
+type Issue struct {
+	Line   int    // строка файла (CSV, YAML, JSON — начало записи)
+	Record int    // порядковый номер записи, с 1; 0 — ошибка выписки целиком (не сходится остаток и т.п.)
+	Field  string // "" — запись целиком
+	Raw    string
+	Reason string
+	Source string // исходный текст записи — для файла отклонённых строк
+}
+
+func (i Issue) String() string {
+	if i.Record == 0 {
+		return fmt.Sprintf("строка %d (выписка): %s", i.Line, i.Reason)
+	}
+	if i.Field == "" {
+		return fmt.Sprintf("строка %d (запись %d): %s", i.Line, i.Record, i.Reason)
+	}
+	return fmt.Sprintf("строка %d (запись %d): %s=%q: %s", i.Line, i.Record, i.Field, i.Raw, i.Reason)
+}
+
+// IssueError возвращается в строгом режиме на первой отклонённой строке.
+type IssueError struct{ Issue Issue }
+
+func (e *IssueError) Error() string { return "import: " + e.Issue.String() }
+
+// Parsed — результат разбора: принятые строки и отклонённые записи.
+// При разборе через BaseImporter.Each строки не собираются — Rows пуст, а
+// число принятых строк — в Accepted.
+type Parsed struct {
+	Rows       []Row
+	Issues     []Issue
+	Records    int
+	Accepted   int
+	Statements []Statement // только для форматов выписок
+
+	emit   func(Row) error // куда отдавать принятые строки; nil — в Rows
+	strict bool
+	err    error // ошибка emit или строгого режима — разбор прекращается
+}
+
+// stopped — ошибка, после которой декодер должен прекратить чтение.
+func (p *Parsed) stopped() error { return p.err }
+
+func (p *Parsed) reject(line, record int, field, raw, reason, source string) {
+	is := Issue{Line: line, Record: record, Field: field, Raw: raw, Reason: reason, Source: source}
+	p.Issues = append(p.Issues, is)
+	if p.strict && p.err == nil {
+		p.err = &IssueError{Issue: is}
+	}
+}
+
+// accept отдаёт строку получателю или копит её в Rows.
+func (p *Parsed) accept(row Row) {
+	p.Accepted++
+	if p.emit == nil {
+		p.Rows = append(p.Rows, row)
+		return
+	}
+	if err := p.emit(row); err != nil {
+		p.err = err
+	}
+}
+
+type Options struct {
+	Strict     bool        // прервать импорт на первой ошибке
+	CSVProfile *CSVProfile // только для CSV; nil — DefaultCSVProfile
+	// DefaultCategory — для форматов без категорий (OFX и т.п.); "" — NoCategory
+	DefaultCategory string
+	// DateOrder — порядок дня и месяца в датах QIF: QIFAuto, QIFMonthFirst или QIFDayFirst
+	DateOrder string
+}
+
+// rawRow — поля записи как текст, до проверки; line — строка каждого поля, если известна.
+type rawRow struct {
+	Type, Amount, Date, Category, Description string
+	ExternalID                                string
+	Statement                                 int
+	line                                      map[string]int
+}
+
+// Record — поля записи стороннего формата как текст, до проверки (см. DecodeFunc).
+type Record struct {
+	Type, Amount, Date, Category, Description string
+	ExternalID                                string
+}
+
+// Add проверяет запись в формате файлов приложения (тип 1/-1, сумма с точкой,
+// дата ГГГГ-ММ-ДД) и принимает её или отклоняет с причинами. false — разбор
+// надо прекратить: строгий режим или ошибка получателя строк.
+func (p *Parsed) Add(line, record int, r Record, source string) bool {
+	p.add(line, record, rawRow{
+		Type:        r.Type,
+		Amount:      r.Amount,
+		Date:        r.Date,
+		Category:    r.Category,
+		Description: r.Description,
+		ExternalID:  r.ExternalID,
+	}, source)
+	return p.err == nil
+}
+
+// fieldFormat — как читать значения; нулевое значение — собственный формат файлов
+// (тип 1/-1, сумма с точкой, дата ГГГГ-ММ-ДД).
+type fieldFormat struct {
+	dateLayout   string
+	dateHint     string // формат даты для сообщений, как в профиле
+	decimalComma bool
+	signed       int            // 0 — тип из колонки type; 1 — минус означает расход; -1 — минус означает доход
+	types        map[string]int // значения колонки type → ±1; nil — "1"/"-1"
+}
+
+var canonicalFormat = fieldFormat{dateLayout: "2006-01-02", dateHint: "ГГГГ-ММ-ДД"}
+
+// add проверяет запись и либо добавляет строку, либо фиксирует все ошибки в ней.
+func (p *Parsed) add(line, record int, r rawRow, source string) {
+	p.addWith(canonicalFormat, line, record, r, source)
+}
+
+func (p *Parsed) addWith(ff fieldFormat, line, record int, r rawRow, source string) {
+	if p.err != nil {
+		return
+	}
+	p.Records++
+	before := len(p.Issues)
+	lineOf := func(field string) int {
+		if l, ok := r.line[field]; ok {
+			return l
+		}
+		return line
+	}
+
+	row := Row{Line: line}
+	amt, err := parseAmount(r.Amount, ff.decimalComma)
+	switch {
+	case err != nil:
+		p.reject(lineOf("amount"), record, "amount", r.Amount, "не число", source)
+	case ff.signed != 0:
+		if amt.IsZero() {
+			p.reject(lineOf("amount"), record, "amount", r.Amount, "нулевая сумма", source)
+			break
+		}
+		// signed: плюс — доход; inverted: плюс — расход
+		row.Type = ff.signed
+		if amt.IsNegative() {
+			row.Type = -ff.signed
+		}
+		row.Amount = amt.Abs().Round(2)
+	case !amt.IsPositive():
+		p.reject(lineOf("amount"), record, "amount", r.Amount, "сумма должна быть > 0", source)
+	default:
+		row.Amount = amt.Round(2)
+	}
+
+	if ff.signed == 0 {
+		t, ok := parseType(r.Type, ff.types)
+		if !ok {
+			reason := "ожидается 1 (доход) или -1 (расход)"
+			if ff.types != nil {
+				reason = "неизвестное значение типа операции"
+			}
+			p.reject(lineOf("type"), record, "type", r.Type, reason, source)
+		}
+		row.Type = t
+	}
+
+	dt, err := time.Parse(ff.dateLayout, strings.TrimSpace(r.Date))
+	if err != nil {
+		p.reject(lineOf("date"), record, "date", r.Date, "ожидается дата в формате "+ff.dateHint, source)
+	}
+	row.Date = time.Date(dt.Year(), dt.Month(), dt.Day(), 0, 0, 0, 0, time.UTC)
+
+	row.Category = strings.TrimSpace(r.Category)
+	if row.Category == "" {
+		p.reject(lineOf("category"), record, "category", r.Category, "категория обязательна", source)
+	}
+	row.Description = r.Description
+	row.ExternalID = r.ExternalID
+	row.Statement = r.Statement
+
+	if len(p.Issues) == before {
+		p.accept(row)
+	}
+}
+
+// parseAmount понимает пробелы-разделители тысяч и, при decimalComma, запятую.
+func parseAmount(s string, decimalComma bool) (decimal.Decimal, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u00a0' || r == '\u202f' || r == '\'' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if decimalComma {
+		s = strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+	}
+	return decimal.NewFromString(s)
+}
+
+func parseType(s string, types map[string]int) (int, bool) {
+	s = strings.TrimSpace(s)
+	if types != nil {
+		t, ok := types[strings.ToLower(s)]
+		return t, ok
+	}
+	switch s {
+	case "1", "+1":
+		return 1, true
+	case "-1":
+		return -1, true
+	}
+	return 0, false
+}
+
+// Rejected — число отклонённых записей (в одной записи может быть несколько ошибок).
+func (p Parsed) Rejected() int {
+	seen := map[int]bool{}
+	for _, i := range p.Issues {
+		if i.Record > 0 {
+			seen[i.Record] = true
+		}
+	}
+	return len(seen)
+}
+
+// WriteRejected сохраняет отклонённые записи в CSV рядом с исходным файлом:
+// номер строки, поле, значение, причина и исходный текст записи.
+func WriteRejected(path string, issues []Issue) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"line", "record", "field", "raw", "reason", "source"}); err != nil {
+		return err
+	}
+	for _, i := range issues {
+		rec := []string{strconv.Itoa(i.Line), strconv.Itoa(i.Record), i.Field, i.Raw, i.Reason, i.Source}
+		if err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// RejectedPath — путь файла отклонённых строк по умолчанию: ops.csv → ops.rejected.csv.
+func RejectedPath(path string) string {
+	if i := strings.LastIndex(path, "."); i > strings.LastIndexAny(path, `/\`) {
+		return path[:i] + ".rejected.csv"
+	}
+	return path + ".rejected.csv"
+}
@@ -1,63 +1,300 @@
 package files
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"iter"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"main/domain"
 	"main/repo"
+
+	"github.com/shopspring/decimal"
 )
 
+// RowSeq — поток строк; ошибка источника (БД, файла) приходит вторым значением
+// и заканчивает поток. Потоки из ExportOperations и BaseImporter.Rows можно
+// пройти повторно — каждый проход заново читает источник; этим пользуются
+// форматы, которым до строк нужны итоги или список счетов.
+type RowSeq = iter.Seq2[Row, error]
+
+// Encoder пишет строки в w по мере чтения, не собирая их в памяти.
 type Encoder interface {
-	EncodeRows(rows []Row) ([]byte, error)
+	Encode(w io.Writer, rows RowSeq) error
+}
+
+// SliceRows — поток из готового среза.
+func SliceRows(rows []Row) RowSeq {
+	return func(yield func(Row, error) bool) {
+		for _, r := range rows {
+			if !yield(r, nil) {
+				return
+			}
+		}
+	}
+}
+
+// EncodeRows — результат кодирования среза строк целиком в памяти.
+func EncodeRows(enc Encoder, rows []Row) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := enc.Encode(buf, SliceRows(rows)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func ExportOperations(
 	ctx context.Context,
 	ops *repo.PgOperationRepo,
-	cats *repo.PgCategoryRepo,
+	cats *repo.CachedCategoryRepo,
 	accID domain.AccountID,
 	from, to time.Time,
 	path string,
 	enc Encoder,
 ) error {
-	list, err := ops.ListByAccount(ctx, accID, from, to)
-	if err != nil {
-		return err
+	return writeFile(path, func(w io.Writer) error {
+		return enc.Encode(w, accountRows(ctx, ops, cats, accID, from, to))
+	})
+}
+
+// ExportQuery — что выгружать: счета, период и фильтры.
+type ExportQuery struct {
+	Accounts   []domain.AccountID // пусто — все счета, доступные пользователю
+	From, To   time.Time
+	Categories []string // только эти категории (без учёта регистра); пусто — все
+	Type       int      // 1 — только доходы, -1 — только расходы, 0 — все
+}
+
+func (q ExportQuery) match(r Row) bool {
+	if q.Type != 0 && r.Type != q.Type {
+		return false
 	}
+	if len(q.Categories) == 0 {
+		return true
+	}
+	for _, c := range q.Categories {
+		if strings.EqualFold(strings.TrimSpace(c), r.Category) {
+			return true
+		}
+	}
+	return false
+}
 
-	cmap := map[domain.CategoryID]string{}
-	getCatName := func(id domain.CategoryID) string {
-		if n, ok := cmap[id]; ok {
-			return n
+// accountRows — операции счёта за период строками экспорта, потоком из курсора.
+func accountRows(
+	ctx context.Context,
+	ops *repo.PgOperationRepo,
+	cats *repo.CachedCategoryRepo,
+	accID domain.AccountID,
+	from, to time.Time,
+) RowSeq {
+	return queryRows(ctx, ops, cats, ExportQuery{Accounts: []domain.AccountID{accID}, From: from, To: to}, nil)
+}
+
+// queryRows — операции по запросу строками экспорта; names — имена счетов для Row.Account.
+func queryRows(
+	ctx context.Context,
+	ops *repo.PgOperationRepo,
+	cats *repo.CachedCategoryRepo,
+	q ExportQuery,
+	names map[domain.AccountID]string,
+) RowSeq {
+	return func(yield func(Row, error) bool) {
+		cmap := map[domain.CategoryID]string{}
+		getCatName := func(id domain.CategoryID) (string, error) {
+			if n, ok := cmap[id]; ok {
+				return n, nil
+			}
+			c, err := cats.Get(ctx, id)
+			if err != nil {
+				return "", fmt.Errorf("category %s: %w", id, err)
+			}
+			cmap[id] = c.Name
+			return c.Name, nil
 		}
-		c, err := cats.Get(ctx, id)
-		if err != nil {
-			return ""
+		for o, err := range ops.StreamByAccounts(ctx, q.Accounts, q.From, q.To) {
+			if err != nil {
+				yield(Row{}, err)
+				return
+			}
+			t := 1
+			if o.IsExpense() {
+				t = -1
+			}
+			cat, err := getCatName(o.Category)
+			if err != nil {
+				yield(Row{}, err)
+				return
+			}
+			row := Row{
+				Type:        t,
+				Amount:      o.Amount,
+				Date:        o.Date,
+				Category:    cat,
+				Description: o.Description,
+				Account:     names[o.BankAccount],
+			}
+			if !q.match(row) {
+				continue
+			}
+			if !yield(row, nil) {
+				return
+			}
 		}
-		cmap[id] = c.Name
-		return c.Name
 	}
+}
 
-	rows := make([]Row, 0, len(list))
-	for _, o := range list {
-		t := 1
-		if o.IsExpense() {
-			t = -1
+// Колонки CSV, JSON и YAML.
+const (
+	ColType        = "type"
+	ColAmount      = "amount"
+	ColDate        = "date"
+	ColCategory    = "category"
+	ColDescription = "description"
+	ColAccount     = "account"
+)
+
+// DefaultColumns — колонки, которые читают импортёры этих форматов.
+var DefaultColumns = []string{ColType, ColAmount, ColDate, ColCategory, ColDescription}
+
+// AllColumns — все колонки, которые можно выбрать при экспорте.
+var AllColumns = append(append([]string(nil), DefaultColumns...), ColAccount)
+
+// ParseColumns читает список колонок через запятую ("date, amount, category");
+// пустая строка — DefaultColumns.
+func ParseColumns(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultColumns, nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" || seen[c] {
+			continue
+		}
+		if !slices.Contains(AllColumns, c) {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", c, strings.Join(AllColumns, ", "))
 		}
-		rows = append(rows, Row{
-			Type:        t,
-			Amount:      o.Amount,
-			Date:        o.Date,
-			Category:    getCatName(o.Category),
-			Description: o.Description,
-		})
+		seen[c] = true
+		out = append(out, c)
 	}
+	return out, nil
+}
 
-	b, err := enc.EncodeRows(rows)
+// columns — колонки энкодера; nil — DefaultColumns.
+func columns(cols []string) []string {
+	if len(cols) == 0 {
+		return DefaultColumns
+	}
+	return cols
+}
+
+// rowValue — значение колонки: type — число, остальное — строка.
+func rowValue(r Row, col string) any {
+	switch col {
+	case ColType:
+		return r.Type
+	case ColAmount:
+		return r.Amount.StringFixed(2)
+	case ColDate:
+		return r.Date.Format("2006-01-02")
+	case ColCategory:
+		return r.Category
+	case ColDescription:
+		return r.Description
+	case ColAccount:
+		return r.Account
+	}
+	return ""
+}
+
+// writeFile пишет файл через буфер; при ошибке недописанный файл удаляется.
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, b, 0644)
+	bw := bufio.NewWriterSize(f, 64*1024)
+	err = write(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// errWriter запоминает первую ошибку записи, чтобы не проверять каждый Fprintf.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
+}
+
+// opsNet — изменение баланса от операций: доходы минус расходы.
+func opsNet(list iter.Seq2[domain.Operation, error]) (decimal.Decimal, error) {
+	sum := decimal.Zero
+	for o, err := range list {
+		if err != nil {
+			return decimal.Zero, err
+		}
+		if o.IsExpense() {
+			sum = sum.Sub(o.Amount)
+		} else {
+			sum = sum.Add(o.Amount)
+		}
+	}
+	return sum, nil
+}
+
+// openingBalance — остаток счёта на начало периода: текущий баланс за вычетом
+// операций периода и всех более поздних.
+func openingBalance(
+	ctx context.Context,
+	accs *repo.PgAccountRepo,
+	ops *repo.PgOperationRepo,
+	accID domain.AccountID,
+	from, to time.Time,
+) (domain.BankAccount, decimal.Decimal, error) {
+	acc, err := accs.Get(ctx, accID)
+	if err != nil {
+		return domain.BankAccount{}, decimal.Zero, err
+	}
+	closing, err := closingBalance(ctx, ops, acc, to)
+	if err != nil {
+		return domain.BankAccount{}, decimal.Zero, err
+	}
+	period, err := opsNet(ops.StreamByAccount(ctx, accID, from, to))
+	if err != nil {
+		return domain.BankAccount{}, decimal.Zero, err
+	}
+	return acc, closing.Sub(period), nil
+}
+
+// closingBalance — остаток счёта на конец дня to.
+func closingBalance(ctx context.Context, ops *repo.PgOperationRepo, acc domain.BankAccount, to time.Time) (decimal.Decimal, error) {
+	after, err := opsNet(ops.StreamByAccount(ctx, acc.ID, to.AddDate(0, 0, 1), to.AddDate(100, 0, 0)))
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return acc.Balance.Sub(after), nil
 }
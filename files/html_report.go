@@ -0,0 +1,522 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"main/domain"
+	"main/repo"
+
+	"github.com/shopspring/decimal"
+)
+
+// HTMLReport — отчёт за период одним HTML-файлом: графики встроены как SVG,
+// стили — в <style>, внешних ресурсов и скриптов нет. Итоги и разбивка
+// приходят из AnalyticsFacade (Summary, BreakdownByCategory).
+type HTMLReport struct {
+	Account              string
+	From, To             time.Time
+	Income, Expense, Net decimal.Decimal
+	Categories           []CategoryTotal
+	Opening              decimal.Decimal // остаток на начало периода
+	Generated            time.Time
+}
+
+var reportMonths = [...]string{"янв", "фев", "мар", "апр", "май", "июн", "июл", "авг", "сен", "окт", "ноя", "дек"}
+
+// reportColors — палитра секторов диаграммы; последний цвет — «Прочее».
+var reportColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+const (
+	reportIncomeColor  = "#2e7d32"
+	reportExpenseColor = "#c62828"
+	reportLineColor    = "#1f5f9f"
+)
+
+type reportCatRow struct {
+	Category string
+	Amount   string
+	Share    string
+}
+
+type reportMonthRow struct {
+	Month, Income, Expense, Net string
+	Negative                    bool
+}
+
+type reportPage struct {
+	Title, Account, Period, Generated      string
+	Income, Expense, Net, Opening, Closing string
+	NetNegative                            bool
+	Count                                  int
+	Monthly, Pie, Balance                  template.HTML
+	Months                                 []reportMonthRow
+	Incomes, Expenses                      []reportCatRow
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, Arial, sans-serif; color: #222; margin: 0 auto; max-width: 980px; padding: 24px; }
+h1 { font-size: 24px; margin-bottom: 4px; }
+h2 { font-size: 18px; margin-top: 32px; border-bottom: 1px solid #ddd; padding-bottom: 4px; }
+.muted { color: #777; }
+.cards { display: flex; flex-wrap: wrap; gap: 12px; margin-top: 16px; }
+.card { flex: 1 1 160px; border: 1px solid #e3e3e3; border-radius: 6px; padding: 12px; }
+.card .label { color: #777; font-size: 13px; }
+.card .value { font-size: 20px; font-weight: 600; margin-top: 4px; }
+.inc { color: ` + reportIncomeColor + `; }
+.exp { color: ` + reportExpenseColor + `; }
+table { border-collapse: collapse; width: 100%; margin-top: 8px; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #eee; text-align: left; }
+th { background: #f5f7fa; font-weight: 600; }
+td.num, th.num { text-align: right; white-space: nowrap; font-variant-numeric: tabular-nums; }
+.cols { display: flex; flex-wrap: wrap; gap: 24px; }
+.cols > div { flex: 1 1 400px; }
+svg { max-width: 100%; height: auto; }
+svg text { font-size: 11px; fill: #555; }
+@media print { body { padding: 0; } h2 { break-after: avoid; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="muted">Счёт: {{.Account}} · период {{.Period}} · сформирован {{.Generated}}</div>
+
+<div class="cards">
+<div class="card"><div class="label">Доходы</div><div class="value inc">{{.Income}}</div></div>
+<div class="card"><div class="label">Расходы</div><div class="value exp">{{.Expense}}</div></div>
+<div class="card"><div class="label">Итого</div><div class="value {{if .NetNegative}}exp{{else}}inc{{end}}">{{.Net}}</div></div>
+<div class="card"><div class="label">Остаток на начало / конец</div><div class="value">{{.Opening}} → {{.Closing}}</div></div>
+</div>
+
+<h2>Доходы и расходы по месяцам</h2>
+{{.Monthly}}
+<table>
+<tr><th>Месяц</th><th class="num">Доходы</th><th class="num">Расходы</th><th class="num">Итого</th></tr>
+{{range .Months}}<tr><td>{{.Month}}</td><td class="num">{{.Income}}</td><td class="num">{{.Expense}}</td><td class="num {{if .Negative}}exp{{end}}">{{.Net}}</td></tr>
+{{end}}</table>
+
+<h2>Расходы по категориям</h2>
+{{.Pie}}
+
+<h2>Остаток на счёте</h2>
+{{.Balance}}
+
+<h2>Разбивка по категориям</h2>
+<div class="cols">
+<div>
+<table>
+<tr><th>Доходы</th><th class="num">Сумма</th><th class="num">Доля</th></tr>
+{{range .Incomes}}<tr><td>{{.Category}}</td><td class="num">{{.Amount}}</td><td class="num">{{.Share}}</td></tr>
+{{else}}<tr><td colspan="3" class="muted">нет доходов</td></tr>
+{{end}}</table>
+</div>
+<div>
+<table>
+<tr><th>Расходы</th><th class="num">Сумма</th><th class="num">Доля</th></tr>
+{{range .Expenses}}<tr><td>{{.Category}}</td><td class="num">{{.Amount}}</td><td class="num">{{.Share}}</td></tr>
+{{else}}<tr><td colspan="3" class="muted">нет расходов</td></tr>
+{{end}}</table>
+</div>
+</div>
+<p class="muted">Операций за период: {{.Count}}.</p>
+</body>
+</html>
+`))
+
+// Encode читает строки один раз: в памяти копятся только суммы по месяцам,
+// дням и категориям.
+func (r HTMLReport) Encode(w io.Writer, rows RowSeq) error {
+	var tot rowTotals
+	months := map[string]reportMonth{}
+	days := map[time.Time]decimal.Decimal{}
+	var first, last time.Time
+	for row, err := range rows {
+		if err != nil {
+			return err
+		}
+		tot.add(row)
+		k := row.Date.Format("2006-01")
+		m := months[k]
+		d := day(row.Date)
+		if row.Type < 0 {
+			m.expense = m.expense.Add(row.Amount)
+			days[d] = days[d].Sub(row.Amount)
+		} else {
+			m.income = m.income.Add(row.Amount)
+			days[d] = days[d].Add(row.Amount)
+		}
+		months[k] = m
+		if first.IsZero() || row.Date.Before(first) {
+			first = row.Date
+		}
+		if row.Date.After(last) {
+			last = row.Date
+		}
+	}
+
+	from, to := r.From, r.To
+	if from.IsZero() || to.IsZero() {
+		from, to = day(first), day(last)
+		if from.IsZero() {
+			from = day(time.Now())
+			to = from
+		}
+	}
+	generated := r.Generated
+	if generated.IsZero() {
+		generated = time.Now()
+	}
+	cats := r.Categories
+	if cats == nil {
+		cats = tot.cats.totals()
+	}
+	income, expense, net := r.Income, r.Expense, r.Net
+	if income.IsZero() && expense.IsZero() {
+		income, expense = tot.income, tot.expense
+		net = income.Sub(expense)
+	}
+
+	monthly := reportMonthly(months, from, to)
+	page := reportPage{
+		Title:       "Финансовый отчёт: " + reportPeriod(from, to),
+		Account:     r.Account,
+		Period:      from.Format("02.01.2006") + " — " + to.Format("02.01.2006"),
+		Generated:   generated.Format("02.01.2006 15:04"),
+		Income:      reportMoney(income),
+		Expense:     reportMoney(expense),
+		Net:         reportMoney(net),
+		NetNegative: net.IsNegative(),
+		Opening:     reportMoney(r.Opening),
+		Closing:     reportMoney(r.Opening.Add(net)),
+		Count:       tot.count,
+		Monthly:     template.HTML(reportBarChart(monthly)),
+		Pie:         template.HTML(reportPieChart(cats)),
+		Balance:     template.HTML(reportBalanceChart(days, r.Opening, from, to)),
+		Incomes:     reportCategoryRows(cats, 1),
+		Expenses:    reportCategoryRows(cats, -1),
+	}
+	if page.Account == "" {
+		page.Account = "—"
+	}
+	for _, m := range monthly {
+		n := m.income.Sub(m.expense)
+		page.Months = append(page.Months, reportMonthRow{
+			Month: m.label(), Income: reportMoney(m.income), Expense: reportMoney(m.expense),
+			Net: reportMoney(n), Negative: n.IsNegative(),
+		})
+	}
+	return reportTemplate.Execute(w, page)
+}
+
+type reportMonth struct {
+	start           time.Time
+	income, expense decimal.Decimal
+}
+
+func (m reportMonth) label() string {
+	return fmt.Sprintf("%s %d", reportMonths[m.start.Month()-1], m.start.Year())
+}
+
+// reportMonthly — доходы и расходы по каждому месяцу периода ("2006-01" → суммы), включая пустые.
+func reportMonthly(sums map[string]reportMonth, from, to time.Time) []reportMonth {
+	var out []reportMonth
+	for m := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); !m.After(to); m = m.AddDate(0, 1, 0) {
+		s := sums[m.Format("2006-01")]
+		s.start = m
+		out = append(out, s)
+	}
+	return out
+}
+
+func reportCategoryRows(cats []CategoryTotal, typ int) []reportCatRow {
+	total := decimal.Zero
+	for _, c := range cats {
+		if c.Type == typ {
+			total = total.Add(c.Amount)
+		}
+	}
+	var out []reportCatRow
+	for _, c := range cats {
+		if c.Type != typ {
+			continue
+		}
+		out = append(out, reportCatRow{Category: c.Category, Amount: reportMoney(c.Amount), Share: reportShare(c.Amount, total)})
+	}
+	return out
+}
+
+// reportBarChart — пары столбцов «доход/расход» по месяцам.
+func reportBarChart(months []reportMonth) string {
+	const w, h, left, bottom, top = 900.0, 280.0, 70.0, 30.0, 20.0
+	max := 0.0
+	for _, m := range months {
+		max = math.Max(max, math.Max(m.income.InexactFloat64(), m.expense.InexactFloat64()))
+	}
+	if max == 0 {
+		return reportEmpty("Нет операций за период")
+	}
+	max = reportNiceMax(max)
+	plotH := h - bottom - top
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `<svg viewBox="0 0 %g %g" xmlns="http://www.w3.org/2000/svg" role="img" aria-label="Доходы и расходы по месяцам">`, w, h)
+	reportGrid(b, left, w, top, plotH, 0, max)
+
+	slot := (w - left) / float64(len(months))
+	bar := math.Min(slot*0.35, 40)
+	for i, m := range months {
+		x := left + slot*float64(i) + slot/2
+		for j, v := range []decimal.Decimal{m.income, m.expense} {
+			hh := v.InexactFloat64() / max * plotH
+			color, name := reportIncomeColor, "Доходы"
+			if j == 1 {
+				color, name = reportExpenseColor, "Расходы"
+			}
+			fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s, %s: %s</title></rect>`,
+				x-bar+float64(j)*bar, top+plotH-hh, bar, hh, color, m.label(), name, reportMoney(v))
+		}
+		fmt.Fprintf(b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, x, h-bottom+16, m.label())
+	}
+	fmt.Fprintf(b, `<rect x="%g" y="4" width="10" height="10" fill="%s"/><text x="%g" y="13">Доходы</text>`, w-170, reportIncomeColor, w-156)
+	fmt.Fprintf(b, `<rect x="%g" y="4" width="10" height="10" fill="%s"/><text x="%g" y="13">Расходы</text>`, w-90, reportExpenseColor, w-76)
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// reportPieChart — доли расходов; всё после восьмой категории — «Прочее».
+func reportPieChart(cats []CategoryTotal) string {
+	type slice struct {
+		name string
+		v    decimal.Decimal
+	}
+	var list []slice
+	total := decimal.Zero
+	for _, c := range cats {
+		if c.Type < 0 && c.Amount.IsPositive() {
+			list = append(list, slice{c.Category, c.Amount})
+			total = total.Add(c.Amount)
+		}
+	}
+	if total.IsZero() {
+		return reportEmpty("Нет расходов за период")
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].v.GreaterThan(list[j].v) })
+	if max := len(reportColors) - 2; len(list) > max+1 {
+		rest := decimal.Zero
+		for _, s := range list[max:] {
+			rest = rest.Add(s.v)
+		}
+		list = append(list[:max:max], slice{"Прочее", rest})
+	}
+
+	const cx, cy, rad = 150.0, 150.0, 130.0
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `<svg viewBox="0 0 640 %d" xmlns="http://www.w3.org/2000/svg" role="img" aria-label="Расходы по категориям">`,
+		int(math.Max(300, float64(len(list))*24+20)))
+	angle := -math.Pi / 2
+	for i, s := range list {
+		color := reportColors[i%len(reportColors)]
+		if s.name == "Прочее" {
+			color = reportColors[len(reportColors)-1]
+		}
+		frac := s.v.Div(total).InexactFloat64()
+		title := fmt.Sprintf("<title>%s: %s (%s)</title>", html.EscapeString(s.name), reportMoney(s.v), reportShare(s.v, total))
+		if frac >= 0.9999 {
+			fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="%g" fill="%s">%s</circle>`, cx, cy, rad, color, title)
+		} else {
+			end := angle + frac*2*math.Pi
+			large := 0
+			if frac > 0.5 {
+				large = 1
+			}
+			fmt.Fprintf(b, `<path d="M%g,%g L%.2f,%.2f A%g,%g 0 %d 1 %.2f,%.2f Z" fill="%s" stroke="#fff" stroke-width="1">%s</path>`,
+				cx, cy, cx+rad*math.Cos(angle), cy+rad*math.Sin(angle), rad, rad, large,
+				cx+rad*math.Cos(end), cy+rad*math.Sin(end), color, title)
+			angle = end
+		}
+		y := 20 + float64(i)*24
+		fmt.Fprintf(b, `<rect x="320" y="%g" width="14" height="14" fill="%s"/><text x="342" y="%g" style="font-size:13px">%s — %s (%s)</text>`,
+			y, color, y+12, html.EscapeString(s.name), reportMoney(s.v), reportShare(s.v, total))
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// reportBalanceChart — остаток на конец каждого дня периода ступенчатой линией;
+// days — изменение остатка за день.
+func reportBalanceChart(days map[time.Time]decimal.Decimal, opening decimal.Decimal, from, to time.Time) string {
+	const w, h, left, bottom, top = 900.0, 260.0, 70.0, 30.0, 20.0
+	from, to = day(from), day(to)
+	keys := make([]time.Time, 0, len(days))
+	for d := range days {
+		keys = append(keys, d)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Before(keys[j]) })
+
+	type point struct {
+		t time.Time
+		v float64
+	}
+	bal := opening
+	pts := []point{{from, bal.InexactFloat64()}}
+	for _, d := range keys {
+		bal = bal.Add(days[d])
+		if d.Before(from) {
+			d = from
+		}
+		if last := &pts[len(pts)-1]; last.t.Equal(d) {
+			last.v = bal.InexactFloat64()
+		} else {
+			pts = append(pts, point{d, bal.InexactFloat64()})
+		}
+	}
+	end := to.AddDate(0, 0, 1)
+	pts = append(pts, point{end, bal.InexactFloat64()})
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, p := range pts {
+		lo, hi = math.Min(lo, p.v), math.Max(hi, p.v)
+	}
+	lo = math.Min(lo, 0)
+	if hi <= lo {
+		hi = lo + 1
+	}
+	hi = reportNiceMax(hi)
+	plotH := h - bottom - top
+	span := end.Sub(from).Hours()
+	x := func(t time.Time) float64 { return left + (w-left-10)*t.Sub(from).Hours()/span }
+	y := func(v float64) float64 { return top + plotH - (v-lo)/(hi-lo)*plotH }
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `<svg viewBox="0 0 %g %g" xmlns="http://www.w3.org/2000/svg" role="img" aria-label="Остаток на счёте">`, w, h)
+	reportGrid(b, left, w, top, plotH, lo, hi)
+	var line []string
+	for i, p := range pts {
+		if i > 0 {
+			line = append(line, fmt.Sprintf("%.1f,%.1f", x(p.t), y(pts[i-1].v)))
+		}
+		line = append(line, fmt.Sprintf("%.1f,%.1f", x(p.t), y(p.v)))
+	}
+	fmt.Fprintf(b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, strings.Join(line, " "), reportLineColor)
+	for _, p := range pts[:len(pts)-1] {
+		fmt.Fprintf(b, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="%s"><title>%s: %s</title></circle>`,
+			x(p.t), y(p.v), reportLineColor, p.t.Format("02.01.2006"), reportMoney(decimal.NewFromFloat(p.v)))
+	}
+	fmt.Fprintf(b, `<text x="%g" y="%g">%s</text>`, left, h-bottom+16, from.Format("02.01.2006"))
+	fmt.Fprintf(b, `<text x="%g" y="%g" text-anchor="end">%s</text>`, w-10, h-bottom+16, to.Format("02.01.2006"))
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// reportGrid — горизонтальные линии сетки с подписями от lo до hi.
+func reportGrid(b *strings.Builder, left, w, top, plotH, lo, hi float64) {
+	const ticks = 4
+	for i := 0; i <= ticks; i++ {
+		v := lo + (hi-lo)*float64(i)/ticks
+		y := top + plotH - plotH*float64(i)/ticks
+		fmt.Fprintf(b, `<line x1="%g" y1="%.1f" x2="%g" y2="%.1f" stroke="#e5e5e5"/>`, left, y, w-10, y)
+		fmt.Fprintf(b, `<text x="%g" y="%.1f" text-anchor="end">%s</text>`, left-6, y+4, reportShort(v))
+	}
+}
+
+// reportNiceMax округляет верх шкалы вверх до 1, 2, 2.5 или 5 × 10^n.
+func reportNiceMax(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	p := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if v <= m*p {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+func reportEmpty(text string) string {
+	return `<svg viewBox="0 0 900 60" xmlns="http://www.w3.org/2000/svg"><text x="450" y="35" text-anchor="middle" style="font-size:14px">` +
+		html.EscapeString(text) + `</text></svg>`
+}
+
+// reportMoney: 1234567.5 → "1 234 567,50".
+func reportMoney(d decimal.Decimal) string {
+	s := d.StringFixed(2)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "−", s[1:]
+	}
+	intPart, frac := s[:len(s)-3], s[len(s)-2:]
+	var parts []string
+	for len(intPart) > 3 {
+		parts = append([]string{intPart[len(intPart)-3:]}, parts...)
+		intPart = intPart[:len(intPart)-3]
+	}
+	parts = append([]string{intPart}, parts...)
+	return sign + strings.Join(parts, " ") + "," + frac
+}
+
+// reportShort — подпись оси: 1500 → "1,5 тыс.", 2000000 → "2 млн".
+func reportShort(v float64) string {
+	f := func(x float64, unit string) string {
+		s := strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.1f", x), "0"), ".")
+		return strings.Replace(s, ".", ",", 1) + unit
+	}
+	switch a := math.Abs(v); {
+	case a >= 1e6:
+		return f(v/1e6, " млн")
+	case a >= 1e3:
+		return f(v/1e3, " тыс.")
+	}
+	return f(v, "")
+}
+
+func reportShare(v, total decimal.Decimal) string {
+	if total.IsZero() {
+		return "—"
+	}
+	return strings.Replace(v.Div(total).Mul(decimal.NewFromInt(100)).StringFixed(1), ".", ",", 1) + "%"
+}
+
+// reportPeriod: целый месяц — «март 2025», иначе даты.
+func reportPeriod(from, to time.Time) string {
+	if from.Day() == 1 && from.Year() == to.Year() && from.Month() == to.Month() && to.AddDate(0, 0, 1).Day() == 1 {
+		return fmt.Sprintf("%s %d", reportMonthNames[from.Month()-1], from.Year())
+	}
+	return from.Format("02.01.2006") + " — " + to.Format("02.01.2006")
+}
+
+var reportMonthNames = [...]string{"январь", "февраль", "март", "апрель", "май", "июнь", "июль", "август", "сентябрь", "октябрь", "ноябрь", "декабрь"}
+
+// ExportReportHTML сохраняет отчёт по счёту за период. Остаток на начало
+// считается от текущего баланса счёта, как в экспорте Beancount.
+func ExportReportHTML(
+	ctx context.Context,
+	accs *repo.PgAccountRepo,
+	ops *repo.PgOperationRepo,
+	cats *repo.CachedCategoryRepo,
+	accID domain.AccountID,
+	from, to time.Time,
+	path string,
+	rep HTMLReport,
+) error {
+	acc, opening, err := openingBalance(ctx, accs, ops, accID, from, to)
+	if err != nil {
+		return err
+	}
+	if rep.Account == "" {
+		rep.Account = acc.Name
+	}
+	rep.From, rep.To, rep.Opening = from, to, opening
+	return ExportOperations(ctx, ops, cats, accID, from, to, path, rep)
+}
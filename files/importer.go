@@ -1,25 +1,115 @@
 package files
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 )
 
+// Importer разбирает поток; принятые строки отдаются через res.add/addWith.
+// CSV, JSON, YAML, MT940 и QIF читаются по записи; OFX, camt.053 и ledger
+// нужен весь файл — они читают его в память через readAll.
 type Importer interface {
-	parse(data []byte) ([]Row, error)
+	decode(r io.Reader, res *Parsed) error
+}
+
+// MaxInMemorySize — предел размера файла для форматов, которые разбираются
+// в памяти целиком (OFX, camt.053, ledger, Дзен-мани, CoinKeeper).
+const MaxInMemorySize = 32 << 20
+
+// readAll читает файл формата format целиком, но не больше MaxInMemorySize.
+func readAll(r io.Reader, format string) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxInMemorySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxInMemorySize {
+		return nil, errTooBig(format)
+	}
+	return data, nil
+}
+
+func errTooBig(format string) error {
+	return fmt.Errorf("%s: файл больше %d МБ — разбейте выгрузку по периодам", format, MaxInMemorySize>>20)
 }
 
 type BaseImporter struct {
 	parser Importer
+	opts   Options
+}
+
+func NewImporter(p Importer, opts Options) BaseImporter {
+	return BaseImporter{parser: p, opts: opts}
 }
 
-func (b BaseImporter) Import(path string) ([]Row, error) {
-	bin, err := os.ReadFile(path)
+// Import собирает все принятые строки в Parsed.Rows.
+func (b BaseImporter) Import(path string) (Parsed, error) {
+	var rows []Row
+	res, err := b.Each(path, func(r Row) error {
+		rows = append(rows, r)
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return Parsed{}, err
 	}
-	rows, err := b.parser.parse(bin)
+	res.Rows = rows
+	return res, nil
+}
+
+// Each передаёт принятые строки в fn по мере разбора, не собирая их;
+// в результате — счётчики, ошибки и выписки файла. Ошибка fn прерывает разбор.
+func (b BaseImporter) Each(path string, fn func(Row) error) (Parsed, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return Parsed{}, err
+	}
+	defer f.Close()
+
+	res := Parsed{emit: fn, strict: b.opts.Strict}
+	err = b.parser.decode(bufio.NewReaderSize(f, 64*1024), &res)
+	if err == nil {
+		err = res.err
+	}
+	if err == nil && b.opts.Strict && len(res.Issues) > 0 {
+		err = &IssueError{Issue: res.Issues[0]}
+	}
+	if err != nil {
+		return Parsed{}, err
+	}
+	res.emit = nil
+	return res, nil
+}
+
+var errStopRows = errors.New("rows: stopped")
+
+// Rows — принятые строки файла потоком; каждый проход заново читает файл.
+func (b BaseImporter) Rows(path string) RowSeq {
+	return func(yield func(Row, error) bool) {
+		_, err := b.Each(path, func(r Row) error {
+			if !yield(r, nil) {
+				return errStopRows
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopRows) {
+			yield(Row{}, err)
+		}
+	}
+}
+
+// StatementRows — строки i-й выписки из потока строк файла.
+func StatementRows(rows RowSeq, i int) RowSeq {
+	return func(yield func(Row, error) bool) {
+		for r, err := range rows {
+			if err != nil {
+				yield(Row{}, err)
+				return
+			}
+			if r.Statement == i && !yield(r, nil) {
+				return
+			}
+		}
 	}
-	return rows, nil
 }
@@ -0,0 +1,47 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadAllLimit(t *testing.T) {
+	data, err := readAll(strings.NewReader("<OFX>"), "ofx")
+	if err != nil || string(data) != "<OFX>" {
+		t.Fatalf("readAll = %q, %v", data, err)
+	}
+
+	big := io.LimitReader(spaces{}, MaxInMemorySize)
+	if data, err := readAll(big, "ofx"); err != nil || len(data) != MaxInMemorySize {
+		t.Fatalf("readAll at the limit: %d bytes, %v", len(data), err)
+	}
+
+	tests := []struct {
+		name string
+		im   Importer
+		want string
+	}{
+		{"ofx", OFXImporter{}, "ofx: файл больше 32 МБ"},
+		{"camt.053", CAMTImporter{}, "camt.053: файл больше 32 МБ"},
+		{"ledger", LedgerImporter{}, "ledger: файл больше 32 МБ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res Parsed
+			err := tt.im.decode(io.LimitReader(spaces{}, MaxInMemorySize+1), &res)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("decode: err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// spaces — бесконечный поток пробелов.
+type spaces struct{}
+
+func (spaces) Read(p []byte) (int, error) {
+	copy(p, bytes.Repeat([]byte{' '}, len(p)))
+	return len(p), nil
+}
@@ -1,80 +1,152 @@
 package files
 
 import (
-	"context"
+	"bytes"
 	"encoding/json"
-	"time"
-
-	"main/domain"
-	"main/repo"
-
-	"github.com/shopspring/decimal"
+	"fmt"
+	"io"
 )
 
-type opRowJSON struct {
-	Type        int    `json:"type"`        // -1/1
-	Amount      string `json:"amount"`      // "123.45"
-	Date        string `json:"date"`        // "YYYY-MM-DD"
-	Category    string `json:"category"`    // имя категории
-	Description string `json:"description"` // опционально
+// JSONEncoder пишет массив объектов с выбранными колонками; nil — DefaultColumns.
+type JSONEncoder struct {
+	Columns []string
 }
 
-type JSONEncoder struct{}
-
-func (JSONEncoder) EncodeRows(rows []Row) ([]byte, error) {
-	out := make([]opRowJSON, 0, len(rows))
-	for _, r := range rows {
-		out = append(out, opRowJSON{
-			Type:        r.Type,
-			Amount:      r.Amount.StringFixed(2),
-			Date:        r.Date.Format("2006-01-02"),
-			Category:    r.Category,
-			Description: r.Description,
-		})
+// Encode пишет массив по одной записи в том же виде, что json.MarshalIndent.
+func (e JSONEncoder) Encode(out io.Writer, rows RowSeq) error {
+	w := &errWriter{w: out}
+	cols := columns(e.Columns)
+	keys := make([][]byte, len(cols))
+	for i, c := range cols {
+		keys[i], _ = json.Marshal(c)
 	}
-	return json.MarshalIndent(out, "", "  ")
-}
-
-func ExportOperationsJSON(
-	ctx context.Context,
-	ops *repo.PgOperationRepo,
-	cats *repo.PgCategoryRepo,
-	accID domain.AccountID,
-	from, to time.Time,
-	path string,
-) error {
-	return ExportOperations(ctx, ops, cats, accID, from, to, path, JSONEncoder{})
+	n := 0
+	obj := &bytes.Buffer{}
+	for r, err := range rows {
+		if err != nil {
+			return err
+		}
+		obj.Reset()
+		obj.WriteString("{")
+		for i, c := range cols {
+			v, err := json.Marshal(rowValue(r, c))
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				obj.WriteString(",")
+			}
+			obj.WriteString("\n    ")
+			obj.Write(keys[i])
+			obj.WriteString(": ")
+			obj.Write(v)
+		}
+		obj.WriteString("\n  }")
+		if n == 0 {
+			io.WriteString(w, "[\n  ")
+		} else {
+			io.WriteString(w, ",\n  ")
+		}
+		w.Write(obj.Bytes())
+		n++
+	}
+	if n == 0 {
+		io.WriteString(w, "[]")
+	} else {
+		io.WriteString(w, "\n]")
+	}
+	return w.err
 }
 
 type JSONImporter struct{}
 
-func (JSONImporter) parse(data []byte) ([]Row, error) {
-	var in []opRowJSON
-	if err := json.Unmarshal(data, &in); err != nil {
-		return nil, err
+// sniffJSON: массив записей.
+func sniffJSON(head []byte) bool {
+	return len(head) > 0 && head[0] == '['
+}
+
+func (JSONImporter) decode(r io.Reader, res *Parsed) error {
+	lr := &lineReader{r: r}
+	dec := json.NewDecoder(lr)
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('[') {
+		return fmt.Errorf("json: ожидается массив операций")
 	}
-	out := make([]Row, 0, len(in))
-	for _, r := range in {
-		amt, err := decimal.NewFromString(r.Amount)
-		if err != nil {
-			continue
+
+	for record := 1; dec.More(); record++ {
+		if err := res.stopped(); err != nil {
+			return err
 		}
-		dt, err := time.Parse("2006-01-02", r.Date)
-		if err != nil {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("json: запись %d (строка %d): %w", record, lr.lineAt(dec.InputOffset()), err)
+		}
+		// после Decode InputOffset указывает на конец записи
+		line := lr.lineAt(dec.InputOffset() - int64(len(raw)))
+		source := string(raw)
+
+		var in map[string]any
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		if err := d.Decode(&in); err != nil {
+			res.Records++
+			res.reject(line, record, "", "", "запись должна быть объектом", source)
 			continue
 		}
-		out = append(out, Row{
-			Type:        r.Type,
-			Amount:      amt.Round(2),
-			Date:        dt,
-			Category:    r.Category,
-			Description: r.Description,
-		})
+		res.add(line, record, rawRow{
+			Type:        jsonText(in["type"]),
+			Amount:      jsonText(in["amount"]),
+			Date:        jsonText(in["date"]),
+			Category:    jsonText(in["category"]),
+			Description: jsonText(in["description"]),
+		}, source)
+	}
+	return nil
+}
+
+// lineReader помнит позиции переводов строк, которые декодер прочитал, но ещё
+// не разобрал; всё до запрошенного смещения сворачивается в счётчик строк.
+type lineReader struct {
+	r     io.Reader
+	off   int64
+	lines int     // переводов строк до первой позиции в nl
+	nl    []int64 // позиции ещё не учтённых переводов строк
+}
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			l.nl = append(l.nl, l.off+int64(i))
+		}
 	}
-	return out, nil
+	l.off += int64(n)
+	return n, err
 }
 
-func ImportOperationsJSON(path string) ([]Row, error) {
-	base := BaseImporter{parser: JSONImporter{}}
-	return base.Import(path)
+// lineAt — номер строки байта offset; смещения запрашиваются по возрастанию.
+func (l *lineReader) lineAt(offset int64) int {
+	i := 0
+	for i < len(l.nl) && l.nl[i] < offset {
+		i++
+	}
+	l.lines += i
+	l.nl = append(l.nl[:0], l.nl[i:]...)
+	return l.lines + 1
+}
+
+func jsonText(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case json.Number:
+		return x.String()
+	default:
+		b, _ := json.Marshal(x)
+		return string(b)
+	}
 }
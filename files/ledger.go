@@ -0,0 +1,428 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Корни счетов журнала ledger/hledger.
+const (
+	LedgerAssets   = "Assets"
+	LedgerExpenses = "Expenses"
+	LedgerIncome   = "Income"
+)
+
+// LedgerEncoder пишет журнал ledger-cli/hledger: счёт — Assets:<имя>, категории —
+// Expenses:<имя> и Income:<имя>. С Transfers категории переводов ("Перевод: Счёт")
+// становятся Assets:<Счёт>, а не расходом или доходом.
+type LedgerEncoder struct {
+	Account   string // имя счёта приложения
+	Transfers bool
+}
+
+// Encode проходит строки дважды: директивы account идут в начале журнала.
+func (e LedgerEncoder) Encode(w io.Writer, rows RowSeq) error {
+	asset := LedgerAssets + ":" + ledgerName(e.Account)
+	if e.Account == "" {
+		asset = LedgerAssets + ":" + ledgerName(NoCategory)
+	}
+
+	used := map[string]bool{asset: true}
+	for r, err := range rows {
+		if err != nil {
+			return err
+		}
+		used[e.category(r)] = true
+	}
+	names := make([]string, 0, len(used))
+	for n := range used {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	buf := &errWriter{w: w}
+	for _, n := range names {
+		fmt.Fprintf(buf, "account %s\n", n)
+	}
+	for r, err := range rows {
+		if err != nil {
+			return err
+		}
+		amt := r.Amount
+		if r.Type < 0 {
+			amt = amt.Neg()
+		}
+		io.WriteString(buf, "\n"+r.Date.Format("2006-01-02"))
+		if d := qifLine(strings.ReplaceAll(r.Description, ";", ",")); d != "" {
+			io.WriteString(buf, " "+d) // ";" начал бы комментарий
+		}
+		io.WriteString(buf, "\n")
+		fmt.Fprintf(buf, "    %-40s  %12s\n", asset, amt.StringFixed(2))
+		fmt.Fprintf(buf, "    %-40s  %12s\n", e.category(r), amt.Neg().StringFixed(2))
+	}
+	return buf.err
+}
+
+func (e LedgerEncoder) category(r Row) string {
+	c := strings.TrimSpace(r.Category)
+	if c == "" {
+		c = NoCategory
+	}
+	if e.Transfers && strings.HasPrefix(c, TransferPrefix) {
+		return LedgerAssets + ":" + ledgerName(strings.TrimPrefix(c, TransferPrefix))
+	}
+	if r.Type < 0 {
+		return LedgerExpenses + ":" + ledgerName(c)
+	}
+	return LedgerIncome + ":" + ledgerName(c)
+}
+
+// ledgerName: имя счёта заканчивается на двух пробелах или табуляции, поэтому
+// пробелы схлопываются; ":" остаётся разделителем уровней ("Авто:Бензин").
+func ledgerName(s string) string {
+	parts := strings.Split(s, ":")
+	out := parts[:0]
+	for _, p := range parts {
+		if p = strings.Join(strings.Fields(strings.ReplaceAll(p, ";", ",")), " "); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, ":")
+}
+
+// LedgerImporter читает простые журналы: транзакции с датой и описанием и проводками
+// "счёт  сумма" (одна сумма может быть опущена). Директивы, комментарии и
+// периодические транзакции пропускаются. Каждый счёт Assets:<имя> — отдельная
+// выписка (Statement.Account = <имя>); проводки на Expenses:/Income: дают категории,
+// на другой Assets: — перевод ("Перевод: <имя>"), на прочие счета — категорию
+// с полным именем счёта. Транзакция с несколькими категориями делится на строки.
+type LedgerImporter struct {
+	DefaultCategory string
+}
+
+// sniffLedger: строка с датой транзакции, за которой идёт проводка с отступом.
+func sniffLedger(head []byte) bool {
+	return ledgerTxnStart.Match(head)
+}
+
+var ledgerTxnStart = regexp.MustCompile(`(?m)^\d{4}[-/.]\d{1,2}[-/.]\d{1,2}[^\n]*\r?\n[ \t]+\S`)
+
+type ledgerPosting struct {
+	account   string
+	amount    decimal.Decimal
+	commodity string
+	elided    bool
+	line      int
+}
+
+type ledgerTxn struct {
+	line     int
+	date     string
+	desc     string
+	postings []ledgerPosting
+	source   []string
+}
+
+var ledgerHeader = regexp.MustCompile(`^(\d{4}[-/.]\d{1,2}[-/.]\d{1,2})(?:=\S+)?\s*(?:[*!]\s*)?(?:\([^)]*\)\s*)?(.*)$`)
+
+// decode читает файл целиком: сумма, опущенная в проводке, выводится из остальных.
+func (im LedgerImporter) decode(r io.Reader, res *Parsed) error {
+	data, err := readAll(r, "ledger")
+	if err != nil {
+		return err
+	}
+	txns, issues, err := readLedger(data)
+	if err != nil {
+		return err
+	}
+	category := im.DefaultCategory
+	if strings.TrimSpace(category) == "" {
+		category = NoCategory
+	}
+
+	stmts := map[string]int{}
+	statement := func(name string) int {
+		if i, ok := stmts[name]; ok {
+			return i
+		}
+		res.Statements = append(res.Statements, Statement{Account: name})
+		stmts[name] = len(res.Statements) - 1
+		return stmts[name]
+	}
+
+	record := 0
+	for _, t := range txns {
+		record++
+		source := strings.Join(t.source, "\n")
+		if is, ok := issues[t.line]; ok {
+			res.Records++
+			res.reject(is.Line, record, is.Field, is.Raw, is.Reason, source)
+			continue
+		}
+		if err := t.balance(); err != nil {
+			res.Records++
+			res.reject(t.line, record, "", "", err.Error(), source)
+			continue
+		}
+		var assets, others []ledgerPosting
+		for _, p := range t.postings {
+			if ledgerRoot(p.account) == LedgerAssets {
+				assets = append(assets, p)
+			} else {
+				others = append(others, p)
+			}
+		}
+		switch {
+		case len(assets) == 0:
+			res.Records++
+			res.reject(t.line, record, "", "", "нет проводки на счёт Assets:…", source)
+			continue
+		case len(assets) > 1 && len(others) > 0:
+			res.Records++
+			res.reject(t.line, record, "", "", "несколько счетов Assets и категорий в одной транзакции не поддерживаются", source)
+			continue
+		}
+		// перевод между счетами: каждая сторона получает категорию-перевод на другую
+		if len(assets) > 1 {
+			for i, a := range assets {
+				for j, b := range assets {
+					if i == j {
+						continue
+					}
+					res.addWith(canonicalSigned, t.line, record, rawRow{
+						Amount:      b.amount.Neg().String(),
+						Date:        t.date,
+						Category:    TransferPrefix + ledgerLeaf(b.account),
+						Description: t.desc,
+						Statement:   statement(ledgerLeaf(a.account)),
+						line:        map[string]int{"amount": a.line, "category": b.line},
+					}, source)
+				}
+			}
+			continue
+		}
+		st := statement(ledgerLeaf(assets[0].account))
+		for _, o := range others {
+			res.addWith(canonicalSigned, t.line, record, rawRow{
+				Amount:      o.amount.Neg().String(),
+				Date:        t.date,
+				Category:    ledgerCategory(o.account, category),
+				Description: t.desc,
+				Statement:   st,
+				line:        map[string]int{"amount": o.line, "category": o.line},
+			}, source)
+		}
+	}
+	if len(txns) == 0 {
+		return fmt.Errorf("ledger: в журнале нет транзакций")
+	}
+	return nil
+}
+
+// canonicalSigned — ГГГГ-ММ-ДД и сумма со знаком: плюс — доход.
+var canonicalSigned = fieldFormat{dateLayout: "2006-01-02", dateHint: "ГГГГ-ММ-ДД", signed: 1}
+
+// balance подставляет опущенную сумму и проверяет, что проводки дают ноль.
+func (t *ledgerTxn) balance() error {
+	sum := decimal.Zero
+	elided := -1
+	commodity := ""
+	for i, p := range t.postings {
+		if p.elided {
+			if elided >= 0 {
+				return fmt.Errorf("сумма опущена больше чем у одной проводки")
+			}
+			elided = i
+			continue
+		}
+		if commodity == "" {
+			commodity = p.commodity
+		} else if p.commodity != "" && p.commodity != commodity {
+			return fmt.Errorf("несколько валют в одной транзакции (%s, %s) не поддерживаются", commodity, p.commodity)
+		}
+		sum = sum.Add(p.amount)
+	}
+	if len(t.postings) < 2 {
+		return fmt.Errorf("в транзакции меньше двух проводок")
+	}
+	if elided >= 0 {
+		t.postings[elided].amount = sum.Neg()
+		t.postings[elided].elided = false
+		return nil
+	}
+	if !sum.IsZero() {
+		return fmt.Errorf("транзакция не сбалансирована: сумма проводок %s", sum.StringFixed(2))
+	}
+	return nil
+}
+
+// readLedger делит журнал на транзакции. Ошибки разбора отдельной транзакции
+// возвращаются по строке её заголовка.
+func readLedger(data []byte) ([]ledgerTxn, map[int]Issue, error) {
+	sc := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var out []ledgerTxn
+	issues := map[int]Issue{}
+	var cur *ledgerTxn
+	skip := false // внутри директивы или периодической транзакции
+	flush := func() {
+		if cur != nil {
+			out = append(out, *cur)
+			cur = nil
+		}
+	}
+	for line := 1; sc.Scan(); line++ {
+		raw := strings.TrimRight(sc.Text(), "\r")
+		s := strings.TrimSpace(raw)
+		indented := raw != "" && (raw[0] == ' ' || raw[0] == '\t')
+
+		switch {
+		case s == "":
+			flush()
+			skip = false
+			continue
+		case strings.ContainsRune(";#*%|", rune(s[0])) && !indented, s[0] == ';':
+			continue // комментарий
+		case !indented:
+			flush()
+			skip = false
+			m := ledgerHeader.FindStringSubmatch(s)
+			if m == nil {
+				skip = true // account, commodity, include, P, ~, = и прочие директивы
+				continue
+			}
+			cur = &ledgerTxn{line: line, date: ledgerDate(m[1]), desc: ledgerComment(m[2]), source: []string{raw}}
+			if i := strings.IndexByte(cur.desc, '|'); i >= 0 { // hledger: "получатель | примечание"
+				cur.desc = joinDescription(cur.desc[:i], cur.desc[i+1:])
+			}
+			continue
+		}
+		if skip || cur == nil {
+			continue
+		}
+		cur.source = append(cur.source, raw)
+		p, err := parsePosting(s, line)
+		if err != nil {
+			if _, seen := issues[cur.line]; !seen {
+				issues[cur.line] = Issue{Line: line, Field: "amount", Raw: s, Reason: err.Error()}
+			}
+			continue
+		}
+		if p.account != "" {
+			cur.postings = append(cur.postings, p)
+		}
+	}
+	flush()
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	return out, issues, nil
+}
+
+var ledgerNumber = regexp.MustCompile(`\d[\d ,.']*`)
+
+// parsePosting: "Expenses:Еда  12.50 RUB ; комментарий"; "(счёт)" и "[счёт]" —
+// виртуальные проводки; "= 100" (проверка остатка) и "@ цена" отбрасываются.
+func parsePosting(s string, line int) (ledgerPosting, error) {
+	s = ledgerComment(s)
+	if s == "" {
+		return ledgerPosting{}, nil
+	}
+	name, rest := s, ""
+	if i := strings.Index(s, "  "); i >= 0 {
+		name, rest = s[:i], strings.TrimSpace(s[i:])
+	}
+	if i := strings.IndexByte(s, '\t'); i >= 0 && i < len(name) {
+		name, rest = s[:i], strings.TrimSpace(s[i:])
+	}
+	name = strings.Trim(strings.TrimSpace(name), "()[]")
+	if len(name) > 2 && (name[0] == '*' || name[0] == '!') && name[1] == ' ' {
+		name = strings.TrimSpace(name[2:])
+	}
+	p := ledgerPosting{account: name, line: line}
+	if i := strings.IndexAny(rest, "=@"); i >= 0 {
+		rest = strings.TrimSpace(rest[:i])
+	}
+	if rest == "" {
+		p.elided = true
+		return p, nil
+	}
+	// знак может стоять и перед валютой: "-$12.50", "$-12.50", "-12.50 RUB"
+	neg := strings.Contains(rest, "-")
+	rest = strings.Replace(rest, "-", "", 1)
+	num := ledgerNumber.FindString(rest)
+	if num == "" {
+		return p, fmt.Errorf("сумма не найдена")
+	}
+	amt, err := decimal.NewFromString(qifAmount(strings.ReplaceAll(num, "'", "")))
+	if err != nil {
+		return p, fmt.Errorf("%q: не число", strings.TrimSpace(num))
+	}
+	if neg {
+		amt = amt.Neg()
+	}
+	p.amount = amt
+	p.commodity = strings.TrimSpace(strings.Replace(rest, num, "", 1))
+	return p, nil
+}
+
+// ledgerComment отрезает комментарий: hledger считает им всё после ";".
+func ledgerComment(s string) string {
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// ledgerDate: 2025/1/5 и 2025.01.05 → 2025-01-05.
+func ledgerDate(s string) string {
+	p := strings.FieldsFunc(s, func(r rune) bool { return r == '-' || r == '/' || r == '.' })
+	if len(p) != 3 {
+		return s
+	}
+	m, err1 := strconv.Atoi(p[1])
+	d, err2 := strconv.Atoi(p[2])
+	if err1 != nil || err2 != nil {
+		return s
+	}
+	return fmt.Sprintf("%s-%02d-%02d", p[0], m, d)
+}
+
+func ledgerRoot(account string) string {
+	root, _, _ := strings.Cut(account, ":")
+	return root
+}
+
+// ledgerLeaf — имя без корня: Assets:Карта → Карта, Assets:Банк:Карта → Банк:Карта.
+func ledgerLeaf(account string) string {
+	_, rest, ok := strings.Cut(account, ":")
+	if !ok {
+		return account
+	}
+	return rest
+}
+
+func ledgerCategory(account, def string) string {
+	switch ledgerRoot(account) {
+	case LedgerExpenses, LedgerIncome:
+		leaf := ledgerLeaf(account)
+		// без Transfers перевод выгружается как Expenses:Перевод:<счёт>
+		if rest, ok := strings.CutPrefix(leaf, strings.TrimSpace(TransferPrefix)); ok && rest != "" {
+			return TransferPrefix + rest
+		}
+		if leaf != account && leaf != "" {
+			return leaf
+		}
+		return def
+	}
+	return account
+}
@@ -0,0 +1,215 @@
+package files
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLedgerImporter(t *testing.T) {
+	tests := []struct {
+		name       string
+		im         LedgerImporter
+		src        string
+		rows       []string
+		statements []string
+		stmtIndex  []int
+		issues     []string
+	}{
+		{
+			name: "директивы, комментарии, опущенная сумма",
+			src: `; журнал
+account Assets:Карта
+commodity RUB
+
+2024/1/5 * (42) Магазин | продукты ; чек
+    Expenses:Еда            1 500,50 RUB
+    Assets:Карта
+
+2024.01.10 Зарплата
+    Assets:Карта    50000 RUB ; аванс
+    Income:Зарплата  -50000 RUB
+
+~ monthly
+    Expenses:Аренда  100
+    Assets:Карта
+`,
+			rows: []string{
+				"-1 1500.50 2024-01-05 Еда | Магазин — продукты",
+				"1 50000.00 2024-01-10 Зарплата | Зарплата",
+			},
+			statements: []string{"Карта  -→-"},
+		},
+		{
+			name: "несколько категорий и прочие счета",
+			im:   LedgerImporter{DefaultCategory: "Прочее"},
+			src: `2024-02-01 Гипермаркет
+    Expenses:Еда:Овощи   $200.00
+    Expenses:Быт         $-12.50 ; возврат
+    Liabilities:Кредит   $10
+    Expenses             $2.50
+    Assets:Банк:Карта
+`,
+			rows: []string{
+				"-1 200.00 2024-02-01 Еда:Овощи | Гипермаркет",
+				"1 12.50 2024-02-01 Быт | Гипермаркет",
+				"-1 10.00 2024-02-01 Liabilities:Кредит | Гипермаркет",
+				"-1 2.50 2024-02-01 Прочее | Гипермаркет",
+			},
+			statements: []string{"Банк:Карта  -→-"},
+		},
+		{
+			name: "перевод между счетами — строка в каждой выписке",
+			src: `2024-03-01 В копилку
+    Assets:Сбережения   1000
+    Assets:Карта       -1000
+`,
+			rows: []string{
+				"1 1000.00 2024-03-01 Перевод: Карта | В копилку",
+				"-1 1000.00 2024-03-01 Перевод: Сбережения | В копилку",
+			},
+			statements: []string{"Сбережения  -→-", "Карта  -→-"},
+			stmtIndex:  []int{0, 1},
+		},
+		{
+			name: "ошибки транзакций",
+			src: `2024-04-01 не сходится
+    Expenses:Еда   10
+    Assets:Карта  -9
+
+2024-04-02 две опущенные
+    Expenses:Еда
+    Assets:Карта
+
+2024-04-03 две валюты
+    Expenses:Еда   10 USD
+    Assets:Карта  -10 EUR
+
+2024-04-04 без счёта
+    Expenses:Еда     10
+    Income:Возврат  -10
+
+2024-04-05 плохая сумма
+    Expenses:Еда   abc
+    Assets:Карта
+
+2024-04-06 одна проводка
+    Assets:Карта   10
+
+2024-04-07 два счёта и категория
+    Assets:Карта       -10
+    Assets:Сбережения    5
+    Expenses:Еда         5
+
+2024-04-08 ок
+    Expenses:Еда   1
+    Assets:Карта
+`,
+			rows:       []string{"-1 1.00 2024-04-08 Еда | ок"},
+			statements: []string{"Карта  -→-"},
+			issues: []string{
+				"1 : транзакция не сбалансирована: сумма проводок 1.00",
+				"2 : сумма опущена больше чем у одной проводки",
+				"3 : несколько валют в одной транзакции (USD, EUR) не поддерживаются",
+				"4 : нет проводки на счёт Assets:…",
+				"5 amount: сумма не найдена",
+				"6 : в транзакции меньше двух проводок",
+				"7 : несколько счетов Assets и категорий в одной транзакции не поддерживаются",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := decodeString(t, tt.im, tt.src)
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n got %q\nwant %q", got, tt.rows)
+			}
+			if got := statementsText(res.Statements); !reflect.DeepEqual(got, tt.statements) {
+				t.Errorf("statements:\n got %q\nwant %q", got, tt.statements)
+			}
+			if got := issuesText(res.Issues); !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("issues:\n got %q\nwant %q", got, tt.issues)
+			}
+			if tt.stmtIndex != nil {
+				var got []int
+				for _, r := range res.Rows {
+					got = append(got, r.Statement)
+				}
+				if !reflect.DeepEqual(got, tt.stmtIndex) {
+					t.Errorf("statement index: got %v, want %v", got, tt.stmtIndex)
+				}
+			}
+		})
+	}
+}
+
+func TestLedgerImporterEmpty(t *testing.T) {
+	var res Parsed
+	err := LedgerImporter{}.decode(strings.NewReader("account Assets:Карта\n; пусто\n"), &res)
+	if err == nil || !strings.Contains(err.Error(), "нет транзакций") {
+		t.Fatalf("err = %v, want 'нет транзакций'", err)
+	}
+}
+
+func TestLedgerRoundTrip(t *testing.T) {
+	rows := []Row{
+		testRow(-1, "1500.5", "2024-01-05", "Еда", "Магазин; у дома"),
+		testRow(1, "50000", "2024-01-10", "Зарплата", ""),
+		testRow(-1, "30", "2024-01-11", "Авто:  Бензин", "АЗС"),
+		testRow(-1, "1000", "2024-01-12", TransferPrefix+"Сбережения", "В копилку"),
+		testRow(1, "7", "2024-01-13", "", ""),
+	}
+	tests := []struct {
+		name       string
+		enc        LedgerEncoder
+		rows       []string
+		statements []string
+	}{
+		{
+			name: "переводы как категории",
+			enc:  LedgerEncoder{Account: "Карта  Visa"},
+			rows: []string{
+				"-1 1500.50 2024-01-05 Еда | Магазин, у дома",
+				"1 50000.00 2024-01-10 Зарплата | ",
+				"-1 30.00 2024-01-11 Авто:Бензин | АЗС",
+				"-1 1000.00 2024-01-12 Перевод: Сбережения | В копилку",
+				"1 7.00 2024-01-13 Без категории | ",
+			},
+			statements: []string{"Карта Visa  -→-"},
+		},
+		{
+			name: "переводы как счета",
+			enc:  LedgerEncoder{Account: "Карта  Visa", Transfers: true},
+			rows: []string{
+				"-1 1500.50 2024-01-05 Еда | Магазин, у дома",
+				"1 50000.00 2024-01-10 Зарплата | ",
+				"-1 30.00 2024-01-11 Авто:Бензин | АЗС",
+				"-1 1000.00 2024-01-12 Перевод: Сбережения | В копилку",
+				"1 1000.00 2024-01-12 Перевод: Карта Visa | В копилку",
+				"1 7.00 2024-01-13 Без категории | ",
+			},
+			statements: []string{"Карта Visa  -→-", "Сбережения  -→-"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := EncodeRows(tt.enc, rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sniffLedger(out) {
+				t.Errorf("sniffLedger не узнал журнал:\n%s", out)
+			}
+			res := decodeString(t, LedgerImporter{}, string(out))
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n got %q\nwant %q\nfile:\n%s", got, tt.rows, out)
+			}
+			if got := statementsText(res.Statements); !reflect.DeepEqual(got, tt.statements) {
+				t.Errorf("statements:\n got %q\nwant %q", got, tt.statements)
+			}
+			if len(res.Issues) > 0 {
+				t.Errorf("issues: %q", issuesText(res.Issues))
+			}
+		})
+	}
+}
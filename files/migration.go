@@ -0,0 +1,244 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Общее для выгрузок других приложений учёта (Дзен-мани, CoinKeeper): в одном
+// файле операции нескольких счетов, у каждого счёта своя валюта. Каждый счёт
+// файла — отдельная выписка Parsed.Statements; меню сопоставляет её со
+// счётом по имени или создаёт новый. Перевод между счетами — две строки:
+// расход в одном счёте и доход в другом с категорией TransferPrefix + имя
+// второго счёта, как в QIF и ledger.
+
+// appRecord — запись CSV: строка файла, номер записи и поля.
+type appRecord struct {
+	line, record int
+	fields       []string
+	date         time.Time // для сортировки; нулевая — не разобрана
+}
+
+// readAppCSV читает таблицу целиком: разделитель (',' или ';') берётся из
+// заголовка, BOM отбрасывается, колонки ищутся по именам names (у каждой
+// несколько вариантов: английский и русский заголовок). Приложения выгружают
+// операции от новых к старым, а импорт считает баланс по порядку строк,
+// поэтому записи сортируются по колонке "date" (устойчиво) — и поэтому файл
+// больше MaxInMemorySize отклоняется. tableOnly — таблица операций кончается на
+// первой строке с другим числом колонок (дальше в файле итоги).
+func readAppCSV(in io.Reader, app string, names map[string][]string, required []string, tableOnly bool) (map[string]int, []appRecord, error) {
+	lr := &io.LimitedReader{R: skipBOM(in), N: MaxInMemorySize + 1}
+	tooBig := func() error { return errTooBig(app) }
+	br := bufio.NewReader(lr)
+	first, _ := br.Peek(4096)
+	first, _, _ = bytes.Cut(first, []byte("\n"))
+	r := csv.NewReader(br)
+	if bytes.Count(first, []byte(";")) > bytes.Count(first, []byte(",")) {
+		r.Comma = ';'
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	header, err := r.Read()
+	if err != nil && lr.N <= 0 {
+		return nil, nil, tooBig()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: заголовок: %w", app, err)
+	}
+	cols := map[string]int{}
+	for field, aliases := range names {
+		for i, h := range header {
+			if slices.Contains(aliases, strings.ToLower(strings.TrimSpace(h))) {
+				cols[field] = i
+				break
+			}
+		}
+	}
+	for _, f := range required {
+		if _, ok := cols[f]; !ok {
+			return nil, nil, fmt.Errorf("%s: в заголовке нет колонки %q", app, names[f][0])
+		}
+	}
+
+	var recs []appRecord
+	for n := 1; ; n++ {
+		rec, err := r.Read()
+		if err != nil && lr.N <= 0 {
+			return nil, nil, tooBig()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", app, err)
+		}
+		if tableOnly && len(rec) != len(header) {
+			break
+		}
+		line, _ := r.FieldPos(0)
+		date, _ := parseAppDate(appField(rec, cols, "date"))
+		recs = append(recs, appRecord{line: line, record: n, fields: rec, date: date})
+	}
+	if lr.N <= 0 {
+		// последняя запись обрезана пределом и могла оборвать таблицу раньше времени
+		return nil, nil, tooBig()
+	}
+	slices.SortStableFunc(recs, func(a, b appRecord) int { return a.date.Compare(b.date) })
+	return cols, recs, nil
+}
+
+// appField — поле записи по имени колонки; "" — колонки нет или строка короче.
+func appField(rec []string, cols map[string]int, field string) string {
+	i, ok := cols[field]
+	if !ok || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+// appFormat — даты и суммы после appDate/appAmount.
+var appFormat = fieldFormat{dateLayout: time.DateOnly, dateHint: "ГГГГ-ММ-ДД, ДД.ММ.ГГГГ или ММ/ДД/ГГГГ"}
+
+// appDateLayouts — форматы дат выгрузок; время после даты отбрасывается.
+var appDateLayouts = []string{time.DateOnly, "2.1.2006", "1/2/2006"}
+
+func parseAppDate(s string) (time.Time, bool) {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), " ")
+	for _, l := range appDateLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// appDate — дата в ГГГГ-ММ-ДД; неразобранная возвращается как есть (её отклонит addWith).
+func appDate(s string) string {
+	if t, ok := parseAppDate(s); ok {
+		return t.Format(time.DateOnly)
+	}
+	return s
+}
+
+// appAmount читает сумму с точкой или запятой; пусто — ноль.
+func appAmount(s string) (decimal.Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return decimal.Zero, nil
+	}
+	return parseAmount(s, strings.Contains(s, ",") && !strings.Contains(s, "."))
+}
+
+// appBook раскладывает строки файла по выпискам-счетам.
+type appBook struct {
+	res   *Parsed
+	index map[string]int // имя счёта без учёта регистра → выписка
+}
+
+func newAppBook(res *Parsed) *appBook {
+	return &appBook{res: res, index: map[string]int{}}
+}
+
+// statement — выписка счёта; reason != "" — валюта строки не та, в которой счёт уже встречался.
+func (b *appBook) statement(account, currency string) (i int, reason string) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	key := strings.ToLower(account)
+	i, ok := b.index[key]
+	if !ok {
+		b.res.Statements = append(b.res.Statements, Statement{Account: account, Currency: currency})
+		b.index[key] = len(b.res.Statements) - 1
+		return len(b.res.Statements) - 1, ""
+	}
+	st := &b.res.Statements[i]
+	switch {
+	case currency == "" || currency == st.Currency:
+	case st.Currency == "":
+		st.Currency = currency
+	default:
+		return i, fmt.Sprintf("валюта %s, а счёт «%s» в файле в %s", currency, account, st.Currency)
+	}
+	return i, ""
+}
+
+// appEntry — одна сторона записи: операция в счёте account.
+type appEntry struct {
+	account, currency string
+	amount            decimal.Decimal
+	typ               int
+	category          string
+}
+
+// add принимает стороны записи — все или ни одной: нет счёта или не та
+// валюта у одной стороны перевода отклоняет запись целиком.
+func (b *appBook) add(rec appRecord, source, date, desc string, entries ...appEntry) {
+	sts := make([]int, len(entries))
+	for i, e := range entries {
+		if e.account == "" {
+			b.res.Records++
+			b.res.reject(rec.line, rec.record, "account", "", "не указан счёт", source)
+			return
+		}
+		st, reason := b.statement(e.account, e.currency)
+		if reason != "" {
+			b.res.Records++
+			b.res.reject(rec.line, rec.record, "currency", e.currency, reason, source)
+			return
+		}
+		sts[i] = st
+	}
+	for i, e := range entries {
+		b.res.addWith(appFormat, rec.line, rec.record, rawRow{
+			Type:        fmt.Sprint(e.typ),
+			Amount:      e.amount.String(),
+			Date:        date,
+			Category:    e.category,
+			Description: desc,
+			Statement:   sts[i],
+		}, source)
+	}
+}
+
+// transfer — перевод: расход в from и доход в to, каждая сторона со своей суммой и валютой.
+func (b *appBook) transfer(rec appRecord, source string, from, to appEntry, date, desc string) {
+	from.typ, from.category = -1, TransferPrefix+to.account
+	to.typ, to.category = 1, TransferPrefix+from.account
+	b.add(rec, source, date, desc, from, to)
+}
+
+// headerCells — ячейки первой строки в нижнем регистре, без кавычек.
+func headerCells(head []byte) []string {
+	first, _, _ := bytes.Cut(head, []byte("\n"))
+	cells := strings.FieldsFunc(string(first), func(r rune) bool { return r == ',' || r == ';' })
+	for i, c := range cells {
+		cells[i] = strings.ToLower(strings.Trim(strings.TrimSpace(c), `"`))
+	}
+	return cells
+}
+
+// joinNonEmpty склеивает непустые части описания.
+func joinNonEmpty(sep string, parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
+
+// defaultCategory — категория для записей без категории.
+func defaultCategory(c string) string {
+	if strings.TrimSpace(c) == "" {
+		return NoCategory
+	}
+	return c
+}
@@ -0,0 +1,138 @@
+package files
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppBookStatement(t *testing.T) {
+	var res Parsed
+	b := newAppBook(&res)
+	steps := []struct {
+		account, currency string
+		i                 int
+		reason            string
+	}{
+		{"Карта", "rub", 0, ""},
+		{"карта", "RUB", 0, ""},
+		{"Наличные", "", 1, ""},
+		{"наличные", "usd", 1, ""},
+		{"Наличные", "EUR", 1, "валюта EUR, а счёт «Наличные» в файле в USD"},
+		{"Карта", "", 0, ""},
+	}
+	for _, s := range steps {
+		i, reason := b.statement(s.account, s.currency)
+		if i != s.i || reason != s.reason {
+			t.Errorf("statement(%q, %q) = %d, %q; want %d, %q", s.account, s.currency, i, reason, s.i, s.reason)
+		}
+	}
+	want := []string{"Карта RUB -→-", "Наличные USD -→-"}
+	if got := statementsText(res.Statements); !reflect.DeepEqual(got, want) {
+		t.Errorf("statements:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestReadAppCSV(t *testing.T) {
+	names := map[string][]string{"date": {"date", "дата"}, "name": {"name"}}
+	tests := []struct {
+		name      string
+		src       string
+		tableOnly bool
+		recs      []string // "строка/запись поле"
+	}{
+		{
+			name: "BOM, ';' и устойчивая сортировка по дате",
+			src:  "\ufeffДата;name\n2024-03-02;b\n01.03.2024;a\n2024-03-02 10:00;c\nbad;d\n",
+			recs: []string{"5/4 d", "3/2 a", "2/1 b", "4/3 c"},
+		},
+		{
+			name:      "таблица кончается на строке с другим числом колонок",
+			src:       "date,name\n2024-01-01,a\n\nTotal\n2024-01-02,b\n",
+			tableOnly: true,
+			recs:      []string{"2/1 a"},
+		},
+		{
+			name: "без tableOnly читается весь файл",
+			src:  "date,name\n2024-01-02,b\nTotal\n2024-01-01,a\n",
+			recs: []string{"3/2 ", "4/3 a", "2/1 b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cols, recs, err := readAppCSV(strings.NewReader(tt.src), "app", names, []string{"date"}, tt.tableOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range recs {
+				got = append(got, strconv.Itoa(r.line)+"/"+strconv.Itoa(r.record)+" "+appField(r.fields, cols, "name"))
+			}
+			if !reflect.DeepEqual(got, tt.recs) {
+				t.Errorf("records:\n got %q\nwant %q", got, tt.recs)
+			}
+		})
+	}
+}
+
+func TestReadAppCSVErrors(t *testing.T) {
+	names := map[string][]string{"date": {"date"}, "amount": {"amount", "сумма"}}
+	tests := []struct {
+		name, src, want string
+	}{
+		{"пустой файл", "", "app: заголовок"},
+		{"нет колонки", "date,note\n", `app: в заголовке нет колонки "amount"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readAppCSV(strings.NewReader(tt.src), "app", names, []string{"date", "amount"}, false)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAppDate(t *testing.T) {
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	for src, want := range map[string]time.Time{
+		"2024-03-05":          day,
+		"2024-03-05 10:00:00": day,
+		"5.3.2024":            day,
+		"05.03.2024 12:30":    day,
+		"3/5/2024":            day,
+		" 03/05/2024 ":        day,
+		"2024.03.05":          {},
+		"":                    {},
+	} {
+		got, ok := parseAppDate(src)
+		if !got.Equal(want) || ok == want.IsZero() {
+			t.Errorf("parseAppDate(%q) = %v, %v; want %v", src, got, ok, want)
+		}
+	}
+	if got := appDate("вчера"); got != "вчера" {
+		t.Errorf("appDate(%q) = %q, want it unchanged", "вчера", got)
+	}
+}
+
+func TestAppAmount(t *testing.T) {
+	for src, want := range map[string]string{
+		"":         "0",
+		"12.50":    "12.5",
+		"12,50":    "12.5",
+		"1 000,50": "1000.5",
+		"-3":       "-3",
+		"1,000.25": "",
+		"abc":      "",
+	} {
+		got, err := appAmount(src)
+		switch {
+		case want == "" && err == nil:
+			t.Errorf("appAmount(%q) = %s, want error", src, got)
+		case want != "" && (err != nil || got.String() != want):
+			t.Errorf("appAmount(%q) = %s, %v; want %s", src, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// MT940Importer читает выписки SWIFT MT940: :20: начинает выписку, :25: — счёт,
+// :60F:/:60M: — входящий остаток, :61: — запись, :86: — её описание, :62F:/:62M: —
+// исходящий остаток. Остальные теги (:28C:, :64:, :65: ...) пропускаются. Если
+// входящий остаток плюс записи не дают исходящий, это фиксируется как ошибка выписки.
+type MT940Importer struct {
+	DefaultCategory string
+}
+
+// sniffMT940: теги :20: и :25: в начале строк.
+func sniffMT940(head []byte) bool {
+	return mt940Tags.Match(head)
+}
+
+var mt940Tags = regexp.MustCompile(`(?m)^:20:[^\n]*\n(?:[^\n]*\n)*?:25:`)
+
+var mt940Format = fieldFormat{dateLayout: "2006-01-02", dateHint: "ГГММДД", signed: 1}
+
+// :61: ГГММДД[ММДД]{C|D|RC|RD}[код средств]сумма{N|F|S}XXX реф.клиента[//реф.банка][\n доп.сведения]
+var mt940Line61 = regexp.MustCompile(`^(\d{6})(\d{4})?(R?[CD])([A-Z])?(\d+,\d*)([NFS][A-Z0-9]{3})([^/\n]*)(?://([^\n]*))?(?:\n(.*))?$`)
+
+// :60F: и :62F: — {C|D}ГГММДД валюта сумма
+var mt940Balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})(\d+,\d*)$`)
+
+type mt940Field struct {
+	tag   string
+	value string
+	line  int
+}
+
+// decode читает файл по полям: запись :61: разбирается, как только известно,
+// есть ли у неё :86:.
+func (im MT940Importer) decode(r io.Reader, res *Parsed) error {
+	category := im.DefaultCategory
+	if strings.TrimSpace(category) == "" {
+		category = NoCategory
+	}
+
+	record := 0
+	var st *Statement
+	var movement decimal.Decimal
+	closingLine := 0
+	// finish проверяет выписку: входящий + движение = исходящий
+	finish := func() {
+		if st == nil {
+			return
+		}
+		if st.Opening != nil && st.Closing != nil {
+			if want := st.Opening.Amount.Add(movement); !want.Equal(st.Closing.Amount) {
+				res.reject(closingLine, 0, "balance", st.Closing.Amount.StringFixed(2),
+					fmt.Sprintf("входящий остаток %s и записи (%s) дают %s, а в выписке %s",
+						st.Opening.Amount.StringFixed(2), movement.StringFixed(2),
+						want.StringFixed(2), st.Closing.Amount.StringFixed(2)), "")
+			}
+		}
+		res.Statements = append(res.Statements, *st)
+		st = nil
+	}
+	start := func() {
+		finish()
+		st = &Statement{}
+		movement = decimal.Zero
+		closingLine = 0
+	}
+	// entry разбирает запись :61: с её :86: (info == nil — описания нет)
+	entry := func(f mt940Field, info *mt940Field) {
+		record++
+		source := ":61:" + f.value
+		desc := ""
+		if info != nil {
+			desc = mt940Description(info.value)
+			source += "\n:86:" + info.value
+		}
+		m := mt940Line61.FindStringSubmatch(f.value)
+		if m == nil {
+			res.Records++
+			res.reject(f.line, record, "61", firstLine(f.value), "не разобрана строка :61: (ожидается ГГММДД[ММДД]C|D сумма тип ...)", source)
+			return
+		}
+		amount := strings.Replace(m[5], ",", ".", 1)
+		if strings.HasSuffix(amount, ".") {
+			amount += "0"
+		}
+		// RC — сторно прихода (списание), RD — сторно списания (приход)
+		if m[3] == "D" || m[3] == "RC" {
+			amount = "-" + amount
+		}
+		if desc == "" {
+			desc = strings.TrimSpace(m[9])
+		}
+		ext := strings.TrimSpace(m[8])
+		if strings.EqualFold(ext, "NONREF") {
+			ext = ""
+		}
+		accepted := res.Accepted
+		res.addWith(mt940Format, f.line, record, rawRow{
+			Amount:      amount,
+			Date:        mt940Date(m[1], m[2]),
+			Category:    category,
+			Description: desc,
+			ExternalID:  ext,
+			Statement:   len(res.Statements),
+		}, source)
+		// в движение идут только принятые записи: остаток сверяется с тем, что попадёт в базу
+		if res.Accepted > accepted {
+			v, _ := decimal.NewFromString(amount)
+			movement = movement.Add(v.Round(2))
+		}
+	}
+
+	var pending *mt940Field // :61:, ждущая возможного :86:
+	for f, err := range mt940Fields(r) {
+		if err != nil {
+			return err
+		}
+		if pending != nil {
+			p := *pending
+			pending = nil
+			if f.tag == "86" {
+				entry(p, &f)
+				continue
+			}
+			entry(p, nil)
+		}
+		if st == nil && f.tag != "20" {
+			start() // выписка без :20: — бывает у выгрузок без заголовка
+		}
+		switch f.tag {
+		case "20":
+			start()
+		case "25":
+			st.Account = strings.ReplaceAll(strings.TrimSpace(f.value), " ", "")
+		case "60F", "60M":
+			b, cur, err := mt940BalanceOf(f.value)
+			if err != nil {
+				return fmt.Errorf("mt940: строка %d: :%s: %w", f.line, f.tag, err)
+			}
+			if st.Opening == nil {
+				st.Opening, st.Currency = &b, cur
+			}
+		case "62F", "62M":
+			b, _, err := mt940BalanceOf(f.value)
+			if err != nil {
+				return fmt.Errorf("mt940: строка %d: :%s: %w", f.line, f.tag, err)
+			}
+			if st.Closing == nil || f.tag == "62F" {
+				st.Closing, closingLine = &b, f.line
+			}
+		case "61":
+			pending = &f
+		}
+	}
+	if pending != nil {
+		entry(*pending, nil)
+	}
+	finish()
+	if len(res.Statements) == 0 {
+		return fmt.Errorf("mt940: в файле нет выписок (:20:/:61:)")
+	}
+	return nil
+}
+
+// mt940Fields отдаёт поля по одному: тег ":XX:" в начале строки открывает поле,
+// следующие строки без тега — его продолжение, поэтому поле отдаётся, когда
+// начинается следующее. Заголовки SWIFT ({1:...}{2:...}{4:) и разделители
+// выписок ("-", "-}") пропускаются.
+func mt940Fields(r io.Reader) iter.Seq2[mt940Field, error] {
+	return func(yield func(mt940Field, error) bool) {
+		sc := bufio.NewScanner(skipBOM(r))
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		var cur *mt940Field
+		for line := 1; sc.Scan(); line++ {
+			s := strings.TrimRight(sc.Text(), "\r ")
+			if i := strings.Index(s, "{4:"); strings.HasPrefix(s, "{") && i >= 0 {
+				s = s[i+3:]
+			}
+			switch {
+			case s == "" || s == "-" || s == "-}" || strings.HasPrefix(s, "{"):
+				continue
+			case len(s) > 3 && s[0] == ':':
+				if end := strings.IndexByte(s[1:], ':'); end > 0 && end <= 4 {
+					if cur != nil && !yield(*cur, nil) {
+						return
+					}
+					cur = &mt940Field{tag: s[1 : end+1], value: s[end+2:], line: line}
+					continue
+				}
+			}
+			if cur == nil {
+				yield(mt940Field{}, fmt.Errorf("mt940: строка %d: ожидается тег вида :20:", line))
+				return
+			}
+			cur.value += "\n" + s
+		}
+		if err := sc.Err(); err != nil {
+			yield(mt940Field{}, err)
+			return
+		}
+		if cur != nil {
+			yield(*cur, nil)
+		}
+	}
+}
+
+func mt940BalanceOf(v string) (Balance, string, error) {
+	m := mt940Balance.FindStringSubmatch(strings.TrimSpace(v))
+	if m == nil {
+		return Balance{}, "", fmt.Errorf("%q: ожидается C|D ГГММДД валюта сумма", v)
+	}
+	dt, err := time.Parse("060102", m[2])
+	if err != nil {
+		return Balance{}, "", fmt.Errorf("дата %q: %w", m[2], err)
+	}
+	s := strings.Replace(m[4], ",", ".", 1)
+	if strings.HasSuffix(s, ".") {
+		s += "0"
+	}
+	amt, err := decimal.NewFromString(s)
+	if err != nil {
+		return Balance{}, "", fmt.Errorf("сумма %q: не число", m[4])
+	}
+	if m[1] == "D" {
+		amt = amt.Neg()
+	}
+	return Balance{Amount: amt, Date: dt}, m[3], nil
+}
+
+// mt940Date — дата проводки (ММДД) с годом из даты валютирования; без неё — дата валютирования.
+// Проводка 02.01 при валютировании 31.12 относится к следующему году, и наоборот.
+func mt940Date(value, entry string) string {
+	vd, err := time.Parse("060102", value)
+	if err != nil {
+		return value
+	}
+	if entry == "" {
+		return vd.Format("2006-01-02")
+	}
+	ed, err := time.Parse("20060102", vd.Format("2006")+entry)
+	if err != nil {
+		return value + entry
+	}
+	switch {
+	case vd.Month() == time.December && ed.Month() == time.January:
+		ed = ed.AddDate(1, 0, 0)
+	case vd.Month() == time.January && ed.Month() == time.December:
+		ed = ed.AddDate(-1, 0, 0)
+	}
+	return ed.Format("2006-01-02")
+}
+
+var mt940Subfield = regexp.MustCompile(`\?(\d{2})`)
+
+// mt940Description: структурированное :86: (подполя ?20–?29 и ?60–?63 — назначение,
+// ?32–?33 — контрагент) или просто текст.
+func mt940Description(v string) string {
+	v = strings.ReplaceAll(v, "\n", "")
+	if !strings.Contains(v, "?2") {
+		return strings.Join(strings.Fields(v), " ")
+	}
+	idx := mt940Subfield.FindAllStringSubmatchIndex(v, -1)
+	var party, purpose []string
+	for n, m := range idx {
+		end := len(v)
+		if n+1 < len(idx) {
+			end = idx[n+1][0]
+		}
+		// подполя фиксированной ширины режут слова — склеиваются без пробелов
+		code, text := v[m[2]:m[3]], v[m[1]:end]
+		switch {
+		case code >= "20" && code <= "29", code >= "60" && code <= "63":
+			purpose = append(purpose, text)
+		case code == "32" || code == "33":
+			party = append(party, text)
+		}
+	}
+	clean := func(parts []string) string { return strings.Join(strings.Fields(strings.Join(parts, "")), " ") }
+	return joinDescription(clean(party), clean(purpose))
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,187 @@
+package files
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const mt940Simple = `{1:F01BANKDEFFXXXX0000000000}{2:O9401200240103BANKDEFFXXXX00000000002401031200N}{4:
+:20:STMT1
+:25:DE89370400440532013000
+:28C:1/1
+:60F:C240101EUR1000,00
+:61:2401020102D250,00NTRFNONREF//B1
+:86:?20Miete ?21Januar?32Vermieter ?33GmbH
+:61:2401030103C100,NMSCREF2
+:86:Plain text
+ continued
+:61:240103D5,00NCHGNONREF
+Kontofuehrung
+:62F:C240103EUR845,00
+-}
+`
+
+func TestMT940Importer(t *testing.T) {
+	tests := []struct {
+		name       string
+		im         MT940Importer
+		src        string
+		rows       []string
+		statements []string
+		stmtIndex  []int
+		issues     []string
+	}{
+		{
+			name: "заголовки SWIFT, :86: с подполями и текстом",
+			im:   MT940Importer{DefaultCategory: "Банк"},
+			src:  mt940Simple,
+			rows: []string{
+				"-1 250.00 2024-01-02 Банк | Vermieter GmbH — Miete Januar | B1",
+				"1 100.00 2024-01-03 Банк | Plain text continued",
+				"-1 5.00 2024-01-03 Банк | Kontofuehrung",
+			},
+			statements: []string{"DE89370400440532013000 EUR 1000@2024-01-01→845@2024-01-03"},
+		},
+		{
+			name: "остаток не сходится",
+			src: `:20:S
+:25:1
+:60F:D240101RUB100,00
+:61:240102C50,00NTRFNONREF
+:62F:C240102RUB50,00
+`,
+			rows:       []string{"1 50.00 2024-01-02 Без категории | "},
+			statements: []string{"1 RUB -100@2024-01-01→50@2024-01-02"},
+			issues:     []string{"0 balance: входящий остаток -100.00 и записи (50.00) дают -50.00, а в выписке 50.00"},
+		},
+		{
+			name: "отклонённая запись не входит в движение",
+			src: `:20:S
+:25:1
+:60F:C240101RUB100,00
+:61:240102C50,00NTRFNONREF
+:61:241302D30,00NTRFNONREF
+:62F:C240102RUB120,00
+`,
+			rows:       []string{"1 50.00 2024-01-02 Без категории | "},
+			statements: []string{"1 RUB 100@2024-01-01→120@2024-01-02"},
+			issues: []string{
+				"2 date: ожидается дата в формате ГГММДД",
+				"0 balance: входящий остаток 100.00 и записи (50.00) дают 150.00, а в выписке 120.00",
+			},
+		},
+		{
+			name: "сторно: RC — списание, RD — приход",
+			src: `:20:S
+:25:1
+:60F:C240101RUB100,00
+:61:240102RC30,00NTRFNONREF
+:61:240102RD10,NTRFNONREF
+:62F:C240102RUB80,00
+`,
+			rows: []string{
+				"-1 30.00 2024-01-02 Без категории | ",
+				"1 10.00 2024-01-02 Без категории | ",
+			},
+			statements: []string{"1 RUB 100@2024-01-01→80@2024-01-02"},
+		},
+		{
+			name: "дата проводки на стыке лет",
+			src: `:20:S
+:61:2312310102C1,00NTRFNONREF
+:61:2401021231D1,00NTRFNONREF
+`,
+			rows: []string{
+				"1 1.00 2024-01-02 Без категории | ",
+				"-1 1.00 2023-12-31 Без категории | ",
+			},
+			statements: []string{"  -→-"},
+		},
+		{
+			name: "несколько выписок, первая без :20:",
+			src: `:25:A
+:61:240102C1,00NTRFNONREF
+-
+:20:S2
+:25:B
+:60M:C240101USD0,
+:61:240103D2,00NTRFNONREF
+:62M:D240103USD2,00
+:62F:D240103USD2,00
+`,
+			rows: []string{
+				"1 1.00 2024-01-02 Без категории | ",
+				"-1 2.00 2024-01-03 Без категории | ",
+			},
+			statements: []string{"A  -→-", "B USD 0@2024-01-01→-2@2024-01-03"},
+			stmtIndex:  []int{0, 1},
+		},
+		{
+			name: "неразобранная :61:",
+			src: `:20:S
+:61:CREDIT 100
+:86:что-то
+:61:240102C1,00NTRFNONREF
+`,
+			rows:       []string{"1 1.00 2024-01-02 Без категории | "},
+			statements: []string{"  -→-"},
+			issues:     []string{"1 61: не разобрана строка :61: (ожидается ГГММДД[ММДД]C|D сумма тип ...)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := decodeString(t, tt.im, tt.src)
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n got %q\nwant %q", got, tt.rows)
+			}
+			if got := statementsText(res.Statements); !reflect.DeepEqual(got, tt.statements) {
+				t.Errorf("statements:\n got %q\nwant %q", got, tt.statements)
+			}
+			if got := issuesText(res.Issues); !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("issues:\n got %q\nwant %q", got, tt.issues)
+			}
+			if tt.stmtIndex != nil {
+				var got []int
+				for _, r := range res.Rows {
+					got = append(got, r.Statement)
+				}
+				if !reflect.DeepEqual(got, tt.stmtIndex) {
+					t.Errorf("statement index: got %v, want %v", got, tt.stmtIndex)
+				}
+			}
+		})
+	}
+}
+
+func TestMT940ImporterErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"нет выписок", "{1:F01}\n-}\n", "нет выписок"},
+		{"текст до тегов", "hello\n:20:S\n", "строка 1: ожидается тег"},
+		{"плохой остаток", ":20:S\n:60F:C2401EUR1,00\n", "строка 2: :60F:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res Parsed
+			err := MT940Importer{}.decode(strings.NewReader(tt.src), &res)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffMT940(t *testing.T) {
+	for src, want := range map[string]bool{
+		mt940Simple:                    true,
+		":20:S\n:28C:1\n:25:123\n":     true,
+		":25:123\n:20:S\n":             false,
+		"!Type:Bank\nD01/02/2024\n^\n": false,
+	} {
+		if got := sniffMT940([]byte(src)); got != want {
+			t.Errorf("sniffMT940(%.20q) = %v, want %v", src, got, want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// NoCategory — категория для строк из форматов без категорий (OFX и т.п.),
+// если в Options.DefaultCategory ничего не задано.
+const NoCategory = "Без категории"
+
+// OFXImporter читает OFX 1.x (SGML, листовые теги без закрывающих) и 2.x (XML)
+// банковские и карточные выписки (STMTRS / CCSTMTRS). FITID становится ExternalID,
+// LEDGERBAL — конечным остатком выписки.
+type OFXImporter struct {
+	DefaultCategory string
+}
+
+// sniffOFX: заголовок OFX 1.x или корневой тег <OFX>.
+func sniffOFX(head []byte) bool {
+	h := bytes.ToUpper(head)
+	return bytes.HasPrefix(h, []byte("OFXHEADER")) || bytes.Contains(h, []byte("<OFX>"))
+}
+
+var ofxFormat = fieldFormat{dateLayout: "20060102", dateHint: "YYYYMMDD", signed: 1}
+
+// decode читает файл целиком: дерево OFX строится по всему документу.
+func (im OFXImporter) decode(r io.Reader, res *Parsed) error {
+	data, err := readAll(r, "ofx")
+	if err != nil {
+		return err
+	}
+	data, err = ofxDecode(data)
+	if err != nil {
+		return err
+	}
+	root, err := parseOFXTree(data)
+	if err != nil {
+		return err
+	}
+	category := im.DefaultCategory
+	if strings.TrimSpace(category) == "" {
+		category = NoCategory
+	}
+
+	record := 0
+	stmts := root.all("STMTRS", "CCSTMTRS")
+	if len(stmts) == 0 {
+		return fmt.Errorf("ofx: в файле нет выписок (STMTRS/CCSTMTRS)")
+	}
+	for _, stmt := range stmts {
+		st := Statement{
+			Account:  stmt.get("BANKACCTFROM", "ACCTID"),
+			Currency: stmt.get("CURDEF"),
+		}
+		if st.Account == "" {
+			st.Account = stmt.get("CCACCTFROM", "ACCTID")
+		}
+		if lb := stmt.child("LEDGERBAL"); lb != nil {
+			b, err := ofxBalance(lb)
+			if err != nil {
+				return fmt.Errorf("ofx: строка %d: LEDGERBAL: %w", lb.line, err)
+			}
+			st.Closing = &b
+		}
+		res.Statements = append(res.Statements, st)
+
+		list := stmt.child("BANKTRANLIST")
+		if list == nil {
+			continue
+		}
+		for _, tr := range list.all("STMTTRN") {
+			record++
+			date := tr.get("DTPOSTED")
+			if len(date) > 8 {
+				date = date[:8]
+			}
+			res.addWith(ofxFormat, tr.line, record, rawRow{
+				Amount:      ofxAmount(tr.get("TRNAMT")),
+				Date:        date,
+				Category:    category,
+				Description: ofxDescription(tr),
+				ExternalID:  tr.get("FITID"),
+				Statement:   len(res.Statements) - 1,
+				line: map[string]int{
+					"amount": tr.lineOf("TRNAMT"),
+					"date":   tr.lineOf("DTPOSTED"),
+				},
+			}, strings.TrimSpace(string(data[tr.start:tr.end])))
+		}
+	}
+	return nil
+}
+
+func ofxDescription(tr *ofxNode) string {
+	name := tr.get("NAME")
+	if name == "" {
+		name = tr.get("PAYEE", "NAME")
+	}
+	memo := tr.get("MEMO")
+	switch {
+	case name == "":
+		return memo
+	case memo == "" || strings.EqualFold(memo, name):
+		return name
+	}
+	return name + " — " + memo
+}
+
+// ofxAmount: некоторые банки пишут десятичную запятую.
+func ofxAmount(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ",") && !strings.Contains(s, ".") {
+		s = strings.ReplaceAll(s, ",", ".")
+	}
+	return s
+}
+
+func ofxBalance(n *ofxNode) (Balance, error) {
+	amt, err := decimal.NewFromString(ofxAmount(n.get("BALAMT")))
+	if err != nil {
+		return Balance{}, fmt.Errorf("BALAMT %q: не число", n.get("BALAMT"))
+	}
+	var dt time.Time
+	if s := n.get("DTASOF"); len(s) >= 8 {
+		if dt, err = time.Parse("20060102", s[:8]); err != nil {
+			return Balance{}, fmt.Errorf("DTASOF %q: %w", s, err)
+		}
+	}
+	return Balance{Amount: amt, Date: dt}, nil
+}
+
+// ofxDecode перекодирует выписку в UTF-8 по заголовку: CHARSET:1251 в OFX 1.x
+// или encoding="windows-1251" в XML-декларации OFX 2.x.
+func ofxDecode(data []byte) ([]byte, error) {
+	end := bytes.Index(data, []byte("<OFX>"))
+	if end < 0 {
+		return nil, fmt.Errorf("ofx: нет тега <OFX>")
+	}
+	head := strings.ToUpper(string(data[:end]))
+	switch {
+	case strings.Contains(head, "CHARSET:1251"), strings.Contains(head, `ENCODING="WINDOWS-1251"`):
+		return charmap.Windows1251.NewDecoder().Bytes(data)
+	case strings.Contains(head, "CHARSET:1252"), strings.Contains(head, `ENCODING="WINDOWS-1252"`):
+		return charmap.Windows1252.NewDecoder().Bytes(data)
+	}
+	return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), nil
+}
+
+type ofxNode struct {
+	name       string
+	value      string
+	children   []*ofxNode
+	line       int
+	start, end int // смещения в данных — для исходного текста записи
+}
+
+// parseOFXTree строит дерево тегов. Тег, за которым сразу идёт текст, — лист
+// (в SGML у него нет закрывающего тега, в XML он есть и пропускается);
+// закрывающий тег агрегата снимает со стека всё до него.
+func parseOFXTree(data []byte) (*ofxNode, error) {
+	i := bytes.Index(data, []byte("<OFX>"))
+	root := &ofxNode{name: "#root"}
+	stack := []*ofxNode{root}
+	lineAtPos := func(pos int) int { return bytes.Count(data[:pos], []byte("\n")) + 1 }
+
+	for i < len(data) {
+		lt := bytes.IndexByte(data[i:], '<')
+		if lt < 0 {
+			break
+		}
+		lt += i
+		gt := bytes.IndexByte(data[lt:], '>')
+		if gt < 0 {
+			return nil, fmt.Errorf("ofx: строка %d: незакрытый тег", lineAtPos(lt))
+		}
+		gt += lt
+		tag := strings.TrimSpace(string(data[lt+1 : gt]))
+		i = gt + 1
+
+		switch {
+		case tag == "" || tag[0] == '?' || tag[0] == '!' || strings.HasSuffix(tag, "/"):
+			continue
+		case tag[0] == '/':
+			name := strings.ToUpper(tag[1:])
+			for k := len(stack) - 1; k > 0; k-- {
+				if stack[k].name == name {
+					stack[k].end = gt + 1
+					stack = stack[:k]
+					break
+				}
+			}
+			continue
+		}
+
+		n := &ofxNode{name: strings.ToUpper(tag), line: lineAtPos(lt), start: lt, end: gt + 1}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, n)
+
+		next := bytes.IndexByte(data[i:], '<')
+		if next < 0 {
+			next = len(data) - i
+		}
+		text := strings.TrimSpace(string(data[i : i+next]))
+		if text == "" {
+			stack = append(stack, n)
+			continue
+		}
+		n.value = html.UnescapeString(text)
+		i += next
+		n.end = i
+		closing := "</" + n.name + ">"
+		if i+len(closing) <= len(data) && strings.EqualFold(string(data[i:i+len(closing)]), closing) {
+			i += len(closing)
+			n.end = i
+		}
+	}
+	return root, nil
+}
+
+func (n *ofxNode) child(name string) *ofxNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// get — значение листа по пути от n; "" — если его нет.
+func (n *ofxNode) get(path ...string) string {
+	cur := n
+	for _, p := range path {
+		if cur = cur.child(p); cur == nil {
+			return ""
+		}
+	}
+	return cur.value
+}
+
+func (n *ofxNode) lineOf(name string) int {
+	if c := n.child(name); c != nil {
+		return c.line
+	}
+	return n.line
+}
+
+// all — все потомки с одним из имён (без захода внутрь найденных).
+func (n *ofxNode) all(names ...string) []*ofxNode {
+	var out []*ofxNode
+	for _, c := range n.children {
+		matched := false
+		for _, name := range names {
+			if c.name == name {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			out = append(out, c)
+			continue
+		}
+		out = append(out, c.all(names...)...)
+	}
+	return out
+}
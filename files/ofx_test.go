@@ -0,0 +1,219 @@
+package files
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// decodeString разбирает текст src так же, как BaseImporter — файл.
+func decodeString(t *testing.T, im Importer, src string) Parsed {
+	t.Helper()
+	var res Parsed
+	if err := im.decode(strings.NewReader(src), &res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return res
+}
+
+// rowsText — строки в виде "тип сумма дата категория | описание | id" для сравнения в таблицах.
+func rowsText(rows []Row) []string {
+	var out []string
+	for _, r := range rows {
+		s := fmt.Sprintf("%d %s %s %s | %s", r.Type, r.Amount.StringFixed(2), r.Date.Format("2006-01-02"), r.Category, r.Description)
+		if r.ExternalID != "" {
+			s += " | " + r.ExternalID
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// statementsText — выписки в виде "счёт валюта открытие→закрытие".
+func statementsText(stmts []Statement) []string {
+	bal := func(b *Balance) string {
+		if b == nil {
+			return "-"
+		}
+		return b.Amount.String() + "@" + b.Date.Format("2006-01-02")
+	}
+	var out []string
+	for _, s := range stmts {
+		out = append(out, fmt.Sprintf("%s %s %s→%s", s.Account, s.Currency, bal(s.Opening), bal(s.Closing)))
+	}
+	return out
+}
+
+func issuesText(issues []Issue) []string {
+	var out []string
+	for _, i := range issues {
+		out = append(out, fmt.Sprintf("%d %s: %s", i.Record, i.Field, i.Reason))
+	}
+	return out
+}
+
+const ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+CHARSET:NONE
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>RUB
+<BANKACCTFROM><BANKID>044525225<ACCTID>40817810000000000001<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240105120000[+3:MSK]<TRNAMT>-1500.50<FITID>A1<NAME>Магазин<MEMO>Продукты</STMTTRN>
+<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20240110<TRNAMT>50000<FITID>A2<NAME>Зарплата</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL><BALAMT>48499.50<DTASOF>20240131</LEDGERBAL>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const ofxXML = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX>
+  <CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+    <CURDEF>USD</CURDEF>
+    <CCACCTFROM><ACCTID>4111</ACCTID></CCACCTFROM>
+    <BANKTRANLIST>
+      <STMTTRN>
+        <DTPOSTED>20240201</DTPOSTED>
+        <TRNAMT>-12,30</TRNAMT>
+        <FITID>C1</FITID>
+        <PAYEE><NAME>Coffee &amp; Co</NAME></PAYEE>
+        <MEMO>coffee &amp; co</MEMO>
+      </STMTTRN>
+    </BANKTRANLIST>
+  </CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+const ofxTwoStatements = `<OFX>
+<STMTRS><CURDEF>RUB<BANKACCTFROM><ACCTID>1</BANKACCTFROM>
+<BANKTRANLIST><STMTTRN><DTPOSTED>20240301<TRNAMT>10<FITID>X</STMTTRN></BANKTRANLIST>
+</STMTRS>
+<STMTRS><CURDEF>EUR<BANKACCTFROM><ACCTID>2</BANKACCTFROM>
+<BANKTRANLIST><STMTTRN><DTPOSTED>20240302<TRNAMT>-20<FITID>Y<MEMO>Комиссия</STMTTRN></BANKTRANLIST>
+</STMTRS>
+</OFX>
+`
+
+func TestOFXImporter(t *testing.T) {
+	tests := []struct {
+		name       string
+		im         OFXImporter
+		src        string
+		rows       []string
+		statements []string
+		issues     []string
+	}{
+		{
+			name: "sgml 1.x",
+			src:  ofxSGML,
+			rows: []string{
+				"-1 1500.50 2024-01-05 Без категории | Магазин — Продукты | A1",
+				"1 50000.00 2024-01-10 Без категории | Зарплата | A2",
+			},
+			statements: []string{"40817810000000000001 RUB -→48499.5@2024-01-31"},
+		},
+		{
+			name:       "xml 2.x, карта, запятая в сумме, payee",
+			im:         OFXImporter{DefaultCategory: "Карта"},
+			src:        ofxXML,
+			rows:       []string{"-1 12.30 2024-02-01 Карта | Coffee & Co | C1"},
+			statements: []string{"4111 USD -→-"},
+		},
+		{
+			name: "windows-1251",
+			src: mustEncode1251(t, `OFXHEADER:100
+CHARSET:1251
+<OFX><STMTRS><CURDEF>RUB<BANKTRANLIST>
+<STMTTRN><DTPOSTED>20240115<TRNAMT>-99.90<FITID>W<NAME>Аптека</STMTTRN>
+</BANKTRANLIST></STMTRS></OFX>`),
+			rows:       []string{"-1 99.90 2024-01-15 Без категории | Аптека | W"},
+			statements: []string{" RUB -→-"},
+		},
+		{
+			name: "несколько выписок",
+			src:  ofxTwoStatements,
+			rows: []string{
+				"1 10.00 2024-03-01 Без категории |  | X",
+				"-1 20.00 2024-03-02 Без категории | Комиссия | Y",
+			},
+			statements: []string{"1 RUB -→-", "2 EUR -→-"},
+		},
+		{
+			name: "нулевая сумма и плохая дата",
+			src: `<OFX><STMTRS><BANKTRANLIST>
+<STMTTRN><DTPOSTED>2024-01-01<TRNAMT>5</STMTTRN>
+<STMTTRN><DTPOSTED>20240101<TRNAMT>0.00</STMTTRN>
+</BANKTRANLIST></STMTRS></OFX>`,
+			statements: []string{"  -→-"},
+			issues: []string{
+				"1 date: ожидается дата в формате YYYYMMDD",
+				"2 amount: нулевая сумма",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := decodeString(t, tt.im, tt.src)
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n got %q\nwant %q", got, tt.rows)
+			}
+			if got := statementsText(res.Statements); !reflect.DeepEqual(got, tt.statements) {
+				t.Errorf("statements:\n got %q\nwant %q", got, tt.statements)
+			}
+			if got := issuesText(res.Issues); !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("issues:\n got %q\nwant %q", got, tt.issues)
+			}
+		})
+	}
+}
+
+func mustEncode1251(t *testing.T, s string) string {
+	t.Helper()
+	out, err := charmap.Windows1251.NewEncoder().String(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestOFXImporterErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"нет OFX", "OFXHEADER:100\n", "нет тега <OFX>"},
+		{"нет выписок", "<OFX><SIGNONMSGSRSV1></SIGNONMSGSRSV1></OFX>", "нет выписок"},
+		{"плохой остаток", "<OFX><STMTRS><LEDGERBAL><BALAMT>abc</LEDGERBAL></STMTRS></OFX>", "BALAMT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res Parsed
+			err := OFXImporter{}.decode(strings.NewReader(tt.src), &res)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffOFX(t *testing.T) {
+	for src, want := range map[string]bool{
+		ofxSGML:           true,
+		ofxXML:            true,
+		"type,amount\n":   false,
+		"!Type:Bank\n":    false,
+		"<Document>\n":    false,
+		"<ofx>\n<STMTRS>": true,
+	} {
+		if got := sniffOFX([]byte(src)); got != want {
+			t.Errorf("sniffOFX(%.20q) = %v, want %v", src, got, want)
+		}
+	}
+}
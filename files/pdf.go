@@ -0,0 +1,321 @@
+package files
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Минимальный писатель PDF 1.7: страницы с текстом, линиями и заливкой.
+// Шрифты TrueType встраиваются целиком как Type0/CIDFontType2 с кодировкой
+// Identity-H (текст — номера глифов), поэтому кириллица выводится без
+// подмены шрифтов у читателя; ToUnicode позволяет искать и копировать текст.
+
+const (
+	pdfPageW = 595.28 // A4, пункты
+	pdfPageH = 841.89
+)
+
+type pdfFont struct {
+	data  []byte
+	f     *sfnt.Font
+	buf   sfnt.Buffer
+	upem  int
+	used  map[sfnt.GlyphIndex]rune
+	width map[sfnt.GlyphIndex]int // ширина в 1/1000 кегля
+	cache map[rune]sfnt.GlyphIndex
+}
+
+func newPDFFont(data []byte) (*pdfFont, error) {
+	f, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &pdfFont{
+		data:  data,
+		f:     f,
+		upem:  int(f.UnitsPerEm()),
+		used:  map[sfnt.GlyphIndex]rune{},
+		width: map[sfnt.GlyphIndex]int{},
+		cache: map[rune]sfnt.GlyphIndex{},
+	}, nil
+}
+
+func (p *pdfFont) ppem() fixed.Int26_6 { return fixed.Int26_6(p.upem << 6) }
+
+// glyph — глиф символа; чего нет в шрифте, выводится как "?".
+func (p *pdfFont) glyph(r rune) sfnt.GlyphIndex {
+	if g, ok := p.cache[r]; ok {
+		return g
+	}
+	g, err := p.f.GlyphIndex(&p.buf, r)
+	if (err != nil || g == 0) && r != '?' {
+		g = p.glyph('?')
+	}
+	if _, ok := p.width[g]; !ok {
+		adv, err := p.f.GlyphAdvance(&p.buf, g, p.ppem(), font.HintingNone)
+		if err == nil {
+			p.width[g] = int(adv) * 1000 / 64 / p.upem
+		}
+	}
+	p.cache[r] = g
+	return g
+}
+
+// measure — ширина строки в пунктах.
+func (p *pdfFont) measure(s string, size float64) float64 {
+	w := 0
+	for _, r := range s {
+		w += p.width[p.glyph(r)]
+	}
+	return float64(w) * size / 1000
+}
+
+// encode — строка для Tj: номера глифов в hex.
+func (p *pdfFont) encode(s string) string {
+	b := &strings.Builder{}
+	b.WriteByte('<')
+	for _, r := range s {
+		g := p.glyph(r)
+		if _, ok := p.used[g]; !ok {
+			p.used[g] = r
+		}
+		fmt.Fprintf(b, "%04X", uint16(g))
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// fit обрезает строку до ширины с многоточием.
+func (p *pdfFont) fit(s string, size, max float64) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if p.measure(s, size) <= max {
+		return s
+	}
+	rs := []rune(s)
+	for len(rs) > 0 && p.measure(string(rs)+"…", size) > max {
+		rs = rs[:len(rs)-1]
+	}
+	return strings.TrimSpace(string(rs)) + "…"
+}
+
+// pdfDoc выводит страницы по одной: заполненная страница сразу уходит
+// в файл, в памяти остаются только шрифты и номера объектов страниц.
+type pdfDoc struct {
+	w      *pdfWriter
+	fonts  []*pdfFont
+	refs   []int // зарезервированные номера объектов шрифтов
+	pages  int
+	kids   []int
+	cur    *bytes.Buffer
+	footer func(page int) // рисует колонтитул перед выводом страницы
+	title  string
+}
+
+func newPDFDoc(out io.Writer, title string, fonts ...*pdfFont) *pdfDoc {
+	d := &pdfDoc{w: newPDFWriter(out), fonts: fonts, title: title}
+	d.pages = d.w.reserve()
+	for range fonts {
+		d.refs = append(d.refs, d.w.reserve())
+	}
+	return d
+}
+
+func (d *pdfDoc) newPage() {
+	d.flush()
+	d.cur = &bytes.Buffer{}
+}
+
+func (d *pdfDoc) page() *bytes.Buffer { return d.cur }
+
+// flush дописывает колонтитул и выводит текущую страницу.
+func (d *pdfDoc) flush() {
+	if d.cur == nil {
+		return
+	}
+	if d.footer != nil {
+		d.footer(len(d.kids) + 1)
+	}
+	fonts := make([]string, len(d.refs))
+	for i, n := range d.refs {
+		fonts[i] = fmt.Sprintf("/F%d %d 0 R", i+1, n)
+	}
+	content := d.w.stream(d.cur.Bytes(), "")
+	d.kids = append(d.kids, d.w.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+		d.pages, pdfPageW, pdfPageH, strings.Join(fonts, " "), content)))
+	d.cur = nil
+}
+
+// text выводит строку; y отсчитывается от верха страницы до базовой линии.
+func (d *pdfDoc) text(x, y float64, font int, size float64, gray float64, s string) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(d.page(), "%.3f g BT /F%d %.1f Tf %.2f %.2f Td %s Tj ET\n",
+		gray, font+1, size, x, pdfPageH-y, d.fonts[font].encode(s))
+}
+
+func (d *pdfDoc) textRight(right, y float64, font int, size float64, gray float64, s string) {
+	d.text(right-d.fonts[font].measure(s, size), y, font, size, gray, s)
+}
+
+func (d *pdfDoc) line(x1, y1, x2, y2, width, gray float64) {
+	fmt.Fprintf(d.page(), "%.3f G %.2f w %.2f %.2f m %.2f %.2f l S\n", gray, width, x1, pdfPageH-y1, x2, pdfPageH-y2)
+}
+
+// fill — прямоугольник с верхним левым углом (x, y).
+func (d *pdfDoc) fill(x, y, w, h, gray float64) {
+	fmt.Fprintf(d.page(), "%.3f g %.2f %.2f %.2f %.2f re f\n", gray, x, pdfPageH-y-h, w, h)
+}
+
+// close выводит последнюю страницу, шрифты (с глифами всех страниц) и xref.
+func (d *pdfDoc) close(creation string) error {
+	d.flush()
+	for i, f := range d.fonts {
+		f.write(d.w, d.refs[i])
+	}
+	kids := make([]string, len(d.kids))
+	for i, n := range d.kids {
+		kids[i] = fmt.Sprintf("%d 0 R", n)
+	}
+	d.w.set(d.pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	catalog := d.w.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", d.pages))
+	info := d.w.add(fmt.Sprintf("<< /Title %s /Producer (finance) /CreationDate (D:%s) >>", pdfTextString(d.title), creation))
+	return d.w.finish(catalog, info)
+}
+
+// pdfWriter пишет объекты сразу в поток и запоминает их смещения для xref;
+// номер можно зарезервировать заранее, а объект вывести позже.
+type pdfWriter struct {
+	out     *errWriter
+	off     int
+	offsets []int
+}
+
+func newPDFWriter(out io.Writer) *pdfWriter {
+	w := &pdfWriter{out: &errWriter{w: out}}
+	w.put([]byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"))
+	return w
+}
+
+func (w *pdfWriter) put(b []byte) {
+	n, _ := w.out.Write(b)
+	w.off += n
+}
+
+func (w *pdfWriter) reserve() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+func (w *pdfWriter) write(n int, body []byte) {
+	w.offsets[n-1] = w.off
+	w.put(fmt.Appendf(nil, "%d 0 obj\n", n))
+	w.put(body)
+	w.put([]byte("\nendobj\n"))
+}
+
+func (w *pdfWriter) set(n int, body string) { w.write(n, []byte(body)) }
+
+func (w *pdfWriter) add(body string) int {
+	n := w.reserve()
+	w.set(n, body)
+	return n
+}
+
+// stream добавляет сжатый поток; extra — дополнительные ключи словаря.
+func (w *pdfWriter) stream(data []byte, extra string) int {
+	z := &bytes.Buffer{}
+	zw := zlib.NewWriter(z)
+	zw.Write(data)
+	zw.Close()
+	n := w.reserve()
+	w.write(n, append(fmt.Appendf(nil, "<< /Length %d /Filter /FlateDecode%s >>\nstream\n", z.Len(), extra),
+		append(z.Bytes(), "\nendstream"...)...))
+	return n
+}
+
+func (w *pdfWriter) finish(root, info int) error {
+	xref := w.off
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, off := range w.offsets {
+		fmt.Fprintf(b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(b, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, root, info, xref)
+	w.put(b.Bytes())
+	return w.out.err
+}
+
+// write встраивает шрифт: Type0 → CIDFontType2 → FontDescriptor → FontFile2, плюс ToUnicode.
+func (p *pdfFont) write(w *pdfWriter, ref int) {
+	name, err := p.f.Name(&p.buf, sfnt.NameIDPostScript)
+	if err != nil || name == "" {
+		name = "Font"
+	}
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune("()<>[]{}/%#", r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	m, _ := p.f.Metrics(&p.buf, p.ppem(), font.HintingNone)
+	bb, _ := p.f.Bounds(&p.buf, p.ppem(), font.HintingNone)
+	u := func(v fixed.Int26_6) int { return int(v) * 1000 / 64 / p.upem }
+
+	file := w.stream(p.data, fmt.Sprintf(" /Length1 %d", len(p.data)))
+	desc := w.add(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		name, u(bb.Min.X), -u(bb.Max.Y), u(bb.Max.X), -u(bb.Min.Y), u(m.Ascent), -u(m.Descent), u(m.CapHeight), file))
+
+	gids := make([]int, 0, len(p.used))
+	for g := range p.used {
+		gids = append(gids, int(g))
+	}
+	sort.Ints(gids)
+	widths := &strings.Builder{}
+	for _, g := range gids {
+		fmt.Fprintf(widths, "%d [%d] ", g, p.width[sfnt.GlyphIndex(g)])
+	}
+	cid := w.add(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /DW 500 /W [%s] /CIDToGIDMap /Identity >>",
+		name, desc, strings.TrimSpace(widths.String())))
+
+	cmap := &strings.Builder{}
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for i := 0; i < len(gids); i += 100 {
+		chunk := gids[i:min(i+100, len(gids))]
+		fmt.Fprintf(cmap, "%d beginbfchar\n", len(chunk))
+		for _, g := range chunk {
+			fmt.Fprintf(cmap, "<%04X> <", g)
+			for _, c := range utf16.Encode([]rune{p.used[sfnt.GlyphIndex(g)]}) {
+				fmt.Fprintf(cmap, "%04X", c)
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	toUni := w.stream([]byte(cmap.String()), "")
+
+	w.set(ref, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, cid, toUni))
+}
+
+// pdfTextString — строка метаданных в UTF-16BE с BOM.
+func pdfTextString(s string) string {
+	b := &strings.Builder{}
+	b.WriteString("<FEFF")
+	for _, c := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(b, "%04X", c)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
@@ -0,0 +1,262 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"main/domain"
+	"main/repo"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// PDFStatement — выписка по счёту за период: остатки на начало и конец,
+// операции с остатком после каждой и итоги. Шрифты Go (с кириллицей) встраиваются в файл.
+type PDFStatement struct {
+	Account   string
+	Holder    string // владелец, если известен
+	From, To  time.Time
+	Opening   decimal.Decimal
+	Generated time.Time
+}
+
+const (
+	pdfRegular = iota
+	pdfBold
+)
+
+// колонки таблицы: левая граница и ширина
+var pdfColumns = []struct {
+	title string
+	x, w  float64
+	right bool
+}{
+	{"Дата", 40, 58, false},
+	{"Описание", 98, 172, false},
+	{"Категория", 270, 95, false},
+	{"Приход", 365, 62, true},
+	{"Расход", 427, 62, true},
+	{"Остаток", 489, 66, true},
+}
+
+const (
+	pdfLeft   = 40.0
+	pdfRight  = pdfPageW - 40
+	pdfTop    = 50.0          // начало таблицы на следующих страницах
+	pdfBottom = pdfPageH - 60 // ниже — колонтитул
+	pdfRowH   = 15.0
+)
+
+// Encode проходит строки дважды: сначала ради итогов, числа операций и страниц
+// (они нужны в шапке и колонтитулах), затем выводит таблицу постранично.
+func (s PDFStatement) Encode(w io.Writer, rows RowSeq) error {
+	regular, err := newPDFFont(goregular.TTF)
+	if err != nil {
+		return err
+	}
+	bold, err := newPDFFont(gobold.TTF)
+	if err != nil {
+		return err
+	}
+
+	in, out, count := decimal.Zero, decimal.Zero, 0
+	var first, last time.Time
+	for r, err := range rows {
+		if err != nil {
+			return err
+		}
+		if r.Type < 0 {
+			out = out.Add(r.Amount)
+		} else {
+			in = in.Add(r.Amount)
+		}
+		if first.IsZero() || r.Date.Before(first) {
+			first = r.Date
+		}
+		if r.Date.After(last) {
+			last = r.Date
+		}
+		count++
+	}
+	closing := s.Opening.Add(in).Sub(out)
+
+	from, to := s.From, s.To
+	if from.IsZero() || to.IsZero() {
+		from, to = first, last
+		if count == 0 {
+			from = time.Now()
+			to = from
+		}
+	}
+	generated := s.Generated
+	if generated.IsZero() {
+		generated = time.Now()
+	}
+	period := from.Format("02.01.2006") + " — " + to.Format("02.01.2006")
+
+	d := newPDFDoc(w, "Выписка по счёту «"+s.Account+"» за "+period, regular, bold)
+	total := 0
+	d.footer = func(page int) {
+		d.line(pdfLeft, pdfPageH-40, pdfRight, pdfPageH-40, 0.4, 0.7)
+		d.text(pdfLeft, pdfPageH-28, pdfRegular, 8, 0.4, regular.fit(s.Account+" · "+period, 8, 350))
+		d.textRight(pdfRight, pdfPageH-28, pdfRegular, 8, 0.4, fmt.Sprintf("Страница %d из %d", page, total))
+	}
+	d.newPage()
+
+	// шапка
+	y := 60.0
+	d.text(pdfLeft, y, pdfBold, 16, 0, "Выписка по счёту")
+	d.textRight(pdfRight, y, pdfRegular, 9, 0.4, "Сформирована "+generated.Format("02.01.2006 15:04"))
+	y += 22
+	d.text(pdfLeft, y, pdfRegular, 10, 0.4, "Счёт")
+	d.text(pdfLeft+90, y, pdfBold, 10, 0, regular.fit(s.Account, 10, pdfRight-pdfLeft-90))
+	if s.Holder != "" {
+		y += 15
+		d.text(pdfLeft, y, pdfRegular, 10, 0.4, "Владелец")
+		d.text(pdfLeft+90, y, pdfRegular, 10, 0, regular.fit(s.Holder, 10, pdfRight-pdfLeft-90))
+	}
+	y += 15
+	d.text(pdfLeft, y, pdfRegular, 10, 0.4, "Период")
+	d.text(pdfLeft+90, y, pdfRegular, 10, 0, period)
+
+	// остатки и обороты
+	y += 18
+	boxes := []struct {
+		label string
+		v     decimal.Decimal
+	}{
+		{"Остаток на " + from.Format("02.01.2006"), s.Opening},
+		{"Поступления", in},
+		{"Списания", out},
+		{"Остаток на " + to.Format("02.01.2006"), closing},
+	}
+	bw := (pdfRight - pdfLeft) / float64(len(boxes))
+	d.fill(pdfLeft, y, pdfRight-pdfLeft, 40, 0.95)
+	for i, b := range boxes {
+		x := pdfLeft + bw*float64(i) + 8
+		d.text(x, y+14, pdfRegular, 8.5, 0.4, b.label)
+		d.text(x, y+31, pdfBold, 12, 0, reportMoney(b.v))
+	}
+	y += 62
+
+	header := func() {
+		d.fill(pdfLeft, y, pdfRight-pdfLeft, pdfRowH+2, 0.88)
+		for _, c := range pdfColumns {
+			if c.right {
+				d.textRight(c.x+c.w-4, y+11.5, pdfBold, 8.5, 0, c.title)
+			} else {
+				d.text(c.x+4, y+11.5, pdfBold, 8.5, 0, c.title)
+			}
+		}
+		y += pdfRowH + 2
+	}
+	header()
+	total = pdfStatementPages(y, count)
+
+	bal := s.Opening
+	i := 0
+	for r, err := range rows {
+		if err != nil {
+			return err
+		}
+		if i == count {
+			break // источник изменился между проходами
+		}
+		if y+pdfRowH > pdfBottom {
+			d.newPage()
+			y = pdfTop
+			header()
+		}
+		cells := make([]string, len(pdfColumns))
+		cells[0] = r.Date.Format("02.01.2006")
+		cells[1] = r.Description
+		cells[2] = r.Category
+		if r.Type < 0 {
+			bal = bal.Sub(r.Amount)
+			cells[4] = reportMoney(r.Amount)
+		} else {
+			bal = bal.Add(r.Amount)
+			cells[3] = reportMoney(r.Amount)
+		}
+		cells[5] = reportMoney(bal)
+		if i%2 == 1 {
+			d.fill(pdfLeft, y, pdfRight-pdfLeft, pdfRowH, 0.97)
+		}
+		for j, c := range pdfColumns {
+			text := regular.fit(cells[j], 8.5, c.w-8)
+			if c.right {
+				d.textRight(c.x+c.w-4, y+10.5, pdfRegular, 8.5, 0, text)
+			} else {
+				d.text(c.x+4, y+10.5, pdfRegular, 8.5, 0, text)
+			}
+		}
+		y += pdfRowH
+		i++
+	}
+	if count == 0 {
+		d.text(pdfLeft+4, y+10.5, pdfRegular, 8.5, 0.4, "Операций за период нет")
+		y += pdfRowH
+	}
+
+	// итоги
+	if y+3*pdfRowH > pdfBottom {
+		d.newPage()
+		y = pdfTop
+	}
+	d.line(pdfLeft, y+2, pdfRight, y+2, 0.8, 0)
+	y += 2
+	d.text(pdfColumns[0].x+4, y+11, pdfBold, 8.5, 0, "Итого за период")
+	d.textRight(pdfColumns[3].x+pdfColumns[3].w-4, y+11, pdfBold, 8.5, 0, reportMoney(in))
+	d.textRight(pdfColumns[4].x+pdfColumns[4].w-4, y+11, pdfBold, 8.5, 0, reportMoney(out))
+	d.textRight(pdfColumns[5].x+pdfColumns[5].w-4, y+11, pdfBold, 8.5, 0, reportMoney(closing))
+	y += pdfRowH + 6
+	d.text(pdfLeft, y+10, pdfRegular, 8.5, 0.4, fmt.Sprintf("Операций: %d", count))
+
+	return d.close(generated.Format("20060102150405"))
+}
+
+// pdfStatementPages повторяет разбиение таблицы на страницы из Encode,
+// чтобы число страниц было известно до вывода первой.
+func pdfStatementPages(y float64, rows int) int {
+	pages := 1
+	for range rows {
+		if y+pdfRowH > pdfBottom {
+			pages++
+			y = pdfTop + pdfRowH + 2
+		}
+		y += pdfRowH
+	}
+	if rows == 0 {
+		y += pdfRowH
+	}
+	if y+3*pdfRowH > pdfBottom {
+		pages++
+	}
+	return pages
+}
+
+// ExportStatementPDF — выписка по счёту за период; остаток на начало считается как в HTML-отчёте.
+func ExportStatementPDF(
+	ctx context.Context,
+	accs *repo.PgAccountRepo,
+	ops *repo.PgOperationRepo,
+	cats *repo.CachedCategoryRepo,
+	accID domain.AccountID,
+	from, to time.Time,
+	path string,
+	st PDFStatement,
+) error {
+	acc, opening, err := openingBalance(ctx, accs, ops, accID, from, to)
+	if err != nil {
+		return err
+	}
+	if st.Account == "" {
+		st.Account = acc.Name
+	}
+	st.From, st.To, st.Opening = from, to, opening
+	return ExportOperations(ctx, ops, cats, accID, from, to, path, st)
+}
@@ -0,0 +1,408 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Порядок дня и месяца в датах QIF: "01/02/2025" — 2 января (mdy) или 1 февраля (dmy).
+const (
+	QIFAuto       = ""    // определить по файлу; если нельзя — как mdy
+	QIFMonthFirst = "mdy" // американский, так пишет Quicken
+	QIFDayFirst   = "dmy"
+)
+
+// TransferPrefix — категория перевода в другой счёт: "Перевод: Сбережения".
+// Так их создаёт импорт QIF и журналов ledger; экспорт в ledger превращает их обратно в Assets:<счёт>.
+const TransferPrefix = "Перевод: "
+
+type QIFEncoder struct {
+	DateOrder string // QIFMonthFirst по умолчанию
+}
+
+func (e QIFEncoder) Encode(out io.Writer, rows RowSeq) error {
+	layout := "01/02/2006"
+	if e.DateOrder == QIFDayFirst {
+		layout = "02/01/2006"
+	}
+	buf := &errWriter{w: out}
+	io.WriteString(buf, "!Type:Bank\n")
+	for r, err := range rows {
+		if err != nil {
+			return err
+		}
+		amt := r.Amount.StringFixed(2)
+		if r.Type < 0 {
+			amt = r.Amount.Neg().StringFixed(2)
+		}
+		fmt.Fprintf(buf, "D%s\nT%s\n", r.Date.Format(layout), amt)
+		if d := qifLine(r.Description); d != "" {
+			fmt.Fprintf(buf, "M%s\n", d)
+		}
+		if c := qifLine(r.Category); strings.HasPrefix(c, TransferPrefix) {
+			fmt.Fprintf(buf, "L[%s]\n", strings.TrimPrefix(c, TransferPrefix))
+		} else if c != "" {
+			fmt.Fprintf(buf, "L%s\n", c)
+		}
+		io.WriteString(buf, "^\n")
+	}
+	return buf.err
+}
+
+// qifLine: поле QIF — одна строка.
+func qifLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// QIFImporter читает разделы !Type:Bank, !Type:Cash и !Type:CCard. Сплит-строки
+// (S/E/$) становятся отдельными строками со своими категориями; сумма сплитов
+// должна совпадать с T. Перевод в другой счёт ("L[Сбережения]") получает
+// категорию "Перевод: Сбережения".
+type QIFImporter struct {
+	DateOrder       string
+	DefaultCategory string
+}
+
+// sniffQIF: файл начинается с заголовка раздела (!Type:, !Account, !Option).
+func sniffQIF(head []byte) bool {
+	h := bytes.ToUpper(head)
+	return bytes.HasPrefix(h, []byte("!TYPE:")) || bytes.HasPrefix(h, []byte("!ACCOUNT")) || bytes.HasPrefix(h, []byte("!OPTION"))
+}
+
+type qifRecord struct {
+	line   int
+	fields []qifField
+	source []string
+}
+
+type qifField struct {
+	code  byte
+	value string
+	line  int
+}
+
+type qifSplit struct {
+	category, memo, amount string
+	line                   int
+}
+
+// decode читает файл по записям. При автоопределении порядок дня и месяца
+// ясен с первой даты, где одно из чисел больше 12: до неё записи копятся
+// в памяти, дальше идут потоком. Если такой даты нет, месяц идёт первым.
+func (im QIFImporter) decode(r io.Reader, res *Parsed) error {
+	order := im.DateOrder
+	var pending []qifRecord
+	record := 0
+	flush := func(recs []qifRecord) {
+		ff := fieldFormat{dateLayout: "2006-01-02", dateHint: "дата QIF (" + order + ")", signed: 1}
+		for _, rec := range recs {
+			record++
+			im.record(res, ff, order, record, rec)
+		}
+	}
+	for rec, err := range qifRecords(r) {
+		if err != nil {
+			return err
+		}
+		if order != QIFAuto {
+			flush([]qifRecord{rec})
+			continue
+		}
+		pending = append(pending, rec)
+		if o := qifRecordOrder(rec); o != "" {
+			order = o
+			flush(pending)
+			pending = nil
+		}
+	}
+	if order == QIFAuto {
+		order = detectQIFDateOrder(pending)
+	}
+	flush(pending)
+	return nil
+}
+
+// record разбирает одну запись: операцию или её сплиты.
+func (im QIFImporter) record(res *Parsed, ff fieldFormat, order string, record int, rec qifRecord) {
+	category := im.DefaultCategory
+	if strings.TrimSpace(category) == "" {
+		category = NoCategory
+	}
+	source := strings.Join(rec.source, "\n")
+	if rec.fields == nil {
+		res.Records++
+		res.reject(rec.line, record, "", "", "раздел не поддерживается (нужен !Type:Bank, Cash или CCard)", source)
+		return
+	}
+	var date, amount, payee, memo, cat string
+	var splits []qifSplit
+	lines := map[string]int{}
+	for _, f := range rec.fields {
+		switch f.code {
+		case 'D':
+			date, lines["date"] = f.value, f.line
+		case 'T', 'U':
+			if amount == "" || f.code == 'T' {
+				amount, lines["amount"] = f.value, f.line
+			}
+		case 'P':
+			payee = f.value
+		case 'M':
+			memo = f.value
+		case 'L':
+			cat, lines["category"] = f.value, f.line
+		case 'S':
+			splits = append(splits, qifSplit{category: f.value, line: f.line})
+		case 'E':
+			if len(splits) > 0 {
+				splits[len(splits)-1].memo = f.value
+			}
+		case '$':
+			if len(splits) > 0 {
+				splits[len(splits)-1].amount = f.value
+			}
+		}
+	}
+	isoDate := qifDate(date, order)
+	desc := joinDescription(payee, memo)
+
+	if len(splits) == 0 {
+		res.addWith(ff, rec.line, record, rawRow{
+			Amount:      qifAmount(amount),
+			Date:        isoDate,
+			Category:    qifCategory(cat, category),
+			Description: desc,
+			line:        lines,
+		}, source)
+		return
+	}
+
+	// сплиты: сумма частей должна совпасть с T
+	total, err := decimal.NewFromString(qifAmount(amount))
+	if err != nil {
+		res.Records++
+		res.reject(lines["amount"], record, "amount", amount, "не число", source)
+		return
+	}
+	sum := decimal.Zero
+	ok := true
+	for _, sp := range splits {
+		v, err := decimal.NewFromString(qifAmount(sp.amount))
+		if err != nil {
+			res.Records++
+			res.reject(sp.line, record, "split", sp.amount, "сумма сплита не число", source)
+			ok = false
+			break
+		}
+		sum = sum.Add(v)
+	}
+	if !ok {
+		return
+	}
+	if !sum.Equal(total) {
+		res.Records++
+		res.reject(rec.line, record, "split", sum.StringFixed(2),
+			fmt.Sprintf("сумма сплитов не равна сумме операции %s", total.StringFixed(2)), source)
+		return
+	}
+	for _, sp := range splits {
+		lines["category"] = sp.line
+		lines["amount"] = sp.line
+		res.addWith(ff, sp.line, record, rawRow{
+			Amount:      qifAmount(sp.amount),
+			Date:        isoDate,
+			Category:    qifCategory(sp.category, category),
+			Description: joinDescription(desc, sp.memo),
+			line:        lines,
+		}, source)
+	}
+}
+
+// qifRecords режет файл на записи по "^" и отдаёт их по одной. Записи
+// неподдерживаемых разделов отдаются без полей; списки категорий, классов
+// и счетов пропускаются.
+func qifRecords(r io.Reader) iter.Seq2[qifRecord, error] {
+	return func(yield func(qifRecord, error) bool) {
+		sc := bufio.NewScanner(skipBOM(r))
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		section := ""
+		cur := qifRecord{}
+		for line := 1; sc.Scan(); line++ {
+			s := strings.TrimRight(sc.Text(), "\r")
+			if strings.TrimSpace(s) == "" {
+				continue
+			}
+			if s[0] == '!' {
+				head := strings.ToLower(strings.TrimSpace(s))
+				switch {
+				case strings.HasPrefix(head, "!type:"):
+					section = strings.TrimSpace(head[len("!type:"):])
+				case head == "!account":
+					section = "account"
+				case strings.HasPrefix(head, "!option"), strings.HasPrefix(head, "!clear"):
+					// переключатели Quicken на разбор не влияют
+				default:
+					section = head
+				}
+				continue
+			}
+			if cur.line == 0 {
+				cur.line = line
+			}
+			cur.source = append(cur.source, s)
+			if s[0] == '^' {
+				rec, emit := cur, true
+				switch section {
+				case "bank", "cash", "ccard":
+					if rec.fields == nil {
+						rec.fields = []qifField{}
+					}
+				case "cat", "class", "account", "memorized":
+					emit = false
+				default:
+					rec.fields = nil
+				}
+				if emit && !yield(rec, nil) {
+					return
+				}
+				cur = qifRecord{}
+				continue
+			}
+			switch section {
+			case "bank", "cash", "ccard":
+				cur.fields = append(cur.fields, qifField{code: s[0], value: strings.TrimSpace(s[1:]), line: line})
+			}
+		}
+		if err := sc.Err(); err != nil {
+			yield(qifRecord{}, err)
+			return
+		}
+		if len(cur.source) > 0 && len(cur.fields) > 0 {
+			yield(cur, nil) // последняя запись без "^"
+		}
+	}
+}
+
+// detectQIFDateOrder: если в какой-то дате первое число больше 12 — день идёт первым,
+// если второе — первым идёт месяц. Иначе — как в Quicken, месяц первым.
+func detectQIFDateOrder(recs []qifRecord) string {
+	for _, r := range recs {
+		if o := qifRecordOrder(r); o != "" {
+			return o
+		}
+	}
+	return QIFMonthFirst
+}
+
+// qifRecordOrder — порядок дня и месяца, если его выдаёт дата записи; "" — не ясно.
+func qifRecordOrder(r qifRecord) string {
+	for _, f := range r.fields {
+		if f.code != 'D' {
+			continue
+		}
+		p := qifDateParts(f.value)
+		if len(p) != 3 || len(p[0]) == 4 {
+			continue
+		}
+		a, _ := strconv.Atoi(p[0])
+		b, _ := strconv.Atoi(p[1])
+		switch {
+		case a > 12:
+			return QIFDayFirst
+		case b > 12:
+			return QIFMonthFirst
+		}
+	}
+	return ""
+}
+
+func qifDateParts(s string) []string {
+	return strings.FieldsFunc(strings.TrimSpace(s), func(r rune) bool {
+		return r == '/' || r == '.' || r == '-' || r == '\'' || r == ' '
+	})
+}
+
+// qifDate приводит дату к ГГГГ-ММ-ДД; непонятную дату возвращает как есть —
+// её отклонит общая проверка.
+func qifDate(s, order string) string {
+	p := qifDateParts(s)
+	if len(p) != 3 {
+		return s
+	}
+	var y, m, d string
+	switch {
+	case len(p[0]) == 4:
+		y, m, d = p[0], p[1], p[2]
+	case order == QIFDayFirst:
+		d, m, y = p[0], p[1], p[2]
+	default:
+		m, d, y = p[0], p[1], p[2]
+	}
+	yy, err1 := strconv.Atoi(y)
+	mm, err2 := strconv.Atoi(m)
+	dd, err3 := strconv.Atoi(d)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return s
+	}
+	if len(y) <= 2 {
+		// "1/15'25" — апостроф у Quicken означает 2000-е
+		if strings.Contains(s, "'") || yy < 70 {
+			yy += 2000
+		} else {
+			yy += 1900
+		}
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", yy, mm, dd)
+}
+
+// qifAmount: "1,234.56" и "1.234,56" → "1234.56".
+func qifAmount(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case dot >= 0 && comma >= 0 && comma > dot:
+		s = strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+	case dot >= 0 && comma >= 0:
+		s = strings.ReplaceAll(s, ",", "")
+	case comma >= 0 && len(s)-comma-1 == 2:
+		s = strings.ReplaceAll(s, ",", ".")
+	case comma >= 0:
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	return s
+}
+
+// qifCategory: "Авто:Бензин/Работа" → "Авто:Бензин" (класс после "/" отбрасывается),
+// "[Сбережения]" → "Перевод: Сбережения".
+func qifCategory(s, def string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		return TransferPrefix + strings.TrimSpace(s[1:len(s)-1])
+	}
+	if i := strings.Index(s, "/"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func joinDescription(a, b string) string {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	switch {
+	case a == "":
+		return b
+	case b == "" || strings.EqualFold(a, b):
+		return a
+	}
+	return a + " — " + b
+}
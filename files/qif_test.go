@@ -0,0 +1,213 @@
+package files
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// testRow — строка для кодировщиков: сумма и дата текстом, как в фикстурах.
+func testRow(typ int, amount, date, category, description string) Row {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic(err)
+	}
+	return Row{Type: typ, Amount: decimal.RequireFromString(amount), Date: d, Category: category, Description: description}
+}
+
+func TestDetectQIFDateOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		dates []string
+		want  string
+	}{
+		{"день больше 12", []string{"01/02/2024", "25/02/2024"}, QIFDayFirst},
+		{"месяц первым", []string{"01/02/2024", "02/25/2024"}, QIFMonthFirst},
+		{"неоднозначно — как Quicken", []string{"01/02/2024", "03.04.2024"}, QIFMonthFirst},
+		{"ISO не решает", []string{"2024-12-25", "31.01.2024"}, QIFDayFirst},
+		{"первая однозначная дата решает", []string{"13.01.24", "01/31/24"}, QIFDayFirst},
+		{"апостроф Quicken", []string{"1/15'25"}, QIFMonthFirst},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var recs []qifRecord
+			for _, d := range tt.dates {
+				recs = append(recs, qifRecord{fields: []qifField{{code: 'T', value: "1"}, {code: 'D', value: d}}})
+			}
+			if got := detectQIFDateOrder(recs); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQIFDate(t *testing.T) {
+	tests := []struct {
+		in, order, want string
+	}{
+		{"01/02/2024", QIFMonthFirst, "2024-01-02"},
+		{"01/02/2024", QIFDayFirst, "2024-02-01"},
+		{"2024-03-04", QIFDayFirst, "2024-03-04"},
+		{"1/15'25", QIFMonthFirst, "2025-01-15"},
+		{"12/31/99", QIFMonthFirst, "1999-12-31"},
+		{"31.12.05", QIFDayFirst, "2005-12-31"},
+		{"вчера", QIFMonthFirst, "вчера"},
+	}
+	for _, tt := range tests {
+		if got := qifDate(tt.in, tt.order); got != tt.want {
+			t.Errorf("qifDate(%q, %q) = %q, want %q", tt.in, tt.order, got, tt.want)
+		}
+	}
+}
+
+func TestQIFAmount(t *testing.T) {
+	for in, want := range map[string]string{
+		"-1,234.56": "-1234.56",
+		"1.234,56":  "1234.56",
+		"12,30":     "12.30",
+		"1,234":     "1234",
+		"1 000.00":  "1000.00",
+		"15":        "15",
+	} {
+		if got := qifAmount(in); got != want {
+			t.Errorf("qifAmount(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestQIFImporter(t *testing.T) {
+	tests := []struct {
+		name   string
+		im     QIFImporter
+		src    string
+		rows   []string
+		issues []string
+	}{
+		{
+			name: "простые записи, день первым по файлу",
+			src: `!Type:Bank
+D01/02/2024
+T-1,500.00
+PМагазин
+MПродукты
+LЕда/Семья
+^
+D25/02/2024
+T50000
+LЗарплата
+^
+`,
+			rows: []string{
+				"-1 1500.00 2024-02-01 Еда | Магазин — Продукты",
+				"1 50000.00 2024-02-25 Зарплата | ",
+			},
+		},
+		{
+			name: "порядок задан явно",
+			im:   QIFImporter{DateOrder: QIFMonthFirst, DefaultCategory: "Прочее"},
+			src:  "!Type:Cash\nD01/02/2024\nT-10\n^\n",
+			rows: []string{"-1 10.00 2024-01-02 Прочее | "},
+		},
+		{
+			name: "сплиты и перевод",
+			src: `!Type:CCard
+D03/15/2024
+T-300.00
+PГипермаркет
+SЕда
+EОвощи
+$-200.00
+S[Сбережения]
+$-100.00
+^
+`,
+			rows: []string{
+				"-1 200.00 2024-03-15 Еда | Гипермаркет — Овощи",
+				"-1 100.00 2024-03-15 Перевод: Сбережения | Гипермаркет",
+			},
+		},
+		{
+			name: "сумма сплитов не сходится",
+			src:  "!Type:Bank\nD03/15/2024\nT-300\nSЕда\n$-200\nSБыт\n$-50\n^\n",
+			issues: []string{
+				"1 split: сумма сплитов не равна сумме операции -300.00",
+			},
+		},
+		{
+			name: "неподдерживаемый раздел и списки",
+			src: `!Type:Cat
+NЕда
+^
+!Type:Invst
+D01/02/2024
+NBuy
+^
+!Type:Bank
+D01/03/2024
+T5
+^
+`,
+			rows:   []string{"1 5.00 2024-01-03 Без категории | "},
+			issues: []string{"1 : раздел не поддерживается (нужен !Type:Bank, Cash или CCard)"},
+		},
+		{
+			name: "последняя запись без ^",
+			src:  "!Type:Bank\nD2024-05-06\nU7.50\n",
+			rows: []string{"1 7.50 2024-05-06 Без категории | "},
+		},
+		{
+			name: "записи до и после однозначной даты",
+			src:  "!Type:Bank\nD01/02/2024\nT1\n^\nD02/03/2024\nT2\n^\nD13/03/2024\nT3\n^\nD04/05/2024\nT4\n^\n",
+			rows: []string{
+				"1 1.00 2024-02-01 Без категории | ",
+				"1 2.00 2024-03-02 Без категории | ",
+				"1 3.00 2024-03-13 Без категории | ",
+				"1 4.00 2024-05-04 Без категории | ",
+			},
+		},
+		{
+			name: "однозначной даты нет — месяц первым",
+			src:  "!Type:Bank\nD01/02/2024\nT1\n^\nD03/04/2024\nT2\n^\n",
+			rows: []string{
+				"1 1.00 2024-01-02 Без категории | ",
+				"1 2.00 2024-03-04 Без категории | ",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := decodeString(t, tt.im, tt.src)
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n got %q\nwant %q", got, tt.rows)
+			}
+			if got := issuesText(res.Issues); !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("issues:\n got %q\nwant %q", got, tt.issues)
+			}
+		})
+	}
+}
+
+func TestQIFRoundTrip(t *testing.T) {
+	rows := []Row{
+		testRow(-1, "1500.5", "2024-02-01", "Еда", "Магазин\nу дома"),
+		testRow(1, "100", "2024-02-13", TransferPrefix+"Сбережения", ""),
+	}
+	for _, order := range []string{QIFMonthFirst, QIFDayFirst} {
+		t.Run(order, func(t *testing.T) {
+			out, err := EncodeRows(QIFEncoder{DateOrder: order}, rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := decodeString(t, QIFImporter{}, string(out))
+			want := []string{
+				"-1 1500.50 2024-02-01 Еда | Магазин у дома",
+				"1 100.00 2024-02-13 Перевод: Сбережения | ",
+			}
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, want) {
+				t.Errorf("rows:\n got %q\nwant %q\nfile:\n%s", got, want, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"main/domain"
+	"main/repo"
+)
+
+// Format — формат файла операций в реестре. Встроенные форматы регистрируются
+// ниже в init; сторонний формат подключается одним вызовом Register:
+//
+//	files.Register(files.Format{
+//		Name: "mybank", Title: "Выписка MyBank", Extensions: []string{".mbk"},
+//		Sniff:    func(head []byte) bool { return bytes.HasPrefix(head, []byte("MYBANK")) },
+//		Importer: func(files.Options) files.Importer { return files.DecodeFunc(decodeMyBank) },
+//	})
+type Format struct {
+	Name       string   // ключ формата: флаг -format, сообщения
+	Title      string   // название для меню
+	Extensions []string // с точкой, в нижнем регистре: ".csv"
+	// Sniff узнаёт формат по началу файла (до sniffSize байт, без BOM и ведущих
+	// пробелов); nil — только по расширению.
+	Sniff func(head []byte) bool
+	// Importer — разборщик с настройками импорта; nil — формат только для выгрузки.
+	Importer func(opts Options) Importer
+	// Encoder — кодировщик выгрузки; nil — формат только для импорта.
+	Encoder func(opts ExportOptions) Encoder
+	// Asks — какие настройки формата спросить у пользователя.
+	Asks Ask
+}
+
+// Ask — настройки, которые меню спрашивает для формата.
+type Ask uint
+
+const (
+	AskAccounts   Ask = 1 << iota // выгрузка: несколько счетов (ExportQuery.Accounts)
+	AskFilters                    // выгрузка: категории и тип (ExportQuery)
+	AskColumns                    // выгрузка: ExportOptions.Columns
+	AskCSVProfile                 // импорт: Options.CSVProfile
+	AskDateOrder                  // Options.DateOrder / ExportOptions.DateOrder
+	AskCategory                   // импорт: Options.DefaultCategory
+	AskTransfers                  // выгрузка: ExportOptions.Transfers
+	AskCurrency                   // выгрузка: ExportOptions.Currency
+)
+
+// ExportOptions — настройки кодировщиков; каждый формат берёт нужные ему.
+type ExportOptions struct {
+	Columns    []string        // CSV, JSON, YAML; nil — DefaultColumns
+	DateOrder  string          // QIF
+	Transfers  bool            // ledger
+	Currency   string          // Beancount
+	Names      BeancountNames  // Beancount
+	Categories []CategoryTotal // XLSX: разбивка из аналитики; nil — по строкам
+
+	// Заполняет Export.
+	Account  string // имя счёта, если он в выгрузке один
+	From, To time.Time
+}
+
+// AccountsEncoder — кодировщик, которому нужны счета по отдельности, с остатком
+// на начало периода (Beancount). Export отдаёт ему все счета запроса.
+type AccountsEncoder interface {
+	EncodeAccounts(w io.Writer, accs []BeancountAccount) error
+}
+
+// DecodeFunc — разборщик стороннего формата: записи передаются в res.Add.
+type DecodeFunc func(r io.Reader, res *Parsed) error
+
+func (f DecodeFunc) decode(r io.Reader, res *Parsed) error { return f(r, res) }
+
+var registry []Format
+
+func init() {
+	for _, f := range []Format{
+		{Name: "csv", Title: "CSV", Extensions: []string{".csv"}, Sniff: sniffCSV, Asks: AskAccounts | AskFilters | AskColumns | AskCSVProfile,
+			Importer: func(o Options) Importer { return CSVImporter{Profile: o.CSVProfile} },
+			Encoder:  func(o ExportOptions) Encoder { return CSVEncoder{Columns: o.Columns} }},
+		{Name: "yaml", Title: "YAML", Extensions: []string{".yaml", ".yml"}, Sniff: sniffYAML, Asks: AskAccounts | AskFilters | AskColumns,
+			Importer: func(Options) Importer { return YAMLImporter{} },
+			Encoder:  func(o ExportOptions) Encoder { return YAMLEncoder{Columns: o.Columns} }},
+		{Name: "json", Title: "JSON", Extensions: []string{".json"}, Sniff: sniffJSON, Asks: AskAccounts | AskFilters | AskColumns,
+			Importer: func(Options) Importer { return JSONImporter{} },
+			Encoder:  func(o ExportOptions) Encoder { return JSONEncoder{Columns: o.Columns} }},
+		{Name: "xlsx", Title: "XLSX", Extensions: []string{".xlsx"},
+			Encoder: func(o ExportOptions) Encoder {
+				return XLSXEncoder{Account: o.Account, From: o.From, To: o.To, Categories: o.Categories}
+			}},
+		{Name: "beancount", Title: "Beancount", Extensions: []string{".beancount", ".bean"}, Asks: AskAccounts | AskCurrency,
+			Encoder: func(o ExportOptions) Encoder {
+				return BeancountEncoder{Account: o.Account, Currency: o.Currency, Names: o.Names, From: o.From, To: o.To}
+			}},
+		{Name: "ledger", Title: "ledger/hledger", Extensions: []string{".journal", ".ledger", ".hledger"}, Sniff: sniffLedger, Asks: AskTransfers,
+			Importer: func(o Options) Importer { return LedgerImporter{DefaultCategory: o.DefaultCategory} },
+			Encoder:  func(o ExportOptions) Encoder { return LedgerEncoder{Account: o.Account, Transfers: o.Transfers} }},
+		{Name: "qif", Title: "QIF", Extensions: []string{".qif"}, Sniff: sniffQIF, Asks: AskDateOrder | AskCategory,
+			Importer: func(o Options) Importer {
+				return QIFImporter{DateOrder: o.DateOrder, DefaultCategory: o.DefaultCategory}
+			},
+			Encoder: func(o ExportOptions) Encoder { return QIFEncoder{DateOrder: o.DateOrder} }},
+		{Name: "mt940", Title: "MT940", Extensions: []string{".sta", ".mt940", ".940"}, Sniff: sniffMT940, Asks: AskCategory,
+			Importer: func(o Options) Importer { return MT940Importer{DefaultCategory: o.DefaultCategory} }},
+		{Name: "camt", Title: "camt.053", Extensions: []string{".xml", ".camt"}, Sniff: sniffCAMT, Asks: AskCategory,
+			Importer: func(o Options) Importer { return CAMTImporter{DefaultCategory: o.DefaultCategory} }},
+		{Name: "ofx", Title: "OFX/QFX", Extensions: []string{".ofx", ".qfx"}, Sniff: sniffOFX, Asks: AskCategory,
+			Importer: func(o Options) Importer { return OFXImporter{DefaultCategory: o.DefaultCategory} }},
+		{Name: "zenmoney", Title: "Дзен-мани (CSV)", Extensions: []string{".csv"}, Sniff: sniffZenmoney, Asks: AskCategory,
+			Importer: func(o Options) Importer { return ZenmoneyImporter{DefaultCategory: o.DefaultCategory} }},
+		{Name: "coinkeeper", Title: "CoinKeeper (CSV)", Extensions: []string{".csv"}, Sniff: sniffCoinKeeper, Asks: AskCategory,
+			Importer: func(o Options) Importer { return CoinKeeperImporter{DefaultCategory: o.DefaultCategory} }},
+	} {
+		Register(f)
+	}
+}
+
+// Register добавляет формат в реестр. Sniff проверяются от последнего
+// зарегистрированного к первому: сторонние форматы — раньше встроенных, а CSV,
+// под который подходит почти любой текст, — последним. Повтор имени — паника,
+// как у database/sql.Register.
+func Register(f Format) {
+	if f.Name == "" || (f.Importer == nil && f.Encoder == nil) {
+		panic("files: Register: format needs a name and an importer or encoder")
+	}
+	if _, ok := FormatByName(f.Name); ok {
+		panic("files: Register: format " + f.Name + " registered twice")
+	}
+	registry = append(registry, f)
+}
+
+// Formats — зарегистрированные форматы в порядке регистрации.
+func Formats() []Format {
+	return slices.Clone(registry)
+}
+
+func FormatByName(name string) (Format, bool) {
+	for _, f := range registry {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// CanImport / CanExport — поддерживает ли формат направление.
+func (f Format) CanImport() bool { return f.Importer != nil }
+func (f Format) CanExport() bool { return f.Encoder != nil }
+
+// Open — импортёр файла этого формата.
+func (f Format) Open(opts Options) BaseImporter {
+	return NewImporter(f.Importer(opts), opts)
+}
+
+const sniffSize = 4096
+
+// DetectFormat — формат файла для импорта. Единственный формат с таким
+// расширением выбирается сразу; если расширение общее у нескольких форматов
+// или незнакомо — по содержимому.
+func DetectFormat(path string) (Format, error) {
+	byExt := formatsFor(path, Format.CanImport)
+	if len(byExt) == 1 {
+		return byExt[0], nil
+	}
+	head, err := readHead(path)
+	if err != nil {
+		return Format{}, err
+	}
+	for _, cands := range [][]Format{byExt, registry} {
+		for _, f := range slices.Backward(cands) {
+			if f.CanImport() && f.Sniff != nil && f.Sniff(head) {
+				return f, nil
+			}
+		}
+	}
+	return Format{}, fmt.Errorf("не удалось определить формат файла %s", filepath.Base(path))
+}
+
+// ExportFormat — формат выгрузки по расширению файла.
+func ExportFormat(path string) (Format, error) {
+	byExt := formatsFor(path, Format.CanExport)
+	if len(byExt) == 0 {
+		return Format{}, fmt.Errorf("нет формата выгрузки для расширения %q", filepath.Ext(path))
+	}
+	return byExt[0], nil
+}
+
+func formatsFor(path string, can func(Format) bool) []Format {
+	ext := strings.ToLower(filepath.Ext(path))
+	var out []Format
+	for _, f := range registry {
+		if can(f) && slices.Contains(f.Extensions, ext) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// readHead — начало файла без BOM и ведущих пробелов.
+func readHead(path string) ([]byte, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	head, err := bufio.NewReader(fh).Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	return bytes.TrimLeft(head, " \t\r\n"), nil
+}
+
+// Export выгружает операции по запросу в формате f. Форматы без AskAccounts пишут
+// ровно один счёт; AccountsEncoder получает счета по отдельности.
+func Export(
+	ctx context.Context,
+	accs *repo.PgAccountRepo,
+	ops *repo.PgOperationRepo,
+	cats *repo.CachedCategoryRepo,
+	f Format,
+	q ExportQuery,
+	opts ExportOptions,
+	path string,
+) error {
+	if !f.CanExport() {
+		return fmt.Errorf("export: format %s is import-only", f.Name)
+	}
+	list, err := accs.List(ctx)
+	if err != nil {
+		return err
+	}
+	byID := map[domain.AccountID]domain.BankAccount{}
+	names := map[domain.AccountID]string{}
+	for _, a := range list {
+		byID[a.ID] = a
+		names[a.ID] = a.Name
+	}
+	if len(q.Accounts) == 0 {
+		for _, a := range list {
+			q.Accounts = append(q.Accounts, a.ID)
+		}
+	}
+	for _, id := range q.Accounts {
+		if _, ok := byID[id]; !ok {
+			return fmt.Errorf("export: account %s not found", id)
+		}
+	}
+	if f.Asks&AskAccounts == 0 && len(q.Accounts) != 1 {
+		return fmt.Errorf("export: format %s writes exactly one account, got %d", f.Name, len(q.Accounts))
+	}
+	// остатки и даты в файле — по календарным дням
+	q.From, q.To = day(q.From), day(q.To)
+	opts.From, opts.To = q.From, q.To
+	if len(q.Accounts) == 1 {
+		opts.Account = names[q.Accounts[0]]
+	}
+	enc := f.Encoder(opts)
+
+	if ae, ok := enc.(AccountsEncoder); ok {
+		out := make([]BeancountAccount, 0, len(q.Accounts))
+		for _, id := range q.Accounts {
+			a := byID[id]
+			closing, err := closingBalance(ctx, ops, a, q.To)
+			if err != nil {
+				return err
+			}
+			period, err := opsNet(ops.StreamByAccount(ctx, a.ID, q.From, q.To))
+			if err != nil {
+				return err
+			}
+			one := q
+			one.Accounts = []domain.AccountID{id}
+			out = append(out, BeancountAccount{
+				Name:    a.Name,
+				Opening: closing.Sub(period),
+				Rows:    queryRows(ctx, ops, cats, one, names),
+			})
+		}
+		return writeFile(path, func(w io.Writer) error {
+			return ae.EncodeAccounts(w, out)
+		})
+	}
+	return writeFile(path, func(w io.Writer) error {
+		return enc.Encode(w, queryRows(ctx, ops, cats, q, names))
+	})
+}
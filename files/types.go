@@ -12,4 +12,43 @@ type Row struct {
 	Date        time.Time       `json:"date" yaml:"date"`         // YYYY-MM-DD
 	Category    string          `json:"category" yaml:"category"` // имя категории
 	Description string          `json:"description" yaml:"description"`
+	Line        int             `json:"-" yaml:"-"` // строка исходного файла, 0 — неизвестна
+	ExternalID  string          `json:"-" yaml:"-"` // id операции в выписке банка (FITID), "" — нет
+	Statement   int             `json:"-" yaml:"-"` // индекс выписки в Parsed.Statements
+	Account     string          `json:"-" yaml:"-"` // имя счёта — при экспорте нескольких счетов
+}
+
+// Balance — остаток по выписке на дату.
+type Balance struct {
+	Amount decimal.Decimal
+	Date   time.Time
+}
+
+// Statement — сведения о выписке из файла (OFX и т.п.), по которым импорт
+// можно сверить с балансом счёта.
+type Statement struct {
+	Account  string // номер счёта в банке
+	Currency string
+	Opening  *Balance
+	Closing  *Balance // для OFX — LEDGERBAL
+}
+
+// Check сверяет выписку саму с собой: входящий остаток плюс движение по строкам
+// должен дать исходящий. ok=false — в выписке нет одного из остатков.
+func (s Statement) Check(rows RowSeq) (diff decimal.Decimal, ok bool, err error) {
+	if s.Opening == nil || s.Closing == nil {
+		return decimal.Zero, false, nil
+	}
+	bal := s.Opening.Amount
+	for r, err := range rows {
+		if err != nil {
+			return decimal.Zero, false, err
+		}
+		if r.Type < 0 {
+			bal = bal.Sub(r.Amount)
+		} else {
+			bal = bal.Add(r.Amount)
+		}
+	}
+	return bal.Sub(s.Closing.Amount), true, nil
 }
@@ -0,0 +1,365 @@
+package files
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CategoryTotal — строка разбивки по категориям (как в AnalyticsFacade.BreakdownByCategory).
+type CategoryTotal struct {
+	Category string
+	Type     int // 1 доход, -1 расход
+	Amount   decimal.Decimal
+}
+
+// XLSXEncoder собирает книгу Excel (Office Open XML) без сторонних библиотек:
+// лист операций с датами и суммами как числами, лист разбивки по категориям
+// и лист сводки. Заголовки закреплены, у сумм и дат — числовые форматы.
+type XLSXEncoder struct {
+	Account  string
+	From, To time.Time
+	// Categories — разбивка за период; nil — считается по строкам.
+	Categories []CategoryTotal
+}
+
+// Стили ячеек — индексы cellXfs в xlsxStyles.
+const (
+	xlsxGeneral = iota
+	xlsxDate
+	xlsxMoney
+	xlsxHeader
+	xlsxTotal
+	xlsxPercent
+	xlsxTotalLabel
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="dd.mm.yyyy"/><numFmt numFmtId="165" formatCode="#,##0.00;[Red]\-#,##0.00"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill><fill><patternFill patternType="solid"><fgColor rgb="FFD9E1F2"/><bgColor indexed="64"/></patternFill></fill></fills>
+<borders count="2"><border><left/><right/><top/><bottom/><diagonal/></border><border><left/><right/><top/><bottom style="thin"><color auto="1"/></bottom><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="7">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="1" fillId="2" borderId="1" xfId="0" applyFont="1" applyFill="1" applyBorder="1"/>
+<xf numFmtId="165" fontId="1" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>
+<xf numFmtId="10" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+// xlsxCell — значение ячейки: string, decimal.Decimal, time.Time, int или формула.
+type xlsxCell struct {
+	v     any
+	style int
+}
+
+type xlsxFormula struct {
+	expr   string
+	cached decimal.Decimal
+}
+
+type xlsxSheet struct {
+	name   string
+	widths []float64
+	rows   [][]xlsxCell
+	frozen bool // первая строка — закреплённый заголовок
+}
+
+// Encode пишет лист операций в архив по мере чтения строк, попутно считая
+// итоги и разбивку для остальных листов; в памяти остаются только они.
+func (e XLSXEncoder) Encode(out io.Writer, rows RowSeq) error {
+	zw := zip.NewWriter(out)
+	write := func(name, body string) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, body)
+		return err
+	}
+
+	w, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	tot, err := e.operations(w, rows)
+	if err != nil {
+		return err
+	}
+	sheets := []xlsxSheet{{name: "Операции"}, e.categories(tot), e.summary(tot)}
+
+	var ct, wb, rels strings.Builder
+	ct.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+`)
+	wb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, sh := range sheets {
+		n := i + 1
+		fmt.Fprintf(&ct, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", n)
+		fmt.Fprintf(&wb, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sh.name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		if i == 0 {
+			continue // лист операций уже записан
+		}
+		if err := write(fmt.Sprintf("xl/worksheets/sheet%d.xml", n), sh.xml()); err != nil {
+			return err
+		}
+	}
+	ct.WriteString(`</Types>`)
+	wb.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`, len(sheets)+1)
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", ct.String()},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", wb.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		if err := write(p.name, p.body); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// rowTotals — итоги потока строк для сводок.
+type rowTotals struct {
+	count           int
+	income, expense decimal.Decimal
+	cats            categoryAcc
+}
+
+func (t *rowTotals) add(r Row) {
+	t.count++
+	if r.Type < 0 {
+		t.expense = t.expense.Add(r.Amount)
+	} else {
+		t.income = t.income.Add(r.Amount)
+	}
+	t.cats.add(r)
+}
+
+func header(names ...string) []xlsxCell {
+	out := make([]xlsxCell, len(names))
+	for i, n := range names {
+		out[i] = xlsxCell{n, xlsxHeader}
+	}
+	return out
+}
+
+func (e XLSXEncoder) operations(w io.Writer, rows RowSeq) (rowTotals, error) {
+	sh := xlsxSheet{name: "Операции", widths: []float64{12, 10, 14, 24, 50}, frozen: true}
+	out := &errWriter{w: w}
+	sh.writeHead(out)
+	sh.writeRow(out, 1, header("Дата", "Тип", "Сумма", "Категория", "Описание"))
+	var tot rowTotals
+	total := decimal.Zero
+	for r, err := range rows {
+		if err != nil {
+			return tot, err
+		}
+		tot.add(r)
+		typ, amt := "Доход", r.Amount
+		if r.Type < 0 {
+			typ, amt = "Расход", r.Amount.Neg()
+		}
+		total = total.Add(amt)
+		sh.writeRow(out, tot.count+1, []xlsxCell{
+			{r.Date, xlsxDate}, {typ, xlsxGeneral}, {amt, xlsxMoney}, {r.Category, xlsxGeneral}, {r.Description, xlsxGeneral},
+		})
+		if out.err != nil {
+			return tot, out.err
+		}
+	}
+	if tot.count > 0 {
+		sum := xlsxFormula{fmt.Sprintf("SUM(C2:C%d)", tot.count+1), total}
+		sh.writeRow(out, tot.count+2, []xlsxCell{{"Итого", xlsxTotalLabel}, {"", xlsxGeneral}, {sum, xlsxTotal}})
+	}
+	sh.writeTail(out)
+	return tot, out.err
+}
+
+func (e XLSXEncoder) categories(tot rowTotals) xlsxSheet {
+	cats := e.Categories
+	if cats == nil {
+		cats = tot.cats.totals()
+	}
+	sh := xlsxSheet{name: "Категории", widths: []float64{10, 30, 14, 10}, frozen: true}
+	sh.rows = append(sh.rows, header("Тип", "Категория", "Сумма", "Доля"))
+	for _, t := range []int{1, -1} {
+		typ, label := "Доход", "Итого доходов"
+		if t < 0 {
+			typ, label = "Расход", "Итого расходов"
+		}
+		total := decimal.Zero
+		for _, c := range cats {
+			if c.Type == t {
+				total = total.Add(c.Amount)
+			}
+		}
+		for _, c := range cats {
+			if c.Type != t {
+				continue
+			}
+			share := decimal.Zero
+			if !total.IsZero() {
+				share = c.Amount.Div(total)
+			}
+			sh.rows = append(sh.rows, []xlsxCell{{typ, xlsxGeneral}, {c.Category, xlsxGeneral}, {c.Amount, xlsxMoney}, {share, xlsxPercent}})
+		}
+		if !total.IsZero() {
+			sh.rows = append(sh.rows, []xlsxCell{{"", xlsxGeneral}, {label, xlsxTotalLabel}, {total, xlsxTotal}})
+		}
+	}
+	return sh
+}
+
+func (e XLSXEncoder) summary(tot rowTotals) xlsxSheet {
+	sh := xlsxSheet{name: "Сводка", widths: []float64{22, 20}, frozen: true}
+	sh.rows = append(sh.rows, header("Показатель", "Значение"))
+	if e.Account != "" {
+		sh.rows = append(sh.rows, []xlsxCell{{"Счёт", xlsxGeneral}, {e.Account, xlsxGeneral}})
+	}
+	if !e.From.IsZero() {
+		sh.rows = append(sh.rows, []xlsxCell{{"Период с", xlsxGeneral}, {e.From, xlsxDate}})
+	}
+	if !e.To.IsZero() {
+		sh.rows = append(sh.rows, []xlsxCell{{"Период по", xlsxGeneral}, {e.To, xlsxDate}})
+	}
+	sh.rows = append(sh.rows,
+		[]xlsxCell{{"Операций", xlsxGeneral}, {tot.count, xlsxGeneral}},
+		[]xlsxCell{{"Доходы", xlsxGeneral}, {tot.income, xlsxMoney}},
+		[]xlsxCell{{"Расходы", xlsxGeneral}, {tot.expense, xlsxMoney}},
+		[]xlsxCell{{"Итого", xlsxTotalLabel}, {tot.income.Sub(tot.expense), xlsxTotal}},
+	)
+	return sh
+}
+
+// categoryAcc копит разбивку по категориям; totals — по убыванию суммы внутри типа.
+type categoryAcc struct {
+	idx map[string]int
+	out []CategoryTotal
+}
+
+func (a *categoryAcc) add(r Row) {
+	if a.idx == nil {
+		a.idx = map[string]int{}
+	}
+	t := 1
+	if r.Type < 0 {
+		t = -1
+	}
+	k := strconv.Itoa(t) + "|" + r.Category
+	i, ok := a.idx[k]
+	if !ok {
+		a.out = append(a.out, CategoryTotal{Category: r.Category, Type: t})
+		i = len(a.out) - 1
+		a.idx[k] = i
+	}
+	a.out[i].Amount = a.out[i].Amount.Add(r.Amount)
+}
+
+func (a *categoryAcc) totals() []CategoryTotal {
+	out := append([]CategoryTotal(nil), a.out...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Amount.GreaterThan(out[j].Amount) })
+	return out
+}
+
+func (sh xlsxSheet) xml() string {
+	var b strings.Builder
+	sh.writeHead(&b)
+	for i, row := range sh.rows {
+		sh.writeRow(&b, i+1, row)
+	}
+	sh.writeTail(&b)
+	return b.String()
+}
+
+func (sh xlsxSheet) writeHead(b io.Writer) {
+	io.WriteString(b, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if sh.frozen {
+		io.WriteString(b, `<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/><selection pane="bottomLeft" activeCell="A2" sqref="A2"/></sheetView></sheetViews>`)
+	}
+	if len(sh.widths) > 0 {
+		io.WriteString(b, `<cols>`)
+		for i, w := range sh.widths {
+			fmt.Fprintf(b, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, w)
+		}
+		io.WriteString(b, `</cols>`)
+	}
+	io.WriteString(b, `<sheetData>`)
+}
+
+// writeRow пишет строку листа с номером n (с 1).
+func (sh xlsxSheet) writeRow(b io.Writer, n int, row []xlsxCell) {
+	fmt.Fprintf(b, `<row r="%d">`, n)
+	for j, c := range row {
+		ref := xlsxColumn(j) + strconv.Itoa(n)
+		switch v := c.v.(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+			fmt.Fprintf(b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, c.style, xmlEscape(v))
+		case decimal.Decimal:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, c.style, v.String())
+		case int:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, c.style, v)
+		case time.Time:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, c.style, excelSerial(v))
+		case xlsxFormula:
+			fmt.Fprintf(b, `<c r="%s" s="%d"><f>%s</f><v>%s</v></c>`, ref, c.style, xmlEscape(v.expr), v.cached.String())
+		}
+	}
+	io.WriteString(b, `</row>`)
+}
+
+func (sh xlsxSheet) writeTail(b io.Writer) {
+	io.WriteString(b, `</sheetData></worksheet>`)
+}
+
+// excelSerial — дата как число дней от 1899-12-30 (с учётом ошибки Excel про 1900 год).
+func excelSerial(t time.Time) int64 {
+	d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return int64(d.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+}
+
+// xlsxColumn: 0 → A, 25 → Z, 26 → AA.
+func xlsxColumn(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -1,82 +1,190 @@
 package files
 
 import (
+	"bufio"
 	"bytes"
-	"context"
-	"time"
+	"fmt"
+	"io"
+	"strings"
 
-	"main/domain"
-	"main/repo"
-
-	"github.com/shopspring/decimal"
 	"gopkg.in/yaml.v3"
 )
 
-type opRowYAML struct {
-	Type        int    `yaml:"type"`
-	Amount      string `yaml:"amount"`
-	Date        string `yaml:"date"`
-	Category    string `yaml:"category"`
-	Description string `yaml:"description"`
+// YAMLEncoder пишет список словарей с выбранными колонками; nil — DefaultColumns.
+type YAMLEncoder struct {
+	Columns []string
 }
 
-type YAMLEncoder struct{}
-
-func (YAMLEncoder) EncodeRows(rows []Row) ([]byte, error) {
-	out := make([]opRowYAML, 0, len(rows))
-	for _, r := range rows {
-		out = append(out, opRowYAML{
-			Type:        r.Type,
-			Amount:      r.Amount.StringFixed(2),
-			Date:        r.Date.Format("2006-01-02"),
-			Category:    r.Category,
-			Description: r.Description,
-		})
+// Encode пишет список по одному элементу: yaml.Marshal одноэлементного списка
+// даёт ровно тот же текст, что элемент в составе всего списка.
+func (e YAMLEncoder) Encode(out io.Writer, rows RowSeq) error {
+	w := &errWriter{w: out}
+	cols := columns(e.Columns)
+	n := 0
+	for r, err := range rows {
+		if err != nil {
+			return err
+		}
+		item := &yaml.Node{Kind: yaml.MappingNode}
+		for _, c := range cols {
+			v := &yaml.Node{}
+			if err := v.Encode(rowValue(r, c)); err != nil {
+				return err
+			}
+			item.Content = append(item.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: c}, v)
+		}
+		b, err := yaml.Marshal([]*yaml.Node{item})
+		if err != nil {
+			return err
+		}
+		w.Write(b)
+		n++
+	}
+	if n == 0 {
+		io.WriteString(w, "[]\n")
 	}
-	return yaml.Marshal(out)
+	return w.err
 }
 
-func ExportOperationsYAML(
-	ctx context.Context,
-	ops *repo.PgOperationRepo,
-	cats *repo.PgCategoryRepo,
-	accID domain.AccountID,
-	from, to time.Time,
-	path string,
-) error {
-	return ExportOperations(ctx, ops, cats, accID, from, to, path, YAMLEncoder{})
+type YAMLImporter struct{}
+
+// sniffYAML: список блочного вида или начало документа "---".
+func sniffYAML(head []byte) bool {
+	return yamlItemStart(head) || bytes.HasPrefix(head, []byte("---"))
 }
 
-type YAMLImporter struct{}
+// decode читает список блочного вида ("- type: 1", как пишет YAMLEncoder) по
+// одному элементу: элемент верхнего уровня начинается с "-" в первой колонке.
+// Остальное (поток "[...]", якоря между элементами) разбирается целиком.
+func (im YAMLImporter) decode(r io.Reader, res *Parsed) error {
+	br := bufio.NewReader(r)
+	var head []byte // комментарии и пустые строки до первого элемента
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		t := bytes.TrimSpace(line)
+		if len(t) > 0 && t[0] != '#' && !bytes.Equal(t, []byte("---")) {
+			if !yamlItemStart(line) {
+				rest, rerr := io.ReadAll(br)
+				if rerr != nil {
+					return rerr
+				}
+				return im.decodeDoc(append(append(head, line...), rest...), res)
+			}
+			return im.decodeItems(br, line, bytes.Count(head, []byte("\n"))+1, res)
+		}
+		head = append(head, line...)
+		if err == io.EOF {
+			return nil // пустой документ
+		}
+	}
+}
+
+func yamlItemStart(line []byte) bool {
+	return len(line) > 0 && line[0] == '-' && (len(line) == 1 || line[1] == ' ' || line[1] == '\n' || line[1] == '\r')
+}
 
-func (YAMLImporter) parse(data []byte) ([]Row, error) {
-	dec := yaml.NewDecoder(bytes.NewReader(data))
-	var in []opRowYAML
-	if err := dec.Decode(&in); err != nil {
-		return nil, err
+// decodeItems разбирает элементы списка по одному; first — первая строка первого
+// элемента, start — её номер в файле.
+func (im YAMLImporter) decodeItems(br *bufio.Reader, first []byte, start int, res *Parsed) error {
+	item := append([]byte(nil), first...)
+	line, record := start, 0
+	flush := func(next int) error {
+		record++
+		var doc yaml.Node
+		if err := yaml.Unmarshal(item, &doc); err != nil {
+			return fmt.Errorf("yaml: запись %d (строка %d): %w", record, line, err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.SequenceNode {
+			return fmt.Errorf("yaml: строка %d: ожидается список операций", line)
+		}
+		for _, n := range doc.Content[0].Content {
+			yamlShift(n, line-1)
+			im.item(n, record, res)
+		}
+		item, line = item[:0], next
+		return res.stopped()
 	}
-	out := make([]Row, 0, len(in))
-	for _, r := range in {
-		amt, err := decimal.NewFromString(r.Amount)
-		if err != nil {
-			continue
+	n := start
+	for {
+		b, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
 		}
-		dt, err := time.Parse("2006-01-02", r.Date)
-		if err != nil {
-			continue
+		if len(b) > 0 {
+			n++
+			if yamlItemStart(b) {
+				if err := flush(n); err != nil {
+					return err
+				}
+			} else if t := bytes.TrimSpace(b); bytes.Equal(t, []byte("...")) || bytes.Equal(t, []byte("---")) {
+				break // конец документа; следующие документы не читаются, как и в yaml.Unmarshal
+			}
+			item = append(item, b...)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return flush(n)
+}
+
+// yamlShift переводит номера строк узла из куска в номера строк файла.
+func yamlShift(n *yaml.Node, by int) {
+	n.Line += by
+	for _, c := range n.Content {
+		yamlShift(c, by)
+	}
+}
+
+// decodeDoc — разбор документа целиком.
+func (im YAMLImporter) decodeDoc(data []byte, res *Parsed) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	seq := doc.Content[0]
+	if seq.Kind != yaml.SequenceNode {
+		return fmt.Errorf("yaml: строка %d: ожидается список операций", seq.Line)
+	}
+	for i, item := range seq.Content {
+		if err := res.stopped(); err != nil {
+			return err
 		}
-		out = append(out, Row{
-			Type:        r.Type,
-			Amount:      amt.Round(2),
-			Date:        dt,
-			Category:    r.Category,
-			Description: r.Description,
-		})
+		im.item(item, i+1, res)
 	}
-	return out, nil
+	return nil
 }
 
-func ImportOperationsYAML(path string) ([]Row, error) {
-	base := BaseImporter{parser: YAMLImporter{}}
-	return base.Import(path)
+func (YAMLImporter) item(item *yaml.Node, record int, res *Parsed) {
+	src, _ := yaml.Marshal(item)
+	source := strings.TrimSpace(string(src))
+	if item.Kind != yaml.MappingNode {
+		res.Records++
+		res.reject(item.Line, record, "", "", "запись должна быть объектом", source)
+		return
+	}
+	raw := rawRow{line: map[string]int{}}
+	for j := 0; j+1 < len(item.Content); j += 2 {
+		k, v := item.Content[j], item.Content[j+1]
+		raw.line[k.Value] = v.Line
+		switch k.Value {
+		case "type":
+			raw.Type = v.Value
+		case "amount":
+			raw.Amount = v.Value
+		case "date":
+			raw.Date = v.Value
+		case "category":
+			raw.Category = v.Value
+		case "description":
+			raw.Description = v.Value
+		}
+	}
+	res.add(item.Line, record, raw, source)
 }
@@ -0,0 +1,116 @@
+package files
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ZenmoneyImporter читает CSV-выгрузку Дзен-мани: у записи есть счёт списания
+// с суммой outcome и счёт зачисления с суммой income, каждая в своей валюте.
+// Расход — заполнен только outcome, доход — только income; оба на разных
+// счетах — перевод. Категория — первый тег (вложенные — «Родитель / Тег»),
+// остальные теги, получатель и комментарий идут в описание.
+type ZenmoneyImporter struct {
+	DefaultCategory string // для записей без тега; "" — NoCategory
+}
+
+var zenmoneyColumns = map[string][]string{
+	"date":        {"date", "дата"},
+	"category":    {"categoryname", "категория"},
+	"payee":       {"payee", "получатель", "плательщик"},
+	"comment":     {"comment", "комментарий"},
+	"outAccount":  {"outcomeaccountname", "счет списания", "счёт списания"},
+	"out":         {"outcome", "расход"},
+	"outCurrency": {"outcomecurrencyshorttitle", "валюта списания"},
+	"inAccount":   {"incomeaccountname", "счет зачисления", "счёт зачисления"},
+	"in":          {"income", "доход"},
+	"inCurrency":  {"incomecurrencyshorttitle", "валюта зачисления"},
+}
+
+func sniffZenmoney(head []byte) bool {
+	cells := headerCells(head)
+	return slices.Contains(cells, "outcomeaccountname") && slices.Contains(cells, "incomeaccountname")
+}
+
+// decode читает файл целиком: записи сортируются по дате.
+func (im ZenmoneyImporter) decode(in io.Reader, res *Parsed) error {
+	cols, recs, err := readAppCSV(in, "zenmoney", zenmoneyColumns,
+		[]string{"date", "outAccount", "out", "inAccount", "in"}, false)
+	if err != nil {
+		return err
+	}
+	book := newAppBook(res)
+	for _, rec := range recs {
+		if err := res.stopped(); err != nil {
+			return err
+		}
+		f := func(field string) string { return appField(rec.fields, cols, field) }
+		source := strings.Join(rec.fields, ";")
+
+		out, err1 := appAmount(f("out"))
+		in, err2 := appAmount(f("in"))
+		if err1 != nil || err2 != nil {
+			res.Records++
+			if err1 != nil {
+				res.reject(rec.line, rec.record, "outcome", f("out"), "не число", source)
+			}
+			if err2 != nil {
+				res.reject(rec.line, rec.record, "income", f("in"), "не число", source)
+			}
+			continue
+		}
+		if !out.IsPositive() && !in.IsPositive() {
+			res.Records++
+			res.reject(rec.line, rec.record, "outcome", f("out"), "нет ни расхода, ни дохода", source)
+			continue
+		}
+
+		tags := zenmoneyTags(f("category"))
+		category := im.DefaultCategory
+		if len(tags) > 0 {
+			category = tags[0]
+		}
+		var more string
+		if len(tags) > 1 {
+			more = "теги: " + strings.Join(tags[1:], ", ")
+		}
+		desc := joinNonEmpty("; ", f("payee"), f("comment"), more)
+		date := appDate(f("date"))
+		from := appEntry{account: f("outAccount"), currency: f("outCurrency"), amount: out}
+		to := appEntry{account: f("inAccount"), currency: f("inCurrency"), amount: in}
+
+		if out.IsPositive() && in.IsPositive() && !strings.EqualFold(from.account, to.account) {
+			book.transfer(rec, source, from, to, date, desc)
+			continue
+		}
+		if out.IsPositive() {
+			from.typ, from.category = -1, defaultCategory(category)
+			book.add(rec, source, date, desc, from)
+		}
+		if in.IsPositive() {
+			to.typ, to.category = 1, defaultCategory(category)
+			book.add(rec, source, date, desc, to)
+		}
+	}
+	if len(recs) == 0 {
+		return fmt.Errorf("zenmoney: в файле нет операций")
+	}
+	return nil
+}
+
+// zenmoneyTags — теги записи через запятую; вложенный тег «Родитель / Тег».
+func zenmoneyTags(s string) []string {
+	var out []string
+	for _, t := range strings.Split(s, ",") {
+		parts := strings.Split(t, "/")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		if t = strings.Join(slices.DeleteFunc(parts, func(p string) bool { return p == "" }), " / "); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package files
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const zenmoneyHeader = "date,categoryName,payee,comment,outcomeAccountName,outcome,outcomeCurrencyShortTitle,incomeAccountName,income,incomeCurrencyShortTitle\n"
+
+func TestZenmoneyImporter(t *testing.T) {
+	tests := []struct {
+		name       string
+		im         ZenmoneyImporter
+		src        string
+		rows       []string
+		statements []string
+		stmtIndex  []int
+		issues     []string
+	}{
+		{
+			name: "расход, доход и перевод; от новых к старым",
+			src: zenmoneyHeader +
+				"2024-03-05,,,,Карта,1000,RUB,Сбережения,1000,RUB\n" +
+				"2024-03-02,Зарплата,ООО Ромашка,,Карта,0,RUB,Карта,50000,RUB\n" +
+				`2024-03-01,"Еда / Кафе, Отпуск",Кофейня,латте,Карта,250.50,RUB,Карта,0,RUB` + "\n",
+			rows: []string{
+				"-1 250.50 2024-03-01 Еда / Кафе | Кофейня; латте; теги: Отпуск",
+				"1 50000.00 2024-03-02 Зарплата | ООО Ромашка",
+				"-1 1000.00 2024-03-05 Перевод: Сбережения | ",
+				"1 1000.00 2024-03-05 Перевод: Карта | ",
+			},
+			statements: []string{"Карта RUB -→-", "Сбережения RUB -→-"},
+			stmtIndex:  []int{0, 0, 0, 1},
+		},
+		{
+			name: "русский заголовок, валютный перевод и чужая валюта счёта",
+			src: "Дата;Категория;Получатель;Комментарий;Счет списания;Расход;Валюта списания;Счет зачисления;Доход;Валюта зачисления\n" +
+				"02.03.2024;;;;Карта;9000,00;RUB;Доллары;100,00;USD\n" +
+				"01.03.2024;Продукты;;;Карта;500,00;RUB;Карта;0;RUB\n" +
+				"03.03.2024;Продукты;;;Доллары;10;EUR;Доллары;0;EUR\n" +
+				"04.03.2024;;;;Карта;10;RUB;Доллары;1;EUR\n",
+			rows: []string{
+				"-1 500.00 2024-03-01 Продукты | ",
+				"-1 9000.00 2024-03-02 Перевод: Доллары | ",
+				"1 100.00 2024-03-02 Перевод: Карта | ",
+			},
+			statements: []string{"Карта RUB -→-", "Доллары USD -→-"},
+			stmtIndex:  []int{0, 0, 1},
+			issues: []string{
+				"3 currency: валюта EUR, а счёт «Доллары» в файле в USD",
+				"4 currency: валюта EUR, а счёт «Доллары» в файле в USD",
+			},
+		},
+		{
+			name: "ошибки записей и категория по умолчанию",
+			im:   ZenmoneyImporter{DefaultCategory: "Разное"},
+			src: "date,outcomeAccountName,outcome,incomeAccountName,income\n" +
+				"2024-01-01,Карта,abc,Карта,0\n" +
+				"2024-01-02,Карта,0,Карта,0\n" +
+				"2024-01-03,,5,,0\n" +
+				"2024-01-04,Карта,5,Карта,0\n" +
+				"2024-01-05,Карта,5,Карта,7\n",
+			rows: []string{
+				"-1 5.00 2024-01-04 Разное | ",
+				"-1 5.00 2024-01-05 Разное | ",
+				"1 7.00 2024-01-05 Разное | ",
+			},
+			statements: []string{"Карта  -→-"},
+			issues: []string{
+				"1 outcome: не число",
+				"2 outcome: нет ни расхода, ни дохода",
+				"3 account: не указан счёт",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := decodeString(t, tt.im, tt.src)
+			if got := rowsText(res.Rows); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n got %q\nwant %q", got, tt.rows)
+			}
+			if got := statementsText(res.Statements); !reflect.DeepEqual(got, tt.statements) {
+				t.Errorf("statements:\n got %q\nwant %q", got, tt.statements)
+			}
+			if got := issuesText(res.Issues); !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("issues:\n got %q\nwant %q", got, tt.issues)
+			}
+			if tt.stmtIndex != nil {
+				var got []int
+				for _, r := range res.Rows {
+					got = append(got, r.Statement)
+				}
+				if !reflect.DeepEqual(got, tt.stmtIndex) {
+					t.Errorf("statement index: got %v, want %v", got, tt.stmtIndex)
+				}
+			}
+		})
+	}
+}
+
+func TestZenmoneyImporterErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"нет операций", zenmoneyHeader, "zenmoney: в файле нет операций"},
+		{"нет колонки", "date,outcome\n2024-01-01,5\n", `в заголовке нет колонки "outcomeaccountname"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res Parsed
+			err := ZenmoneyImporter{}.decode(strings.NewReader(tt.src), &res)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestZenmoneyTags(t *testing.T) {
+	for src, want := range map[string][]string{
+		"":                         nil,
+		"Еда":                      {"Еда"},
+		"Еда/Кафе, Отпуск":         {"Еда / Кафе", "Отпуск"},
+		" Дом /  / Ремонт ,, Дача": {"Дом / Ремонт", "Дача"},
+	} {
+		if got := zenmoneyTags(src); !reflect.DeepEqual(got, want) {
+			t.Errorf("zenmoneyTags(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestSniffZenmoney(t *testing.T) {
+	for src, want := range map[string]bool{
+		zenmoneyHeader:                    true,
+		"Date,Type,From,To,Tags,Amount\n": false,
+		"date,outcomeAccountName\n":       false,
+	} {
+		if got := sniffZenmoney([]byte(src)); got != want {
+			t.Errorf("sniffZenmoney(%q) = %v, want %v", src, got, want)
+		}
+	}
+}
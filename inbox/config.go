@@ -0,0 +1,86 @@
+package inbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"main/files"
+)
+
+// Config — папка входящих и правила для её файлов.
+type Config struct {
+	Dir      string        `yaml:"dir"`      // папка; "" — DefaultDir
+	Interval time.Duration `yaml:"interval"` // период опроса в режиме наблюдения; 0 — DefaultInterval
+	Rules    Rules         `yaml:"rules"`
+}
+
+const (
+	DefaultDir      = "incoming"
+	DefaultInterval = time.Minute
+)
+
+// Rule — как импортировать файлы, имя которых подходит под Match. Пустые
+// поля — как без правила: формат по файлу, счёт по выписке или имени файла.
+type Rule struct {
+	Match          string `yaml:"match"`           // шаблон имени файла (filepath.Match), без учёта регистра
+	Account        string `yaml:"account"`         // имя или ID счёта
+	Format         string `yaml:"format"`          // имя формата из реестра (files.Formats)
+	Profile        string `yaml:"profile"`         // профиль CSV
+	DateOrder      string `yaml:"date_order"`      // QIF: mdy | dmy
+	Category       string `yaml:"category"`        // категория для операций без категории
+	CreateAccounts bool   `yaml:"create_accounts"` // незнакомые счета выписки создавать, а не отклонять файл
+}
+
+type Rules []Rule
+
+// Match — первое правило, под которое подходит имя файла.
+func (rs Rules) Match(name string) (Rule, bool) {
+	name = strings.ToLower(filepath.Base(name))
+	for _, r := range rs {
+		if ok, _ := filepath.Match(strings.ToLower(r.Match), name); ok {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// LoadConfig читает настройки из YAML-файла. Отсутствующий файл — не ошибка:
+// папка по умолчанию, правил нет.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(b, &cfg); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = DefaultDir
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	for i, r := range cfg.Rules {
+		if r.Match == "" {
+			return Config{}, fmt.Errorf("%s: правило %d: нет match", path, i+1)
+		}
+		if _, err := filepath.Match(r.Match, ""); err != nil {
+			return Config{}, fmt.Errorf("%s: правило %d: match %q: %w", path, i+1, r.Match, err)
+		}
+		if r.Format != "" {
+			if f, ok := files.FormatByName(r.Format); !ok || !f.CanImport() {
+				return Config{}, fmt.Errorf("%s: правило %d: нет формата импорта %q", path, i+1, r.Format)
+			}
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,399 @@
+package inbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"main/domain"
+	"main/facade"
+	"main/files"
+	"main/repo"
+)
+
+// Inbox импортирует файлы из папки без вопросов: формат — по правилу или по
+// файлу, счёт — по правилу, выписке или имени файла. Обработанный файл
+// переезжает в done/ или failed/, итог дописывается в LogName.
+type Inbox struct {
+	Config   Config
+	Import   facade.ImportFacade
+	Acc      facade.AccountFacade
+	Accounts *repo.PgAccountRepo
+	Profiles files.CSVProfiles
+	Out      io.Writer // ход обработки; nil — os.Stdout
+}
+
+const (
+	DoneDir   = "done"
+	FailedDir = "failed"
+	LogName   = "inbox.log"
+)
+
+// Result — итог обработки одного файла.
+type Result struct {
+	File     string
+	Format   string
+	Accounts []string // счета, в которые шёл импорт
+	Imported int
+	Skipped  int    // дубли, которые уже есть в счетах
+	MovedTo  string // куда переехал файл; "" — не удалось перенести
+	Err      error
+}
+
+func (r Result) OK() bool { return r.Err == nil }
+
+// Process обрабатывает все файлы папки один раз.
+func (in Inbox) Process(ctx context.Context) ([]Result, error) {
+	names, err := in.pending()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Result, 0, len(names))
+	for _, name := range names {
+		out = append(out, in.processFile(ctx, name))
+	}
+	return out, nil
+}
+
+// Watch опрашивает папку каждые Config.Interval, пока не отменён ctx. Файл
+// берётся в работу, когда его размер и время изменения не поменялись между
+// двумя опросами, — недокачанные файлы не трогаются.
+func (in Inbox) Watch(ctx context.Context) error {
+	type stamp struct {
+		size int64
+		mod  time.Time
+	}
+	seen := map[string]stamp{}
+	t := time.NewTicker(in.Config.Interval)
+	defer t.Stop()
+	in.printf("Слежу за папкой %s (опрос раз в %s), Ctrl+C — выход\n", in.Config.Dir, in.Config.Interval)
+	for {
+		names, err := in.pending()
+		if err != nil {
+			in.printf("! %v\n", err)
+		}
+		next := map[string]stamp{}
+		for _, name := range names {
+			fi, err := os.Stat(filepath.Join(in.Config.Dir, name))
+			if err != nil {
+				continue
+			}
+			st := stamp{fi.Size(), fi.ModTime()}
+			if prev, ok := seen[name]; ok && prev == st {
+				in.processFile(ctx, name)
+				continue
+			}
+			next[name] = st
+		}
+		seen = next
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// pending — файлы папки, которые ждут обработки (без скрытых и недокачанных).
+// Папки нет — она создаётся.
+func (in Inbox) pending() ([]string, error) {
+	if err := os.MkdirAll(in.Config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("inbox: %w", err)
+	}
+	entries, err := os.ReadDir(in.Config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("inbox: %w", err)
+	}
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || name == LogName || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".part", ".crdownload", ".download", ".tmp":
+			continue
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
+
+func (in Inbox) processFile(ctx context.Context, name string) Result {
+	path := filepath.Join(in.Config.Dir, name)
+	res := Result{File: name}
+	issues, err := in.importFile(ctx, path, &res)
+	res.Err = err
+	if err != nil && ctx.Err() != nil {
+		// остановили посреди импорта: транзакция откатилась, файл ждёт следующего запуска
+		in.printf("… %s: прервано\n", name)
+		return res
+	}
+
+	dir := DoneDir
+	if err != nil {
+		dir = FailedDir
+	}
+	dest, merr := move(path, filepath.Join(in.Config.Dir, dir))
+	if merr == nil {
+		res.MovedTo = dest
+		if len(issues) > 0 {
+			merr = files.WriteRejected(files.RejectedPath(dest), issues)
+		}
+	}
+	if merr != nil && res.Err == nil {
+		res.Err = merr
+	}
+	in.report(res)
+	return res
+}
+
+// importFile: разбор → счета → предпросмотр всех выписок → импорт. Ошибка в
+// любой записи отклоняет файл целиком, до записи в БД. Все выписки
+// импортируются одной транзакцией: файл либо попадает в БД целиком, либо нет.
+func (in Inbox) importFile(ctx context.Context, path string, res *Result) ([]files.Issue, error) {
+	rule, _ := in.Config.Rules.Match(path)
+	f, err := in.format(path, rule)
+	if err != nil {
+		return nil, err
+	}
+	res.Format = f.Name
+	opts, err := in.options(f, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	im := f.Open(opts)
+	perStatement := map[int]int{}
+	parsed, err := im.Each(path, func(r files.Row) error {
+		perStatement[r.Statement]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed.Issues) > 0 {
+		return parsed.Issues, fmt.Errorf("отклонено записей: %d, первая — %s", parsed.Rejected(), parsed.Issues[0])
+	}
+	if parsed.Accepted == 0 {
+		return nil, fmt.Errorf("нет записей для импорта")
+	}
+
+	type target struct {
+		acc  domain.BankAccount
+		rows files.RowSeq
+		iban string // счёт ещё не создан: создаётся при импорте с этим номером
+	}
+	var targets []target
+	rows := im.Rows(path)
+	if len(parsed.Statements) == 0 {
+		acc, err := in.fileAccount(ctx, path, rule)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target{acc: acc, rows: rows})
+	}
+	newAccs := map[string]domain.BankAccount{}
+	for i, st := range parsed.Statements {
+		if perStatement[i] == 0 {
+			continue
+		}
+		acc, create, err := in.statementAccount(ctx, path, st, rule, newAccs)
+		if err != nil {
+			return nil, err
+		}
+		t := target{acc: acc, rows: files.StatementRows(rows, i)}
+		if create {
+			t.iban = st.Account
+		}
+		targets = append(targets, t)
+	}
+
+	iopts := facade.ImportOptions{Source: filepath.Base(path)}
+	all := make([]facade.ImportTarget, len(targets))
+	for i, t := range targets {
+		all[i] = facade.ImportTarget{Account: t.acc.ID, Rows: t.rows, Options: iopts}
+		var p facade.ImportPreview
+		if t.iban != "" {
+			acc := t.acc
+			all[i].Create, all[i].IBAN = &acc, t.iban
+			p, err = in.Import.PreviewNew(ctx, acc, t.rows, iopts)
+		} else {
+			p, err = in.Import.Preview(ctx, t.acc.ID, t.rows, iopts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.FirstShortfall > 0 {
+			return nil, fmt.Errorf("счёт «%s»: на строке %d баланс уходит в минус", t.acc.Name, p.FirstShortfall)
+		}
+	}
+	results, err := in.Import.ApplyAll(ctx, all)
+	if err != nil {
+		return nil, fmt.Errorf("импорт отменён: %w", err)
+	}
+	printed := map[domain.AccountID]bool{}
+	for _, t := range targets {
+		if t.iban != "" && !printed[t.acc.ID] {
+			printed[t.acc.ID] = true
+			in.printf("Создан счёт «%s»\n", t.acc.Name)
+		}
+	}
+	for i, r := range results {
+		res.Accounts = append(res.Accounts, targets[i].acc.Name)
+		res.Imported += r.Imported
+		res.Skipped += len(r.Skipped) + len(r.Flagged)
+	}
+	return nil, nil
+}
+
+func (in Inbox) format(path string, rule Rule) (files.Format, error) {
+	if rule.Format == "" {
+		return files.DetectFormat(path)
+	}
+	f, ok := files.FormatByName(rule.Format)
+	if !ok || !f.CanImport() {
+		return files.Format{}, fmt.Errorf("нет формата импорта %q", rule.Format)
+	}
+	return f, nil
+}
+
+func (in Inbox) options(f files.Format, rule Rule) (files.Options, error) {
+	opts := files.Options{DateOrder: rule.DateOrder, DefaultCategory: rule.Category}
+	if f.Asks&files.AskCSVProfile != 0 && rule.Profile != "" {
+		p, ok := in.Profiles.Get(rule.Profile)
+		if !ok {
+			return opts, fmt.Errorf("нет профиля CSV %q", rule.Profile)
+		}
+		opts.CSVProfile = &p
+	}
+	return opts, nil
+}
+
+// fileAccount — счёт файла без выписок: из правила, иначе — счёт, с имени
+// которого начинается имя файла («Карта-2025-03.csv» → «Карта»).
+func (in Inbox) fileAccount(ctx context.Context, path string, rule Rule) (domain.BankAccount, error) {
+	accs, err := in.Accounts.List(ctx)
+	if err != nil {
+		return domain.BankAccount{}, err
+	}
+	if rule.Account != "" {
+		for _, a := range accs {
+			if string(a.ID) == rule.Account || strings.EqualFold(a.Name, rule.Account) {
+				return a, nil
+			}
+		}
+		return domain.BankAccount{}, fmt.Errorf("нет счёта %q из правила %q", rule.Account, rule.Match)
+	}
+	stem := strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	var best domain.BankAccount
+	for _, a := range accs {
+		rest, ok := strings.CutPrefix(stem, strings.ToLower(a.Name))
+		if !ok || len(a.Name) <= len(best.Name) {
+			continue
+		}
+		if r := []rune(rest); len(r) > 0 && (unicode.IsLetter(r[0]) || unicode.IsDigit(r[0])) {
+			continue
+		}
+		best = a
+	}
+	if best.ID == "" {
+		return best, fmt.Errorf("не понять, в какой счёт импортировать: нет правила, а имя файла не начинается с имени счёта")
+	}
+	return best, nil
+}
+
+// statementAccount — счёт выписки по номеру (IBAN) или имени; выписка без
+// номера идёт в счёт файла. Незнакомый счёт заводится, только если это
+// разрешено правилом, и пока только в памяти (create): его создаёт импорт
+// в своей транзакции. newAccs — счета, уже заведённые для выписок файла.
+func (in Inbox) statementAccount(ctx context.Context, path string, st files.Statement, rule Rule, newAccs map[string]domain.BankAccount) (acc domain.BankAccount, create bool, err error) {
+	if st.Account == "" {
+		acc, err = in.fileAccount(ctx, path, rule)
+		return acc, false, err
+	}
+	if acc, ok := newAccs[strings.ToLower(st.Account)]; ok {
+		return acc, true, nil
+	}
+	acc, err = in.Accounts.FindByIBAN(ctx, st.Account)
+	if err == nil {
+		return acc, false, nil
+	}
+	if !errors.Is(err, repo.ErrAccountNotFound) {
+		return domain.BankAccount{}, false, err
+	}
+	accs, err := in.Accounts.List(ctx)
+	if err != nil {
+		return domain.BankAccount{}, false, err
+	}
+	for _, a := range accs {
+		if strings.EqualFold(a.Name, st.Account) {
+			return a, false, nil
+		}
+	}
+	if !rule.CreateAccounts {
+		return domain.BankAccount{}, false, fmt.Errorf("счёт %s из выписки не найден (create_accounts в правиле — создавать такие счета)", st.Account)
+	}
+	if acc, err = in.Acc.New(st.Account); err != nil {
+		return domain.BankAccount{}, false, err
+	}
+	newAccs[strings.ToLower(st.Account)] = acc
+	return acc, true, nil
+}
+
+// move переносит файл в dir; занятое имя получает метку времени.
+func move(path, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := filepath.Base(path)
+	dest := filepath.Join(dir, name)
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(name)
+		dest = filepath.Join(dir, strings.TrimSuffix(name, ext)+"."+time.Now().Format("20060102-150405")+ext)
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// report печатает итог и дописывает его в журнал папки:
+// время;файл;OK|FAIL;формат;счета;импортировано;пропущено;ошибка
+func (in Inbox) report(r Result) {
+	status, msg := "OK", ""
+	if r.Err != nil {
+		status, msg = "FAIL", r.Err.Error()
+	}
+	if r.OK() {
+		in.printf("✓ %s (%s): импортировано %d, пропущено дублей %d → %s\n",
+			r.File, r.Format, r.Imported, r.Skipped, strings.Join(r.Accounts, ", "))
+	} else {
+		in.printf("✗ %s: %s\n", r.File, msg)
+	}
+	line := strings.Join([]string{
+		time.Now().UTC().Format(time.RFC3339), r.File, status, r.Format, strings.Join(r.Accounts, ","),
+		fmt.Sprint(r.Imported), fmt.Sprint(r.Skipped), strings.ReplaceAll(msg, "\n", " "),
+	}, ";")
+	lf, err := os.OpenFile(filepath.Join(in.Config.Dir, LogName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		in.printf("! журнал: %v\n", err)
+		return
+	}
+	defer lf.Close()
+	fmt.Fprintln(lf, line)
+}
+
+func (in Inbox) printf(format string, a ...any) {
+	out := in.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, format, a...)
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 
+	"main/commands"
 	"main/di"
 	"main/menu"
+	"main/repo"
 )
 
 func main() {
@@ -21,5 +23,15 @@ func main() {
 		panic(err)
 	}
 
+	ctx = repo.WithUser(ctx, app.Deps.User.ID)
+
+	if len(os.Args) > 1 {
+		if err := commands.Run(ctx, &app.Deps, os.Args[1:]); err != nil {
+			fmt.Println("Ошибка:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	menu.Run(ctx, app.Menu, &app.Deps)
 }
@@ -2,14 +2,19 @@ package menu
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"main/backup"
 	"main/domain"
 	"main/facade"
 	"main/files"
-	"main/state"
+	"main/inbox"
+	"main/repo"
+	"main/service"
 
 	"github.com/shopspring/decimal"
 )
@@ -23,11 +28,7 @@ func actionAddIncome(ctx context.Context, d *Deps) error {
 	if err != nil {
 		return err
 	}
-	catID, err := chooseCategory(ctx, d.CatRepo, d.Factory, domain.CatIncome)
-	if err != nil {
-		return err
-	}
-	cat, err := d.CatRepo.Get(ctx, catID)
+	catName, err := chooseCategory(ctx, d.CatRepo, domain.CatIncome)
 	if err != nil {
 		return err
 	}
@@ -36,7 +37,7 @@ func actionAddIncome(ctx context.Context, d *Deps) error {
 		AccountID:    d.AccountID,
 		Amount:       amt,
 		When:         when,
-		CategoryName: cat.Name,
+		CategoryName: catName,
 		Description:  desc,
 	})
 	if err != nil {
@@ -54,11 +55,7 @@ func actionAddExpense(ctx context.Context, d *Deps) error {
 	if err != nil {
 		return err
 	}
-	catID, err := chooseCategory(ctx, d.CatRepo, d.Factory, domain.CatExpense)
-	if err != nil {
-		return err
-	}
-	cat, err := d.CatRepo.Get(ctx, catID)
+	catName, err := chooseCategory(ctx, d.CatRepo, domain.CatExpense)
 	if err != nil {
 		return err
 	}
@@ -67,7 +64,7 @@ func actionAddExpense(ctx context.Context, d *Deps) error {
 		AccountID:    d.AccountID,
 		Amount:       amt,
 		When:         when,
-		CategoryName: cat.Name,
+		CategoryName: catName,
 		Description:  desc,
 	})
 	if err != nil {
@@ -239,7 +236,7 @@ func actionCreateAccount(ctx context.Context, d *Deps) error {
 	fmt.Println("Счёт создан:", acc.Name, acc.ID)
 	if confirm("Сделать активным?") {
 		d.AccountID = acc.ID
-		_ = state.SaveAccountID(string(d.AccountID))
+		_ = d.Auth.SetActiveAccount(ctx, d.User.ID, d.AccountID)
 		fmt.Println("Активный счёт обновлён.")
 	}
 	return nil
@@ -251,7 +248,7 @@ func actionSelectAccount(ctx context.Context, d *Deps) error {
 		return err
 	}
 	d.AccountID = id
-	_ = state.SaveAccountID(string(d.AccountID))
+	_ = d.Auth.SetActiveAccount(ctx, d.User.ID, d.AccountID)
 	fmt.Println("Активный счёт обновлён:", id)
 	return nil
 }
@@ -272,11 +269,11 @@ func actionDeleteAccount(ctx context.Context, d *Deps) error {
 		accs, _ := d.AccRepo.List(ctx)
 		if len(accs) > 0 {
 			d.AccountID = accs[0].ID
-			_ = state.SaveAccountID(string(d.AccountID))
+			_ = d.Auth.SetActiveAccount(ctx, d.User.ID, d.AccountID)
 			fmt.Println("Новый активный счёт:", accs[0].Name)
 		} else {
 			d.AccountID = ""
-			_ = state.SaveAccountID("")
+			_ = d.Auth.SetActiveAccount(ctx, d.User.ID, "")
 			fmt.Println("Нет активного счёта.")
 		}
 	}
@@ -296,145 +293,601 @@ func actionRenameAccount(ctx context.Context, d *Deps) error {
 	return nil
 }
 
-func actionExportOpsCSV(ctx context.Context, d *Deps) error {
-	path := readLine("Путь к файлу (напр. ops.csv): ")
+func actionShareAccount(ctx context.Context, d *Deps) error {
+	if err := printSharedWith(ctx, d); err != nil {
+		return err
+	}
+	login := readLine("Логин пользователя: ")
+	if strings.TrimSpace(login) == "" {
+		fmt.Println("Логин пустой")
+		return nil
+	}
+	if err := d.Acc.Share(ctx, d.AccountID, login); err != nil {
+		return err
+	}
+	fmt.Println("Доступ открыт.")
+	return nil
+}
+
+func actionUnshareAccount(ctx context.Context, d *Deps) error {
+	if err := printSharedWith(ctx, d); err != nil {
+		return err
+	}
+	login := readLine("Логин пользователя: ")
+	if strings.TrimSpace(login) == "" {
+		fmt.Println("Логин пустой")
+		return nil
+	}
+	if err := d.Acc.Unshare(ctx, d.AccountID, login); err != nil {
+		return err
+	}
+	fmt.Println("Доступ закрыт.")
+	return nil
+}
+
+func printSharedWith(ctx context.Context, d *Deps) error {
+	users, err := d.Acc.SharedWith(ctx, d.AccountID)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		fmt.Println("Счёт никому не открыт.")
+		return nil
+	}
+	fmt.Println("Доступ есть у:")
+	for _, u := range users {
+		fmt.Println("-", u.Login)
+	}
+	return nil
+}
+
+// actionExportOps — выгрузка в формате по расширению файла (реестр files.Formats).
+func actionExportOps(ctx context.Context, d *Deps) error {
+	printFormats("Форматы выгрузки:", files.Format.CanExport)
+	path := readLine("Путь к файлу (формат — по расширению, пусто = ops.csv): ")
 	if path == "" {
 		path = "ops.csv"
 	}
-	from, to := time.Now().AddDate(0, 0, -30), time.Now()
-	if err := files.ExportOperationsCSV(ctx, d.OpsRepo, d.CatRepo, d.AccountID, from, to, path); err != nil {
+	f, err := files.ExportFormat(path)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Формат:", f.Title)
+	q, opts, err := chooseExport(ctx, d, f)
+	if err != nil {
+		return err
+	}
+	if err := files.Export(ctx, d.AccRepo, d.OpsRepo, d.CatRepo, f, q, opts, path); err != nil {
 		return err
 	}
 	fmt.Println("Экспортировано в", path)
 	return nil
 }
 
-func actionExportOpsJSON(ctx context.Context, d *Deps) error {
-	path := readLine("Путь к файлу (напр. ops.json): ")
+// chooseExport — период, счета и настройки, которые нужны формату f (Format.Asks).
+func chooseExport(ctx context.Context, d *Deps, f files.Format) (files.ExportQuery, files.ExportOptions, error) {
+	q, cols, err := chooseExportQuery(ctx, d, f.Asks)
+	if err != nil {
+		return q, files.ExportOptions{}, err
+	}
+	opts := files.ExportOptions{Columns: cols, Names: d.BeancountNames}
+	if f.Asks&files.AskDateOrder != 0 {
+		if opts.DateOrder, err = chooseDateOrder(false); err != nil {
+			return q, opts, err
+		}
+	}
+	if f.Asks&files.AskTransfers != 0 {
+		opts.Transfers = confirm(fmt.Sprintf("Выгружать категории «%s…» как переводы между счетами Assets?", files.TransferPrefix))
+	}
+	if f.Asks&files.AskCurrency != 0 {
+		opts.Currency = strings.ToUpper(strings.TrimSpace(readLine("Валюта (пусто = RUB): ")))
+	}
+	opts.Categories, err = ExportCategories(ctx, d, f, q)
+	return q, opts, err
+}
+
+// printFormats — форматы реестра, подходящие под can, с расширениями.
+func printFormats(title string, can func(files.Format) bool) {
+	fmt.Println(title)
+	for _, f := range files.Formats() {
+		if can(f) {
+			fmt.Printf("- %-22s %s\n", f.Title, strings.Join(f.Extensions, " "))
+		}
+	}
+}
+
+func actionReportHTML(ctx context.Context, d *Deps) error {
+	from, to, err := choosePeriod()
+	if err != nil {
+		return err
+	}
+	path := readLine(fmt.Sprintf("Путь к файлу (пусто = report-%s.html): ", from.Format("2006-01")))
+	if path == "" {
+		path = fmt.Sprintf("report-%s.html", from.Format("2006-01"))
+	}
+	sum, err := d.Ana.Summary(ctx, d.AccountID, from, to)
+	if err != nil {
+		return err
+	}
+	br, err := d.Ana.BreakdownByCategory(ctx, d.AccountID, from, to)
+	if err != nil {
+		return err
+	}
+	rep := files.HTMLReport{Income: sum.Income, Expense: sum.Expense, Net: sum.Net, Categories: categoryTotals(br)}
+	if err := files.ExportReportHTML(ctx, d.AccRepo, d.OpsRepo, d.CatRepo, d.AccountID, from, to, path, rep); err != nil {
+		return err
+	}
+	fmt.Println("Отчёт сохранён в", path)
+	return nil
+}
+
+func actionStatementPDF(ctx context.Context, d *Deps) error {
+	from, to, err := choosePeriod()
+	if err != nil {
+		return err
+	}
+	path := readLine(fmt.Sprintf("Путь к файлу (пусто = statement-%s.pdf): ", from.Format("2006-01")))
 	if path == "" {
-		path = "ops.json"
+		path = fmt.Sprintf("statement-%s.pdf", from.Format("2006-01"))
 	}
-	from, to := time.Now().AddDate(0, 0, -30), time.Now()
-	if err := files.ExportOperationsJSON(ctx, d.OpsRepo, d.CatRepo, d.AccountID, from, to, path); err != nil {
+	holder := readLine("Владелец счёта для шапки (пусто = не указывать): ")
+	st := files.PDFStatement{Holder: strings.TrimSpace(holder)}
+	if err := files.ExportStatementPDF(ctx, d.AccRepo, d.OpsRepo, d.CatRepo, d.AccountID, from, to, path, st); err != nil {
 		return err
 	}
-	fmt.Println("Экспортировано в", path)
+	fmt.Println("Выписка сохранена в", path)
 	return nil
 }
 
-func actionExportOpsYAML(ctx context.Context, d *Deps) error {
-	path := readLine("Путь к файлу (напр. ops.yaml): ")
+// actionExportDataset — все счета, категории и операции с их ID (files.Dataset).
+func actionExportDataset(ctx context.Context, d *Deps) error {
+	def := "dataset-" + time.Now().Format("20060102") + ".json"
+	path := readLine(fmt.Sprintf("Путь к файлу (пусто = %s): ", def))
 	if path == "" {
-		path = "ops.yaml"
+		path = def
 	}
-	from, to := time.Now().AddDate(0, 0, -30), time.Now()
-	if err := files.ExportOperationsYAML(ctx, d.OpsRepo, d.CatRepo, d.AccountID, from, to, path); err != nil {
+	if err := files.ExportDataset(ctx, d.AccRepo, d.OpsRepo, d.CatRepo, path); err != nil {
 		return err
 	}
-	fmt.Println("Экспортировано в", path)
+	fmt.Println("Данные выгружены в", path)
 	return nil
 }
 
-func actionImportOpsCSV(ctx context.Context, d *Deps) error {
-	path := readLine("Путь к CSV для импорта: ")
+func actionImportDataset(ctx context.Context, d *Deps) error {
+	path := readLine("Путь к файлу выгрузки: ")
 	if path == "" {
 		fmt.Println("Файл не указан")
 		return nil
 	}
-	rows, err := files.ImportOperationsCSV(path)
+	return importDataset(ctx, d, path)
+}
+
+// importDataset: проверка файла → предпросмотр (транзакция откатывается) → подтверждение → импорт.
+func importDataset(ctx context.Context, d *Deps, path string) error {
+	ds, err := files.ReadDataset(path)
 	if err != nil {
 		return err
 	}
-	if len(rows) == 0 {
-		fmt.Println("Нет записей для импорта")
+	fmt.Printf("В файле: счетов %d, категорий %d, операций %d\n", len(ds.Accounts), len(ds.Categories), len(ds.Operations))
+	rep, err := d.Dataset.Preview(ctx, ds)
+	if err != nil {
+		return err
+	}
+	PrintDatasetReport(rep)
+	if rep.Accounts.Created+rep.Accounts.Updated+rep.Categories.Created+rep.Categories.Updated+
+		rep.Operations.Created+rep.Operations.Updated == 0 {
+		fmt.Println("Все данные файла уже есть — импортировать нечего.")
 		return nil
 	}
-	for _, r := range rows {
-		in := facade.AddOpInput{
-			AccountID:    d.AccountID,
-			Amount:       r.Amount,
-			When:         r.Date,
-			CategoryName: r.Category,
-			Description:  r.Description,
-		}
-		if r.Type >= 0 {
-			_, err = d.Op.AddIncome(ctx, in)
-		} else {
-			_, err = d.Op.AddExpense(ctx, in)
-		}
-		if err != nil {
-			return err
-		}
+	if !confirm("Импортировать?") {
+		return nil
+	}
+	if _, err := d.Dataset.Import(ctx, ds); err != nil {
+		return err
+	}
+	fmt.Println("Импорт завершён.")
+	return nil
+}
+
+func PrintDatasetReport(rep facade.DatasetReport) {
+	fmt.Println("               новых  изменено  без изменений")
+	for _, r := range []struct {
+		name string
+		c    facade.DatasetCounts
+	}{{"Счета", rep.Accounts}, {"Категории", rep.Categories}, {"Операции", rep.Operations}} {
+		fmt.Printf("%-12s %8d %9d %14d\n", r.name, r.c.Created, r.c.Updated, r.c.Unchanged)
+	}
+	if rep.Merged > 0 {
+		fmt.Printf("Категорий слито с существующими (тот же тип и имя): %d\n", rep.Merged)
+	}
+	for _, name := range rep.NotRenamed {
+		fmt.Printf("Счёт «%s» не переименован: менять имя может только владелец\n", name)
+	}
+	for _, b := range rep.Mismatched {
+		fmt.Printf("Баланс «%s» после импорта %s, в файле %s — в БД есть операции, которых нет в файле\n",
+			b.Name, b.Result.StringFixed(2), b.File.StringFixed(2))
 	}
-	return printSummary(ctx, *d, fmt.Sprintf("Импортировано операций: %d.", len(rows)))
 }
 
-func actionImportOpsJSON(ctx context.Context, d *Deps) error {
-	path := readLine("Путь к JSON для импорта: ")
+// actionImportOps — импорт файла; формат определяется по расширению или содержимому.
+func actionImportOps(ctx context.Context, d *Deps) error {
+	printFormats("Форматы импорта:", files.Format.CanImport)
+	path := readLine("Путь к файлу для импорта: ")
 	if path == "" {
 		fmt.Println("Файл не указан")
 		return nil
 	}
-	rows, err := files.ImportOperationsJSON(path)
+	if files.IsDataset(path) {
+		fmt.Println("Формат: полная выгрузка данных (JSON с ID)")
+		return importDataset(ctx, d, path)
+	}
+	f, err := files.DetectFormat(path)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Формат:", f.Title)
+	opts, err := chooseImportOptions(d, f)
+	if err != nil {
+		return err
+	}
+	return importOps(ctx, d, path, f, opts)
+}
+
+// chooseImportOptions — настройки разбора, которые нужны формату f (Format.Asks).
+func chooseImportOptions(d *Deps, f files.Format) (files.Options, error) {
+	var opts files.Options
+	if f.Asks&files.AskCSVProfile != 0 {
+		profile, err := chooseCSVProfile(d.CSVProfiles)
+		if err != nil {
+			return opts, err
+		}
+		opts.CSVProfile = &profile
+	}
+	if f.Asks&files.AskDateOrder != 0 {
+		order, err := chooseDateOrder(true)
+		if err != nil {
+			return opts, err
+		}
+		opts.DateOrder = order
+	}
+	if f.Asks&files.AskCategory != 0 {
+		opts.DefaultCategory = readLine(fmt.Sprintf("Категория для операций без категории (пусто = %s): ", files.NoCategory))
+	}
+	return opts, nil
+}
+
+// importOps: разбор файла → предпросмотр → подтверждение → импорт одной транзакцией.
+// Файл с несколькими выписками импортируется по выпискам, каждая — в свой счёт:
+// сначала предпросмотр всех, затем одно подтверждение и одна транзакция на все.
+// Строки не держатся в памяти: первый проход только проверяет файл, предпросмотр
+// и импорт читают его заново.
+func importOps(ctx context.Context, d *Deps, path string, f files.Format, opts files.Options) error {
+	opts.Strict = confirm("Строгий режим (остановиться на первой ошибке)?")
+	im := f.Open(opts)
+	perStatement := map[int]int{}
+	parsed, err := im.Each(path, func(r files.Row) error {
+		perStatement[r.Statement]++
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	if len(rows) == 0 {
+	if err := reportIssues(path, parsed); err != nil {
+		return err
+	}
+	if parsed.Accepted == 0 {
 		fmt.Println("Нет записей для импорта")
 		return nil
 	}
-	for _, r := range rows {
-		in := facade.AddOpInput{
-			AccountID:    d.AccountID,
-			Amount:       r.Amount,
-			When:         r.Date,
-			CategoryName: r.Category,
-			Description:  r.Description,
+
+	rows := im.Rows(path)
+	var plans []importPlan
+	if len(parsed.Statements) == 0 {
+		p, ok, err := previewRows(ctx, d, d.AccountID, nil, rows, path, nil)
+		if err != nil || !ok {
+			return err
+		}
+		plans = append(plans, p)
+	}
+	newAccs := map[string]*domain.BankAccount{}
+	for i, st := range parsed.Statements {
+		if len(parsed.Statements) > 1 {
+			fmt.Printf("=== Выписка %d из %d: %s ===\n", i+1, len(parsed.Statements), statementName(st))
 		}
-		if r.Type >= 0 {
-			_, err = d.Op.AddIncome(ctx, in)
-		} else {
-			_, err = d.Op.AddExpense(ctx, in)
+		if perStatement[i] == 0 {
+			fmt.Println("Нет записей для импорта")
+			continue
 		}
+		accID, create, err := statementAccount(ctx, d, st, newAccs)
 		if err != nil {
 			return err
 		}
+		p, ok, err := previewRows(ctx, d, accID, create, files.StatementRows(rows, i), path, &st)
+		if err != nil {
+			return err
+		}
+		if ok {
+			plans = append(plans, p)
+		}
 	}
-	return printSummary(ctx, *d, fmt.Sprintf("Импортировано операций: %d.", len(rows)))
+	return applyPlans(ctx, d, plans)
 }
 
-func actionImportOpsYAML(ctx context.Context, d *Deps) error {
-	path := readLine("Путь к YAML для импорта: ")
-	if path == "" {
-		fmt.Println("Файл не указан")
-		return nil
+// importPlan — выписка после предпросмотра: в какой счёт и с какими настройками.
+type importPlan struct {
+	target  facade.ImportTarget
+	st      *files.Statement
+	preview facade.ImportPreview
+}
+
+// previewRows показывает, что изменит импорт строк в счёт accID (create — счёт
+// ещё не создан). ok=false — импортировать нечего; баланс, ушедший в минус, —
+// ошибка: тогда файл не импортируется целиком.
+func previewRows(ctx context.Context, d *Deps, accID domain.AccountID, create *domain.BankAccount, rows files.RowSeq, path string, st *files.Statement) (importPlan, bool, error) {
+	opts := facade.ImportOptions{Source: filepath.Base(path)}
+	preview := func() (facade.ImportPreview, error) {
+		if create != nil {
+			return d.Import.PreviewNew(ctx, *create, rows, opts)
+		}
+		return d.Import.Preview(ctx, accID, rows, opts)
 	}
-	rows, err := files.ImportOperationsYAML(path)
+	p, err := preview()
 	if err != nil {
-		return err
+		return importPlan{}, false, err
+	}
+	printDuplicates("Уже есть в счёте (будут пропущены):", p.Skipped)
+	if len(p.Flagged) > 0 {
+		printDuplicates("Похожи на существующие операции (дата отличается на день):", p.Flagged)
+		if confirm("Импортировать похожие строки тоже?") {
+			opts.KeepFuzzy = true
+			if p, err = preview(); err != nil {
+				return importPlan{}, false, err
+			}
+		}
 	}
-	if len(rows) == 0 {
-		fmt.Println("Нет записей для импорта")
+	if p.Rows == 0 {
+		fmt.Println("Новых операций нет — импортировать нечего")
+		return importPlan{}, false, nil
+	}
+	printImportPreview(p)
+	if st != nil {
+		if err := checkStatement(*st, rows, p); err != nil {
+			return importPlan{}, false, err
+		}
+	}
+	if p.FirstShortfall > 0 {
+		return importPlan{}, false, fmt.Errorf("на строке %d баланс уйдёт в минус — импорт не пройдёт. Измените порядок строк или пополните счёт", p.FirstShortfall)
+	}
+	plan := importPlan{target: facade.ImportTarget{Account: accID, Rows: rows, Options: opts, Create: create}, preview: p}
+	if st != nil {
+		s := *st
+		plan.st = &s
+		if create != nil {
+			plan.target.IBAN = st.Account
+		}
+	}
+	return plan, true, nil
+}
+
+// applyPlans после одного подтверждения импортирует все выписки одной транзакцией.
+func applyPlans(ctx context.Context, d *Deps, plans []importPlan) error {
+	if len(plans) == 0 {
+		return nil
+	}
+	q := "Импортировать?"
+	if len(plans) > 1 {
+		q = fmt.Sprintf("Импортировать все выписки (%d)?", len(plans))
+	}
+	if !confirm(q) {
+		fmt.Println("Импорт отменён")
 		return nil
 	}
-	for _, r := range rows {
-		in := facade.AddOpInput{
-			AccountID:    d.AccountID,
-			Amount:       r.Amount,
-			When:         r.Date,
-			CategoryName: r.Category,
-			Description:  r.Description,
+
+	targets := make([]facade.ImportTarget, len(plans))
+	for i, p := range plans {
+		targets[i] = p.target
+	}
+	results, err := d.Import.ApplyAll(ctx, targets)
+	if err != nil {
+		return fmt.Errorf("импорт отменён, изменения не сохранены: %w", err)
+	}
+
+	created := map[domain.AccountID]bool{}
+	for i, res := range results {
+		p := plans[i]
+		if c := p.target.Create; c != nil && !created[c.ID] {
+			created[c.ID] = true
+			fmt.Printf("Создан счёт «%s»\n", c.Name)
 		}
-		if r.Type >= 0 {
-			_, err = d.Op.AddIncome(ctx, in)
-		} else {
-			_, err = d.Op.AddExpense(ctx, in)
+		skipped := len(res.Skipped)
+		if !p.target.Options.KeepFuzzy {
+			skipped += len(res.Flagged)
 		}
-		if err != nil {
+		msg := fmt.Sprintf("Импортировано операций: %d, пропущено дублей: %d (пакет %s).", res.Imported, skipped, res.BatchID)
+		if p.target.Account != d.AccountID {
+			fmt.Println(msg)
+		} else if err := printSummary(ctx, *d, msg); err != nil {
 			return err
 		}
+		if p.st != nil {
+			if err := reconcileStatement(ctx, d, p.target.Account, *p.st); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func statementName(st files.Statement) string {
+	name := st.Account
+	if name == "" {
+		name = "счёт не указан"
+	}
+	if st.Currency != "" {
+		name += " " + st.Currency
+	}
+	return name
+}
+
+// statementAccount находит счёт выписки по номеру (IBAN) или имени; для
+// незнакомого предлагается создать счёт с этим именем или привязать номер к
+// выбранному счёту. Новый счёт (create) только заводится в памяти — его создаёт
+// импорт после подтверждения; newAccs — счета, уже заведённые для выписок файла.
+func statementAccount(ctx context.Context, d *Deps, st files.Statement, newAccs map[string]*domain.BankAccount) (id domain.AccountID, create *domain.BankAccount, err error) {
+	if st.Account == "" {
+		return d.AccountID, nil, nil
+	}
+	if acc, ok := newAccs[strings.ToLower(st.Account)]; ok {
+		fmt.Printf("Выписка по %s → новый счёт «%s»\n", st.Account, acc.Name)
+		return acc.ID, acc, nil
+	}
+	acc, err := d.AccRepo.FindByIBAN(ctx, st.Account)
+	if err == nil {
+		fmt.Printf("Выписка по %s → счёт «%s»\n", st.Account, acc.Name)
+		return acc.ID, nil, nil
+	}
+	if !errors.Is(err, repo.ErrAccountNotFound) {
+		return "", nil, err
+	}
+	// журналы ledger называют счета по имени, а не по номеру
+	accs, err := d.AccRepo.List(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, a := range accs {
+		if strings.EqualFold(a.Name, st.Account) {
+			fmt.Printf("Выписка по %s → счёт «%s»\n", st.Account, a.Name)
+			return a.ID, nil, nil
+		}
+	}
+	fmt.Printf("Счёт %s пока не привязан.\n", statementName(st))
+	// выгрузки других приложений учёта (Дзен-мани, CoinKeeper) переезжают вместе со счетами
+	if confirm(fmt.Sprintf("Создать новый счёт «%s» (при импорте)?", st.Account)) {
+		acc, err := d.Acc.New(st.Account)
+		if err != nil {
+			return "", nil, err
+		}
+		newAccs[strings.ToLower(st.Account)] = &acc
+		return acc.ID, &acc, nil
+	}
+	fmt.Println("В какой счёт импортировать?")
+	id, err = chooseAccount(ctx, d.AccRepo)
+	if err != nil {
+		return "", nil, err
+	}
+	if confirm(fmt.Sprintf("Запомнить: %s → этот счёт?", st.Account)) {
+		if err := d.AccRepo.SetIBAN(ctx, id, st.Account); errors.Is(err, repo.ErrAccountNotFound) {
+			fmt.Println("Привязать номер может только владелец счёта — импорт продолжится без привязки")
+		} else if err != nil {
+			return "", nil, err
+		}
+	}
+	return id, nil, nil
+}
+
+// checkStatement: сходится ли выписка сама с собой и с балансом счёта до импорта.
+func checkStatement(st files.Statement, rows files.RowSeq, p facade.ImportPreview) error {
+	if st.Opening != nil && !st.Opening.Amount.Equal(p.BalanceBefore) {
+		fmt.Printf("! Входящий остаток выписки на %s — %s, а на счёте сейчас %s\n",
+			st.Opening.Date.Format("2006-01-02"), st.Opening.Amount.StringFixed(2), p.BalanceBefore.StringFixed(2))
+	}
+	diff, ok, err := st.Check(rows)
+	if err != nil {
+		return err
+	}
+	if ok && !diff.IsZero() {
+		fmt.Printf("! Входящий остаток %s и записи выписки не дают исходящий %s: расхождение %s\n",
+			st.Opening.Amount.StringFixed(2), st.Closing.Amount.StringFixed(2), signed(diff))
+	}
+	return nil
+}
+
+// reconcileStatement сверяет баланс счёта с остатком выписки (если он в файле есть).
+func reconcileStatement(ctx context.Context, d *Deps, accID domain.AccountID, st files.Statement) error {
+	rec, ok, err := d.Import.Reconcile(ctx, accID, st)
+	if err != nil || !ok {
+		return err
+	}
+	fmt.Printf("Сверка с выпиской на %s: в выписке %s, на счёте %s",
+		rec.Statement.Date.Format("2006-01-02"), rec.Statement.Amount.StringFixed(2), rec.Account.StringFixed(2))
+	if rec.OK() {
+		fmt.Println(" — совпадает")
+	} else {
+		fmt.Printf(" — расхождение %s\n", signed(rec.Diff()))
+	}
+	return nil
+}
+
+func printDuplicates(title string, dups []facade.Duplicate) {
+	if len(dups) == 0 {
+		return
+	}
+	fmt.Println(title)
+	for _, dp := range dups {
+		typ := "доход"
+		if dp.Row.Type < 0 {
+			typ = "расход"
+		}
+		fmt.Printf("- строка %d: %s | %-6s | %8s | %s (есть: %s)\n", dp.Row.Line,
+			dp.Row.Date.Format("2006-01-02"), typ, dp.Row.Amount.StringFixed(2), dp.Row.Description,
+			dp.Match.Date.Format("2006-01-02"))
+	}
+}
+
+// maxIssuesShown — сколько ошибок разбора печатать; полный список — в файле отклонённых строк.
+const maxIssuesShown = 20
+
+func reportIssues(path string, p files.Parsed) error {
+	fmt.Printf("Записей в файле: %d | принято: %d | отклонено: %d\n", p.Records, p.Accepted, p.Rejected())
+	if len(p.Issues) == 0 {
+		return nil
+	}
+	for i, is := range p.Issues {
+		if i == maxIssuesShown {
+			fmt.Printf("... и ещё %d\n", len(p.Issues)-maxIssuesShown)
+			break
+		}
+		fmt.Println("! ", is)
+	}
+	if !confirm("Сохранить отклонённые строки в файл?") {
+		return nil
+	}
+	out := readLine(fmt.Sprintf("Путь (пусто = %s): ", files.RejectedPath(path)))
+	if out == "" {
+		out = files.RejectedPath(path)
+	}
+	if err := files.WriteRejected(out, p.Issues); err != nil {
+		return err
+	}
+	fmt.Println("Отклонённые строки сохранены в", out)
+	return nil
+}
+
+func printImportPreview(p facade.ImportPreview) {
+	fmt.Println("=== Предпросмотр импорта ===")
+	fmt.Printf("Строк: %d (доходов: %d на %s, расходов: %d на %s)\n",
+		p.Rows, p.Incomes, p.IncomeTotal.StringFixed(2), p.Expenses, p.ExpenseTotal.StringFixed(2))
+	fmt.Printf("Баланс: %s → %s (%s)\n",
+		p.BalanceBefore.StringFixed(2), p.BalanceAfter.StringFixed(2), signed(p.Net()))
+	if len(p.NewCategories) == 0 {
+		fmt.Println("Новых категорий нет")
+		return
+	}
+	fmt.Println("Будут созданы категории:")
+	for _, c := range p.NewCategories {
+		typ := "доход"
+		if c.Type == domain.CatExpense {
+			typ = "расход"
+		}
+		fmt.Printf("- %s (%s)\n", c.Name, typ)
 	}
-	return printSummary(ctx, *d, fmt.Sprintf("Импортировано операций: %d.", len(rows)))
+}
+
+func signed(v decimal.Decimal) string {
+	if v.IsNegative() {
+		return v.StringFixed(2)
+	}
+	return "+" + v.StringFixed(2)
 }
 
 func actionEditOp30d(ctx context.Context, d *Deps) error {
@@ -470,31 +923,10 @@ func actionEditOp30d(ctx context.Context, d *Deps) error {
 		newDatePtr = &v
 	}
 
-	var newCatNamePtr *string
-	if newType != old.Type {
-		newCatID, err := chooseCategoryOptional(ctx, d.CatRepo, d.Factory,
-			domain.CategoryType(newType), old.Category, false)
-		if err != nil {
-			return err
-		}
-		c, err := d.CatRepo.Get(ctx, newCatID)
-		if err != nil {
-			return err
-		}
-		n := c.Name
-		newCatNamePtr = &n
-	} else {
-		newCatID, err := chooseCategoryOptional(ctx, d.CatRepo, d.Factory,
-			domain.CategoryType(newType), old.Category, true)
-		if err != nil {
-			return err
-		}
-		c, err := d.CatRepo.Get(ctx, newCatID)
-		if err != nil {
-			return err
-		}
-		n := c.Name
-		newCatNamePtr = &n
+	newCatName, err := chooseCategoryOptional(ctx, d.CatRepo,
+		domain.CategoryType(newType), old.Category, newType == old.Type)
+	if err != nil {
+		return err
 	}
 
 	var forced *domain.CategoryType
@@ -513,7 +945,7 @@ func actionEditOp30d(ctx context.Context, d *Deps) error {
 		OperationID: old.ID,
 		NewAmount:   newAmtPtr,
 		NewWhen:     newDatePtr,
-		NewCategory: newCatNamePtr,
+		NewCategory: &newCatName,
 		NewDesc:     strPtrOrNil(readLine(fmt.Sprintf("Описание (пусто = оставить: %q): ", old.Description))),
 		ForcedType:  forced,
 	})
@@ -539,3 +971,286 @@ func actionDeleteOp30d(ctx context.Context, d *Deps) error {
 	}
 	return printSummary(ctx, *d, "Операция удалена.")
 }
+
+// actionProcessInbox — один проход по папке входящих (inbox.Inbox).
+func actionProcessInbox(ctx context.Context, d *Deps) error {
+	fmt.Println("Папка входящих:", d.Inbox.Config.Dir)
+	res, err := d.Inbox.Process(ctx)
+	if err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		fmt.Println("Новых файлов нет")
+		return nil
+	}
+	PrintInboxSummary(res)
+	return nil
+}
+
+func PrintInboxSummary(res []inbox.Result) {
+	ok := 0
+	for _, r := range res {
+		if r.OK() {
+			ok++
+		}
+	}
+	fmt.Printf("Файлов: %d, импортировано: %d, с ошибками: %d (подробности — в %s)\n",
+		len(res), ok, len(res)-ok, inbox.LogName)
+}
+
+func actionBackup(ctx context.Context, d *Deps) error {
+	def := "backup-" + time.Now().Format("20060102-150405") + ".zip"
+	path := readLine(fmt.Sprintf("Путь к архиву (пусто = %s): ", def))
+	if path == "" {
+		path = def
+	}
+	m, err := d.Backup.Create(ctx, path)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Резервная копия создана:", path)
+	for _, e := range m.Entries {
+		fmt.Printf("- %-12s %6d записей  sha256=%s\n", e.Table, e.Rows, e.SHA256[:12])
+	}
+	return nil
+}
+
+func actionRestore(ctx context.Context, d *Deps) error {
+	path := readLine("Путь к архиву: ")
+	if path == "" {
+		fmt.Println("Файл не указан")
+		return nil
+	}
+	fmt.Println("1) Заменить мои данные (точная копия архива)")
+	fmt.Println("2) Слить с текущей БД")
+	n, err := readInt("Режим: ")
+	if err != nil {
+		return err
+	}
+	var mode backup.Mode
+	switch n {
+	case 1:
+		mode = backup.ModeReplace
+		if !confirm("Ваши счета, категории и операции будут удалены и загружены из архива. Продолжить?") {
+			return nil
+		}
+	case 2:
+		mode = backup.ModeMerge
+	default:
+		return fmt.Errorf("неверный выбор")
+	}
+
+	rep, err := d.Backup.Restore(ctx, path, mode)
+	if err != nil {
+		return err
+	}
+	PrintRestoreReport(rep)
+	return ensureAccountAfterRestore(ctx, d)
+}
+
+func PrintRestoreReport(rep backup.Report) {
+	fmt.Printf("Архив от %s (версия %d)\n", rep.Manifest.CreatedAt.Local().Format("2006-01-02 15:04"), rep.Manifest.Version)
+	for _, t := range []string{"accounts", "account_shares", "categories", "import_batches", "operations"} {
+		fmt.Printf("- %-14s добавлено: %d, пропущено: %d\n", t, rep.Inserted[t], rep.Skipped[t])
+	}
+	if len(rep.Conflicts) == 0 {
+		fmt.Println("Конфликтов нет.")
+		return
+	}
+	fmt.Printf("Конфликты (%d):\n", len(rep.Conflicts))
+	for _, c := range rep.Conflicts {
+		fmt.Printf("  [%s] %s: %s\n", c.Table, c.ID, c.Reason)
+	}
+}
+
+func ensureAccountAfterRestore(ctx context.Context, d *Deps) error {
+	if _, err := d.AccRepo.Get(ctx, d.AccountID); err == nil {
+		return nil
+	}
+	accs, err := d.AccRepo.List(ctx)
+	if err != nil {
+		return err
+	}
+	if len(accs) == 0 {
+		d.AccountID = ""
+		_ = d.Auth.SetActiveAccount(ctx, d.User.ID, "")
+		fmt.Println("Нет активного счёта.")
+		return nil
+	}
+	d.AccountID = accs[0].ID
+	_ = d.Auth.SetActiveAccount(ctx, d.User.ID, d.AccountID)
+	fmt.Println("Новый активный счёт:", accs[0].Name)
+	return nil
+}
+
+func actionDoctor(ctx context.Context, d *Deps) error {
+	rep, err := d.Doctor.Check(ctx)
+	if err != nil {
+		return err
+	}
+	PrintDoctorReport(rep)
+	if rep.Problems() == 0 && len(rep.Orphans) == 0 {
+		return nil
+	}
+
+	fmt.Println("1) Показать исправления без записи (dry run)")
+	fmt.Println("2) Исправить")
+	fmt.Println("0) Ничего не делать")
+	n, err := readInt("Выбор: ")
+	if err != nil || n == 0 {
+		return nil
+	}
+	opts := service.RepairOptions{DryRun: n != 2}
+	if len(rep.Orphans) > 0 {
+		opts.DropOrphans = confirm("Удалить категории без операций?")
+	}
+	_, res, err := d.Doctor.Repair(ctx, opts)
+	if err != nil {
+		return err
+	}
+	PrintRepairResult(res)
+	return nil
+}
+
+func PrintDoctorReport(rep service.DoctorReport) {
+	fmt.Printf("=== Проверка: счетов %d ===\n", rep.Accounts)
+	if len(rep.Balances) == 0 {
+		fmt.Println("Балансы: OK")
+	}
+	for _, b := range rep.Balances {
+		fmt.Printf("Баланс счёта %q: записан %s, по операциям %s\n",
+			b.Name, b.Stored.StringFixed(2), b.Computed.StringFixed(2))
+	}
+	if len(rep.TypeMismatches) == 0 {
+		fmt.Println("Типы операций и категорий: OK")
+	}
+	for _, m := range rep.TypeMismatches {
+		fmt.Printf("Операция %s (%s, %s, тип %d) в категории %q типа %d\n",
+			m.OperationID, m.Date.Format("2006-01-02"), m.Amount.StringFixed(2), int(m.OpType), m.CategoryName, int(m.CategoryType))
+	}
+	if len(rep.Duplicates) == 0 {
+		fmt.Println("Дубликаты категорий: нет")
+	}
+	for _, g := range rep.Duplicates {
+		names := make([]string, 0, len(g.Dups))
+		for _, c := range g.Dups {
+			names = append(names, fmt.Sprintf("%q", c.Name))
+		}
+		fmt.Printf("Дубликаты категории %q: %s\n", g.Canonical.Name, strings.Join(names, ", "))
+	}
+	if len(rep.Orphans) > 0 {
+		fmt.Printf("Категории без операций (%d):\n", len(rep.Orphans))
+		for _, c := range rep.Orphans {
+			fmt.Printf("  - %s\n", c.Name)
+		}
+	}
+	fmt.Printf("Проблем: %d\n", rep.Problems())
+}
+
+func PrintRepairResult(res service.RepairResult) {
+	if res.DryRun {
+		fmt.Println("=== Dry run: изменения не сохранены ===")
+	} else {
+		fmt.Println("=== Исправлено ===")
+	}
+	if len(res.Actions) == 0 {
+		fmt.Println("Нечего исправлять.")
+	}
+	for _, a := range res.Actions {
+		fmt.Println("-", a)
+	}
+	for _, u := range res.Unfixable {
+		fmt.Println("! ", u)
+	}
+}
+
+func actionCacheStats(_ context.Context, d *Deps) error {
+	st := d.CatRepo.Stats()
+	total := st.Hits + st.Misses
+	ratio := 0.0
+	if total > 0 {
+		ratio = float64(st.Hits) * 100 / float64(total)
+	}
+	listen := "нет (только TTL)"
+	if st.Listening {
+		listen = "да"
+	}
+	fmt.Println("=== Кэш категорий ===")
+	fmt.Printf("Попаданий: %d | Промахов: %d | Hit rate: %.1f%%\n", st.Hits, st.Misses, ratio)
+	fmt.Printf("Сбросов: %d (из них по NOTIFY: %d)\n", st.Invalidations, st.Notifications)
+	fmt.Printf("LISTEN активен: %s | ошибок соединения: %d\n", listen, st.ListenErrors)
+	fmt.Printf("TTL: %s | записей: %d\n", st.TTL, st.Entries)
+	return nil
+}
+
+// Поиск идёт по уже расшифрованным описаниям: по шифртексту в SQL искать нельзя.
+func actionSearchOps(ctx context.Context, d *Deps) error {
+	q := strings.ToLower(strings.TrimSpace(readLine("Текст для поиска: ")))
+	if q == "" {
+		return fmt.Errorf("пустой запрос")
+	}
+	from, err := readDate("Дата ОТ")
+	if err != nil {
+		return err
+	}
+	to, err := readDate("Дата ДО")
+	if err != nil {
+		return err
+	}
+	list, err := d.OpsRepo.ListByAccount(ctx, d.AccountID, from, to)
+	if err != nil {
+		return err
+	}
+	found := 0
+	for _, o := range list {
+		if !strings.Contains(strings.ToLower(o.Description), q) {
+			continue
+		}
+		if found == 0 {
+			fmt.Println("=== Найденные операции ===")
+		}
+		found++
+		typ := "доход"
+		if o.IsExpense() {
+			typ = "расход"
+		}
+		fmt.Printf("%s | %-6s | %8s | %s\n",
+			o.Date.Format("2006-01-02"), typ, o.Amount.StringFixed(2), o.Description)
+	}
+	if found == 0 {
+		fmt.Println("Ничего не найдено")
+	}
+	return nil
+}
+
+func actionReencrypt(ctx context.Context, d *Deps) error {
+	if !d.Crypt.Enabled() {
+		fmt.Println("Ключ шифрования не задан (FINANCE_ENC_KEY_FILE или FINANCE_ENC_KEY)")
+		return nil
+	}
+	if err := d.Crypt.Authorize(ctx); errors.Is(err, service.ErrNotAdmin) {
+		fmt.Println("Перешифровка меняет описания всех пользователей и доступна только администраторам (FINANCE_ADMINS)")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !confirm("Перешифровать описания всех операций текущим ключом?") {
+		return nil
+	}
+	res, err := d.Crypt.Reencrypt(ctx, service.ReencryptOptions{})
+	if err != nil {
+		return err
+	}
+	PrintReencryptResult(res)
+	return nil
+}
+
+func PrintReencryptResult(res service.ReencryptResult) {
+	if res.DryRun {
+		fmt.Println("(пробный запуск — изменения не сохранены)")
+	}
+	if res.KeyID != "" {
+		fmt.Println("Текущий ключ:", res.KeyID)
+	}
+	fmt.Printf("Описаний: %d | изменено: %d | зашифровано текущим ключом: %d\n", res.Total, res.Changed, res.Encrypted)
+}
@@ -55,12 +55,24 @@ func Execute(ctx context.Context, key string, d *Deps) error {
 		if err := actionDeleteAccount(ctx, d); err != nil {
 			return err
 		}
-	case "export_ops_csv":
-		if err := actionExportOpsCSV(ctx, d); err != nil {
+	case "export_ops":
+		if err := actionExportOps(ctx, d); err != nil {
 			return err
 		}
-	case "import_ops_csv":
-		if err := actionImportOpsCSV(ctx, d); err != nil {
+	case "import_ops":
+		if err := actionImportOps(ctx, d); err != nil {
+			return err
+		}
+	case "export_dataset":
+		if err := actionExportDataset(ctx, d); err != nil {
+			return err
+		}
+	case "import_dataset":
+		if err := actionImportDataset(ctx, d); err != nil {
+			return err
+		}
+	case "process_inbox":
+		if err := actionProcessInbox(ctx, d); err != nil {
 			return err
 		}
 	case "edit_op_30d":
@@ -71,10 +83,6 @@ func Execute(ctx context.Context, key string, d *Deps) error {
 		if err := actionDeleteOp30d(ctx, d); err != nil {
 			return err
 		}
-	case "export_ops_json":
-		if err := actionExportOpsJSON(ctx, d); err != nil {
-			return err
-		}
 	case "summary_cat_30d":
 		if err := actionSummaryCat30d(ctx, d); err != nil {
 			return err
@@ -83,8 +91,12 @@ func Execute(ctx context.Context, key string, d *Deps) error {
 		if err := actionSummaryCatPeriod(ctx, d); err != nil {
 			return err
 		}
-	case "import_ops_json":
-		if err := actionImportOpsJSON(ctx, d); err != nil {
+	case "report_html":
+		if err := actionReportHTML(ctx, d); err != nil {
+			return err
+		}
+	case "statement_pdf":
+		if err := actionStatementPDF(ctx, d); err != nil {
 			return err
 		}
 	case "rename_account":
@@ -99,12 +111,36 @@ func Execute(ctx context.Context, key string, d *Deps) error {
 		if err := actionDeleteCategory(ctx, d); err != nil {
 			return err
 		}
-	case "export_ops_yaml":
-		if err := actionExportOpsYAML(ctx, d); err != nil {
+	case "share_account":
+		if err := actionShareAccount(ctx, d); err != nil {
+			return err
+		}
+	case "unshare_account":
+		if err := actionUnshareAccount(ctx, d); err != nil {
+			return err
+		}
+	case "backup":
+		if err := actionBackup(ctx, d); err != nil {
+			return err
+		}
+	case "restore":
+		if err := actionRestore(ctx, d); err != nil {
+			return err
+		}
+	case "doctor":
+		if err := actionDoctor(ctx, d); err != nil {
+			return err
+		}
+	case "search_ops":
+		if err := actionSearchOps(ctx, d); err != nil {
+			return err
+		}
+	case "reencrypt":
+		if err := actionReencrypt(ctx, d); err != nil {
 			return err
 		}
-	case "import_ops_yaml":
-		if err := actionImportOpsYAML(ctx, d); err != nil {
+	case "cache_stats":
+		if err := actionCacheStats(ctx, d); err != nil {
 			return err
 		}
 	case "exit":
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -12,6 +13,8 @@ import (
 	"github.com/shopspring/decimal"
 
 	"main/domain"
+	"main/facade"
+	"main/files"
 	"main/repo"
 )
 
@@ -98,7 +101,7 @@ func chooseAccount(ctx context.Context, ar *repo.PgAccountRepo) (domain.AccountI
 	return accs[n-1].ID, nil
 }
 
-func chooseAnyCategory(ctx context.Context, cr *repo.PgCategoryRepo) (domain.CategoryID, error) {
+func chooseAnyCategory(ctx context.Context, cr *repo.CachedCategoryRepo) (domain.CategoryID, error) {
 	cats, err := cr.List(ctx)
 	if err != nil {
 		return "", err
@@ -124,7 +127,9 @@ func chooseAnyCategory(ctx context.Context, cr *repo.PgCategoryRepo) (domain.Cat
 	return cats[n-1].ID, nil
 }
 
-func chooseCategory(ctx context.Context, cr *repo.PgCategoryRepo, f domain.Factory, t domain.CategoryType) (domain.CategoryID, error) {
+// chooseCategory возвращает имя категории. Новая категория здесь не создаётся —
+// её создаст фасад в той же транзакции, что и операцию.
+func chooseCategory(ctx context.Context, cr *repo.CachedCategoryRepo, t domain.CategoryType) (string, error) {
 	cats, err := cr.List(ctx)
 	if err != nil {
 		return "", err
@@ -149,31 +154,27 @@ func chooseCategory(ctx context.Context, cr *repo.PgCategoryRepo, f domain.Facto
 		return "", err
 	}
 	if n == 0 {
-		name := readLine("Название новой категории: ")
-		c, err := f.NewCategory(name, t)
-		if err != nil {
-			return "", err
-		}
-		if err := cr.Create(ctx, c); err != nil {
-			return "", err
-		}
-		return c.ID, nil
+		return readNewCategoryName()
 	}
 	if n >= 1 && n <= len(opts) {
-		return opts[n-1].ID, nil
+		return opts[n-1].Name, nil
 	}
 	return "", fmt.Errorf("неверный выбор")
 }
 
-func chooseCategoryOptional(ctx context.Context, cr *repo.PgCategoryRepo, f domain.Factory,
+func chooseCategoryOptional(ctx context.Context, cr *repo.CachedCategoryRepo,
 	t domain.CategoryType, current domain.CategoryID, allowEmpty bool,
-) (domain.CategoryID, error) {
+) (string, error) {
 	cats, err := cr.List(ctx)
 	if err != nil {
 		return "", err
 	}
 	var opts []domain.Category
+	currentName := ""
 	for _, c := range cats {
+		if c.ID == current {
+			currentName = c.Name
+		}
 		if c.Type == t {
 			opts = append(opts, c)
 		}
@@ -201,25 +202,32 @@ func chooseCategoryOptional(ctx context.Context, cr *repo.PgCategoryRepo, f doma
 	}
 	if n == 0 {
 		if allowEmpty {
-			return current, nil
-		}
-		name := readLine("Название новой категории: ")
-		c, err := f.NewCategory(name, t)
-		if err != nil {
-			return "", err
-		}
-		if err := cr.Create(ctx, c); err != nil {
-			return "", err
+			if currentName == "" {
+				c, err := cr.Get(ctx, current)
+				if err != nil {
+					return "", err
+				}
+				currentName = c.Name
+			}
+			return currentName, nil
 		}
-		return c.ID, nil
+		return readNewCategoryName()
 	}
 	if n >= 1 && n <= len(opts) {
-		return opts[n-1].ID, nil
+		return opts[n-1].Name, nil
 	}
 	return "", fmt.Errorf("неверный выбор")
 }
 
-func chooseOperation(ctx context.Context, or *repo.PgOperationRepo, cr *repo.PgCategoryRepo, acc domain.AccountID, from, to time.Time) (domain.OperationID, error) {
+func readNewCategoryName() (string, error) {
+	name := strings.TrimSpace(readLine("Название новой категории: "))
+	if name == "" {
+		return "", domain.ErrEmptyCategoryName
+	}
+	return name, nil
+}
+
+func chooseOperation(ctx context.Context, or *repo.PgOperationRepo, cr *repo.CachedCategoryRepo, acc domain.AccountID, from, to time.Time) (domain.OperationID, error) {
 	list, err := or.ListByAccount(ctx, acc, from, to)
 	if err != nil {
 		return "", err
@@ -390,9 +398,271 @@ func printCategoryBreakdownCombined(ctx context.Context, d *Deps, from, to time.
 	return nil
 }
 
+func chooseCSVProfile(ps files.CSVProfiles) (files.CSVProfile, error) {
+	if len(ps) <= 1 {
+		return files.DefaultCSVProfile, nil
+	}
+	fmt.Println("Профиль CSV:")
+	for i, p := range ps {
+		fmt.Printf("%d) %s\n", i+1, p.Name)
+	}
+	s := readLine("Номер (пусто = 1): ")
+	if s == "" {
+		return ps[0], nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > len(ps) {
+		return files.CSVProfile{}, fmt.Errorf("неверный номер профиля")
+	}
+	return ps[n-1], nil
+}
+
 func strPtrOrNil(s string) *string {
 	if strings.TrimSpace(s) == "" {
 		return nil
 	}
 	return &s
 }
+
+// chooseDateOrder — порядок дня и месяца для QIF; withAuto добавляет вариант "определить по файлу".
+func chooseDateOrder(withAuto bool) (string, error) {
+	fmt.Println("Порядок дня и месяца в датах:")
+	if withAuto {
+		fmt.Println("0) Определить по файлу")
+	}
+	fmt.Println("1) ММ/ДД/ГГГГ (Quicken, США)")
+	fmt.Println("2) ДД/ММ/ГГГГ")
+	n, err := readInt("Выбери №: ")
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case n == 0 && withAuto:
+		return files.QIFAuto, nil
+	case n == 1:
+		return files.QIFMonthFirst, nil
+	case n == 2:
+		return files.QIFDayFirst, nil
+	}
+	return "", fmt.Errorf("неверный выбор")
+}
+
+// periodPresets — готовые периоды в порядке меню; key — имя для флага -period.
+var periodPresets = []struct{ key, title string }{
+	{"month", "Текущий месяц"},
+	{"last-month", "Прошлый месяц"},
+	{"30d", "Последние 30 дней"},
+	{"3m", "Последние 3 месяца"},
+	{"ytd", "С начала года"},
+	{"last-year", "Прошлый год"},
+}
+
+// PeriodPreset — даты готового периода по ключу: month, last-month, 30d, 3m, ytd, last-year.
+func PeriodPreset(key string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	switch key {
+	case "month":
+		return month, today, nil
+	case "last-month":
+		return month.AddDate(0, -1, 0), month.AddDate(0, 0, -1), nil
+	case "30d":
+		return today.AddDate(0, 0, -30), today, nil
+	case "3m":
+		return month.AddDate(0, -2, 0), today, nil
+	case "ytd":
+		return time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.Local), today, nil
+	case "last-year":
+		return time.Date(now.Year()-1, 1, 1, 0, 0, 0, 0, time.Local), time.Date(now.Year()-1, 12, 31, 0, 0, 0, 0, time.Local), nil
+	}
+	keys := make([]string, len(periodPresets))
+	for i, p := range periodPresets {
+		keys[i] = p.key
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("неизвестный период %q (доступны: %s)", key, strings.Join(keys, ", "))
+}
+
+// choosePeriod — период по пресету или свои даты; to — последний день включительно.
+func choosePeriod() (time.Time, time.Time, error) {
+	fmt.Println("Период:")
+	for i, p := range periodPresets {
+		fmt.Printf("%d) %s\n", i+1, p.title)
+	}
+	custom := len(periodPresets) + 1
+	fmt.Printf("%d) Свой период\n", custom)
+	n, err := readInt("Выбери №: ")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	switch {
+	case n >= 1 && n < custom:
+		return PeriodPreset(periodPresets[n-1].key, time.Now())
+	case n == custom:
+		from, err := readDate("Начало периода")
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		to, err := readDate("Конец периода")
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if to.Before(from) {
+			return time.Time{}, time.Time{}, fmt.Errorf("конец периода раньше начала")
+		}
+		return from, to, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("неверный выбор")
+}
+
+// chooseAccounts — несколько счетов по номерам через запятую.
+func chooseAccounts(ctx context.Context, ar *repo.PgAccountRepo) ([]domain.AccountID, error) {
+	accs, err := ar.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(accs) == 0 {
+		return nil, fmt.Errorf("нет счетов")
+	}
+	fmt.Println("=== Счета ===")
+	for i, a := range accs {
+		fmt.Printf("%d) %s | %s\n", i+1, a.Name, a.Balance.StringFixed(2))
+	}
+	var ids []domain.AccountID
+	for _, f := range splitList(readLine("Номера через запятую: ")) {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 1 || n > len(accs) {
+			return nil, fmt.Errorf("неверный номер: %s", f)
+		}
+		if !slices.Contains(ids, accs[n-1].ID) {
+			ids = append(ids, accs[n-1].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("счета не выбраны")
+	}
+	return ids, nil
+}
+
+// ResolveAccounts — счета по списку имён или ID через запятую: пусто — активный
+// счёт, "all" — все (nil).
+func ResolveAccounts(ctx context.Context, d *Deps, spec string) ([]domain.AccountID, error) {
+	spec = strings.TrimSpace(spec)
+	switch strings.ToLower(spec) {
+	case "":
+		return []domain.AccountID{d.AccountID}, nil
+	case "all":
+		return nil, nil
+	}
+	accs, err := d.AccRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ids []domain.AccountID
+	for _, name := range splitList(spec) {
+		i := slices.IndexFunc(accs, func(a domain.BankAccount) bool {
+			return strings.EqualFold(a.Name, name) || string(a.ID) == name
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("счёт %q не найден", name)
+		}
+		ids = append(ids, accs[i].ID)
+	}
+	return ids, nil
+}
+
+// splitList — непустые элементы списка через запятую.
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// chooseExportQuery — период, а по asks формата — счета, фильтры и колонки.
+// Без AskAccounts выгружается активный счёт. Для нескольких счетов колонки
+// по умолчанию дополняются колонкой account.
+func chooseExportQuery(ctx context.Context, d *Deps, asks files.Ask) (files.ExportQuery, []string, error) {
+	var q files.ExportQuery
+	var err error
+	if q.From, q.To, err = choosePeriod(); err != nil {
+		return q, nil, err
+	}
+
+	q.Accounts = []domain.AccountID{d.AccountID}
+	if asks&files.AskAccounts != 0 {
+		fmt.Println("Счета:")
+		fmt.Println("1) Активный счёт")
+		fmt.Println("2) Выбрать несколько")
+		fmt.Println("3) Все счета")
+		n, err := readInt("Выбери №: ")
+		if err != nil {
+			return q, nil, err
+		}
+		switch n {
+		case 1:
+		case 2:
+			if q.Accounts, err = chooseAccounts(ctx, d.AccRepo); err != nil {
+				return q, nil, err
+			}
+		case 3:
+			q.Accounts = nil
+		default:
+			return q, nil, fmt.Errorf("неверный выбор")
+		}
+	}
+
+	if asks&files.AskFilters != 0 {
+		q.Categories = splitList(readLine("Категории через запятую (пусто = все): "))
+		switch readLine("Тип операций: 1) все 2) доходы 3) расходы (пусто = все): ") {
+		case "", "1":
+		case "2":
+			q.Type = 1
+		case "3":
+			q.Type = -1
+		default:
+			return q, nil, fmt.Errorf("неверный выбор")
+		}
+	}
+
+	if asks&files.AskColumns == 0 {
+		return q, nil, nil
+	}
+	raw := readLine(fmt.Sprintf("Колонки через запятую из %s (пусто = по умолчанию): ", strings.Join(files.AllColumns, ", ")))
+	cols, err := files.ParseColumns(raw)
+	if err != nil {
+		return q, nil, err
+	}
+	if raw == "" && len(q.Accounts) != 1 {
+		cols = append(slices.Clip(cols), files.ColAccount)
+	}
+	return q, cols, nil
+}
+
+// ExportCategories — разбивка по категориям из аналитики для форматов, которые
+// её выводят (XLSX). Берётся, когда в выгрузке один счёт и нет фильтров по
+// категориям и типу; иначе nil — формат посчитает суммы по строкам выгрузки.
+func ExportCategories(ctx context.Context, d *Deps, f files.Format, q files.ExportQuery) ([]files.CategoryTotal, error) {
+	if f.Name != "xlsx" || len(q.Accounts) != 1 || len(q.Categories) > 0 || q.Type != 0 {
+		return nil, nil
+	}
+	br, err := d.Ana.BreakdownByCategory(ctx, q.Accounts[0], q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	return categoryTotals(br), nil
+}
+
+// categoryTotals — разбивка из аналитики для отчётов в files.
+func categoryTotals(br facade.Breakdown) []files.CategoryTotal {
+	out := []files.CategoryTotal{}
+	for _, c := range br.Incomes {
+		out = append(out, files.CategoryTotal{Category: c.Category, Type: 1, Amount: c.Amount})
+	}
+	for _, c := range br.Expenses {
+		out = append(out, files.CategoryTotal{Category: c.Category, Type: -1, Amount: c.Amount})
+	}
+	return out
+}
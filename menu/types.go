@@ -1,9 +1,13 @@
 package menu
 
 import (
+	"main/backup"
 	"main/domain"
 	"main/facade"
+	"main/files"
+	"main/inbox"
 	"main/repo"
+	"main/service"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -20,12 +24,24 @@ type Deps struct {
 	Pool      *pgxpool.Pool
 	Factory   domain.Factory
 	AccRepo   *repo.PgAccountRepo
-	CatRepo   *repo.PgCategoryRepo
+	CatRepo   *repo.CachedCategoryRepo
 	OpsRepo   *repo.PgOperationRepo
 	AccountID domain.AccountID
+	User      domain.User
 
-	Op  facade.OperationFacade
-	Acc facade.AccountFacade
-	Cat facade.CategoryFacade
-	Ana facade.AnalyticsFacade
+	Auth    facade.AuthFacade
+	Op      facade.OperationFacade
+	Acc     facade.AccountFacade
+	Cat     facade.CategoryFacade
+	Ana     facade.AnalyticsFacade
+	Import  facade.ImportFacade
+	Dataset facade.DatasetFacade
+	Inbox   inbox.Inbox
+
+	CSVProfiles    files.CSVProfiles
+	BeancountNames files.BeancountNames
+
+	Backup *backup.Service
+	Doctor *service.DoctorService
+	Crypt  *service.EncryptionService
 }
@@ -0,0 +1,13 @@
+CREATE OR REPLACE FUNCTION notify_categories_changed() RETURNS trigger AS $$
+BEGIN
+  -- доставляется слушателям только после коммита; кэш сбрасывается целиком
+  PERFORM pg_notify('categories_changed', TG_OP);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_categories_notify ON categories;
+
+CREATE TRIGGER trg_categories_notify
+AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON categories
+FOR EACH STATEMENT EXECUTE FUNCTION notify_categories_changed();
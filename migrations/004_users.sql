@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS users (
+  id                uuid PRIMARY KEY,
+  login             text NOT NULL UNIQUE,
+  password_hash     text NOT NULL, -- bcrypt
+  active_account_id uuid REFERENCES accounts(id) ON DELETE SET NULL,
+  created_at        timestamptz NOT NULL DEFAULT now()
+);
+
+-- NULL — данные, созданные до появления пользователей; их забирает первый
+-- зарегистрированный пользователь
+ALTER TABLE accounts   ADD COLUMN IF NOT EXISTS owner_id uuid REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS owner_id uuid REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_accounts_owner   ON accounts(owner_id);
+CREATE INDEX IF NOT EXISTS idx_categories_owner ON categories(owner_id);
+
+CREATE TABLE IF NOT EXISTS account_shares (
+  account_id uuid NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+  user_id    uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  PRIMARY KEY (account_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_shares_user ON account_shares(user_id);
+
+-- имена категорий уникальны в пределах пользователя
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS uq_categories_type_name;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_categories_owner_type_name
+  ON categories (COALESCE(owner_id, '00000000-0000-0000-0000-000000000000'::uuid), type, name);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS import_batches (
+  id         uuid PRIMARY KEY,
+  account_id uuid NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+  user_id    uuid REFERENCES users(id) ON DELETE SET NULL,
+  source     text NOT NULL DEFAULT '',
+  imported   int  NOT NULL DEFAULT 0,
+  skipped    int  NOT NULL DEFAULT 0,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_batches_account ON import_batches(account_id, created_at);
+
+-- отпечаток (sha256 от даты, суммы, типа, нормализованного описания и счёта)
+-- и пакет, которым операция была импортирована; у добавленных вручную — NULL
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS import_batch_id uuid REFERENCES import_batches(id) ON DELETE SET NULL;
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS fingerprint text;
+
+CREATE INDEX IF NOT EXISTS idx_operations_fingerprint ON operations(bank_account_id, fingerprint);
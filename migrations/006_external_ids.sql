@@ -0,0 +1,6 @@
+-- стабильный id операции из выписки банка (FITID в OFX и т.п.): повторный импорт
+-- той же выписки распознаётся по нему, даже если банк поправил описание
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS external_id text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_operations_account_external_id
+  ON operations(bank_account_id, external_id) WHERE external_id IS NOT NULL;
@@ -0,0 +1,6 @@
+-- номер счёта в банке (IBAN или другой идентификатор из выписки): по нему импорт
+-- выписок с несколькими счетами раскладывает записи по счетам
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS iban text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_accounts_owner_iban
+  ON accounts(owner_id, iban) WHERE iban IS NOT NULL;
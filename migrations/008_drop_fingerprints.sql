@@ -0,0 +1,4 @@
+-- отпечатки операций считаются в памяти при импорте; хранить несекретный хэш
+-- рядом с зашифрованными описаниями нельзя — описание подбирается по нему словарём
+DROP INDEX IF EXISTS idx_operations_fingerprint;
+ALTER TABLE operations DROP COLUMN IF EXISTS fingerprint;
@@ -4,29 +4,50 @@ import (
 	"context"
 	"errors"
 
+	"main/db"
 	"main/domain"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/shopspring/decimal"
 )
 
+var ErrAccountNotFound = errors.New("account not found")
+
 type PgAccountRepo struct{ db *pgxpool.Pool }
 
 func NewPgAccountRepo(db *pgxpool.Pool) *PgAccountRepo { return &PgAccountRepo{db: db} }
 
 func (r *PgAccountRepo) Create(ctx context.Context, a domain.BankAccount) error {
-	_, err := r.db.Exec(ctx,
-		`INSERT INTO accounts(id,name,balance) VALUES($1,$2,$3)`,
-		a.ID, a.Name, a.Balance.StringFixed(2),
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.Conn(ctx, r.db).Exec(ctx,
+		`INSERT INTO accounts(id,name,balance,owner_id) VALUES($1,$2,$3,$4)`,
+		a.ID, a.Name, a.Balance.StringFixed(2), uid,
 	)
 	return err
 }
 
 func (r *PgAccountRepo) Get(ctx context.Context, id domain.AccountID) (domain.BankAccount, error) {
+	return r.get(ctx, id, "")
+}
+
+// GetForUpdate блокирует строку счёта до конца транзакции из ctx.
+func (r *PgAccountRepo) GetForUpdate(ctx context.Context, id domain.AccountID) (domain.BankAccount, error) {
+	return r.get(ctx, id, " FOR UPDATE OF a")
+}
+
+func (r *PgAccountRepo) get(ctx context.Context, id domain.AccountID, lock string) (domain.BankAccount, error) {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return domain.BankAccount{}, err
+	}
 	var a domain.BankAccount
 	var bal string
-	err := r.db.QueryRow(ctx,
-		`SELECT id, name, balance FROM accounts WHERE id=$1`, id,
+	err = db.Conn(ctx, r.db).QueryRow(ctx,
+		`SELECT a.id, a.name, a.balance FROM accounts a WHERE a.id=$1 AND `+AccountAccess("a", 2)+lock, id, uid,
 	).Scan(&a.ID, &a.Name, &bal)
 	if err != nil {
 		return domain.BankAccount{}, err
@@ -40,30 +61,47 @@ func (r *PgAccountRepo) Get(ctx context.Context, id domain.AccountID) (domain.Ba
 }
 
 func (r *PgAccountRepo) Update(ctx context.Context, a domain.BankAccount) error {
-	ct, err := r.db.Exec(ctx,
-		`UPDATE accounts SET name=$2, balance=$3 WHERE id=$1`,
-		a.ID, a.Name, a.Balance.StringFixed(2),
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := db.Conn(ctx, r.db).Exec(ctx,
+		`UPDATE accounts a SET name=$2, balance=$3 WHERE a.id=$1 AND `+AccountAccess("a", 4),
+		a.ID, a.Name, a.Balance.StringFixed(2), uid,
 	)
 	if err != nil {
 		return err
 	}
 	if ct.RowsAffected() == 0 {
-		return errors.New("account not found")
+		return ErrAccountNotFound
 	}
 	return nil
 }
+
+// UpdateName доступен только владельцу счёта.
 func (r *PgAccountRepo) UpdateName(ctx context.Context, id domain.AccountID, name string) error {
-	ct, err := r.db.Exec(ctx, `UPDATE accounts SET name=$2 WHERE id=$1`, id, name)
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := db.Conn(ctx, r.db).Exec(ctx, `UPDATE accounts SET name=$2 WHERE id=$1 AND owner_id=$3`, id, name, uid)
 	if err != nil {
 		return err
 	}
 	if ct.RowsAffected() == 0 {
-		return errors.New("account not found")
+		return ErrAccountNotFound
 	}
 	return nil
 }
+
+// List возвращает свои и расшаренные пользователю счета.
 func (r *PgAccountRepo) List(ctx context.Context) ([]domain.BankAccount, error) {
-	rows, err := r.db.Query(ctx, `SELECT id, name, balance FROM accounts ORDER BY name`)
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn(ctx, r.db).Query(ctx,
+		`SELECT a.id, a.name, a.balance FROM accounts a WHERE `+AccountAccess("a", 1)+` ORDER BY a.name`, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -85,7 +123,133 @@ func (r *PgAccountRepo) List(ctx context.Context) ([]domain.BankAccount, error)
 	}
 	return out, rows.Err()
 }
+
+// Delete доступен только владельцу счёта.
 func (r *PgAccountRepo) Delete(ctx context.Context, id domain.AccountID) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM accounts WHERE id=$1`, id)
-	return err
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := db.Conn(ctx, r.db).Exec(ctx, `DELETE FROM accounts WHERE id=$1 AND owner_id=$2`, id, uid)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+// Share открывает счёт другому пользователю; делиться может только владелец.
+func (r *PgAccountRepo) Share(ctx context.Context, id domain.AccountID, with domain.UserID) error {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := db.Conn(ctx, r.db).Exec(ctx,
+		`INSERT INTO account_shares(account_id, user_id)
+		 SELECT a.id, $2 FROM accounts a WHERE a.id=$1 AND a.owner_id=$3
+		 ON CONFLICT DO NOTHING`, id, with, uid)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		var owned bool
+		if err := db.Conn(ctx, r.db).QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM accounts WHERE id=$1 AND owner_id=$2)`, id, uid).Scan(&owned); err != nil {
+			return err
+		}
+		if !owned {
+			return ErrAccountNotFound
+		}
+	}
+	return nil
+}
+
+func (r *PgAccountRepo) Unshare(ctx context.Context, id domain.AccountID, with domain.UserID) error {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := db.Conn(ctx, r.db).Exec(ctx,
+		`DELETE FROM account_shares s USING accounts a
+		  WHERE s.account_id = a.id AND a.id=$1 AND a.owner_id=$3 AND s.user_id=$2`, id, with, uid)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
+// SharedWith — логины пользователей, которым владелец открыл счёт.
+func (r *PgAccountRepo) SharedWith(ctx context.Context, id domain.AccountID) ([]domain.User, error) {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn(ctx, r.db).Query(ctx,
+		`SELECT u.id, u.login
+		   FROM account_shares s
+		   JOIN accounts a ON a.id = s.account_id
+		   JOIN users u ON u.id = s.user_id
+		  WHERE a.id=$1 AND a.owner_id=$2
+		  ORDER BY u.login`, id, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.User
+	for rows.Next() {
+		var u domain.User
+		if err := rows.Scan(&u.ID, &u.Login); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// FindByIBAN ищет среди доступных пользователю счетов счёт с номером из выписки;
+// свой счёт важнее расшаренного.
+func (r *PgAccountRepo) FindByIBAN(ctx context.Context, iban string) (domain.BankAccount, error) {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return domain.BankAccount{}, err
+	}
+	var id domain.AccountID
+	err = db.Conn(ctx, r.db).QueryRow(ctx,
+		`SELECT a.id FROM accounts a WHERE a.iban=$1 AND `+AccountAccess("a", 2)+`
+		  ORDER BY (a.owner_id = $2) DESC LIMIT 1`, iban, uid).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.BankAccount{}, ErrAccountNotFound
+	}
+	if err != nil {
+		return domain.BankAccount{}, err
+	}
+	return r.Get(ctx, id)
+}
+
+// SetIBAN привязывает номер из выписки к счёту (только владелец); у другого счёта
+// владельца этот номер снимается.
+func (r *PgAccountRepo) SetIBAN(ctx context.Context, id domain.AccountID, iban string) error {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	conn := db.Conn(ctx, r.db)
+	if _, err := conn.Exec(ctx,
+		`UPDATE accounts SET iban=NULL WHERE owner_id=$1 AND iban=$2 AND id<>$3`, uid, iban, id); err != nil {
+		return err
+	}
+	ct, err := conn.Exec(ctx, `UPDATE accounts SET iban=$2 WHERE id=$1 AND owner_id=$3`, id, iban, uid)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
 }
@@ -2,57 +2,117 @@ package repo
 
 import (
 	"context"
+	"main/db"
 	"main/domain"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type CachedCategoryRepo struct {
 	inner *PgCategoryRepo
-	mu    sync.RWMutex
-	list  []domain.Category
-	byID  map[domain.CategoryID]domain.Category
+	ttl   time.Duration // 0 — без ограничения, полагаемся только на NOTIFY
+
+	mu       sync.RWMutex
+	owner    domain.UserID // кэш принадлежит одному пользователю
+	list     []domain.Category
+	byID     map[domain.CategoryID]domain.Category
+	loadedAt time.Time
+	gen      uint64 // растёт при каждой инвалидации; загрузка, во время которой он сменился, в кэш не попадает
+
+	hits, misses, invalidations, notifications, listenErrors atomic.Int64
+	listening                                                atomic.Bool
+}
+
+type CacheStats struct {
+	Hits          int64
+	Misses        int64
+	Invalidations int64
+	Notifications int64 // инвалидации по NOTIFY из других процессов
+	ListenErrors  int64
+	Listening     bool
+	TTL           time.Duration
+	Entries       int
+	LoadedAt      time.Time
 }
 
-func NewCachedCategoryRepo(inner *PgCategoryRepo) *CachedCategoryRepo {
-	return &CachedCategoryRepo{inner: inner, byID: map[domain.CategoryID]domain.Category{}}
+func NewCachedCategoryRepo(inner *PgCategoryRepo, ttl time.Duration) *CachedCategoryRepo {
+	return &CachedCategoryRepo{inner: inner, ttl: ttl, byID: map[domain.CategoryID]domain.Category{}}
+}
+
+// fresh вызывается под r.mu.
+func (r *CachedCategoryRepo) fresh(ctx context.Context) bool {
+	if uid, _ := UserFrom(ctx); uid != r.owner {
+		return false
+	}
+	return r.ttl <= 0 || time.Since(r.loadedAt) < r.ttl
 }
 
 func (r *CachedCategoryRepo) List(ctx context.Context) ([]domain.Category, error) {
+	if _, ok := db.TxFrom(ctx); ok {
+		// внутри транзакции видны незакоммиченные данные — в кэш их не кладём
+		return r.inner.List(ctx)
+	}
 	r.mu.RLock()
-	if r.list != nil {
+	if r.list != nil && r.fresh(ctx) {
 		defer r.mu.RUnlock()
+		r.hits.Add(1)
 		return append([]domain.Category(nil), r.list...), nil
 	}
+	gen := r.gen
 	r.mu.RUnlock()
 
+	r.misses.Add(1)
 	cats, err := r.inner.List(ctx)
 	if err != nil {
 		return nil, err
 	}
 	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gen != gen {
+		// пока шёл запрос, кэш сбросили — результат мог устареть
+		return cats, nil
+	}
+	r.owner, _ = UserFrom(ctx)
 	r.list = append([]domain.Category(nil), cats...)
 	r.byID = map[domain.CategoryID]domain.Category{}
 	for _, c := range cats {
 		r.byID[c.ID] = c
 	}
-	r.mu.Unlock()
+	r.loadedAt = time.Now()
 	return cats, nil
 }
 
 func (r *CachedCategoryRepo) Get(ctx context.Context, id domain.CategoryID) (domain.Category, error) {
+	if _, ok := db.TxFrom(ctx); ok {
+		return r.inner.Get(ctx, id)
+	}
 	r.mu.RLock()
-	if c, ok := r.byID[id]; ok {
+	if c, ok := r.byID[id]; ok && r.fresh(ctx) {
 		r.mu.RUnlock()
+		r.hits.Add(1)
 		return c, nil
 	}
+	gen := r.gen
 	r.mu.RUnlock()
+
+	r.misses.Add(1)
 	c, err := r.inner.Get(ctx, id)
 	if err != nil {
 		return c, err
 	}
 	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gen != gen {
+		return c, nil
+	}
+	if !r.fresh(ctx) {
+		r.owner, _ = UserFrom(ctx)
+		r.list = nil
+		r.byID = map[domain.CategoryID]domain.Category{}
+		r.loadedAt = time.Now()
+	}
 	r.byID[id] = c
-	r.mu.Unlock()
 	return c, nil
 }
 
@@ -60,36 +120,60 @@ func (r *CachedCategoryRepo) Create(ctx context.Context, c domain.Category) erro
 	if err := r.inner.Create(ctx, c); err != nil {
 		return err
 	}
-	r.invalidate()
+	r.invalidateOnCommit(ctx)
 	return nil
 }
 func (r *CachedCategoryRepo) UpdateName(ctx context.Context, id domain.CategoryID, name string) error {
 	if err := r.inner.UpdateName(ctx, id, name); err != nil {
 		return err
 	}
-	r.invalidate()
+	r.invalidateOnCommit(ctx)
 	return nil
 }
 func (r *CachedCategoryRepo) UpdateType(ctx context.Context, id domain.CategoryID, t domain.CategoryType) error {
 	if err := r.inner.UpdateType(ctx, id, t); err != nil {
 		return err
 	}
-	r.invalidate()
+	r.invalidateOnCommit(ctx)
 	return nil
 }
 func (r *CachedCategoryRepo) Delete(ctx context.Context, id domain.CategoryID) error {
 	if err := r.inner.Delete(ctx, id); err != nil {
 		return err
 	}
-	r.invalidate()
+	r.invalidateOnCommit(ctx)
 	return nil
 }
 func (r *CachedCategoryRepo) HasOperations(ctx context.Context, id domain.CategoryID) (bool, error) {
 	return r.inner.HasOperations(ctx, id)
 }
+
+func (r *CachedCategoryRepo) Stats() CacheStats {
+	r.mu.RLock()
+	entries, loadedAt := len(r.byID), r.loadedAt
+	r.mu.RUnlock()
+	return CacheStats{
+		Hits:          r.hits.Load(),
+		Misses:        r.misses.Load(),
+		Invalidations: r.invalidations.Load(),
+		Notifications: r.notifications.Load(),
+		ListenErrors:  r.listenErrors.Load(),
+		Listening:     r.listening.Load(),
+		TTL:           r.ttl,
+		Entries:       entries,
+		LoadedAt:      loadedAt,
+	}
+}
+
+func (r *CachedCategoryRepo) invalidateOnCommit(ctx context.Context) {
+	r.invalidate()
+	db.OnCommit(ctx, r.invalidate)
+}
 func (r *CachedCategoryRepo) invalidate() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.invalidations.Add(1)
+	r.gen++
 	r.list = nil
 	r.byID = map[domain.CategoryID]domain.Category{}
 }
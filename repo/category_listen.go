@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CategoriesChannel — канал NOTIFY, в который пишет триггер
+// из migrations/003_categories_notify.sql.
+const CategoriesChannel = "categories_changed"
+
+// Listen держит отдельное соединение с LISTEN на CategoriesChannel и сбрасывает
+// кэш при каждом уведомлении. При обрыве переподключается; пока соединения нет,
+// свежесть кэша ограничивает только TTL. Блокирует до отмены ctx.
+func (r *CachedCategoryRepo) Listen(ctx context.Context, pool *pgxpool.Pool) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := r.listenOnce(ctx, pool.Config().ConnConfig)
+		if r.listening.Swap(false) {
+			// LISTEN прошёл — обрыв после него начинает отсчёт паузы заново
+			backoff = time.Second
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			r.listenErrors.Add(1)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+func (r *CachedCategoryRepo) listenOnce(ctx context.Context, cfg *pgx.ConnConfig) error {
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+CategoriesChannel); err != nil {
+		return err
+	}
+	r.listening.Store(true)
+	// пока соединения не было, уведомления могли потеряться
+	r.invalidate()
+
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		r.notifications.Add(1)
+		r.invalidate()
+	}
+}
@@ -4,64 +4,105 @@ import (
 	"context"
 	"errors"
 
+	"main/db"
 	"main/domain"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrCategoryNotFound = errors.New("category not found")
+
+// PgCategoryRepo — категории вошедшего пользователя. Get дополнительно видит
+// категории операций в расшаренных ему счетах.
 type PgCategoryRepo struct{ db *pgxpool.Pool }
 
 func NewPgCategoryRepo(db *pgxpool.Pool) *PgCategoryRepo { return &PgCategoryRepo{db: db} }
 
 func (r *PgCategoryRepo) UpdateName(ctx context.Context, id domain.CategoryID, name string) error {
-	_, err := r.db.Exec(ctx, `UPDATE categories SET name=$2 WHERE id=$1`, id, name)
-	return err
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := db.Conn(ctx, r.db).Exec(ctx, `UPDATE categories SET name=$2 WHERE id=$1 AND owner_id=$3`, id, name, uid)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrCategoryNotFound
+	}
+	return nil
 }
 
 func (r *PgCategoryRepo) UpdateType(ctx context.Context, id domain.CategoryID, t domain.CategoryType) error {
-	ct, err := r.db.Exec(ctx, `UPDATE categories SET type=$2 WHERE id=$1`, id, int(t))
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	ct, err := db.Conn(ctx, r.db).Exec(ctx, `UPDATE categories SET type=$2 WHERE id=$1 AND owner_id=$3`, id, int(t), uid)
 	if err != nil {
 		return err
 	}
 	if ct.RowsAffected() == 0 {
-		return errors.New("category not found")
+		return ErrCategoryNotFound
 	}
 	return nil
 }
 func (r *PgCategoryRepo) Delete(ctx context.Context, id domain.CategoryID) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM categories WHERE id=$1`, id)
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.Conn(ctx, r.db).Exec(ctx, `DELETE FROM categories WHERE id=$1 AND owner_id=$2`, id, uid)
 	return err
 }
 
+// HasOperations учитывает операции всех пользователей: категорию из чужого
+// расшаренного счёта удалять нельзя.
 func (r *PgCategoryRepo) HasOperations(ctx context.Context, id domain.CategoryID) (bool, error) {
 	var n int64
-	if err := r.db.QueryRow(ctx, `SELECT COUNT(1) FROM operations WHERE category_id=$1`, id).Scan(&n); err != nil {
+	if err := db.Conn(ctx, r.db).QueryRow(ctx, `SELECT COUNT(1) FROM operations WHERE category_id=$1`, id).Scan(&n); err != nil {
 		return false, err
 	}
 	return n > 0, nil
 }
 func (r *PgCategoryRepo) Create(ctx context.Context, c domain.Category) error {
-	_, err := r.db.Exec(ctx,
-		`INSERT INTO categories(id, type, name) VALUES ($1, $2, $3)`,
-		c.ID, int(c.Type), c.Name,
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.Conn(ctx, r.db).Exec(ctx,
+		`INSERT INTO categories(id, type, name, owner_id) VALUES ($1, $2, $3, $4)`,
+		c.ID, int(c.Type), c.Name, uid,
 	)
 	return err
 }
 
 func (r *PgCategoryRepo) Get(ctx context.Context, id domain.CategoryID) (domain.Category, error) {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return domain.Category{}, err
+	}
 	var c domain.Category
-	err := r.db.QueryRow(ctx,
-		`SELECT id, type, name FROM categories WHERE id=$1`, id,
+	err = db.Conn(ctx, r.db).QueryRow(ctx,
+		`SELECT c.id, c.type, c.name FROM categories c
+		  WHERE c.id=$1 AND (c.owner_id=$2 OR EXISTS (
+		        SELECT 1 FROM operations o JOIN accounts a ON a.id = o.bank_account_id
+		         WHERE o.category_id = c.id AND `+AccountAccess("a", 2)+`))`, id, uid,
 	).Scan(&c.ID, &c.Type, &c.Name)
 	return c, err
 }
 
 func (r *PgCategoryRepo) List(ctx context.Context) ([]domain.Category, error) {
-	rows, err := r.db.Query(ctx, `
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn(ctx, r.db).Query(ctx, `
     SELECT DISTINCT ON (type, name) id, type, name
     FROM categories
+    WHERE owner_id = $1
     ORDER BY type, name, id
-  `)
+  `, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"main/db"
+	"main/domain"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PgImportRepo struct{ db *pgxpool.Pool }
+
+func NewPgImportRepo(db *pgxpool.Pool) *PgImportRepo { return &PgImportRepo{db: db} }
+
+func (r *PgImportRepo) CreateBatch(ctx context.Context, b domain.ImportBatch) error {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.Conn(ctx, r.db).Exec(ctx,
+		`INSERT INTO import_batches(id, account_id, user_id, source, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		b.ID, b.AccountID, uid, b.Source, b.CreatedAt,
+	)
+	return err
+}
+
+func (r *PgImportRepo) FinishBatch(ctx context.Context, id domain.ImportBatchID, imported, skipped int) error {
+	_, err := db.Conn(ctx, r.db).Exec(ctx,
+		`UPDATE import_batches SET imported=$2, skipped=$3 WHERE id=$1`, id, imported, skipped)
+	return err
+}
+
+// MarkImported связывает операцию с пакетом импорта и сохраняет внешний id из выписки ("" — нет).
+func (r *PgImportRepo) MarkImported(ctx context.Context, op domain.OperationID, batch domain.ImportBatchID, externalID string) error {
+	var ext *string
+	if externalID != "" {
+		ext = &externalID
+	}
+	_, err := db.Conn(ctx, r.db).Exec(ctx,
+		`UPDATE operations SET import_batch_id=$2, external_id=$3 WHERE id=$1`,
+		op, batch, ext)
+	return err
+}
+
+// ExternalIDs — внешние id операций счёта за период (у операций без id их нет в ответе).
+func (r *PgImportRepo) ExternalIDs(ctx context.Context, accID domain.AccountID, from, to time.Time) (map[domain.OperationID]string, error) {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn(ctx, r.db).Query(ctx,
+		`SELECT o.id, o.external_id
+		  FROM operations o
+		  JOIN accounts a ON a.id = o.bank_account_id
+		  WHERE o.bank_account_id=$1 AND o."date" BETWEEN $2 AND $3 AND o.external_id IS NOT NULL
+		    AND `+AccountAccess("a", 4),
+		accID, from, to, uid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[domain.OperationID]string{}
+	for rows.Next() {
+		var id domain.OperationID
+		var ext string
+		if err := rows.Scan(&id, &ext); err != nil {
+			return nil, err
+		}
+		out[id] = ext
+	}
+	return out, rows.Err()
+}
@@ -2,33 +2,98 @@ package repo
 
 import (
 	"context"
+	"fmt"
+	"iter"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/shopspring/decimal"
 
+	"main/db"
 	"main/domain"
+	"main/secret"
 )
 
-type PgOperationRepo struct{ db *pgxpool.Pool }
+type PgOperationRepo struct {
+	db   *pgxpool.Pool
+	keys *secret.Keyring
+}
+
+func NewPgOperationRepo(db *pgxpool.Pool, keys *secret.Keyring) *PgOperationRepo {
+	return &PgOperationRepo{db: db, keys: keys}
+}
 
-func NewPgOperationRepo(db *pgxpool.Pool) *PgOperationRepo { return &PgOperationRepo{db: db} }
+// DescriptionAAD привязывает зашифрованное описание к его операции. Описание —
+// единственное шифруемое поле: контрагент и назначение платежа импорт пишет в него.
+func DescriptionAAD(id domain.OperationID) string {
+	return "operations.description:" + string(id)
+}
 
 func (r *PgOperationRepo) Create(ctx context.Context, o domain.Operation) error {
-	_, err := r.db.Exec(ctx,
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	desc, err := r.keys.Encrypt(o.Description, DescriptionAAD(o.ID))
+	if err != nil {
+		return err
+	}
+	ct, err := db.Conn(ctx, r.db).Exec(ctx,
 		`INSERT INTO operations(id,type,bank_account_id,amount,"date",description,category_id)
-		 VALUES($1,$2,$3,$4,$5,$6,$7)`,
-		o.ID, int(o.Type), o.BankAccount, o.Amount.StringFixed(2), o.Date, o.Description, o.Category,
+		 SELECT $1,$2,a.id,$4,$5,$6,$7 FROM accounts a WHERE a.id=$3 AND `+AccountAccess("a", 8),
+		o.ID, int(o.Type), o.BankAccount, o.Amount.StringFixed(2), o.Date, desc, o.Category, uid,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
 }
+
+// Update перезаписывает операцию целиком; счёт операции и новый счёт должны
+// быть доступны пользователю. Баланс счетов не меняется.
+func (r *PgOperationRepo) Update(ctx context.Context, o domain.Operation) error {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	desc, err := r.keys.Encrypt(o.Description, DescriptionAAD(o.ID))
+	if err != nil {
+		return err
+	}
+	ct, err := db.Conn(ctx, r.db).Exec(ctx,
+		`UPDATE operations o
+		    SET type=$2, bank_account_id=$3, amount=$4, "date"=$5, description=$6, category_id=$7
+		   FROM accounts a, accounts na
+		  WHERE o.id=$1 AND a.id = o.bank_account_id AND na.id = $3
+		    AND `+AccountAccess("a", 8)+` AND `+AccountAccess("na", 8),
+		o.ID, int(o.Type), o.BankAccount, o.Amount.StringFixed(2), o.Date, desc, o.Category, uid,
+	)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
+
 func (r *PgOperationRepo) ListByAccount(ctx context.Context, accID domain.AccountID, from, to time.Time) ([]domain.Operation, error) {
-	rows, err := r.db.Query(ctx,
-		`SELECT id,type,bank_account_id,amount,"date",description,category_id
-		  FROM operations
-		  WHERE bank_account_id=$1 AND "date" BETWEEN $2 AND $3
-		  ORDER BY "date", id`,
-		accID, from, to,
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn(ctx, r.db).Query(ctx,
+		`SELECT o.id,o.type,o.bank_account_id,o.amount,o."date",o.description,o.category_id
+		  FROM operations o
+		  JOIN accounts a ON a.id = o.bank_account_id
+		  WHERE o.bank_account_id=$1 AND o."date" BETWEEN $2 AND $3 AND `+AccountAccess("a", 4)+`
+		  ORDER BY o."date", o.id`,
+		accID, from, to, uid,
 	)
 	if err != nil {
 		return nil, err
@@ -42,30 +107,173 @@ func (r *PgOperationRepo) ListByAccount(ctx context.Context, accID domain.Accoun
 		if err := rows.Scan(&o.ID, &o.Type, &o.BankAccount, &amt, &o.Date, &o.Description, &o.Category); err != nil {
 			return nil, err
 		}
-		dec, err := decimal.NewFromString(amt)
+		if err := r.finish(&o, amt); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+// streamBatch — сколько строк курсор отдаёт за один FETCH.
+const streamBatch = 1000
+
+var cursorSeq atomic.Int64
+
+// StreamByAccount — операции счёта за период по одной, в том же порядке, что ListByAccount.
+// Серверный курсор читается пачками по streamBatch, поэтому память не зависит от размера
+// выборки, а между пачками соединение свободно для других запросов (категории и т.п.).
+// Курсору нужна транзакция: берётся из контекста, иначе открывается своя, только на чтение.
+// Каждый проход по последовательности заново выполняет запрос.
+func (r *PgOperationRepo) StreamByAccount(ctx context.Context, accID domain.AccountID, from, to time.Time) iter.Seq2[domain.Operation, error] {
+	return r.StreamByAccounts(ctx, []domain.AccountID{accID}, from, to)
+}
+
+// StreamByAccounts — то же для нескольких счетов: операции всех счетов вперемешку, по дате.
+func (r *PgOperationRepo) StreamByAccounts(ctx context.Context, accIDs []domain.AccountID, from, to time.Time) iter.Seq2[domain.Operation, error] {
+	ids := make([]string, len(accIDs))
+	for i, id := range accIDs {
+		ids[i] = string(id)
+	}
+	return func(yield func(domain.Operation, error) bool) {
+		fail := func(err error) { yield(domain.Operation{}, err) }
+		uid, err := UserFrom(ctx)
 		if err != nil {
+			fail(err)
+			return
+		}
+		tx, ok := db.TxFrom(ctx)
+		if !ok {
+			own, err := r.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer own.Rollback(ctx)
+			tx = own
+		}
+
+		name := fmt.Sprintf("ops_stream_%d", cursorSeq.Add(1))
+		_, err = tx.Exec(ctx,
+			`DECLARE `+name+` NO SCROLL CURSOR FOR
+			 SELECT o.id,o.type,o.bank_account_id,o.amount,o."date",o.description,o.category_id
+			   FROM operations o
+			   JOIN accounts a ON a.id = o.bank_account_id
+			   WHERE o.bank_account_id = ANY($1) AND o."date" BETWEEN $2 AND $3 AND `+AccountAccess("a", 4)+`
+			   ORDER BY o."date", o.id`,
+			ids, from, to, uid,
+		)
+		if err != nil {
+			fail(err)
+			return
+		}
+		defer tx.Exec(ctx, `CLOSE `+name)
+
+		batch := make([]domain.Operation, 0, streamBatch)
+		for {
+			batch, err = r.fetch(ctx, tx, name, batch[:0])
+			if err != nil {
+				fail(err)
+				return
+			}
+			if len(batch) == 0 {
+				return
+			}
+			for _, o := range batch {
+				if !yield(o, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// fetch читает следующую пачку курсора; строки закрываются до того, как пачка уйдёт вызывающему.
+func (r *PgOperationRepo) fetch(ctx context.Context, tx pgx.Tx, cursor string, out []domain.Operation) ([]domain.Operation, error) {
+	rows, err := tx.Query(ctx, fmt.Sprintf(`FETCH %d FROM %s`, streamBatch, cursor))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o domain.Operation
+		var amt string
+		if err := rows.Scan(&o.ID, &o.Type, &o.BankAccount, &amt, &o.Date, &o.Description, &o.Category); err != nil {
+			return nil, err
+		}
+		if err := r.finish(&o, amt); err != nil {
 			return nil, err
 		}
-		o.Amount = dec
 		out = append(out, o)
 	}
 	return out, rows.Err()
 }
+
 func (r *PgOperationRepo) Get(ctx context.Context, id domain.OperationID) (domain.Operation, error) {
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return domain.Operation{}, err
+	}
 	var o domain.Operation
 	var amt string
-	err := r.db.QueryRow(ctx,
-		`SELECT id,type,bank_account_id,amount,"date",description,category_id
-		FROM operations WHERE id=$1`, id).
+	err = db.Conn(ctx, r.db).QueryRow(ctx,
+		`SELECT o.id,o.type,o.bank_account_id,o.amount,o."date",o.description,o.category_id
+		FROM operations o JOIN accounts a ON a.id = o.bank_account_id
+		WHERE o.id=$1 AND `+AccountAccess("a", 2), id, uid).
 		Scan(&o.ID, &o.Type, &o.BankAccount, &amt, &o.Date, &o.Description, &o.Category)
 	if err != nil {
 		return domain.Operation{}, err
 	}
+	if err := r.finish(&o, amt); err != nil {
+		return domain.Operation{}, err
+	}
+	return o, nil
+}
+
+// ListByExternalIDs — операции счёта с данными внешними id (FITID и т.п.), по id.
+func (r *PgOperationRepo) ListByExternalIDs(ctx context.Context, accID domain.AccountID, ids []string) (map[string]domain.Operation, error) {
+	out := map[string]domain.Operation{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	uid, err := UserFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Conn(ctx, r.db).Query(ctx,
+		`SELECT o.id,o.type,o.bank_account_id,o.amount,o."date",o.description,o.category_id,o.external_id
+		  FROM operations o
+		  JOIN accounts a ON a.id = o.bank_account_id
+		  WHERE o.bank_account_id=$1 AND o.external_id = ANY($2) AND `+AccountAccess("a", 3),
+		accID, ids, uid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o domain.Operation
+		var amt, ext string
+		if err := rows.Scan(&o.ID, &o.Type, &o.BankAccount, &amt, &o.Date, &o.Description, &o.Category, &ext); err != nil {
+			return nil, err
+		}
+		if err := r.finish(&o, amt); err != nil {
+			return nil, err
+		}
+		out[ext] = o
+	}
+	return out, rows.Err()
+}
+
+func (r *PgOperationRepo) finish(o *domain.Operation, amt string) error {
 	dec, err := decimal.NewFromString(amt)
 	if err != nil {
-		return domain.Operation{}, err
+		return err
 	}
 	o.Amount = dec
-	return o, nil
+	o.Description, err = r.keys.Decrypt(o.Description, DescriptionAAD(o.ID))
+	return err
 }
+
 func (r *PgOperationRepo) Db() *pgxpool.Pool { return r.db }
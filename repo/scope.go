@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"main/domain"
+)
+
+var ErrNoUser = errors.New("no logged-in user")
+
+type userKey struct{}
+
+// WithUser привязывает вошедшего пользователя к ctx; все запросы репозиториев
+// ограничиваются его данными.
+func WithUser(ctx context.Context, id domain.UserID) context.Context {
+	return context.WithValue(ctx, userKey{}, id)
+}
+
+func UserFrom(ctx context.Context) (domain.UserID, error) {
+	id, ok := ctx.Value(userKey{}).(domain.UserID)
+	if !ok || id == "" {
+		return "", ErrNoUser
+	}
+	return id, nil
+}
+
+// AccountAccess — SQL-условие «счёт alias принадлежит пользователю $arg или расшарен ему».
+func AccountAccess(alias string, arg int) string {
+	return fmt.Sprintf(
+		`(%[1]s.owner_id = $%[2]d OR EXISTS (SELECT 1 FROM account_shares s WHERE s.account_id = %[1]s.id AND s.user_id = $%[2]d))`,
+		alias, arg)
+}
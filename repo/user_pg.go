@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"context"
+
+	"main/db"
+	"main/domain"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgUserRepo не ограничен вошедшим пользователем — он нужен до входа.
+type PgUserRepo struct{ db *pgxpool.Pool }
+
+func NewPgUserRepo(db *pgxpool.Pool) *PgUserRepo { return &PgUserRepo{db: db} }
+
+func (r *PgUserRepo) Create(ctx context.Context, u domain.User, passwordHash string) error {
+	_, err := db.Conn(ctx, r.db).Exec(ctx,
+		`INSERT INTO users(id, login, password_hash) VALUES ($1, $2, $3)`,
+		u.ID, u.Login, passwordHash,
+	)
+	return err
+}
+
+func (r *PgUserRepo) GetByLogin(ctx context.Context, login string) (domain.User, string, error) {
+	var u domain.User
+	var hash string
+	err := db.Conn(ctx, r.db).QueryRow(ctx,
+		`SELECT id, login, password_hash FROM users WHERE login=$1`, login,
+	).Scan(&u.ID, &u.Login, &hash)
+	return u, hash, err
+}
+
+// LockRegistration до конца транзакции блокирует создание других
+// пользователей (чтение не блокируется): проверки логина и Count в одной
+// транзакции с Create видят всех уже зарегистрированных. Вызывается только
+// внутри единицы работы.
+func (r *PgUserRepo) LockRegistration(ctx context.Context) error {
+	_, err := db.Conn(ctx, r.db).Exec(ctx, `LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE`)
+	return err
+}
+
+func (r *PgUserRepo) Get(ctx context.Context, id domain.UserID) (domain.User, error) {
+	var u domain.User
+	err := db.Conn(ctx, r.db).QueryRow(ctx,
+		`SELECT id, login FROM users WHERE id=$1`, id,
+	).Scan(&u.ID, &u.Login)
+	return u, err
+}
+
+func (r *PgUserRepo) Count(ctx context.Context) (int, error) {
+	var n int
+	err := db.Conn(ctx, r.db).QueryRow(ctx, `SELECT COUNT(1) FROM users`).Scan(&n)
+	return n, err
+}
+
+// ClaimUnowned отдаёт пользователю счета и категории, созданные до появления
+// пользователей (owner_id IS NULL).
+func (r *PgUserRepo) ClaimUnowned(ctx context.Context, id domain.UserID) (int64, error) {
+	q := db.Conn(ctx, r.db)
+	ct, err := q.Exec(ctx, `UPDATE accounts SET owner_id=$1 WHERE owner_id IS NULL`, id)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := q.Exec(ctx, `UPDATE categories SET owner_id=$1 WHERE owner_id IS NULL`, id); err != nil {
+		return 0, err
+	}
+	return ct.RowsAffected(), nil
+}
+
+func (r *PgUserRepo) ActiveAccount(ctx context.Context, id domain.UserID) (domain.AccountID, error) {
+	var acc *string
+	if err := db.Conn(ctx, r.db).QueryRow(ctx,
+		`SELECT active_account_id::text FROM users WHERE id=$1`, id).Scan(&acc); err != nil {
+		return "", err
+	}
+	if acc == nil {
+		return "", nil
+	}
+	return domain.AccountID(*acc), nil
+}
+
+func (r *PgUserRepo) SetActiveAccount(ctx context.Context, id domain.UserID, acc domain.AccountID) error {
+	var v *domain.AccountID
+	if acc != "" {
+		v = &acc
+	}
+	_, err := db.Conn(ctx, r.db).Exec(ctx, `UPDATE users SET active_account_id=$2 WHERE id=$1`, id, v)
+	return err
+}
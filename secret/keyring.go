@@ -0,0 +1,271 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Зашифрованное значение хранится в той же текстовой колонке:
+//
+//	enc:v1:<id ключа>:<base64(nonce || ciphertext)>
+//
+// Значения без префикса считаются открытым текстом — так старые данные
+// читаются до перешифровки, а шифрование остаётся опциональным.
+const prefix = "enc:v1:"
+
+const KeySize = 32 // AES-256
+
+var (
+	ErrNoKey      = errors.New("encrypted value: no key configured")
+	ErrUnknownKey = errors.New("encrypted value: unknown key")
+	ErrBadValue   = errors.New("encrypted value: malformed or tampered")
+	ErrNoKeyFile  = errors.New("key rotation requires a key file")
+)
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring — набор ключей: первый шифрует, остальные только расшифровывают
+// (нужны, пока данные не перешифрованы после ротации).
+type Keyring struct {
+	mu   sync.RWMutex
+	keys []key
+	file string
+	env  []string // ключи из FINANCE_ENC_KEY (base64), если файла ещё нет
+}
+
+// Load берёт ключи из файла FINANCE_ENC_KEY_FILE (по одному base64-ключу на строку,
+// первый — текущий) или из FINANCE_ENC_KEY (ключи через запятую).
+// Без ключей шифрование выключено.
+func Load() (*Keyring, error) {
+	kr := &Keyring{file: os.Getenv("FINANCE_ENC_KEY_FILE")}
+	if kr.file != "" {
+		b, err := os.ReadFile(kr.file)
+		switch {
+		case err == nil:
+			if err := kr.parse(strings.Split(string(b), "\n")); err != nil {
+				return nil, fmt.Errorf("%s: %w", kr.file, err)
+			}
+			return kr, nil
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+	}
+	if v := os.Getenv("FINANCE_ENC_KEY"); v != "" {
+		kr.env = strings.Split(v, ",")
+		if err := kr.parse(kr.env); err != nil {
+			return nil, fmt.Errorf("FINANCE_ENC_KEY: %w", err)
+		}
+	}
+	return kr, nil
+}
+
+func (kr *Keyring) parse(lines []string) error {
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(l)
+		if err != nil {
+			return fmt.Errorf("bad key: %w", err)
+		}
+		if err := kr.add(raw, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kr *Keyring) add(raw []byte, primary bool) error {
+	if len(raw) != KeySize {
+		return fmt.Errorf("key must be %d bytes, got %d", KeySize, len(raw))
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(raw)
+	k := key{id: hex.EncodeToString(sum[:4]), aead: aead}
+	if primary {
+		kr.keys = append([]key{k}, kr.keys...)
+	} else {
+		kr.keys = append(kr.keys, k)
+	}
+	return nil
+}
+
+func (kr *Keyring) Enabled() bool {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return len(kr.keys) > 0
+}
+
+// PrimaryID — идентификатор текущего ключа ("" если шифрование выключено).
+func (kr *Keyring) PrimaryID() string {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if len(kr.keys) == 0 {
+		return ""
+	}
+	return kr.keys[0].id
+}
+
+// Encrypt шифрует значение текущим ключом. aad привязывает шифртекст к записи,
+// чтобы его нельзя было переставить в другую строку. Пустые строки и значения
+// без ключа остаются как есть.
+func (kr *Keyring) Encrypt(plain, aad string) (string, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if plain == "" || len(kr.keys) == 0 {
+		return plain, nil
+	}
+	k := kr.keys[0]
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, []byte(plain), []byte(aad))
+	return prefix + k.id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt возвращает открытый текст; незашифрованные значения отдаются без изменений.
+func (kr *Keyring) Decrypt(value, aad string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	id, body, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", ErrBadValue
+	}
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if len(kr.keys) == 0 {
+		return "", ErrNoKey
+	}
+	for _, k := range kr.keys {
+		if k.id != id {
+			continue
+		}
+		sealed, err := base64.RawStdEncoding.DecodeString(body)
+		if err != nil || len(sealed) < k.aead.NonceSize() {
+			return "", ErrBadValue
+		}
+		n := k.aead.NonceSize()
+		plain, err := k.aead.Open(nil, sealed[:n], sealed[n:], []byte(aad))
+		if err != nil {
+			return "", ErrBadValue
+		}
+		return string(plain), nil
+	}
+	return "", fmt.Errorf("%w %s", ErrUnknownKey, id)
+}
+
+// Current сообщает, зашифровано ли значение так, как его зашифровал бы Encrypt сейчас.
+func (kr *Keyring) Current(value string) bool {
+	if value == "" {
+		return true
+	}
+	primary := kr.PrimaryID()
+	if primary == "" {
+		return !IsEncrypted(value)
+	}
+	return strings.HasPrefix(value, prefix+primary+":")
+}
+
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Rotate создаёт новый ключ, записывает его первым в файл ключей и делает текущим.
+// Старые ключи остаются в файле, пока данные не перешифрованы. Если файла ещё
+// нет, а ключи заданы в FINANCE_ENC_KEY, они тоже записываются в файл: Load
+// предпочитает файл, и без них старые значения после перезапуска стало бы
+// нечем расшифровать.
+func (kr *Keyring) Rotate() (string, error) {
+	if kr.file == "" {
+		return "", ErrNoKeyFile
+	}
+	raw := make([]byte, KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	old, err := os.ReadFile(kr.file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	content := base64.StdEncoding.EncodeToString(raw) + "\n" + string(old)
+	if errors.Is(err, os.ErrNotExist) {
+		for _, l := range kr.env {
+			if l = strings.TrimSpace(l); l != "" {
+				content += l + "\n"
+			}
+		}
+	}
+	tmp := kr.file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, kr.file); err != nil {
+		return "", err
+	}
+	if err := kr.add(raw, true); err != nil {
+		return "", err
+	}
+	return kr.keys[0].id, nil
+}
+
+// Retire удаляет из файла все ключи, кроме текущего. Вызывать только после
+// полной перешифровки — иначе старые значения станет нечем расшифровать.
+func (kr *Keyring) Retire() error {
+	if kr.file == "" {
+		return ErrNoKeyFile
+	}
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if len(kr.keys) <= 1 {
+		return nil
+	}
+
+	b, err := os.ReadFile(kr.file)
+	if err != nil {
+		return err
+	}
+	var primary string
+	for _, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, "#") {
+			primary = l
+			break
+		}
+	}
+	tmp := kr.file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(primary+"\n"), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, kr.file); err != nil {
+		return err
+	}
+	kr.keys = kr.keys[:1]
+	return nil
+}
@@ -0,0 +1,310 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	raw := make([]byte, KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func newKeyring(t *testing.T, keys ...string) *Keyring {
+	t.Helper()
+	kr := &Keyring{}
+	if err := kr.parse(keys); err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	kr := newKeyring(t, newKey(t))
+	for _, plain := range []string{"Пятёрочка", "a", strings.Repeat("x", 4096)} {
+		enc, err := kr.Encrypt(plain, "op-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(enc) || !strings.HasPrefix(enc, prefix+kr.PrimaryID()+":") {
+			t.Fatalf("Encrypt(%q) = %q: no prefix with key id", plain, enc)
+		}
+		if strings.Contains(enc, plain) {
+			t.Fatalf("Encrypt(%q) leaks plaintext: %q", plain, enc)
+		}
+		if !kr.Current(enc) {
+			t.Errorf("Current(%q) = false", enc)
+		}
+		got, err := kr.Decrypt(enc, "op-1")
+		if err != nil || got != plain {
+			t.Errorf("Decrypt = %q, %v; want %q", got, err, plain)
+		}
+	}
+
+	a, _ := kr.Encrypt("same", "op-1")
+	b, _ := kr.Encrypt("same", "op-1")
+	if a == b {
+		t.Error("two encryptions of one value are equal: nonce is reused")
+	}
+}
+
+func TestKeyringPassThrough(t *testing.T) {
+	off := &Keyring{}
+	if off.Enabled() || off.PrimaryID() != "" {
+		t.Fatal("empty keyring is enabled")
+	}
+	if got, err := off.Encrypt("открыто", "op-1"); err != nil || got != "открыто" {
+		t.Errorf("Encrypt without keys = %q, %v", got, err)
+	}
+	if !off.Current("открыто") {
+		t.Error("plaintext is not current without keys")
+	}
+
+	on := newKeyring(t, newKey(t))
+	if got, err := on.Encrypt("", "op-1"); err != nil || got != "" {
+		t.Errorf("Encrypt(\"\") = %q, %v", got, err)
+	}
+	if got, err := on.Decrypt("старое описание", "op-1"); err != nil || got != "старое описание" {
+		t.Errorf("Decrypt(plaintext) = %q, %v", got, err)
+	}
+	if on.Current("старое описание") {
+		t.Error("plaintext is current with a key")
+	}
+
+	enc, _ := on.Encrypt("тайна", "op-1")
+	if off.Current(enc) {
+		t.Error("ciphertext is current without keys")
+	}
+	if _, err := off.Decrypt(enc, "op-1"); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Decrypt without keys: err = %v, want ErrNoKey", err)
+	}
+}
+
+func TestKeyringDecryptErrors(t *testing.T) {
+	kr := newKeyring(t, newKey(t))
+	enc, err := kr.Encrypt("тайна", "op-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := kr.PrimaryID()
+	body := strings.TrimPrefix(enc, prefix+id+":")
+	sealed, _ := base64.RawStdEncoding.DecodeString(body)
+	sealed[len(sealed)-1] ^= 1
+	tampered := prefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+
+	tests := []struct {
+		name  string
+		value string
+		aad   string
+		want  error
+	}{
+		{"другая запись (AAD)", enc, "op-2", ErrBadValue},
+		{"испорченный шифртекст", tampered, "op-1", ErrBadValue},
+		{"не base64", prefix + id + ":!!!", "op-1", ErrBadValue},
+		{"короче nonce", prefix + id + ":AAAA", "op-1", ErrBadValue},
+		{"без id ключа", prefix + "abc", "op-1", ErrBadValue},
+		{"неизвестный ключ", prefix + "deadbeef:" + body, "op-1", ErrUnknownKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := kr.Decrypt(tt.value, tt.aad)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Decrypt = %q, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	other := newKeyring(t, newKey(t))
+	if _, err := other.Decrypt(enc, "op-1"); !errors.Is(err, ErrUnknownKey) || !strings.Contains(err.Error(), id) {
+		t.Errorf("Decrypt with another key: err = %v, want ErrUnknownKey with id %s", err, id)
+	}
+}
+
+func TestKeyringParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		keys  int
+		err   string
+	}{
+		{"ключи, комментарии и пустые строки", []string{"# текущий", newKey(t), "", "  " + newKey(t) + "  "}, 2, ""},
+		{"не base64", []string{"not a key!"}, 0, "bad key"},
+		{"короткий ключ", []string{base64.StdEncoding.EncodeToString([]byte("short"))}, 0, "key must be 32 bytes, got 5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr := &Keyring{}
+			err := kr.parse(tt.lines)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parse: err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kr.keys) != tt.keys {
+				t.Errorf("keys = %d, want %d", len(kr.keys), tt.keys)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	k1, k2 := newKey(t), newKey(t)
+	dir := t.TempDir()
+
+	t.Run("переменная", func(t *testing.T) {
+		t.Setenv("FINANCE_ENC_KEY_FILE", "")
+		t.Setenv("FINANCE_ENC_KEY", k1+","+k2)
+		kr, err := Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kr.keys) != 2 || kr.PrimaryID() != newKeyring(t, k1).PrimaryID() {
+			t.Errorf("keys = %d, primary %s", len(kr.keys), kr.PrimaryID())
+		}
+	})
+	t.Run("файл важнее переменной", func(t *testing.T) {
+		path := filepath.Join(dir, "keys")
+		if err := os.WriteFile(path, []byte(k2+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("FINANCE_ENC_KEY_FILE", path)
+		t.Setenv("FINANCE_ENC_KEY", k1)
+		kr, err := Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kr.keys) != 1 || kr.PrimaryID() != newKeyring(t, k2).PrimaryID() {
+			t.Errorf("keys = %d, primary %s", len(kr.keys), kr.PrimaryID())
+		}
+	})
+	t.Run("без ключей", func(t *testing.T) {
+		t.Setenv("FINANCE_ENC_KEY_FILE", filepath.Join(dir, "missing"))
+		t.Setenv("FINANCE_ENC_KEY", "")
+		kr, err := Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kr.Enabled() {
+			t.Error("keyring without keys is enabled")
+		}
+	})
+	t.Run("плохой ключ", func(t *testing.T) {
+		t.Setenv("FINANCE_ENC_KEY_FILE", "")
+		t.Setenv("FINANCE_ENC_KEY", "xyz")
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "FINANCE_ENC_KEY") {
+			t.Errorf("err = %v", err)
+		}
+	})
+}
+
+func TestKeyringRotateRetire(t *testing.T) {
+	old := newKey(t)
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(old+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FINANCE_ENC_KEY_FILE", path)
+	t.Setenv("FINANCE_ENC_KEY", "")
+	kr, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldID := kr.PrimaryID()
+	enc, _ := kr.Encrypt("тайна", "op-1")
+
+	id, err := kr.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == oldID || kr.PrimaryID() != id {
+		t.Fatalf("Rotate = %s, primary %s, old %s", id, kr.PrimaryID(), oldID)
+	}
+	if kr.Current(enc) {
+		t.Error("value of the old key is current after rotation")
+	}
+	if got, err := kr.Decrypt(enc, "op-1"); err != nil || got != "тайна" {
+		t.Errorf("Decrypt with the old key after rotation = %q, %v", got, err)
+	}
+	reenc, _ := kr.Encrypt("тайна", "op-1")
+	if !strings.HasPrefix(reenc, prefix+id+":") {
+		t.Errorf("Encrypt after rotation uses %q, want key %s", reenc, id)
+	}
+
+	// новый ключ — первым в файле, старый остаётся
+	reloaded, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.keys) != 2 || reloaded.PrimaryID() != id {
+		t.Fatalf("file after rotation: %d keys, primary %s", len(reloaded.keys), reloaded.PrimaryID())
+	}
+
+	if err := kr.Retire(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kr.Decrypt(enc, "op-1"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with a retired key: err = %v, want ErrUnknownKey", err)
+	}
+	if got, err := kr.Decrypt(reenc, "op-1"); err != nil || got != "тайна" {
+		t.Errorf("Decrypt with the current key after Retire = %q, %v", got, err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Fields(string(b)); len(lines) != 1 || bytes.Contains(b, []byte(old)) {
+		t.Errorf("file after Retire = %q, want only the current key", b)
+	}
+	if err := kr.Retire(); err != nil {
+		t.Errorf("second Retire: %v", err)
+	}
+}
+
+func TestKeyringRotateKeepsEnvKeys(t *testing.T) {
+	env := newKey(t)
+	path := filepath.Join(t.TempDir(), "keys")
+	t.Setenv("FINANCE_ENC_KEY_FILE", path)
+	t.Setenv("FINANCE_ENC_KEY", env)
+	kr, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := kr.Encrypt("тайна", "op-1")
+	if _, err := kr.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// после перезапуска файл важнее переменной — ключ из неё должен быть в файле
+	t.Setenv("FINANCE_ENC_KEY", "")
+	reloaded, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reloaded.Decrypt(enc, "op-1"); err != nil || got != "тайна" {
+		t.Errorf("Decrypt after restart = %q, %v", got, err)
+	}
+}
+
+func TestKeyringRotateWithoutFile(t *testing.T) {
+	kr := newKeyring(t, newKey(t))
+	if _, err := kr.Rotate(); !errors.Is(err, ErrNoKeyFile) {
+		t.Errorf("Rotate: err = %v, want ErrNoKeyFile", err)
+	}
+	if err := kr.Retire(); !errors.Is(err, ErrNoKeyFile) {
+		t.Errorf("Retire: err = %v, want ErrNoKeyFile", err)
+	}
+}
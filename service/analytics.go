@@ -55,19 +55,24 @@ type CategorySummary struct {
 }
 
 func (s *AnalyticsService) ByCategory(ctx context.Context, accID domain.AccountID, from, to time.Time) ([]CategorySummary, error) {
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
 	rows, err := s.ops.Db().Query(ctx, `
 		SELECT c.name, c.type,
 		       SUM(CASE WHEN o.type = 1  THEN o.amount ELSE 0 END) AS income,
 		       SUM(CASE WHEN o.type = -1 THEN o.amount ELSE 0 END) AS expense
 		  FROM operations o
 		  JOIN categories c ON c.id = o.category_id
-		 WHERE o.bank_account_id = $1 AND o."date" BETWEEN $2 AND $3
+		  JOIN accounts a ON a.id = o.bank_account_id
+		 WHERE o.bank_account_id = $1 AND o."date" BETWEEN $2 AND $3 AND `+repo.AccountAccess("a", 4)+`
 		 GROUP BY c.name, c.type
 		 ORDER BY
 		   -- крупные расходы вверх, затем по доходам
 		   SUM(CASE WHEN o.type = -1 THEN o.amount ELSE 0 END) DESC,
 		   SUM(CASE WHEN o.type =  1 THEN o.amount ELSE 0 END) DESC`,
-		accID, from, to,
+		accID, from, to, uid,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+
+	"main/db"
+	"main/domain"
+	"main/repo"
+)
+
+// DoctorService проверяет целостность данных по всем счетам пользователя
+// (своим и расшаренным ему) и умеет чинить найденное одной транзакцией.
+type DoctorService struct {
+	db TxStarter
+	f  domain.Factory
+}
+
+func NewDoctorService(db TxStarter, f domain.Factory) *DoctorService {
+	return &DoctorService{db: db, f: f}
+}
+
+type BalanceIssue struct {
+	AccountID domain.AccountID
+	Name      string
+	Stored    decimal.Decimal
+	Computed  decimal.Decimal // сумма доходов минус сумма расходов
+}
+
+type TypeMismatch struct {
+	OperationID  domain.OperationID
+	AccountID    domain.AccountID
+	Date         time.Time
+	Amount       decimal.Decimal
+	OpType       domain.OperationType
+	CategoryID   domain.CategoryID
+	CategoryName string
+	CategoryType domain.CategoryType
+}
+
+type DuplicateCategories struct {
+	Type      domain.CategoryType
+	Canonical domain.Category   // остаётся после слияния (минимальный id, как в 002_deduqe_and_uniques.sql)
+	Dups      []domain.Category // сливаются в Canonical
+}
+
+type DoctorReport struct {
+	Accounts       int
+	Balances       []BalanceIssue
+	TypeMismatches []TypeMismatch
+	Duplicates     []DuplicateCategories
+	Orphans        []domain.Category // категории без операций
+}
+
+// Problems — число проблем, которые чинит Repair (неиспользуемые категории не в счёт).
+func (r DoctorReport) Problems() int {
+	return len(r.Balances) + len(r.TypeMismatches) + len(r.Duplicates)
+}
+
+type RepairOptions struct {
+	DryRun      bool // выполнить и откатить — показать, что изменилось бы
+	DropOrphans bool // удалить категории без операций
+}
+
+type RepairResult struct {
+	Actions   []string
+	Unfixable []string
+	DryRun    bool
+}
+
+func (s *DoctorService) Check(ctx context.Context) (DoctorReport, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return DoctorReport{}, err
+	}
+	defer tx.Rollback(ctx)
+	return check(ctx, tx)
+}
+
+func (s *DoctorService) Repair(ctx context.Context, opts RepairOptions) (DoctorReport, RepairResult, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+	if err != nil {
+		return DoctorReport{}, RepairResult{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `LOCK TABLE accounts, categories, operations IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return DoctorReport{}, RepairResult{}, err
+	}
+	rep, err := check(ctx, tx)
+	if err != nil {
+		return DoctorReport{}, RepairResult{}, err
+	}
+	res := RepairResult{DryRun: opts.DryRun}
+	if err := s.repair(ctx, tx, rep, opts, &res); err != nil {
+		return rep, RepairResult{}, err
+	}
+	if opts.DryRun {
+		return rep, res, nil
+	}
+	return rep, res, tx.Commit(ctx)
+}
+
+func check(ctx context.Context, q db.Querier) (DoctorReport, error) {
+	var rep DoctorReport
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return rep, err
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT a.id, a.name, a.balance,
+		       COALESCE(SUM(CASE WHEN o.type = 1 THEN o.amount ELSE -o.amount END), 0)
+		  FROM accounts a
+		  LEFT JOIN operations o ON o.bank_account_id = a.id
+		 WHERE `+repo.AccountAccess("a", 1)+`
+		 GROUP BY a.id, a.name, a.balance
+		 ORDER BY a.name, a.id`, uid)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		var b BalanceIssue
+		var stored, computed string
+		if err := rows.Scan(&b.AccountID, &b.Name, &stored, &computed); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		if b.Stored, err = decimal.NewFromString(stored); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		if b.Computed, err = decimal.NewFromString(computed); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		rep.Accounts++
+		if !b.Stored.Equal(b.Computed) {
+			rep.Balances = append(rep.Balances, b)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	rows, err = q.Query(ctx, `
+		SELECT o.id, o.bank_account_id, o."date", o.amount, o.type, c.id, c.name, c.type
+		  FROM operations o
+		  JOIN categories c ON c.id = o.category_id
+		  JOIN accounts a ON a.id = o.bank_account_id
+		 WHERE o.type <> c.type AND `+repo.AccountAccess("a", 1)+`
+		 ORDER BY o."date", o.id`, uid)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		var m TypeMismatch
+		var amt string
+		if err := rows.Scan(&m.OperationID, &m.AccountID, &m.Date, &amt, &m.OpType, &m.CategoryID, &m.CategoryName, &m.CategoryType); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		if m.Amount, err = decimal.NewFromString(amt); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		rep.TypeMismatches = append(rep.TypeMismatches, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	// дубликаты — та же нормализация имени, что в 002_deduqe_and_uniques.sql
+	rows, err = q.Query(ctx, `
+		SELECT type, array_agg(id::text ORDER BY id), array_agg(name ORDER BY id)
+		  FROM categories
+		 WHERE owner_id = $1
+		 GROUP BY type, lower(btrim(name))
+		HAVING COUNT(*) > 1
+		 ORDER BY type, lower(btrim(name))`, uid)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		var t domain.CategoryType
+		var ids, names []string
+		if err := rows.Scan(&t, &ids, &names); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		g := DuplicateCategories{Type: t}
+		for i := range ids {
+			c := domain.Category{ID: domain.CategoryID(ids[i]), Type: t, Name: names[i]}
+			if i == 0 {
+				g.Canonical = c
+			} else {
+				g.Dups = append(g.Dups, c)
+			}
+		}
+		rep.Duplicates = append(rep.Duplicates, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	rep.Orphans, err = orphanCategories(ctx, q, uid)
+	return rep, err
+}
+
+func orphanCategories(ctx context.Context, q db.Querier, uid domain.UserID) ([]domain.Category, error) {
+	rows, err := q.Query(ctx, `
+		SELECT c.id, c.type, c.name
+		  FROM categories c
+		 WHERE c.owner_id = $1
+		   AND NOT EXISTS (SELECT 1 FROM operations o WHERE o.category_id = c.id)
+		 ORDER BY c.type, c.name`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.Category
+	for rows.Next() {
+		var c domain.Category
+		if err := rows.Scan(&c.ID, &c.Type, &c.Name); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (s *DoctorService) repair(ctx context.Context, tx pgx.Tx, rep DoctorReport, opts RepairOptions, res *RepairResult) error {
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 1. слить дубликаты категорий
+	for _, g := range rep.Duplicates {
+		ids := make([]string, 0, len(g.Dups))
+		for _, c := range g.Dups {
+			ids = append(ids, string(c.ID))
+		}
+		ct, err := tx.Exec(ctx, `UPDATE operations SET category_id=$1 WHERE category_id = ANY($2::uuid[])`, g.Canonical.ID, ids)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM categories WHERE id = ANY($1::uuid[])`, ids); err != nil {
+			return err
+		}
+		res.Actions = append(res.Actions, fmt.Sprintf("категории %q: слито дубликатов %d, перенесено операций %d",
+			g.Canonical.Name, len(g.Dups), ct.RowsAffected()))
+	}
+
+	// 2. операции с категорией другого типа переносим в одноимённую категорию нужного типа
+	// (в расшаренном счёте категория может быть чужой — новую создаём у себя)
+	for _, m := range rep.TypeMismatches {
+		var catID domain.CategoryID
+		err := tx.QueryRow(ctx,
+			`SELECT id FROM categories
+			  WHERE owner_id=$3 AND type=$1 AND lower(btrim(name)) = lower(btrim($2))
+			  ORDER BY id LIMIT 1`,
+			int(m.OpType), m.CategoryName, uid,
+		).Scan(&catID)
+		if err == pgx.ErrNoRows {
+			c, err := s.f.NewCategory(m.CategoryName, m.OpType)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `INSERT INTO categories(id, type, name, owner_id) VALUES ($1, $2, $3, $4)`,
+				c.ID, int(c.Type), c.Name, uid); err != nil {
+				return err
+			}
+			catID = c.ID
+			res.Actions = append(res.Actions, fmt.Sprintf("создана категория %q (тип %d)", m.CategoryName, int(m.OpType)))
+		} else if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE operations SET category_id=$2 WHERE id=$1`, m.OperationID, catID); err != nil {
+			return err
+		}
+		res.Actions = append(res.Actions, fmt.Sprintf("операция %s (%s, %s): категория %q приведена к типу операции",
+			m.OperationID, m.Date.Format("2006-01-02"), m.Amount.StringFixed(2), m.CategoryName))
+	}
+
+	// 3. неиспользуемые категории — только по явному запросу
+	if opts.DropOrphans {
+		orphans, err := orphanCategories(ctx, tx, uid)
+		if err != nil {
+			return err
+		}
+		for _, c := range orphans {
+			if _, err := tx.Exec(ctx, `DELETE FROM categories WHERE id=$1`, c.ID); err != nil {
+				return err
+			}
+			res.Actions = append(res.Actions, fmt.Sprintf("удалена неиспользуемая категория %q", c.Name))
+		}
+	}
+
+	// 4. балансы
+	for _, b := range rep.Balances {
+		if b.Computed.IsNegative() {
+			res.Unfixable = append(res.Unfixable, fmt.Sprintf("счёт %q: по операциям баланс %s < 0, нужна ручная правка операций",
+				b.Name, b.Computed.StringFixed(2)))
+			continue
+		}
+		if _, err := tx.Exec(ctx, `UPDATE accounts SET balance=$2 WHERE id=$1`, b.AccountID, b.Computed.StringFixed(2)); err != nil {
+			return err
+		}
+		res.Actions = append(res.Actions, fmt.Sprintf("счёт %q: баланс %s → %s",
+			b.Name, b.Stored.StringFixed(2), b.Computed.StringFixed(2)))
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"main/domain"
+	"main/repo"
+	"main/secret"
+)
+
+var ErrNotAdmin = errors.New("only administrators (FINANCE_ADMINS) may change encryption of the whole database")
+
+// Admins — логины администраторов (FINANCE_ADMINS, через запятую): только им
+// доступны действия над данными всех пользователей.
+type Admins []string
+
+func (a Admins) Has(login string) bool {
+	return slices.ContainsFunc(a, func(s string) bool { return strings.EqualFold(s, login) })
+}
+
+// EncryptionService перешифровывает описания операций текущим ключом.
+// Ключ общий для всей БД, поэтому обрабатываются операции всех пользователей —
+// и поэтому всё это доступно только администраторам.
+type EncryptionService struct {
+	db     TxStarter
+	keys   *secret.Keyring
+	users  *repo.PgUserRepo
+	admins Admins
+}
+
+func NewEncryptionService(db TxStarter, keys *secret.Keyring, users *repo.PgUserRepo, admins Admins) *EncryptionService {
+	return &EncryptionService{db: db, keys: keys, users: users, admins: admins}
+}
+
+// Authorize проверяет, что вошедший пользователь — администратор.
+func (s *EncryptionService) Authorize(ctx context.Context) error {
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	u, err := s.users.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if !s.admins.Has(u.Login) {
+		return ErrNotAdmin
+	}
+	return nil
+}
+
+type ReencryptOptions struct {
+	DryRun  bool
+	Decrypt bool // снять шифрование: записать открытый текст
+}
+
+type ReencryptResult struct {
+	KeyID     string // "" при Decrypt
+	Total     int
+	Changed   int
+	Encrypted int // после перешифровки зашифровано текущим ключом
+	DryRun    bool
+}
+
+func (s *EncryptionService) Enabled() bool { return s.keys.Enabled() }
+
+// reencryptPage — сколько операций Reencrypt читает за один запрос.
+const reencryptPage = 500
+
+// Reencrypt проходит по всем описаниям одной транзакцией: открытый текст и значения,
+// зашифрованные старыми ключами, переписываются текущим ключом. Если хоть одно
+// значение не расшифровывается, ничего не сохраняется.
+func (s *EncryptionService) Reencrypt(ctx context.Context, opts ReencryptOptions) (ReencryptResult, error) {
+	res := ReencryptResult{DryRun: opts.DryRun}
+	if err := s.Authorize(ctx); err != nil {
+		return res, err
+	}
+	if !opts.Decrypt {
+		if !s.keys.Enabled() {
+			return res, secret.ErrNoKey
+		}
+		res.KeyID = s.keys.PrimaryID()
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback(ctx)
+
+	// строки читаются страницами по id: в памяти держится одна страница
+	type row struct {
+		id   domain.OperationID
+		desc string
+	}
+	var after *domain.OperationID
+	for {
+		rows, err := tx.Query(ctx,
+			`SELECT id, description FROM operations
+			  WHERE description <> '' AND ($1::uuid IS NULL OR id > $1)
+			  ORDER BY id LIMIT $2 FOR UPDATE`, after, reencryptPage)
+		if err != nil {
+			return res, err
+		}
+		list := make([]row, 0, reencryptPage)
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.desc); err != nil {
+				rows.Close()
+				return res, err
+			}
+			list = append(list, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return res, err
+		}
+		if len(list) == 0 {
+			break
+		}
+		after = &list[len(list)-1].id
+
+		for _, r := range list {
+			res.Total++
+			if !opts.Decrypt && s.keys.Current(r.desc) {
+				res.Encrypted++
+				continue
+			}
+			if opts.Decrypt && !secret.IsEncrypted(r.desc) {
+				continue
+			}
+			aad := repo.DescriptionAAD(r.id)
+			plain, err := s.keys.Decrypt(r.desc, aad)
+			if err != nil {
+				return res, fmt.Errorf("operation %s: %w", r.id, err)
+			}
+			out := plain
+			if !opts.Decrypt {
+				if out, err = s.keys.Encrypt(plain, aad); err != nil {
+					return res, err
+				}
+				res.Encrypted++
+			}
+			if _, err := tx.Exec(ctx, `UPDATE operations SET description=$2 WHERE id=$1`, r.id, out); err != nil {
+				return res, err
+			}
+			res.Changed++
+		}
+	}
+
+	if opts.DryRun {
+		return res, nil
+	}
+	return res, tx.Commit(ctx)
+}
+
+// Rotate создаёт новый ключ и перешифровывает им все описания.
+// Старые ключи остаются в файле; retire убирает их после успешной перешифровки.
+func (s *EncryptionService) Rotate(ctx context.Context, retire bool) (ReencryptResult, error) {
+	if err := s.Authorize(ctx); err != nil {
+		return ReencryptResult{}, err
+	}
+	if _, err := s.keys.Rotate(); err != nil {
+		return ReencryptResult{}, err
+	}
+	res, err := s.Reencrypt(ctx, ReencryptOptions{})
+	if err != nil {
+		return res, err
+	}
+	if retire {
+		return res, s.keys.Retire()
+	}
+	return res, nil
+}
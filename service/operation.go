@@ -5,19 +5,21 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/jackc/pgx/v5"
 	"github.com/shopspring/decimal"
 
 	"main/domain"
+	"main/repo"
+	"main/secret"
 )
 
 type OperationService struct {
-	db TxStarter
-	f  domain.Factory
+	db   TxStarter
+	f    domain.Factory
+	keys *secret.Keyring
 }
 
-func NewOperationService(db TxStarter, f domain.Factory) *OperationService {
-	return &OperationService{db: db, f: f}
+func NewOperationService(db TxStarter, f domain.Factory, keys *secret.Keyring) *OperationService {
+	return &OperationService{db: db, f: f, keys: keys}
 }
 
 func (s *OperationService) ApplyOperation(
@@ -34,15 +36,22 @@ func (s *OperationService) ApplyOperation(
 	if err != nil {
 		return domain.Operation{}, err
 	}
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return domain.Operation{}, err
+	}
 
-	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	tx, err := begin(ctx, s.db)
 	if err != nil {
 		return domain.Operation{}, err
 	}
 	defer tx.Rollback(ctx)
 
 	var balStr string
-	if err := tx.QueryRow(ctx, `SELECT balance FROM accounts WHERE id=$1 FOR UPDATE`, accountID).Scan(&balStr); err != nil {
+	if err := tx.QueryRow(ctx,
+		`SELECT a.balance FROM accounts a WHERE a.id=$1 AND `+repo.AccountAccess("a", 2)+` FOR UPDATE`,
+		accountID, uid,
+	).Scan(&balStr); err != nil {
 		return domain.Operation{}, err
 	}
 	curBal, err := decimal.NewFromString(balStr)
@@ -61,10 +70,14 @@ func (s *OperationService) ApplyOperation(
 		}
 	}
 
+	desc, err = s.keys.Encrypt(op.Description, repo.DescriptionAAD(op.ID))
+	if err != nil {
+		return domain.Operation{}, err
+	}
 	if _, err := tx.Exec(ctx,
 		`INSERT INTO operations(id,type,bank_account_id,amount,"date",description,category_id)
 		 VALUES($1,$2,$3,$4,$5,$6,$7)`,
-		op.ID, int(op.Type), op.BankAccount, op.Amount.StringFixed(2), op.Date, op.Description, op.Category,
+		op.ID, int(op.Type), op.BankAccount, op.Amount.StringFixed(2), op.Date, desc, op.Category,
 	); err != nil {
 		return domain.Operation{}, err
 	}
@@ -82,7 +95,11 @@ func (s *OperationService) ApplyOperation(
 	return op, nil
 }
 func (s *OperationService) RemoveOperation(ctx context.Context, opID domain.OperationID) error {
-	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := begin(ctx, s.db)
 	if err != nil {
 		return err
 	}
@@ -92,7 +109,9 @@ func (s *OperationService) RemoveOperation(ctx context.Context, opID domain.Oper
 	var accID domain.AccountID
 	var amtStr string
 	err = tx.QueryRow(ctx,
-		`SELECT type, bank_account_id, amount FROM operations WHERE id=$1`, opID).
+		`SELECT o.type, o.bank_account_id, o.amount
+		   FROM operations o JOIN accounts a ON a.id = o.bank_account_id
+		  WHERE o.id=$1 AND `+repo.AccountAccess("a", 2)+` FOR UPDATE OF o`, opID, uid).
 		Scan(&t, &accID, &amtStr)
 	if err != nil {
 		return err
@@ -142,7 +161,11 @@ func (s *OperationService) UpdateOperation(
 	newCategory domain.CategoryID,
 	newDesc string,
 ) error {
-	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	uid, err := repo.UserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := begin(ctx, s.db)
 	if err != nil {
 		return err
 	}
@@ -151,9 +174,12 @@ func (s *OperationService) UpdateOperation(
 	var oldType int
 	var accID domain.AccountID
 	var oldAmtStr string
+	var oldCategory domain.CategoryID
 	if err := tx.QueryRow(ctx,
-		`SELECT type, bank_account_id, amount FROM operations WHERE id=$1`, opID,
-	).Scan(&oldType, &accID, &oldAmtStr); err != nil {
+		`SELECT o.type, o.bank_account_id, o.amount, o.category_id
+		   FROM operations o JOIN accounts a ON a.id = o.bank_account_id
+		  WHERE o.id=$1 AND `+repo.AccountAccess("a", 2)+` FOR UPDATE OF o`, opID, uid,
+	).Scan(&oldType, &accID, &oldAmtStr, &oldCategory); err != nil {
 		return err
 	}
 	oldAmt, err := decimal.NewFromString(oldAmtStr)
@@ -162,7 +188,10 @@ func (s *OperationService) UpdateOperation(
 	}
 
 	var catType int
-	if err := tx.QueryRow(ctx, `SELECT type FROM categories WHERE id=$1`, newCategory).Scan(&catType); err != nil {
+	// своя категория или та, что уже стоит у операции (в расшаренном счёте она может быть чужой)
+	if err := tx.QueryRow(ctx,
+		`SELECT type FROM categories WHERE id=$1 AND (owner_id=$2 OR id=$3)`, newCategory, uid, oldCategory,
+	).Scan(&catType); err != nil {
 		return err
 	}
 	if catType != int(newType) {
@@ -200,6 +229,10 @@ func (s *OperationService) UpdateOperation(
 		}
 	}
 
+	newDesc, err = s.keys.Encrypt(newDesc, repo.DescriptionAAD(opID))
+	if err != nil {
+		return err
+	}
 	if _, err := tx.Exec(ctx,
 		`UPDATE operations
 		    SET type=$2, amount=$3, "date"=$4, description=$5, category_id=$6
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"main/db"
+)
+
+// UnitOfWork выполняет сценарий целиком в одной транзакции.
+// Репозитории и OperationService берут транзакцию из контекста.
+type UnitOfWork struct {
+	db TxStarter
+}
+
+func NewUnitOfWork(db TxStarter) *UnitOfWork { return &UnitOfWork{db: db} }
+
+func (u *UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := db.TxFrom(ctx); ok {
+		// уже внутри единицы работы — коммитит внешний вызов
+		return fn(ctx)
+	}
+	tx, err := u.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	txCtx := db.WithTx(ctx, tx)
+	if err := fn(txCtx); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	db.RunCommitHooks(txCtx)
+	return nil
+}
+
+// begin открывает транзакцию, а внутри единицы работы — savepoint.
+func begin(ctx context.Context, starter TxStarter) (pgx.Tx, error) {
+	if tx, ok := db.TxFrom(ctx); ok {
+		return tx.Begin(ctx)
+	}
+	return starter.BeginTx(ctx, pgx.TxOptions{})
+}